@@ -1,6 +1,6 @@
 package config
 
 type Config struct {
-	DbType string `json:"db_type"` // mysql, sqlite
-	Dsn    string `json:"dsn"`
+	DbType string `json:"db_type" yaml:"db_type"` // mysql, sqlite, postgres, clickhouse, file
+	Dsn    string `json:"dsn" yaml:"dsn"`
 }
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Column transforms supported by ColumnConfig.Transform
+const (
+	TransformSkip     = "skip"     // column not used
+	TransformIdentity = "identity" // numeric value as is
+	TransformStandard = "standard" // feature.StandardScaler
+	TransformMinMax   = "minmax"   // feature.MinMaxScaler
+	TransformQuantile = "quantile" // feature.QuantileScaler
+	TransformOneHot   = "onehot"   // feature.OneHotEncoder
+	TransformHash     = "hash"     // feature.HashOneHot32 with Size
+	TransformMultiHot = "multihot" // feature.StringSplitMultiHot with Separator and Size
+	TransformTFIDF    = "tfidf"    // feature.TFIDFVectorizer with Separator
+)
+
+// identifierRe matches the table and column names, they are written into SQL
+// as is so only letters, digits and underscores are allowed.
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validIdentifier checks name of kind, a table name could be qualified like
+// "schema.table" or "ratings.csv".
+func validIdentifier(kind, name string, table bool) error {
+	parts := []string{name}
+	if table {
+		parts = strings.Split(name, ".")
+	}
+	for _, part := range parts {
+		if !identifierRe.MatchString(part) {
+			return fmt.Errorf("invalid %s name %q, only letters, digits and underscores are allowed", kind, name)
+		}
+	}
+	return nil
+}
+
+// RecSysConfig declares a recommender built from database tables.
+// It could be written in YAML or JSON, e.g.
+//
+//	db:
+//	  db_type: sqlite
+//	  dsn: movielens.db
+//	interaction:
+//	  table: ratings
+//	  user_column: userId
+//	  item_column: movieId
+//	  label_column: rating
+//	  label_threshold: 3.5
+//	  timestamp_column: timestamp
+//	user:
+//	  table: users
+//	  id_column: userId
+//	item:
+//	  table: movies
+//	  id_column: movieId
+//	  columns:
+//	    - name: genres
+//	      transform: multihot
+//	      separator: "|"
+//	      size: 20
+//	    - name: title
+//	      transform: skip
+type RecSysConfig struct {
+	Db          Config            `json:"db" yaml:"db"`
+	Interaction InteractionConfig `json:"interaction" yaml:"interaction"`
+	User        EntityConfig      `json:"user" yaml:"user"`
+	Item        EntityConfig      `json:"item" yaml:"item"`
+}
+
+// InteractionConfig is the user-item interaction table used as samples.
+type InteractionConfig struct {
+	Table           string `json:"table" yaml:"table"`
+	UserColumn      string `json:"user_column" yaml:"user_column"`
+	ItemColumn      string `json:"item_column" yaml:"item_column"`
+	LabelColumn     string `json:"label_column" yaml:"label_column"`
+	TimestampColumn string `json:"timestamp_column" yaml:"timestamp_column"`
+	// LabelThreshold binarizes label into 1 if label > LabelThreshold, if not nil
+	LabelThreshold *float64 `json:"label_threshold,omitempty" yaml:"label_threshold,omitempty"`
+	// Limit is the max count of samples, 0 means no limit
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+// EntityConfig is the user or item feature table.
+// If Columns is empty, all columns except IdColumn are used with inferred transforms.
+type EntityConfig struct {
+	Table    string         `json:"table" yaml:"table"`
+	IdColumn string         `json:"id_column" yaml:"id_column"`
+	Columns  []ColumnConfig `json:"columns,omitempty" yaml:"columns,omitempty"`
+}
+
+// ColumnConfig is the transform of one column, Transform is inferred from
+// column type if empty.
+type ColumnConfig struct {
+	Name      string `json:"name" yaml:"name"`
+	Transform string `json:"transform,omitempty" yaml:"transform,omitempty"`
+	// Size is the output width of hash and multihot
+	Size int `json:"size,omitempty" yaml:"size,omitempty"`
+	// Separator splits multihot and tfidf values
+	Separator string `json:"separator,omitempty" yaml:"separator,omitempty"`
+	// Comment is not used, it is for the config reader
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// LoadRecSysConfig loads RecSysConfig from YAML or JSON file.
+func LoadRecSysConfig(path string) (conf *RecSysConfig, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return ParseRecSysConfig(data)
+}
+
+// ParseRecSysConfig parses RecSysConfig in YAML or JSON.
+func ParseRecSysConfig(data []byte) (conf *RecSysConfig, err error) {
+	conf = &RecSysConfig{}
+	// JSON is a subset of YAML
+	if err = yaml.Unmarshal(data, conf); err != nil {
+		conf = nil
+		return
+	}
+	if err = conf.Validate(); err != nil {
+		conf = nil
+	}
+	return
+}
+
+// Marshal returns the YAML of conf.
+func (conf *RecSysConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(conf)
+}
+
+func (conf *RecSysConfig) Validate() error {
+	in := conf.Interaction
+	if in.Table == "" || in.UserColumn == "" || in.ItemColumn == "" || in.LabelColumn == "" {
+		return fmt.Errorf("interaction table, user_column, item_column and label_column are required")
+	}
+	if err := validIdentifier("table", in.Table, true); err != nil {
+		return err
+	}
+	for _, col := range []string{in.UserColumn, in.ItemColumn, in.LabelColumn, in.TimestampColumn} {
+		if col == "" {
+			continue
+		}
+		if err := validIdentifier("column", col, false); err != nil {
+			return fmt.Errorf("interaction table %s: %v", in.Table, err)
+		}
+	}
+	for _, e := range []struct {
+		name string
+		conf EntityConfig
+	}{{"user", conf.User}, {"item", conf.Item}} {
+		if e.conf.Table == "" || e.conf.IdColumn == "" {
+			return fmt.Errorf("%s table and id_column are required", e.name)
+		}
+		if err := validIdentifier("table", e.conf.Table, true); err != nil {
+			return err
+		}
+		if err := validIdentifier("column", e.conf.IdColumn, false); err != nil {
+			return fmt.Errorf("%s table %s: %v", e.name, e.conf.Table, err)
+		}
+		for _, col := range e.conf.Columns {
+			if err := col.Validate(); err != nil {
+				return fmt.Errorf("%s table %s: %v", e.name, e.conf.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (col *ColumnConfig) Validate() error {
+	if err := validIdentifier("column", col.Name, false); err != nil {
+		return err
+	}
+	switch col.Transform {
+	case "", TransformSkip, TransformIdentity, TransformStandard, TransformMinMax, TransformQuantile,
+		TransformOneHot, TransformTFIDF:
+	case TransformHash:
+		if col.Size <= 0 {
+			return fmt.Errorf("column %s: size of %s must be positive", col.Name, col.Transform)
+		}
+	case TransformMultiHot:
+		if col.Size <= 0 || col.Separator == "" {
+			return fmt.Errorf("column %s: size and separator of %s are required", col.Name, col.Transform)
+		}
+	default:
+		return fmt.Errorf("column %s: unknown transform %s", col.Name, col.Transform)
+	}
+	return nil
+}
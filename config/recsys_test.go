@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testRecSysYaml = `
+db:
+  db_type: sqlite
+  dsn: movielens.db
+interaction:
+  table: ratings
+  user_column: userId
+  item_column: movieId
+  label_column: rating
+  label_threshold: 3.5
+  timestamp_column: timestamp
+user:
+  table: users
+  id_column: userId
+item:
+  table: movies
+  id_column: movieId
+  columns:
+    - name: genres
+      transform: multihot
+      separator: "|"
+      size: 20
+    - name: title
+      transform: skip
+`
+
+func TestParseRecSysConfig(t *testing.T) {
+	Convey("parse yaml", t, func() {
+		conf, err := ParseRecSysConfig([]byte(testRecSysYaml))
+		So(err, ShouldBeNil)
+		So(conf.Db.DbType, ShouldEqual, "sqlite")
+		So(*conf.Interaction.LabelThreshold, ShouldEqual, 3.5)
+		So(conf.Item.Columns, ShouldHaveLength, 2)
+		So(conf.Item.Columns[0].Separator, ShouldEqual, "|")
+
+		// marshaled config could be parsed again
+		data, err := conf.Marshal()
+		So(err, ShouldBeNil)
+		conf2, err := ParseRecSysConfig(data)
+		So(err, ShouldBeNil)
+		So(conf2, ShouldResemble, conf)
+	})
+
+	Convey("parse json", t, func() {
+		conf, err := ParseRecSysConfig([]byte(`{
+			"db": {"db_type": "mysql", "dsn": "root@tcp(localhost)/test"},
+			"interaction": {"table": "clicks", "user_column": "uid", "item_column": "iid", "label_column": "click"},
+			"user": {"table": "users", "id_column": "uid"},
+			"item": {"table": "items", "id_column": "iid", "columns": [{"name": "price", "transform": "quantile"}]}
+		}`))
+		So(err, ShouldBeNil)
+		So(conf.Db.DbType, ShouldEqual, "mysql")
+		So(conf.Interaction.LabelThreshold, ShouldBeNil)
+		So(conf.Item.Columns[0].Transform, ShouldEqual, TransformQuantile)
+	})
+
+	Convey("invalid config", t, func() {
+		_, err := ParseRecSysConfig([]byte(`interaction: {table: clicks}`))
+		So(err, ShouldNotBeNil)
+		_, err = ParseRecSysConfig([]byte(`{
+			"interaction": {"table": "clicks", "user_column": "uid", "item_column": "iid", "label_column": "click"},
+			"user": {"table": "users", "id_column": "uid"},
+			"item": {"table": "items", "id_column": "iid", "columns": [{"name": "tags", "transform": "multihot"}]}
+		}`))
+		So(err, ShouldNotBeNil)
+
+		for _, name := range []string{"clicks; DROP TABLE users", "`clicks`", "1clicks", "db..clicks"} {
+			_, err = ParseRecSysConfig([]byte(fmt.Sprintf(`{
+				"interaction": {"table": %q, "user_column": "uid", "item_column": "iid", "label_column": "click"},
+				"user": {"table": "users", "id_column": "uid"},
+				"item": {"table": "items", "id_column": "iid"}
+			}`, name)))
+			So(err, ShouldNotBeNil)
+		}
+		_, err = ParseRecSysConfig([]byte(`{
+			"interaction": {"table": "db.clicks", "user_column": "uid", "item_column": "iid", "label_column": "click", "timestamp_column": "ts, 1"},
+			"user": {"table": "users", "id_column": "uid"},
+			"item": {"table": "items", "id_column": "iid"}
+		}`))
+		So(err, ShouldNotBeNil)
+		_, err = ParseRecSysConfig([]byte(`{
+			"interaction": {"table": "db.clicks", "user_column": "uid", "item_column": "iid", "label_column": "click"},
+			"user": {"table": "users", "id_column": "uid"},
+			"item": {"table": "items", "id_column": "iid", "columns": [{"name": "price FROM x --"}]}
+		}`))
+		So(err, ShouldNotBeNil)
+		_, err = ParseRecSysConfig([]byte(`{
+			"interaction": {"table": "db.clicks", "user_column": "uid", "item_column": "iid", "label_column": "click"},
+			"user": {"table": "users.csv", "id_column": "uid"},
+			"item": {"table": "items", "id_column": "iid", "columns": [{"name": "price_1"}]}
+		}`))
+		So(err, ShouldBeNil)
+	})
+}
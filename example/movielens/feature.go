@@ -11,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/auxten/go-ctr/feature"
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
 	"github.com/auxten/go-ctr/feature/ubcache"
 	rcmd "github.com/auxten/go-ctr/recommend"
 	"github.com/auxten/go-ctr/utils"
@@ -60,7 +61,7 @@ func (recSys *MovielensRec) ItemSeqGenerator(ctx context.Context) (ret <-chan st
 			close(ch)
 		}()
 		// predict must use the same embedding as train
-		rows, err = db.Query("SELECT movieId FROM ratings_train r WHERE r.rating > 3.5 order by userId, timestamp")
+		rows, err = db.Query("SELECT userId, movieId FROM ratings_train r WHERE r.rating > 3.5 order by userId, timestamp")
 		if err != nil {
 			log.Errorf("failed to query ratings: %v", err)
 			wg.Done()
@@ -68,13 +69,19 @@ func (recSys *MovielensRec) ItemSeqGenerator(ctx context.Context) (ret <-chan st
 		}
 		wg.Done()
 		defer rows.Close()
+		var lastUserId int64 = -1
 		for rows.Next() {
 			i++
-			var movieId sql.NullInt64
-			if err = rows.Scan(&movieId); err != nil {
+			var userId, movieId sql.NullInt64
+			if err = rows.Scan(&userId, &movieId); err != nil {
 				log.Errorf("failed to scan movieId: %v", err)
 				continue
 			}
+			// windows should not cross users
+			if lastUserId != -1 && userId.Int64 != lastUserId {
+				ch <- corpus.EOS
+			}
+			lastUserId = userId.Int64
 			ch <- fmt.Sprintf("%d", movieId.Int64)
 		}
 	}()
@@ -100,46 +107,116 @@ func (recSys *MovielensRec) GetItemFeature(ctx context.Context, itemId int) (ten
 	}
 	defer rows.Close()
 	if rows.Next() {
+		var itemTitle, itemGenres string
+		if err = rows.Scan(&itemTitle, &itemGenres); err != nil {
+			log.Errorf("failed to scan item %d: %v", itemId, err)
+			return
+		}
+		return recSys.itemFeature(itemId, itemTitle, itemGenres)
+	} else {
+		err = fmt.Errorf("itemId %d not found", itemId)
+		return
+	}
+}
+
+// GetItemFeatures implements rcmd.BatchItemFeaturer with one query for all itemIds.
+func (recSys *MovielensRec) GetItemFeatures(ctx context.Context, itemIds []int) (features map[int]rcmd.Tensor, err error) {
+	var (
+		rows *sql.Rows
+		args = make([]interface{}, len(itemIds))
+	)
+	if len(itemIds) == 0 {
+		return
+	}
+	for i, itemId := range itemIds {
+		args[i] = itemId
+	}
+	rows, err = db.QueryContext(ctx, `select movieId, "title" itemTitle, "genres" itemGenres
+				from movies m
+				WHERE m.movieId in (?`+strings.Repeat(",?", len(itemIds)-1)+`)`, args...)
+	if err != nil {
+		log.Errorf("failed to query movies: %v", err)
+		return
+	}
+	defer rows.Close()
+	features = make(map[int]rcmd.Tensor, len(itemIds))
+	for rows.Next() {
 		var (
-			movieYear             int
+			itemId                int
 			itemTitle, itemGenres string
-			avgRating, cntRating  float32
-			GenreTensor           [50]float32 // 5 * 10
 		)
-		if err = rows.Scan(&itemTitle, &itemGenres); err != nil {
-			log.Errorf("failed to scan item %d: %v", itemId, err)
+		if err = rows.Scan(&itemId, &itemTitle, &itemGenres); err != nil {
+			log.Errorf("failed to scan movies: %v", err)
 			return
 		}
-		// regex match year from itemTitle
-		yearStrSlice := yearRegex.FindStringSubmatch(itemTitle)
-		if len(yearStrSlice) > 1 {
-			movieYear, err = strconv.Atoi(yearStrSlice[1])
-			if err != nil {
-				log.Errorf("failed to parse year: %v", err)
-				return
-			}
+		if features[itemId], err = recSys.itemFeature(itemId, itemTitle, itemGenres); err != nil {
+			return
 		}
-		// itemGenres
-		genres := strings.Split(itemGenres, "|")
-		for i, genre := range genres {
-			if i >= 5 {
-				break
-			}
-			copy(GenreTensor[i*10:], genreFeature(genre))
+	}
+	err = rows.Err()
+	return
+}
+
+// ItemGenres returns the genres of all movies by movieId, they are the
+// categories of search.DiagnosticsOptions to judge the item embeddings.
+func (recSys *MovielensRec) ItemGenres(ctx context.Context) (genres map[string][]string, err error) {
+	rows, err := db.QueryContext(ctx, `select movieId, "genres" itemGenres from movies`)
+	if err != nil {
+		log.Errorf("failed to query movies: %v", err)
+		return
+	}
+	defer rows.Close()
+	genres = make(map[string][]string)
+	for rows.Next() {
+		var (
+			itemId     int
+			itemGenres string
+		)
+		if err = rows.Scan(&itemId, &itemGenres); err != nil {
+			log.Errorf("failed to scan movies: %v", err)
+			return
 		}
-		if mr, ok := recSys.mRatingMap[itemId]; ok {
-			avgRating = mr[0] / 5.
-			cntRating = float32(math.Log2(float64(mr[1])))
+		if itemGenres == "(no genres listed)" {
+			continue
 		}
+		genres[strconv.Itoa(itemId)] = strings.Split(itemGenres, "|")
+	}
+	err = rows.Err()
+	return
+}
 
-		tensor = utils.ConcatSlice32(tensor, GenreTensor[:], rcmd.Tensor{
-			float32(movieYear-1990) / 20.0, avgRating, cntRating,
-		})
-		return
-	} else {
-		err = fmt.Errorf("itemId %d not found", itemId)
-		return
+func (recSys *MovielensRec) itemFeature(itemId int, itemTitle, itemGenres string) (tensor rcmd.Tensor, err error) {
+	var (
+		movieYear            int
+		avgRating, cntRating float32
+		GenreTensor          [50]float32 // 5 * 10
+	)
+	// regex match year from itemTitle
+	yearStrSlice := yearRegex.FindStringSubmatch(itemTitle)
+	if len(yearStrSlice) > 1 {
+		movieYear, err = strconv.Atoi(yearStrSlice[1])
+		if err != nil {
+			log.Errorf("failed to parse year: %v", err)
+			return
+		}
+	}
+	// itemGenres
+	genres := strings.Split(itemGenres, "|")
+	for i, genre := range genres {
+		if i >= 5 {
+			break
+		}
+		copy(GenreTensor[i*10:], genreFeature(genre))
+	}
+	if mr, ok := recSys.mRatingMap[itemId]; ok {
+		avgRating = mr[0] / 5.
+		cntRating = float32(math.Log2(float64(mr[1])))
 	}
+
+	tensor = utils.ConcatSlice32(tensor, GenreTensor[:], rcmd.Tensor{
+		float32(movieYear-1990) / 20.0, avgRating, cntRating,
+	})
+	return
 }
 
 func (recSys *MovielensRec) GetUserFeature(ctx context.Context, userId int) (tensor rcmd.Tensor, err error) {
@@ -0,0 +1,118 @@
+package embedding
+
+import (
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+)
+
+// AverageEmbedding returns the mean of the embeddings of words found in embMap,
+// ok is false if none of them is found.
+func AverageEmbedding(embMap word2vec.EmbeddingMap32, words []string) (avg []float32, ok bool) {
+	var n int
+	for _, word := range words {
+		vec, found := embMap.Get(word)
+		if !found {
+			continue
+		}
+		if avg == nil {
+			avg = make([]float32, len(vec))
+		}
+		for i, v := range vec {
+			avg[i] += v
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, false
+	}
+	for i := range avg {
+		avg[i] /= float32(n)
+	}
+	return avg, true
+}
+
+// FeatureAverage gives the words without embedding, like new items, an
+// embedding by their content features. Each feature value, e.g. a genre or an
+// author, is embedded as the mean embedding of the words having it, and a word
+// is embedded as the mean of its feature embeddings.
+type FeatureAverage struct {
+	features word2vec.EmbeddingMap32
+}
+
+// NewFeatureAverage learns the feature embeddings from embMap and the features
+// of words, which are the content features of the words in embMap.
+func NewFeatureAverage(embMap word2vec.EmbeddingMap32, features map[string][]string) *FeatureAverage {
+	var (
+		sums   = make(map[string][]float32)
+		counts = make(map[string]int)
+	)
+	for word, feats := range features {
+		vec, ok := embMap.Get(word)
+		if !ok {
+			continue
+		}
+		for _, f := range feats {
+			sum := sums[f]
+			if sum == nil {
+				sum = make([]float32, len(vec))
+				sums[f] = sum
+			}
+			for i, v := range vec {
+				sum[i] += v
+			}
+			counts[f]++
+		}
+	}
+	for f, sum := range sums {
+		for i := range sum {
+			sum[i] /= float32(counts[f])
+		}
+	}
+	return &FeatureAverage{features: sums}
+}
+
+// Embedding returns the mean embedding of features, ok is false if none of the
+// features is known.
+func (fa *FeatureAverage) Embedding(features []string) ([]float32, bool) {
+	return AverageEmbedding(fa.features, features)
+}
+
+// CooccurrenceAverage embeds the words without embedding in embMap as the mean
+// embedding of the words co-occurring with them within window in sequences.
+// Only the words not in embMap but co-occurring with some word in it are returned.
+func CooccurrenceAverage(embMap word2vec.EmbeddingMap32, sequences <-chan []string, window int) word2vec.EmbeddingMap32 {
+	var (
+		sums   = make(map[string][]float32)
+		counts = make(map[string]int)
+	)
+	for seq := range sequences {
+		for pos, word := range seq {
+			if _, ok := embMap.Get(word); ok {
+				continue
+			}
+			for c := pos - window; c <= pos+window; c++ {
+				if c < 0 || c >= len(seq) || c == pos {
+					continue
+				}
+				vec, ok := embMap.Get(seq[c])
+				if !ok {
+					continue
+				}
+				sum := sums[word]
+				if sum == nil {
+					sum = make([]float32, len(vec))
+					sums[word] = sum
+				}
+				for i, v := range vec {
+					sum[i] += v
+				}
+				counts[word]++
+			}
+		}
+	}
+	for word, sum := range sums {
+		for i := range sum {
+			sum[i] /= float32(counts[word])
+		}
+	}
+	return sums
+}
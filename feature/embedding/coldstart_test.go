@@ -0,0 +1,52 @@
+package embedding
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestColdStart(t *testing.T) {
+	embMap := word2vec.EmbeddingMap32{
+		"1": {1, 0},
+		"2": {0, 1},
+		"3": {1, 1},
+	}
+	Convey("average embedding", t, func() {
+		avg, ok := AverageEmbedding(embMap, []string{"1", "2", "new"})
+		So(ok, ShouldBeTrue)
+		So(avg, ShouldResemble, []float32{0.5, 0.5})
+		_, ok = AverageEmbedding(embMap, []string{"new"})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("feature average", t, func() {
+		fa := NewFeatureAverage(embMap, map[string][]string{
+			"1":   {"comedy"},
+			"2":   {"drama"},
+			"3":   {"comedy", "drama"},
+			"new": {"horror"},
+		})
+		vec, ok := fa.Embedding([]string{"comedy"})
+		So(ok, ShouldBeTrue)
+		So(vec, ShouldResemble, []float32{1, 0.5})
+		vec, ok = fa.Embedding([]string{"comedy", "drama", "horror"})
+		So(ok, ShouldBeTrue)
+		So(vec, ShouldResemble, []float32{0.75, 0.75})
+		_, ok = fa.Embedding([]string{"horror"})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("co-occurrence average", t, func() {
+		seqs := make(chan []string, 3)
+		seqs <- []string{"1", "new", "2", "3"}
+		seqs <- []string{"new", "lonely"}
+		seqs <- []string{"3", "x", "y", "z"}
+		close(seqs)
+		fallback := CooccurrenceAverage(embMap, seqs, 1)
+		So(fallback, ShouldHaveLength, 2)
+		So(fallback["new"], ShouldResemble, []float32{0.5, 0.5})
+		So(fallback["x"], ShouldResemble, []float32{1, 1})
+	})
+}
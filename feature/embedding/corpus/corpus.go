@@ -26,3 +26,75 @@ type Corpus interface {
 	Len() int
 	Load(*verbose.Verbose, int) error
 }
+
+// EOS is the end-of-sequence marker of input words, windows never cross it.
+// Sequences could be the items a user interacted or the items of a session.
+const EOS = "</s>"
+
+// EOSID is the id of EOS in IndexedDoc and BatchWords, it's not in the Dictionary.
+const EOSID = -1
+
+// Sentences splits doc by EOSID, empty sentences are omitted.
+func Sentences(doc []int) (sentences [][]int) {
+	start := 0
+	for i, id := range doc {
+		if id == EOSID {
+			if i > start {
+				sentences = append(sentences, doc[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if len(doc) > start {
+		sentences = append(sentences, doc[start:])
+	}
+	return
+}
+
+// Flatten sends the words of sequences to the returned channel with EOS after each sequence.
+func Flatten(sequences <-chan []string) <-chan string {
+	out := make(chan string, 1000)
+	go func() {
+		defer close(out)
+		for seq := range sequences {
+			if len(seq) == 0 {
+				continue
+			}
+			for _, word := range seq {
+				out <- word
+			}
+			out <- EOS
+		}
+	}()
+	return out
+}
+
+// TimedWord is a word with its timestamp, usually an item and the time it was interacted.
+type TimedWord struct {
+	Word      string
+	Timestamp int64
+}
+
+// SplitSessions splits each sequence into sessions where the time gap between
+// adjacent words is no more than gap. Sequences are expected ordered by
+// Timestamp, gap <= 0 keeps sequences as is.
+func SplitSessions(sequences <-chan []TimedWord, gap int64) <-chan []string {
+	out := make(chan []string, 100)
+	go func() {
+		defer close(out)
+		for seq := range sequences {
+			var session []string
+			for i, tw := range seq {
+				if i > 0 && gap > 0 && tw.Timestamp-seq[i-1].Timestamp > gap {
+					out <- session
+					session = nil
+				}
+				session = append(session, tw.Word)
+			}
+			if len(session) > 0 {
+				out <- session
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,46 @@
+package corpus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentences(t *testing.T) {
+	doc := []int{EOSID, 0, 1, EOSID, EOSID, 2, EOSID, 3, 4}
+	assert.Equal(t, [][]int{{0, 1}, {2}, {3, 4}}, Sentences(doc))
+	assert.Equal(t, [][]int{{0, 1}}, Sentences([]int{0, 1, EOSID}))
+	assert.Empty(t, Sentences(nil))
+}
+
+func TestFlatten(t *testing.T) {
+	seqs := make(chan []string)
+	go func() {
+		defer close(seqs)
+		seqs <- []string{"a", "b"}
+		seqs <- nil
+		seqs <- []string{"c"}
+	}()
+	var words []string
+	for w := range Flatten(seqs) {
+		words = append(words, w)
+	}
+	assert.Equal(t, []string{"a", "b", EOS, "c", EOS}, words)
+}
+
+func TestSplitSessions(t *testing.T) {
+	seq := []TimedWord{{"a", 0}, {"b", 10}, {"c", 100}, {"d", 105}}
+	split := func(gap int64) (sessions [][]string) {
+		seqs := make(chan []TimedWord, 2)
+		seqs <- seq
+		seqs <- []TimedWord{{"e", 1000}}
+		close(seqs)
+		for s := range SplitSessions(seqs, gap) {
+			sessions = append(sessions, s)
+		}
+		return
+	}
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, split(30))
+	assert.Equal(t, [][]string{{"a", "b", "c", "d"}, {"e"}}, split(0))
+	assert.Equal(t, [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}, split(1))
+}
@@ -55,13 +55,15 @@ func (c *Corpus) IndexedDoc() []int {
 func (c *Corpus) BatchWords(ch chan []int, batchSize int) error {
 	cursor, ids := 0, make([]int, batchSize)
 	if err := cpsutil.ReadWord(c.doc, func(word string) error {
-		if c.toLower {
-			word = strings.ToLower(word)
-		}
-
-		id, _ := c.dic.ID(word)
-		if c.filters.Any(id, c.dic) {
-			return nil
+		id := corpus.EOSID
+		if word != corpus.EOS {
+			if c.toLower {
+				word = strings.ToLower(word)
+			}
+			id, _ = c.dic.ID(word)
+			if c.filters.Any(id, c.dic) {
+				return nil
+			}
 		}
 
 		ids[cursor] = id
@@ -92,6 +94,9 @@ func (c *Corpus) Len() int {
 func (c *Corpus) Load(verbose *verbose.Verbose, logBatch int) error {
 	clk := clock.New()
 	if err := cpsutil.ReadWord(c.doc, func(word string) error {
+		if word == corpus.EOS {
+			return nil
+		}
 		if c.toLower {
 			word = strings.ToLower(word)
 		}
@@ -37,9 +37,15 @@ type Corpus struct {
 }
 
 func New(doc <-chan string, toLower bool, maxCount, minCount int) corpus.Corpus {
+	return NewWithDictionary(doc, dictionary.New(), toLower, maxCount, minCount)
+}
+
+// NewWithDictionary is like New but adds the words of doc to an existing dictionary,
+// which is used to continue training a model with new doc.
+func NewWithDictionary(doc <-chan string, dic *dictionary.Dictionary, toLower bool, maxCount, minCount int) corpus.Corpus {
 	return &Corpus{
 		doc:  doc,
-		dic:  dictionary.New(),
+		dic:  dic,
 		idoc: make([]int, 0),
 
 		toLower: toLower,
@@ -53,7 +59,7 @@ func New(doc <-chan string, toLower bool, maxCount, minCount int) corpus.Corpus
 func (c *Corpus) IndexedDoc() []int {
 	var res []int
 	for _, id := range c.idoc {
-		if c.filters.Any(id, c.dic) {
+		if id != corpus.EOSID && c.filters.Any(id, c.dic) {
 			continue
 		}
 		res = append(res, id)
@@ -76,6 +82,12 @@ func (c *Corpus) Len() int {
 func (c *Corpus) Load(verbose *verbose.Verbose, logBatch int) error {
 	clk := clock.New()
 	if err := cpsutil.ReadWord(c.doc, func(word string) error {
+		if word == corpus.EOS {
+			if n := len(c.idoc); n > 0 && c.idoc[n-1] != corpus.EOSID {
+				c.idoc = append(c.idoc, corpus.EOSID)
+			}
+			return nil
+		}
 		if c.toLower {
 			word = strings.ToLower(word)
 		}
@@ -0,0 +1,27 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/util/verbose"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorpusEOS(t *testing.T) {
+	ch := make(chan string, 10)
+	for _, w := range []string{corpus.EOS, "a", "b", corpus.EOS, corpus.EOS, "a", "c", corpus.EOS} {
+		ch <- w
+	}
+	close(ch)
+
+	c := New(ch, false, -1, 0)
+	assert.NoError(t, c.Load(verbose.New(false), 1000))
+	assert.Equal(t, 4, c.Len())
+	assert.Equal(t, 3, c.Dictionary().Len())
+	a, _ := c.Dictionary().ID("a")
+	b, _ := c.Dictionary().ID("b")
+	cc, _ := c.Dictionary().ID("c")
+	assert.Equal(t, []int{a, b, corpus.EOSID, a, cc, corpus.EOSID}, c.IndexedDoc())
+	assert.Equal(t, [][]int{{a, b}, {a, cc}}, corpus.Sentences(c.IndexedDoc()))
+}
@@ -0,0 +1,261 @@
+package emb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// The binary embedding format, all integers and floats are little endian:
+//
+//	magic      [8]byte  "GOCTREMB"
+//	version    uint32
+//	dim        uint32
+//	count      uint64   number of words
+//	matrix     [count][dim]float32, rows in the order of sorted words
+//	offsets    [count+1]uint64, offsets of words in vocab
+//	vocab      words sorted and concatenated
+//
+// The matrix starts at 4 bytes aligned offset, so it could be used as []float32
+// directly after mmap, and words are found by binary search in the sorted vocab,
+// no index needs to be built on loading.
+const (
+	binaryMagic      = "GOCTREMB"
+	binaryVersion    = 1
+	binaryHeaderSize = 24
+)
+
+// SaveBinary writes the embeddings in binary format, all vectors must be of the same dimension.
+func SaveBinary(w io.Writer, embMap map[string][]float32) (err error) {
+	words := make([]string, 0, len(embMap))
+	dim := -1
+	for word, vec := range embMap {
+		if dim == -1 {
+			dim = len(vec)
+		} else if len(vec) != dim {
+			return fmt.Errorf("dimension for all vectors must be the same: %d but got %d of %s", dim, len(vec), word)
+		}
+		words = append(words, word)
+	}
+	if dim == -1 {
+		dim = 0
+	}
+	return SaveBinaryFunc(w, words, dim, func(i int, vec []float32) {
+		copy(vec, embMap[words[i]])
+	})
+}
+
+// SaveBinaryFunc is like SaveBinary but streams the vectors, vector fills vec
+// with the vector of words[i], so no copy of all the embeddings is needed.
+// The words must be unique.
+func SaveBinaryFunc(w io.Writer, words []string, dim int, vector func(i int, vec []float32)) (err error) {
+	order := make([]int, len(words))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return words[order[i]] < words[order[j]] })
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, binaryHeaderSize)
+	copy(header, binaryMagic)
+	binary.LittleEndian.PutUint32(header[8:], binaryVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(dim))
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(words)))
+	if _, err = bw.Write(header); err != nil {
+		return
+	}
+
+	buf := make([]byte, 8)
+	vec := make([]float32, dim)
+	for _, i := range order {
+		vector(i, vec)
+		for _, v := range vec {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(v))
+			if _, err = bw.Write(buf[:4]); err != nil {
+				return
+			}
+		}
+	}
+	var offset uint64
+	for i := 0; i <= len(order); i++ {
+		binary.LittleEndian.PutUint64(buf, offset)
+		if _, err = bw.Write(buf); err != nil {
+			return
+		}
+		if i < len(order) {
+			offset += uint64(len(words[order[i]]))
+		}
+	}
+	for _, i := range order {
+		if _, err = bw.WriteString(words[i]); err != nil {
+			return
+		}
+	}
+	return bw.Flush()
+}
+
+// SaveBinaryFile writes the embeddings to path in binary format.
+func SaveBinaryFile(path string, embMap map[string][]float32) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	if err = SaveBinary(f, embMap); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// BinaryEmbeddings is the read only embeddings of a binary file, memory mapped
+// on unix like systems, so loading is instant and the pages are shared by
+// processes. The vectors returned must not be modified.
+type BinaryEmbeddings struct {
+	data    []byte
+	dim     int
+	count   int
+	matrix  []float32
+	offsets []byte
+	vocab   []byte
+	unmap   func() error
+}
+
+// OpenBinary loads the embeddings written by SaveBinary, Close it when not used.
+func OpenBinary(path string) (embs *BinaryEmbeddings, err error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return
+	}
+	if embs, err = parseBinary(data); err != nil {
+		unmap()
+		return nil, errors.Wrapf(err, "failed to load %s", path)
+	}
+	embs.unmap = unmap
+	return
+}
+
+func parseBinary(data []byte) (embs *BinaryEmbeddings, err error) {
+	if len(data) < binaryHeaderSize || string(data[:8]) != binaryMagic {
+		return nil, errors.New("not a binary embedding file")
+	}
+	if version := binary.LittleEndian.Uint32(data[8:]); version != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary embedding version %d", version)
+	}
+	embs = &BinaryEmbeddings{
+		data:  data,
+		dim:   int(binary.LittleEndian.Uint32(data[12:])),
+		count: int(binary.LittleEndian.Uint64(data[16:])),
+	}
+	if embs.count < 0 || embs.count > len(data) {
+		return nil, errors.New("truncated binary embedding file")
+	}
+	if embs.dim == 0 && embs.count != 0 {
+		return nil, errors.New("zero dimension of binary embeddings")
+	}
+	// divide before multiplying, so a crafted header does not overflow
+	if embs.count != 0 && embs.count > (len(data)-binaryHeaderSize)/4/embs.dim {
+		return nil, errors.New("truncated binary embedding file")
+	}
+	var (
+		matrixEnd  = binaryHeaderSize + embs.count*embs.dim*4
+		offsetsEnd = matrixEnd + (embs.count+1)*8
+	)
+	if offsetsEnd > len(data) {
+		return nil, errors.New("truncated binary embedding file")
+	}
+	embs.offsets = data[matrixEnd:offsetsEnd]
+	embs.vocab = data[offsetsEnd:]
+	for i := 0; i < embs.count; i++ {
+		if embs.offset(i) > embs.offset(i+1) {
+			return nil, errors.New("invalid vocabulary offsets")
+		}
+	}
+	if uint64(len(embs.vocab)) != embs.offset(embs.count) {
+		return nil, errors.New("vocabulary size mismatch")
+	}
+
+	matrix := data[binaryHeaderSize:matrixEnd]
+	if len(matrix) == 0 {
+		return
+	}
+	if isLittleEndian() && uintptr(unsafe.Pointer(&matrix[0]))%4 == 0 {
+		embs.matrix = unsafe.Slice((*float32)(unsafe.Pointer(&matrix[0])), embs.count*embs.dim)
+	} else {
+		embs.matrix = make([]float32, embs.count*embs.dim)
+		for i := range embs.matrix {
+			embs.matrix[i] = math.Float32frombits(binary.LittleEndian.Uint32(matrix[i*4:]))
+		}
+	}
+	return
+}
+
+func isLittleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+func (e *BinaryEmbeddings) offset(i int) uint64 {
+	return binary.LittleEndian.Uint64(e.offsets[i*8:])
+}
+
+func (e *BinaryEmbeddings) word(i int) []byte {
+	return e.vocab[e.offset(i):e.offset(i+1)]
+}
+
+// Len returns the number of words.
+func (e *BinaryEmbeddings) Len() int {
+	return e.count
+}
+
+// Dim returns the dimension of vectors.
+func (e *BinaryEmbeddings) Dim() int {
+	return e.dim
+}
+
+// Word returns the i-th word in sorted order.
+func (e *BinaryEmbeddings) Word(i int) string {
+	return string(e.word(i))
+}
+
+// Vector returns the vector of the i-th word in sorted order.
+func (e *BinaryEmbeddings) Vector(i int) []float32 {
+	return e.matrix[i*e.dim : (i+1)*e.dim : (i+1)*e.dim]
+}
+
+// Get returns the vector of word like word2vec.EmbeddingMap32, it doesn't
+// allocate as the string conversions in comparisons are optimized away.
+func (e *BinaryEmbeddings) Get(word string) ([]float32, bool) {
+	i := sort.Search(e.count, func(i int) bool {
+		return string(e.word(i)) >= word
+	})
+	if i < e.count && string(e.word(i)) == word {
+		return e.Vector(i), true
+	}
+	return nil, false
+}
+
+// EmbeddingMap32 copies all the embeddings into a map.
+func (e *BinaryEmbeddings) EmbeddingMap32() map[string][]float32 {
+	embMap := make(map[string][]float32, e.count)
+	for i := 0; i < e.count; i++ {
+		embMap[e.Word(i)] = append([]float32(nil), e.Vector(i)...)
+	}
+	return embMap
+}
+
+// Close unmaps the file, the vectors got before must not be used after Close.
+func (e *BinaryEmbeddings) Close() (err error) {
+	if e.unmap != nil {
+		err = e.unmap()
+		e.unmap = nil
+	}
+	e.data, e.matrix, e.offsets, e.vocab, e.count = nil, nil, nil, nil, 0
+	return
+}
@@ -0,0 +1,117 @@
+package emb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinary(t *testing.T) {
+	embMap := map[string][]float32{
+		"banana": {1, 2, 3},
+		"apple":  {-1, 0.5, 0},
+		"中文":     {0.25, 0.125, 1e-8},
+		"b":      {4, 5, 6},
+	}
+	path := filepath.Join(t.TempDir(), "emb.bin")
+	assert.NoError(t, SaveBinaryFile(path, embMap))
+
+	embs, err := OpenBinary(path)
+	assert.NoError(t, err)
+	defer embs.Close()
+	assert.Equal(t, 4, embs.Len())
+	assert.Equal(t, 3, embs.Dim())
+	assert.Equal(t, "apple", embs.Word(0))
+	assert.Equal(t, "b", embs.Word(1))
+	for word, vec := range embMap {
+		got, ok := embs.Get(word)
+		assert.True(t, ok)
+		assert.Equal(t, vec, got)
+	}
+	_, ok := embs.Get("cherry")
+	assert.False(t, ok)
+	_, ok = embs.Get("")
+	assert.False(t, ok)
+	assert.Equal(t, embMap, embs.EmbeddingMap32())
+	long := strings.Repeat("cherry", 10)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		embs.Get("banana")
+		embs.Get(long)
+	}))
+
+	assert.NoError(t, embs.Close())
+	assert.Equal(t, 0, embs.Len())
+	_, ok = embs.Get("apple")
+	assert.False(t, ok)
+}
+
+func TestBinaryInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, SaveBinary(&buf, map[string][]float32{"a": {1}, "b": {1, 2}}))
+
+	buf.Reset()
+	assert.NoError(t, SaveBinary(&buf, map[string][]float32{}))
+	embs, err := parseBinary(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, embs.Len())
+
+	buf.Reset()
+	assert.NoError(t, SaveBinary(&buf, map[string][]float32{"a": {1, 2}}))
+	data := buf.Bytes()
+	_, err = parseBinary(data[:len(data)-1])
+	assert.Error(t, err)
+	_, err = parseBinary(data[:30])
+	assert.Error(t, err)
+	_, err = parseBinary([]byte("apple 1 2\n"))
+	assert.Error(t, err)
+
+	// the vectors of the header are more than the data
+	crafted := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(crafted[12:], 1<<31)
+	binary.LittleEndian.PutUint64(crafted[16:], 2)
+	_, err = parseBinary(crafted)
+	assert.Error(t, err)
+	binary.LittleEndian.PutUint32(crafted[12:], 0)
+	binary.LittleEndian.PutUint64(crafted[16:], 1)
+	_, err = parseBinary(crafted)
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.bin")
+	assert.NoError(t, os.WriteFile(empty, nil, 0644))
+	_, err = OpenBinary(empty)
+	assert.Error(t, err)
+	_, err = OpenBinary(filepath.Join(dir, "missing.bin"))
+	assert.Error(t, err)
+}
+
+func BenchmarkBinaryGet(b *testing.B) {
+	embMap := make(map[string][]float32)
+	for i := 0; i < 100000; i++ {
+		embMap[string(rune('a'+i%26))+string(rune(i))] = make([]float32, 16)
+	}
+	path := filepath.Join(b.TempDir(), "emb.bin")
+	if err := SaveBinaryFile(path, embMap); err != nil {
+		b.Fatal(err)
+	}
+	embs, err := OpenBinary(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer embs.Close()
+	words := make([]string, 0, len(embMap))
+	for word := range embMap {
+		words = append(words, word)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := embs.Get(words[i%len(words)]); !ok {
+			b.Fatal("word not found")
+		}
+	}
+}
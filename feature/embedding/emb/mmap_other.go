@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package emb
+
+import (
+	"os"
+)
+
+// mmapFile reads the whole file as mmap is not supported.
+func mmapFile(path string) (data []byte, unmap func() error, err error) {
+	data, err = os.ReadFile(path)
+	unmap = func() error { return nil }
+	return
+}
@@ -0,0 +1,322 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+)
+
+// EGESOptions controls the training of EGES.
+type EGESOptions struct {
+	Dim                int
+	Window             int
+	NegativeSampleSize int
+	// Iter is the number of epochs, each epoch trains with new walks
+	Iter int
+	// Initlr decays linearly to Initlr * 1e-4 in the last epoch
+	Initlr float64
+	Walk   WalkOptions
+}
+
+var DefaultEGESOptions = EGESOptions{
+	Dim:                16,
+	Window:             5,
+	NegativeSampleSize: 5,
+	Iter:               5,
+	Initlr:             0.025,
+	Walk:               DefaultWalkOptions,
+}
+
+func (opts EGESOptions) Validate() error {
+	switch {
+	case opts.Dim <= 0:
+		return fmt.Errorf("invalid dim: %d", opts.Dim)
+	case opts.Window <= 0:
+		return fmt.Errorf("invalid window: %d", opts.Window)
+	case opts.NegativeSampleSize <= 0:
+		return fmt.Errorf("invalid negative sample size: %d", opts.NegativeSampleSize)
+	case opts.Iter <= 0:
+		return fmt.Errorf("invalid iter: %d", opts.Iter)
+	case opts.Initlr <= 0:
+		return fmt.Errorf("invalid initlr: %v", opts.Initlr)
+	}
+	return opts.Walk.Validate()
+}
+
+// EGES is the Enhanced Graph Embedding with Side information of
+// "Billion-scale Commodity Embedding for E-commerce Recommendation in Alibaba".
+// The embedding of a node is the weighted average of its own embedding and the
+// embeddings of its side information (category, tags...), the weights are
+// learned per node, so sparse nodes could rely more on the side information.
+type EGES struct {
+	dim       int
+	words     []string
+	index     map[string]int
+	sideIndex map[string]int
+
+	nodeEmb [][]float64 // own embedding of nodes
+	sideEmb [][]float64 // embedding of side information values
+	sides   [][]int     // side information of each node, index of sideEmb
+	attn    [][]float64 // weights of own and side information embeddings of each node before softmax
+	ctx     [][]float64 // context embedding of nodes
+}
+
+// TrainEGES trains EGES with the random walks of g, sideInfo is the side
+// information values of nodes, like {"1": {"genre:Comedy", "year:1995"}}.
+func TrainEGES(g *Graph, sideInfo map[string][]string, opts EGESOptions) (e *EGES, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	if g.Len() == 0 {
+		return nil, fmt.Errorf("empty graph")
+	}
+	rnd := rand.New(rand.NewSource(opts.Walk.Seed))
+	e = newEGES(g, sideInfo, opts.Dim, rnd)
+	negTable := negativeTable(g)
+
+	minlr := opts.Initlr * 1e-4
+	for it := 0; it < opts.Iter; it++ {
+		lr := opts.Initlr - (opts.Initlr-minlr)*float64(it)/float64(opts.Iter)
+		walkOpts := opts.Walk
+		walkOpts.Seed += int64(it)
+		walks, er := g.Walks(walkOpts)
+		if er != nil {
+			return nil, er
+		}
+		var (
+			fused = make([]float64, opts.Dim)
+			neu   = make([]float64, opts.Dim)
+		)
+		for walk := range walks {
+			for pos, word := range walk {
+				v := e.index[word]
+				b := rnd.Intn(opts.Window)
+				for c := pos - opts.Window + b; c <= pos+opts.Window-b; c++ {
+					if c < 0 || c >= len(walk) || c == pos {
+						continue
+					}
+					e.trainPair(v, e.index[walk[c]], lr, opts.NegativeSampleSize, negTable, rnd, fused, neu)
+				}
+			}
+		}
+	}
+	return
+}
+
+func newEGES(g *Graph, sideInfo map[string][]string, dim int, rnd *rand.Rand) *EGES {
+	initVec := func() []float64 {
+		vec := make([]float64, dim)
+		for i := range vec {
+			vec[i] = (rnd.Float64() - 0.5) / float64(dim)
+		}
+		return vec
+	}
+	e := &EGES{
+		dim:       dim,
+		words:     append([]string(nil), g.words...),
+		index:     make(map[string]int, len(g.index)),
+		sideIndex: make(map[string]int),
+		nodeEmb:   make([][]float64, g.Len()),
+		sides:     make([][]int, g.Len()),
+		attn:      make([][]float64, g.Len()),
+		ctx:       make([][]float64, g.Len()),
+	}
+	for id, word := range g.words {
+		e.index[word] = id
+		e.nodeEmb[id] = initVec()
+		e.ctx[id] = make([]float64, dim)
+		for _, side := range sideInfo[word] {
+			s, ok := e.sideIndex[side]
+			if !ok {
+				s = len(e.sideEmb)
+				e.sideIndex[side] = s
+				e.sideEmb = append(e.sideEmb, initVec())
+			}
+			e.sides[id] = append(e.sides[id], s)
+		}
+		e.attn[id] = make([]float64, 1+len(e.sides[id]))
+	}
+	return e
+}
+
+// negativeTable is the cumulative unigram distribution raised to 3/4 power.
+func negativeTable(g *Graph) []float64 {
+	cum := make([]float64, g.Len())
+	var sum float64
+	for i, f := range g.freq {
+		sum += math.Pow(float64(f), 0.75)
+		cum[i] = sum
+	}
+	return cum
+}
+
+func sampleNegative(cum []float64, rnd *rand.Rand) int {
+	i := sort.SearchFloat64s(cum, rnd.Float64()*cum[len(cum)-1])
+	if i >= len(cum) {
+		i = len(cum) - 1
+	}
+	return i
+}
+
+// components returns the embeddings fused for node v.
+func (e *EGES) components(v int) [][]float64 {
+	comps := make([][]float64, 1, 1+len(e.sides[v]))
+	comps[0] = e.nodeEmb[v]
+	for _, s := range e.sides[v] {
+		comps = append(comps, e.sideEmb[s])
+	}
+	return comps
+}
+
+// fuse writes the weighted average of comps into fused and returns the weights.
+func (e *EGES) fuse(v int, comps [][]float64, fused []float64) []float64 {
+	weights := softmax(e.attn[v])
+	for i := range fused {
+		fused[i] = 0
+	}
+	for j, comp := range comps {
+		for i, x := range comp {
+			fused[i] += weights[j] * x
+		}
+	}
+	return weights
+}
+
+// trainPair is a skip-gram negative sampling step predicting context u by node v.
+func (e *EGES) trainPair(v, u int, lr float64, negative int, negTable []float64, rnd *rand.Rand,
+	fused, neu []float64,
+) {
+	comps := e.components(v)
+	weights := e.fuse(v, comps, fused)
+	for i := range neu {
+		neu[i] = 0
+	}
+	for n := -1; n < negative; n++ {
+		target, label := u, 1.0
+		if n >= 0 {
+			target, label = sampleNegative(negTable, rnd), 0
+			if target == u {
+				continue
+			}
+		}
+		ctx := e.ctx[target]
+		var inner float64
+		for i := range ctx {
+			inner += fused[i] * ctx[i]
+		}
+		g := (label - sigmoid(inner)) * lr
+		for i := range ctx {
+			neu[i] += g * ctx[i]
+			ctx[i] += g * fused[i]
+		}
+	}
+
+	// back propagate to the weights and the embeddings fused
+	for j, comp := range comps {
+		var grad float64
+		for i := range comp {
+			grad += (comp[i] - fused[i]) * neu[i]
+		}
+		e.attn[v][j] += weights[j] * grad
+		for i := range comp {
+			comp[i] += weights[j] * neu[i]
+		}
+	}
+}
+
+func sigmoid(x float64) float64 {
+	if x > 20 {
+		return 1
+	} else if x < -20 {
+		return 0
+	}
+	return 1 / (1 + math.Exp(-x))
+}
+
+func softmax(a []float64) []float64 {
+	maxA := a[0]
+	for _, x := range a[1:] {
+		if x > maxA {
+			maxA = x
+		}
+	}
+	var (
+		sum float64
+		w   = make([]float64, len(a))
+	)
+	for i, x := range a {
+		w[i] = math.Exp(x - maxA)
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return w
+}
+
+// Embedding returns the fused embedding of word.
+func (e *EGES) Embedding(word string) ([]float32, bool) {
+	v, ok := e.index[word]
+	if !ok {
+		return nil, false
+	}
+	fused := make([]float64, e.dim)
+	e.fuse(v, e.components(v), fused)
+	return toFloat32(fused), true
+}
+
+// Weights returns the softmax weights of the own embedding and the side
+// information embeddings of word.
+func (e *EGES) Weights(word string) ([]float64, bool) {
+	v, ok := e.index[word]
+	if !ok {
+		return nil, false
+	}
+	return softmax(e.attn[v]), true
+}
+
+// SideInfoEmbedding returns the mean embedding of the known side information
+// values, which is the embedding of cold start items not in the graph.
+func (e *EGES) SideInfoEmbedding(sideInfo []string) ([]float32, bool) {
+	var (
+		n   int
+		avg = make([]float64, e.dim)
+	)
+	for _, side := range sideInfo {
+		s, ok := e.sideIndex[side]
+		if !ok {
+			continue
+		}
+		for i, x := range e.sideEmb[s] {
+			avg[i] += x
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, false
+	}
+	for i := range avg {
+		avg[i] /= float64(n)
+	}
+	return toFloat32(avg), true
+}
+
+// EmbeddingMap32 returns the fused embeddings of all nodes.
+func (e *EGES) EmbeddingMap32() word2vec.EmbeddingMap32 {
+	embMap := make(word2vec.EmbeddingMap32, len(e.words))
+	for _, word := range e.words {
+		embMap[word], _ = e.Embedding(word)
+	}
+	return embMap
+}
+
+func toFloat32(vec []float64) []float32 {
+	ret := make([]float32, len(vec))
+	for i, x := range vec {
+		ret[i] = float32(x)
+	}
+	return ret
+}
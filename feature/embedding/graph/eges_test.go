@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestEGES(t *testing.T) {
+	Convey("EGES", t, func() {
+		// two clusters of items only transiting inside
+		var (
+			seqs     [][]string
+			sideInfo = make(map[string][]string)
+		)
+		for _, cluster := range []string{"a", "b"} {
+			var items []string
+			for i := 0; i < 5; i++ {
+				item := fmt.Sprintf("%s%d", cluster, i)
+				items = append(items, item)
+				sideInfo[item] = []string{"cluster:" + cluster, fmt.Sprintf("tag:%d", i%2)}
+			}
+			seqs = append(seqs, items, []string{items[4], items[0], items[2]})
+		}
+		g := FromSequences(sequences(seqs...), true)
+
+		_, err := TrainEGES(g, sideInfo, EGESOptions{})
+		So(err, ShouldNotBeNil)
+
+		e, err := TrainEGES(g, sideInfo, DefaultEGESOptions)
+		So(err, ShouldBeNil)
+		embMap := e.EmbeddingMap32()
+		So(embMap, ShouldHaveLength, 10)
+		So(embMap["a0"], ShouldHaveLength, DefaultEGESOptions.Dim)
+		So(cosine(embMap["a0"], embMap["a1"]), ShouldBeGreaterThan, cosine(embMap["a0"], embMap["b1"]))
+
+		weights, ok := e.Weights("a0")
+		So(ok, ShouldBeTrue)
+		So(weights, ShouldHaveLength, 3)
+		So(weights[0]+weights[1]+weights[2], ShouldAlmostEqual, 1)
+		_, ok = e.Embedding("c0")
+		So(ok, ShouldBeFalse)
+
+		// a cold start item of cluster a
+		cold, ok := e.SideInfoEmbedding([]string{"cluster:a", "unknown"})
+		So(ok, ShouldBeTrue)
+		So(cosine(cold, embMap["a2"]), ShouldBeGreaterThan, cosine(cold, embMap["b2"]))
+		_, ok = e.SideInfoEmbedding([]string{"unknown"})
+		So(ok, ShouldBeFalse)
+	})
+}
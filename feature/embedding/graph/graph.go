@@ -0,0 +1,146 @@
+// Package graph generates item embeddings from the item-item transition graph
+// built from user behavior sequences, by node2vec (or DeepWalk) random walks
+// trained with word2vec, or by EGES which also fuses side information.
+package graph
+
+import (
+	"sort"
+)
+
+// Graph is a weighted item transition graph, the weight of edge a->b is the
+// number of times b follows a in the sequences.
+type Graph struct {
+	// Undirected adds edge b->a as well as a->b for every transition
+	Undirected bool
+
+	words []string
+	index map[string]int
+	freq  []int             // occurrences of each node in sequences
+	edges []map[int]float64 // from -> to -> weight
+
+	// adjacency lists for sampling, rebuilt if dirty
+	dirty bool
+	nbrs  [][]int
+	cum   [][]float64 // cumulative weights of nbrs
+}
+
+func New(undirected bool) *Graph {
+	return &Graph{
+		Undirected: undirected,
+		index:      make(map[string]int),
+	}
+}
+
+// FromSequences builds a graph with all the sequences.
+func FromSequences(sequences <-chan []string, undirected bool) *Graph {
+	g := New(undirected)
+	for seq := range sequences {
+		g.AddSequence(seq)
+	}
+	return g
+}
+
+func (g *Graph) node(word string) int {
+	id, ok := g.index[word]
+	if !ok {
+		id = len(g.words)
+		g.index[word] = id
+		g.words = append(g.words, word)
+		g.freq = append(g.freq, 0)
+		g.edges = append(g.edges, make(map[int]float64))
+	}
+	return id
+}
+
+// AddSequence adds the transitions between adjacent words of seq,
+// repeated words like "a a" are not self loops.
+func (g *Graph) AddSequence(seq []string) {
+	prev := -1
+	for _, word := range seq {
+		id := g.node(word)
+		g.freq[id]++
+		if prev != -1 && prev != id {
+			g.addEdge(prev, id, 1)
+		}
+		prev = id
+	}
+	g.dirty = true
+}
+
+// AddEdge adds weight to the edge from -> to.
+func (g *Graph) AddEdge(from, to string, weight float64) {
+	g.addEdge(g.node(from), g.node(to), weight)
+	g.dirty = true
+}
+
+func (g *Graph) addEdge(from, to int, weight float64) {
+	g.edges[from][to] += weight
+	if g.Undirected {
+		g.edges[to][from] += weight
+	}
+}
+
+// Len returns the number of nodes.
+func (g *Graph) Len() int {
+	return len(g.words)
+}
+
+// Nodes returns all the words in the order they were added.
+func (g *Graph) Nodes() []string {
+	return g.words
+}
+
+// Weight returns the weight of edge from -> to, 0 if not connected.
+func (g *Graph) Weight(from, to string) float64 {
+	f, ok := g.index[from]
+	if !ok {
+		return 0
+	}
+	t, ok := g.index[to]
+	if !ok {
+		return 0
+	}
+	return g.edges[f][t]
+}
+
+// Neighbors returns the words reachable from word by one edge, sorted by weight descending.
+func (g *Graph) Neighbors(word string) []string {
+	id, ok := g.index[word]
+	if !ok {
+		return nil
+	}
+	g.prepare()
+	nbrs := make([]string, len(g.nbrs[id]))
+	for i, n := range g.nbrs[id] {
+		nbrs[i] = g.words[n]
+	}
+	sort.SliceStable(nbrs, func(i, j int) bool {
+		return g.edges[id][g.index[nbrs[i]]] > g.edges[id][g.index[nbrs[j]]]
+	})
+	return nbrs
+}
+
+// prepare builds the adjacency lists sorted by node id, so walks are
+// reproducible with the same seed.
+func (g *Graph) prepare() {
+	if !g.dirty && len(g.nbrs) == len(g.words) {
+		return
+	}
+	g.nbrs = make([][]int, len(g.words))
+	g.cum = make([][]float64, len(g.words))
+	for id, edges := range g.edges {
+		nbrs := make([]int, 0, len(edges))
+		for n := range edges {
+			nbrs = append(nbrs, n)
+		}
+		sort.Ints(nbrs)
+		cum := make([]float64, len(nbrs))
+		var sum float64
+		for i, n := range nbrs {
+			sum += edges[n]
+			cum[i] = sum
+		}
+		g.nbrs[id], g.cum[id] = nbrs, cum
+	}
+	g.dirty = false
+}
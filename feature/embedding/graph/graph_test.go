@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sequences(seqs ...[]string) <-chan []string {
+	ch := make(chan []string, len(seqs))
+	for _, seq := range seqs {
+		ch <- seq
+	}
+	close(ch)
+	return ch
+}
+
+func collect(walks <-chan []string) (ret [][]string) {
+	for walk := range walks {
+		ret = append(ret, walk)
+	}
+	return
+}
+
+func TestGraph(t *testing.T) {
+	Convey("transition graph", t, func() {
+		g := FromSequences(sequences(
+			[]string{"a", "b", "c"},
+			[]string{"a", "b", "b", "d"},
+		), false)
+		So(g.Len(), ShouldEqual, 4)
+		So(g.Nodes(), ShouldResemble, []string{"a", "b", "c", "d"})
+		So(g.Weight("a", "b"), ShouldEqual, 2)
+		So(g.Weight("b", "a"), ShouldEqual, 0)
+		So(g.Weight("b", "b"), ShouldEqual, 0)
+		So(g.Weight("x", "a"), ShouldEqual, 0)
+		g.AddEdge("b", "c", 2)
+		So(g.Neighbors("b"), ShouldResemble, []string{"c", "d"})
+		So(g.Neighbors("c"), ShouldBeEmpty)
+
+		undirected := FromSequences(sequences([]string{"a", "b"}), true)
+		So(undirected.Weight("b", "a"), ShouldEqual, 1)
+	})
+
+	Convey("random walks", t, func() {
+		g := FromSequences(sequences([]string{"a", "b", "c", "d", "e"}), true)
+		_, err := g.Walks(WalkOptions{WalkLength: 1, WalksPerNode: 1, P: 1, Q: 1})
+		So(err, ShouldNotBeNil)
+
+		opts := WalkOptions{WalkLength: 8, WalksPerNode: 5, P: 1, Q: 1, Seed: 3}
+		walks, err := g.Walks(opts)
+		So(err, ShouldBeNil)
+		deepWalks := collect(walks)
+		So(deepWalks, ShouldHaveLength, 25)
+		for _, walk := range deepWalks {
+			So(walk, ShouldHaveLength, 8)
+			for i := 1; i < len(walk); i++ {
+				So(g.Weight(walk[i-1], walk[i]), ShouldBeGreaterThan, 0)
+			}
+		}
+		walks, _ = g.Walks(opts)
+		So(collect(walks), ShouldResemble, deepWalks)
+
+		// node2vec never returns to the previous node unless it's the only choice
+		opts.P = 1e9
+		walks, err = g.Walks(opts)
+		So(err, ShouldBeNil)
+		for _, walk := range collect(walks) {
+			for i := 2; i < len(walk); i++ {
+				if walk[i] == walk[i-2] {
+					So(g.Neighbors(walk[i-1]), ShouldHaveLength, 1)
+				}
+			}
+		}
+
+		directed := FromSequences(sequences([]string{"a", "b"}, []string{"c"}), false)
+		walks, _ = directed.Walks(opts)
+		for _, walk := range collect(walks) {
+			So(walk, ShouldResemble, []string{"a", "b"})
+		}
+	})
+
+	Convey("deep walk embedding", t, func() {
+		g := FromSequences(sequences([]string{"a", "b", "c", "d", "e"}), true)
+		opts := word2vec.DefaultOptions()
+		opts.Dim = 8
+		opts.MinCount = 1
+		opts.DocInMemory = true
+		mod, err := TrainEmbedding(g, DefaultWalkOptions, opts)
+		So(err, ShouldBeNil)
+		embMap, err := mod.GenEmbeddingMap32()
+		So(err, ShouldBeNil)
+		So(embMap, ShouldHaveLength, 5)
+	})
+}
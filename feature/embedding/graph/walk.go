@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/model"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+)
+
+// WalkOptions controls the random walks, P = Q = 1 is DeepWalk on weighted graph.
+type WalkOptions struct {
+	// WalkLength is the max number of nodes of a walk, walks stop at nodes without out edges
+	WalkLength int
+	// WalksPerNode is the number of walks starting from each node
+	WalksPerNode int
+	// P is the return parameter of node2vec, larger P makes returning to the previous node less likely
+	P float64
+	// Q is the in-out parameter of node2vec, Q > 1 prefers nodes close to the previous node (BFS like),
+	// Q < 1 prefers nodes far away (DFS like)
+	Q float64
+	// Seed of the random walks
+	Seed int64
+}
+
+var DefaultWalkOptions = WalkOptions{
+	WalkLength:   20,
+	WalksPerNode: 10,
+	P:            1,
+	Q:            1,
+	Seed:         1,
+}
+
+func (opts WalkOptions) Validate() error {
+	switch {
+	case opts.WalkLength < 2:
+		return fmt.Errorf("walk length should be at least 2, got %d", opts.WalkLength)
+	case opts.WalksPerNode < 1:
+		return fmt.Errorf("walks per node should be at least 1, got %d", opts.WalksPerNode)
+	case opts.P <= 0 || opts.Q <= 0:
+		return fmt.Errorf("p and q should be positive, got %v and %v", opts.P, opts.Q)
+	}
+	return nil
+}
+
+// Walks generates WalksPerNode walks from every node, nodes are shuffled in each round.
+// Walks with only one node are omitted. The graph should not be modified until
+// the returned channel is closed.
+func (g *Graph) Walks(opts WalkOptions) (<-chan []string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	g.prepare()
+	ch := make(chan []string, 100)
+	go func() {
+		defer close(ch)
+		var (
+			rnd   = rand.New(rand.NewSource(opts.Seed))
+			order = make([]int, len(g.words))
+		)
+		for i := range order {
+			order[i] = i
+		}
+		for r := 0; r < opts.WalksPerNode; r++ {
+			rnd.Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+			for _, start := range order {
+				walk := g.walk(start, opts, rnd)
+				if len(walk) < 2 {
+					continue
+				}
+				words := make([]string, len(walk))
+				for i, id := range walk {
+					words[i] = g.words[id]
+				}
+				ch <- words
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (g *Graph) walk(start int, opts WalkOptions, rnd *rand.Rand) []int {
+	walk := make([]int, 1, opts.WalkLength)
+	walk[0] = start
+	for len(walk) < opts.WalkLength {
+		cur := walk[len(walk)-1]
+		if len(g.nbrs[cur]) == 0 {
+			break
+		}
+		var next int
+		if len(walk) == 1 || (opts.P == 1 && opts.Q == 1) {
+			next = g.next(cur, rnd)
+		} else {
+			next = g.biasedNext(walk[len(walk)-2], cur, opts, rnd)
+		}
+		walk = append(walk, next)
+	}
+	return walk
+}
+
+// next samples a neighbor of cur by edge weights.
+func (g *Graph) next(cur int, rnd *rand.Rand) int {
+	cum := g.cum[cur]
+	r := rnd.Float64() * cum[len(cum)-1]
+	i := sort.SearchFloat64s(cum, r)
+	if i >= len(cum) {
+		i = len(cum) - 1
+	}
+	return g.nbrs[cur][i]
+}
+
+// biasedNext samples a neighbor x of cur by the edge weight times the node2vec
+// bias: 1/P if x is prev, 1 if x is connected with prev, else 1/Q.
+func (g *Graph) biasedNext(prev, cur int, opts WalkOptions, rnd *rand.Rand) int {
+	var (
+		nbrs    = g.nbrs[cur]
+		weights = make([]float64, len(nbrs))
+		sum     float64
+	)
+	for i, x := range nbrs {
+		w := g.edges[cur][x]
+		switch {
+		case x == prev:
+			w /= opts.P
+		case g.edges[prev][x] > 0 || g.edges[x][prev] > 0:
+		default:
+			w /= opts.Q
+		}
+		sum += w
+		weights[i] = sum
+	}
+	i := sort.SearchFloat64s(weights, rnd.Float64()*sum)
+	if i >= len(weights) {
+		i = len(weights) - 1
+	}
+	return nbrs[i]
+}
+
+// TrainEmbedding trains word2vec model with the random walks of g,
+// node2vec if P or Q is not 1, otherwise DeepWalk.
+func TrainEmbedding(g *Graph, walkOpts WalkOptions, opts word2vec.Options) (mod model.Model, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	walks, err := g.Walks(walkOpts)
+	if err != nil {
+		return
+	}
+	return embedding.TrainEmbeddingSeqWithOptions(walks, opts)
+}
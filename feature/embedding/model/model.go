@@ -23,9 +23,15 @@ import (
 
 type Model interface {
 	Train(<-chan string) error
+	// Update continues training with new words, vectors of existing words are kept
+	Update(<-chan string) error
 	Save(io.Writer, vector.Type) error
+	// SaveBinary saves the trained vectors in the binary format of emb.SaveBinary
+	SaveBinary(io.Writer, vector.Type) error
 	WordVector(vector.Type) *matrix.Matrix
 	GenEmbeddingMap() (map[string][]float64, error)
 	GenEmbeddingMap32() (map[string][]float32, error)
 	EmbeddingByWord(word string) ([]float64, bool)
+	// Frequency returns the counts of the trained words in the corpus
+	Frequency() map[string]int
 }
@@ -32,6 +32,15 @@ func New(row, col int, fn func(int, []float64)) *Matrix {
 	return mat
 }
 
+// Extend appends n rows to the matrix, fn initializes each new row with its index.
+func (m *Matrix) Extend(n int, fn func(int, []float64)) {
+	m.array = append(m.array, make([]float64, n*m.col)...)
+	m.row += n
+	for i := m.row - n; i < m.row; i++ {
+		fn(i, m.Slice(i))
+	}
+}
+
 func (m *Matrix) startIndex(id int) int {
 	return id * m.col
 }
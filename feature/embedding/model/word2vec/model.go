@@ -27,11 +27,21 @@ type mod interface {
 		param *matrix.Matrix,
 		optimizer optimizer,
 	)
+	// freeze stops updating the vectors of ids marked in frozen
+	freeze(frozen frozenIDs)
+}
+
+// frozenIDs marks the ids whose vectors are not updated, ids out of it are not frozen.
+type frozenIDs []bool
+
+func (f frozenIDs) has(id int) bool {
+	return id < len(f) && f[id]
 }
 
 type skipGram struct {
 	ch     chan []float64
 	window int
+	frozen frozenIDs
 }
 
 func newSkipGram(opts Options) mod {
@@ -71,20 +81,29 @@ func (mod *skipGram) trainOne(
 		ctxID := doc[c]
 		ctx := param.Slice(ctxID)
 		optimizer.optim(doc[pos], lr, ctx, tmp)
+		if mod.frozen.has(ctxID) {
+			continue
+		}
 		for i := 0; i < len(ctx); i++ {
 			ctx[i] += tmp[i]
 		}
 	}
 }
 
+func (mod *skipGram) freeze(frozen frozenIDs) {
+	mod.frozen = frozen
+}
+
 type cbow struct {
 	ch     chan []float64
 	window int
+	frozen frozenIDs
 }
 
 func newCbow(opts Options) mod {
+	// each trainOne takes two buffers
 	ch := make(chan []float64, opts.Goroutines*2)
-	for i := 0; i < opts.Goroutines; i++ {
+	for i := 0; i < opts.Goroutines*2; i++ {
 		ch <- make([]float64, opts.Dim)
 	}
 	return &cbow{
@@ -118,7 +137,7 @@ func (mod *cbow) dowith(
 	pos int,
 	param *matrix.Matrix,
 	agg, tmp []float64,
-	fn func(ctx, agg, tmp []float64),
+	fn func(ctxID int, ctx, agg, tmp []float64),
 ) {
 	del := modelutil.NextRandom(mod.window)
 	for a := del; a < mod.window*2+1-del; a++ {
@@ -131,18 +150,25 @@ func (mod *cbow) dowith(
 		}
 		ctxID := doc[c]
 		ctx := param.Slice(ctxID)
-		fn(ctx, agg, tmp)
+		fn(ctxID, ctx, agg, tmp)
 	}
 }
 
-func (c *cbow) aggregate(ctx, agg, _ []float64) {
+func (c *cbow) aggregate(_ int, ctx, agg, _ []float64) {
 	for i := 0; i < len(ctx); i++ {
 		agg[i] += ctx[i]
 	}
 }
 
-func (c *cbow) update(ctx, _, tmp []float64) {
+func (c *cbow) update(ctxID int, ctx, _, tmp []float64) {
+	if c.frozen.has(ctxID) {
+		return
+	}
 	for i := 0; i < len(ctx); i++ {
 		ctx[i] += tmp[i]
 	}
 }
+
+func (c *cbow) freeze(frozen frozenIDs) {
+	c.frozen = frozen
+}
@@ -15,8 +15,6 @@
 package word2vec
 
 import (
-	"math/rand"
-
 	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary"
 	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary/node"
 	"github.com/auxten/go-ctr/feature/embedding/model/modelutil"
@@ -25,25 +23,22 @@ import (
 
 type optimizer interface {
 	optim(id int, lr float64, ctx, tmp []float64)
+	// freeze stops updating the vectors belonging to ids marked in frozen
+	freeze(frozen frozenIDs)
+	// extend makes room for the words added to dic after the optimizer built
+	extend(dic *dictionary.Dictionary)
 }
 
 type negativeSampling struct {
 	ctx        *matrix.Matrix
 	sigtable   *sigmoidTable
 	sampleSize int
+	frozen     frozenIDs
 }
 
 func newNegativeSampling(dic *dictionary.Dictionary, opts Options) optimizer {
 	return &negativeSampling{
-		ctx: matrix.New(
-			dic.Len(),
-			opts.Dim,
-			func(_ int, vec []float64) {
-				for i := 0; i < opts.Dim; i++ {
-					vec[i] = (rand.Float64() - 0.5) / float64(opts.Dim)
-				}
-			},
-		),
+		ctx:        matrix.New(dic.Len(), opts.Dim, initVector),
 		sigtable:   newSigmoidTable(),
 		sampleSize: opts.NegativeSampleSize,
 	}
@@ -85,14 +80,29 @@ func (opt *negativeSampling) optim(
 		}
 		for i := 0; i < dim; i++ {
 			tmp[i] += g * rnd[i]
-			rnd[i] += g * ctx[i]
+			if !opt.frozen.has(picked) {
+				rnd[i] += g * ctx[i]
+			}
 		}
 	}
 }
 
+func (opt *negativeSampling) freeze(frozen frozenIDs) {
+	opt.frozen = frozen
+}
+
+// extend appends the context vectors of new words, so they are drawn as
+// negative samples as well.
+func (opt *negativeSampling) extend(dic *dictionary.Dictionary) {
+	if added := dic.Len() - opt.ctx.Row(); added > 0 {
+		opt.ctx.Extend(added, initVector)
+	}
+}
+
 type hierarchicalSoftmax struct {
 	sigtable *sigmoidTable
 	nodeset  []*node.Node
+	dim      int
 	maxDepth int
 }
 
@@ -100,6 +110,7 @@ func newHierarchicalSoftmax(dic *dictionary.Dictionary, opts Options) optimizer
 	return &hierarchicalSoftmax{
 		sigtable: newSigmoidTable(),
 		nodeset:  dic.HuffnamTree(opts.Dim),
+		dim:      opts.Dim,
 		maxDepth: opts.MaxDepth,
 	}
 }
@@ -127,3 +138,15 @@ func (opt *hierarchicalSoftmax) optim(
 		}
 	}
 }
+
+// freeze does nothing, the inner nodes are shared by all the words and not
+// exported, the frozen input vectors are kept by mod.
+func (opt *hierarchicalSoftmax) freeze(frozenIDs) {}
+
+// extend rebuilds the huffman tree with the new words, so they have paths.
+// The new inner nodes are trained again with the frozen vectors of the old words.
+func (opt *hierarchicalSoftmax) extend(dic *dictionary.Dictionary) {
+	if dic.Len() != len(opt.nodeset) {
+		opt.nodeset = dic.HuffnamTree(opt.dim)
+	}
+}
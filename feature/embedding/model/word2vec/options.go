@@ -103,6 +103,31 @@ func DefaultOptions() Options {
 	}
 }
 
+// Validate checks the options could be used to train a model.
+func (opts Options) Validate() error {
+	switch {
+	case opts.Dim <= 0:
+		return fmt.Errorf("invalid dim: %d", opts.Dim)
+	case opts.Window <= 0:
+		return fmt.Errorf("invalid window: %d", opts.Window)
+	case opts.Iter <= 0:
+		return fmt.Errorf("invalid iter: %d", opts.Iter)
+	case opts.Goroutines <= 0:
+		return fmt.Errorf("invalid goroutines: %d", opts.Goroutines)
+	case !opts.DocInMemory && opts.BatchSize <= 0:
+		return fmt.Errorf("invalid batch size: %d", opts.BatchSize)
+	case opts.LogBatch <= 0 || opts.UpdateLRBatch <= 0:
+		return fmt.Errorf("invalid log batch %d or update lr batch %d", opts.LogBatch, opts.UpdateLRBatch)
+	case opts.ModelType != Cbow && opts.ModelType != SkipGram:
+		return fmt.Errorf("invalid model: %s not in %s|%s", opts.ModelType, Cbow, SkipGram)
+	case opts.OptimizerType != NegativeSampling && opts.OptimizerType != HierarchicalSoftmax:
+		return fmt.Errorf("invalid optimizer: %s not in %s|%s", opts.OptimizerType, NegativeSampling, HierarchicalSoftmax)
+	case opts.OptimizerType == NegativeSampling && opts.NegativeSampleSize <= 0:
+		return fmt.Errorf("invalid negative sample size: %d", opts.NegativeSampleSize)
+	}
+	return nil
+}
+
 func LoadForCmd(cmd *cobra.Command, opts *Options) {
 	cmd.Flags().IntVar(&opts.BatchSize, "batch", defaultBatchSize, "batch size to train")
 	cmd.Flags().IntVarP(&opts.Dim, "dim", "d", defaultDim, "dimension for word vector")
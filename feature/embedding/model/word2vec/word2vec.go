@@ -25,6 +25,7 @@ import (
 	"golang.org/x/sync/semaphore"
 
 	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/corpus/cpsutil"
 	"github.com/auxten/go-ctr/feature/embedding/corpus/fs"
 	"github.com/auxten/go-ctr/feature/embedding/corpus/memory"
 	"github.com/auxten/go-ctr/feature/embedding/model"
@@ -42,11 +43,14 @@ type word2vec struct {
 
 	corpus corpus.Corpus
 
-	param          *matrix.Matrix
-	subsampler     *subsample.Subsampler
-	currentlr      float64
-	mod            mod
-	optimizer      optimizer
+	param      *matrix.Matrix
+	subsampler *subsample.Subsampler
+	currentlr  float64
+	mod        mod
+	optimizer  optimizer
+	// trained marks the ids whose vectors are trained, the words filtered by
+	// MinCount or MaxCount keep their random vectors and are not exported
+	trained        []bool
 	embeddingMap   EmbeddingMap
 	embeddingMap32 EmbeddingMap32
 
@@ -56,13 +60,13 @@ type word2vec struct {
 type EmbeddingMap map[string][]float64
 type EmbeddingMap32 map[string][]float32
 
-func (m *EmbeddingMap) Get(word string) ([]float64, bool) {
-	vec, ok := (*m)[word]
+func (m EmbeddingMap) Get(word string) ([]float64, bool) {
+	vec, ok := m[word]
 	return vec, ok
 }
 
-func (m *EmbeddingMap32) Get(word string) ([]float32, bool) {
-	vec, ok := (*m)[word]
+func (m EmbeddingMap32) Get(word string) ([]float32, bool) {
+	vec, ok := m[word]
 	return vec, ok
 }
 
@@ -76,7 +80,9 @@ func New(opts ...ModelOption) (model.Model, error) {
 }
 
 func NewForOptions(opts Options) (model.Model, error) {
-	// TODO: validate Options
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 	v := verbose.New(opts.Verbose)
 	return &word2vec{
 		opts: opts,
@@ -100,15 +106,7 @@ func (w *word2vec) Train(r <-chan string) error {
 
 	dic, dim := w.corpus.Dictionary(), w.opts.Dim
 
-	w.param = matrix.New(
-		dic.Len(),
-		dim,
-		func(_ int, vec []float64) {
-			for i := 0; i < dim; i++ {
-				vec[i] = (rand.Float64() - 0.5) / float64(dim)
-			}
-		},
-	)
+	w.param = matrix.New(dic.Len(), dim, initVector)
 
 	w.subsampler = subsample.New(dic, w.opts.SubsampleThreshold)
 
@@ -145,9 +143,60 @@ func (w *word2vec) Train(r <-chan string) error {
 			return err
 		}
 	}
+	w.trained = make([]bool, dic.Len())
+	w.markTrained()
 	return nil
 }
 
+// Update continues training the model with a fresh stream of words, the new words
+// are added to the dictionary and the vectors. Only the vectors of words not
+// trained yet are trained, including the old words filtered by MinCount before,
+// the vectors of trained words are kept unchanged, so the embeddings already
+// used stay valid. The doc is always kept in memory.
+func (w *word2vec) Update(r <-chan string) error {
+	if w.corpus == nil {
+		return w.Train(r)
+	}
+
+	dic := w.corpus.Dictionary()
+	frozen := frozenIDs(append([]bool(nil), w.trained...))
+	w.corpus = memory.NewWithDictionary(r, dic, w.opts.ToLower, w.opts.MaxCount, w.opts.MinCount)
+	if err := w.corpus.Load(w.verbose, w.opts.LogBatch); err != nil {
+		return err
+	}
+
+	w.param.Extend(dic.Len()-w.param.Row(), initVector)
+	w.optimizer.extend(dic)
+	w.mod.freeze(frozen)
+	w.optimizer.freeze(frozen)
+	w.subsampler = subsample.New(dic, w.opts.SubsampleThreshold)
+	w.currentlr = w.opts.Initlr
+	w.embeddingMap, w.embeddingMap32 = nil, nil
+
+	if err := w.train(); err != nil {
+		return err
+	}
+	w.trained = append(w.trained, make([]bool, dic.Len()-len(w.trained))...)
+	w.markTrained()
+	return nil
+}
+
+// markTrained marks the ids not filtered by MinCount or MaxCount as trained.
+func (w *word2vec) markTrained() {
+	for i := range w.trained {
+		if !w.filtered(i) {
+			w.trained[i] = true
+		}
+	}
+}
+
+func initVector(_ int, vec []float64) {
+	dim := len(vec)
+	for i := 0; i < dim; i++ {
+		vec[i] = (rand.Float64() - 0.5) / float64(dim)
+	}
+}
+
 func (w *word2vec) train() error {
 	doc := w.corpus.IndexedDoc()
 	indexPerThread := modelutil.IndexPerThread(
@@ -210,11 +259,14 @@ func (w *word2vec) trainPerThread(
 		return err
 	}
 
-	for pos, id := range doc {
-		if w.subsampler.Trial(id) {
-			w.mod.trainOne(doc, pos, w.currentlr, w.param, w.optimizer)
+	// train each sentence separately so that windows never cross corpus.EOS
+	for _, sentence := range corpus.Sentences(doc) {
+		for pos, id := range sentence {
+			if w.subsampler.Trial(id) {
+				w.mod.trainOne(sentence, pos, w.currentlr, w.param, w.optimizer)
+			}
+			trained <- struct{}{}
 		}
-		trained <- struct{}{}
 	}
 
 	return nil
@@ -246,28 +298,59 @@ func (w *word2vec) Save(f io.Writer, typ vector.Type) error {
 	return vector.Save(f, w.corpus.Dictionary(), w.WordVector(typ), w.verbose, w.opts.LogBatch)
 }
 
-func (w *word2vec) WordVector(typ vector.Type) *matrix.Matrix {
-	var mat *matrix.Matrix
+// SaveBinary saves the vectors of trained words, which could be loaded by
+// emb.OpenBinary with mmap. The vectors are streamed to f without a copy of all.
+func (w *word2vec) SaveBinary(f io.Writer, typ vector.Type) error {
+	if typ != vector.Single && typ != vector.Agg {
+		return vector.InvalidTypeError(typ)
+	}
 	dic := w.corpus.Dictionary()
-	ng, ok := w.optimizer.(*negativeSampling)
-	if typ == vector.Agg && ok {
-		mat = matrix.New(dic.Len(), w.opts.Dim,
-			func(row int, vec []float64) {
-				for i := 0; i < w.opts.Dim; i++ {
-					vec[i] = w.param.Slice(row)[i] + ng.ctx.Slice(row)[i]
-				}
-			},
-		)
-	} else {
-		mat = matrix.New(dic.Len(), w.opts.Dim,
-			func(row int, vec []float64) {
-				for i := 0; i < w.opts.Dim; i++ {
-					vec[i] = w.param.Slice(row)[i]
-				}
-			},
-		)
+	var (
+		ids   []int
+		words []string
+	)
+	for i := 0; i < dic.Len(); i++ {
+		if !w.trained[i] {
+			continue
+		}
+		word, _ := dic.Word(i)
+		ids, words = append(ids, i), append(words, word)
+	}
+	vectorOf, tmp := w.vectorFunc(typ), make([]float64, w.opts.Dim)
+	return emb.SaveBinaryFunc(f, words, w.opts.Dim, func(i int, vec []float32) {
+		vectorOf(ids[i], tmp)
+		for j, v := range tmp {
+			vec[j] = float32(v)
+		}
+	})
+}
+
+func (w *word2vec) WordVector(typ vector.Type) *matrix.Matrix {
+	return matrix.New(w.corpus.Dictionary().Len(), w.opts.Dim, w.vectorFunc(typ))
+}
+
+// vectorFunc returns the func filling vec with the vector of id in WordVector(typ).
+func (w *word2vec) vectorFunc(typ vector.Type) func(id int, vec []float64) {
+	if ng, ok := w.optimizer.(*negativeSampling); typ == vector.Agg && ok {
+		return func(id int, vec []float64) {
+			ctx := ng.ctx.Slice(id)
+			for i, v := range w.param.Slice(id) {
+				vec[i] = v + ctx[i]
+			}
+		}
 	}
-	return mat
+	return func(id int, vec []float64) {
+		copy(vec, w.param.Slice(id))
+	}
+}
+
+// filtered returns true if word of id is filtered by MinCount or MaxCount
+// in training, so its vector is not trained.
+func (w *word2vec) filtered(id int) bool {
+	return cpsutil.Filters{
+		cpsutil.MaxCount(w.opts.MaxCount),
+		cpsutil.MinCount(w.opts.MinCount),
+	}.Any(id, w.corpus.Dictionary())
 }
 
 func (w *word2vec) GenEmbeddingMap() (embMap map[string][]float64, err error) {
@@ -285,6 +368,9 @@ func (w *word2vec) GenEmbeddingMap() (embMap map[string][]float64, err error) {
 	w.embeddingMap = make(map[string][]float64)
 	clk := clock.New()
 	for i := 0; i < dict.Len(); i++ {
+		if !w.trained[i] {
+			continue
+		}
 		word, _ := dict.Word(i)
 		vec := wordVec.Slice(i)
 		w.embeddingMap[word] = vec
@@ -310,6 +396,9 @@ func (w *word2vec) GenEmbeddingMap32() (embMap map[string][]float32, err error)
 	w.embeddingMap32 = make(map[string][]float32)
 	clk := clock.New()
 	for i := 0; i < dict.Len(); i++ {
+		if !w.trained[i] {
+			continue
+		}
 		word, _ := dict.Word(i)
 		vec := wordVec.Slice(i)
 		w.embeddingMap32[word] = make([]float32, len(vec))
@@ -342,6 +431,32 @@ func LoadEmbeddingMap(f io.Reader) (embMap map[string][]float64, err error) {
 	return
 }
 
+func (w *word2vec) Frequency() map[string]int {
+	dic := w.corpus.Dictionary()
+	freq := make(map[string]int, dic.Len())
+	for i := 0; i < dic.Len(); i++ {
+		if w.trained[i] {
+			word, _ := dic.Word(i)
+			freq[word] = dic.IDFreq(i)
+		}
+	}
+	return freq
+}
+
+// EmbeddingByWord returns the Agg vector of a trained word, from the map made by
+// GenEmbeddingMap if any.
 func (w *word2vec) EmbeddingByWord(word string) (vec []float64, ok bool) {
-	return w.embeddingMap.Get(word)
+	if w.embeddingMap != nil {
+		return w.embeddingMap.Get(word)
+	}
+	if w.corpus == nil {
+		return
+	}
+	id, ok := w.corpus.Dictionary().ID(word)
+	if !ok || !w.trained[id] {
+		return nil, false
+	}
+	vec = make([]float64, w.opts.Dim)
+	w.vectorFunc(vector.Agg)(id, vec)
+	return vec, true
 }
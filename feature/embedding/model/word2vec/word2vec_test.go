@@ -0,0 +1,233 @@
+package word2vec
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary"
+	"github.com/auxten/go-ctr/feature/embedding/emb"
+	"github.com/auxten/go-ctr/feature/embedding/model/modelutil/vector"
+)
+
+func words(sequences [][]string, times int) <-chan string {
+	ch := make(chan string, 100)
+	go func() {
+		defer close(ch)
+		for i := 0; i < times; i++ {
+			for _, seq := range sequences {
+				for _, w := range seq {
+					ch <- w
+				}
+				ch <- corpus.EOS
+			}
+		}
+	}()
+	return ch
+}
+
+func TestUpdate(t *testing.T) {
+	for _, opt := range []OptimizerType{NegativeSampling, HierarchicalSoftmax} {
+		mod, err := New(Dim(8), Window(2), Iter(2), MinCount(1), Goroutines(2),
+			Model(SkipGram), Optimizer(opt), DocInMemory())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = mod.Train(words([][]string{{"a", "b", "c"}, {"b", "c", "d"}}, 100)); err != nil {
+			t.Fatal(err)
+		}
+		before, err := mod.GenEmbeddingMap32()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before) != 4 {
+			t.Fatalf("%s: expected 4 words, got %d", opt, len(before))
+		}
+
+		if err = mod.Update(words([][]string{{"a", "e", "b"}, {"c", "e"}}, 100)); err != nil {
+			t.Fatal(err)
+		}
+		after, err := mod.GenEmbeddingMap32()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != 5 {
+			t.Fatalf("%s: expected 5 words after update, got %d", opt, len(after))
+		}
+		for word, vec := range before {
+			for i, v := range vec {
+				if after[word][i] != v {
+					t.Fatalf("%s: vector of %s changed after update", opt, word)
+				}
+			}
+		}
+		var norm float32
+		for _, v := range after["e"] {
+			norm += v * v
+		}
+		if norm == 0 {
+			t.Errorf("%s: vector of new word is zero", opt)
+		}
+	}
+}
+
+func TestCbowGoroutines(t *testing.T) {
+	for _, goroutines := range []int{1, 4} {
+		mod, err := New(Dim(4), Window(2), Iter(1), MinCount(1), Goroutines(goroutines),
+			Model(Cbow), DocInMemory())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- mod.Train(words([][]string{{"a", "b", "c", "d"}}, 100))
+		}()
+		// every trainOne of cbow takes two buffers of the pool, a pool of
+		// one buffer per goroutine deadlocks
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("cbow with %d goroutines deadlocks", goroutines)
+		}
+	}
+}
+
+func TestUpdateFilteredWord(t *testing.T) {
+	for _, opt := range []OptimizerType{NegativeSampling, HierarchicalSoftmax} {
+		mod, err := New(Dim(8), Window(2), Iter(2), MinCount(3), Goroutines(2),
+			Model(SkipGram), Optimizer(opt), DocInMemory())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rare is filtered by MinCount in training
+		doc := make(chan string, 1000)
+		for w := range words([][]string{{"a", "b", "c"}, {"b", "c", "a"}}, 100) {
+			doc <- w
+		}
+		doc <- "rare"
+		close(doc)
+		if err = mod.Train(doc); err != nil {
+			t.Fatal(err)
+		}
+		w := mod.(*word2vec)
+		before, err := mod.GenEmbeddingMap32()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := before["rare"]; ok {
+			t.Fatalf("%s: filtered word is exported", opt)
+		}
+		id, _ := w.corpus.Dictionary().ID("rare")
+		init := append([]float64(nil), w.param.Slice(id)...)
+
+		// rare crosses MinCount with the update
+		if err = mod.Update(words([][]string{{"a", "rare", "b"}, {"rare", "c"}}, 100)); err != nil {
+			t.Fatal(err)
+		}
+		after, err := mod.GenEmbeddingMap32()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := after["rare"]; !ok {
+			t.Fatalf("%s: word trained by update is not exported", opt)
+		}
+		if reflect.DeepEqual(w.param.Slice(id), init) {
+			t.Errorf("%s: vector of rare is not trained by update", opt)
+		}
+		for word, vec := range before {
+			if !reflect.DeepEqual(after[word], vec) {
+				t.Errorf("%s: vector of %s changed after update", opt, word)
+			}
+		}
+		if vec, ok := mod.EmbeddingByWord("rare"); !ok || len(vec) != 8 {
+			t.Errorf("%s: no embedding of rare after update", opt)
+		}
+	}
+}
+
+func TestOptimizerExtend(t *testing.T) {
+	dic := dictionary.New()
+	dic.Add("a", "b")
+	opts := DefaultOptions()
+	opts.Dim = 4
+	opts.NegativeSampleSize = 5
+
+	ng := newNegativeSampling(dic, opts).(*negativeSampling)
+	dic.Add("c", "d", "e", "f")
+	ng.extend(dic)
+	if ng.ctx.Row() != dic.Len() {
+		t.Fatalf("expected %d context vectors, got %d", dic.Len(), ng.ctx.Row())
+	}
+	added := make([][]float64, 0)
+	for i := 2; i < dic.Len(); i++ {
+		added = append(added, append([]float64(nil), ng.ctx.Slice(i)...))
+	}
+	ctx, tmp := []float64{1, 1, 1, 1}, make([]float64, 4)
+	for i := 0; i < 100; i++ {
+		ng.optim(0, 0.1, ctx, tmp)
+	}
+	for i := 2; i < dic.Len(); i++ {
+		if reflect.DeepEqual(ng.ctx.Slice(i), added[i-2]) {
+			t.Errorf("new word %d is never drawn as negative sample", i)
+		}
+	}
+
+	hs := newHierarchicalSoftmax(dic, opts).(*hierarchicalSoftmax)
+	dic.Add("g")
+	hs.extend(dic)
+	if len(hs.nodeset) != dic.Len() {
+		t.Fatalf("expected %d nodes, got %d", dic.Len(), len(hs.nodeset))
+	}
+	id, _ := dic.ID("g")
+	tmp = make([]float64, 4)
+	for i := 0; i < 2; i++ {
+		hs.optim(id, 0.1, ctx, tmp)
+	}
+	if reflect.DeepEqual(tmp, make([]float64, 4)) {
+		t.Error("new word has no gradient with hierarchical softmax")
+	}
+}
+
+func TestSaveBinary(t *testing.T) {
+	mod, err := New(Dim(4), Window(2), Iter(1), MinCount(2), Goroutines(1), DocInMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mod.Train(words([][]string{{"a", "b", "c"}, {"rare"}}, 10)); err != nil {
+		t.Fatal(err)
+	}
+	embMap, err := mod.GenEmbeddingMap32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "emb.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mod.SaveBinary(f, vector.Agg); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	embs, err := emb.OpenBinary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer embs.Close()
+	if embs.Len() != len(embMap) {
+		t.Fatalf("expected %d words, got %d", len(embMap), embs.Len())
+	}
+	for word, vec := range embMap {
+		got, ok := embs.Get(word)
+		if !ok || !reflect.DeepEqual(got, vec) {
+			t.Errorf("vector of %s mismatch: %v, %v", word, got, vec)
+		}
+	}
+}
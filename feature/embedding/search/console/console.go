@@ -20,6 +20,8 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"os"
+	"strings"
 
 	"github.com/auxten/go-ctr/feature/embedding/emb"
 	"github.com/auxten/go-ctr/feature/embedding/emb/embutil"
@@ -42,6 +44,10 @@ type Console struct {
 	searcher *search.Searcher
 	cursor   *searchcursor
 	params   *searchparams
+
+	// Diagnostics is the options of command ":diag", set Categories,
+	// Frequency and Items for the purity, popularity bias and coverage.
+	Diagnostics search.DiagnosticsOptions
 }
 
 func New(searcher *search.Searcher, k int) (*Console, error) {
@@ -58,9 +64,16 @@ func New(searcher *search.Searcher, k int) (*Console, error) {
 			dim: searcher.Items[0].Dim,
 			k:   k,
 		},
+		Diagnostics: diagnosticsOptions(k),
 	}, nil
 }
 
+func diagnosticsOptions(k int) search.DiagnosticsOptions {
+	opts := search.DefaultDiagnosticsOptions
+	opts.K = k
+	return opts
+}
+
 func (c *Console) Run() error {
 	defer c.Close()
 	for {
@@ -74,6 +87,12 @@ func (c *Console) Run() error {
 		case "":
 			continue
 		default:
+			if strings.HasPrefix(l, ":") {
+				if err := c.command(strings.Fields(l[1:])); err != nil {
+					fmt.Println(err)
+				}
+				continue
+			}
 			if err := c.eval(l); err != nil {
 				fmt.Println(err)
 			}
@@ -81,6 +100,61 @@ func (c *Console) Run() error {
 	}
 }
 
+// command runs the console commands:
+//
+//	:diag                  print the embedding diagnostics
+//	:export tsv|json PATH  export the 2D projection for plotting
+func (c *Console) command(args []string) error {
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+	switch args[0] {
+	case "diag":
+		d, err := c.searcher.Diagnose(c.Diagnostics)
+		if err != nil {
+			return err
+		}
+		d.Describe()
+		return nil
+	case "export":
+		if len(args) != 3 {
+			return errors.New("usage: :export tsv|json PATH")
+		}
+		return c.export(args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+func (c *Console) export(format, path string) (err error) {
+	var write func(*search.Projection, *os.File) error
+	switch format {
+	case "tsv":
+		write = func(p *search.Projection, f *os.File) error { return p.WriteTSV(f) }
+	case "json":
+		write = func(p *search.Projection, f *os.File) error { return p.WriteJSON(f) }
+	default:
+		return fmt.Errorf("invalid format %s, should be tsv or json", format)
+	}
+	proj, err := c.searcher.Project2D(c.Diagnostics.Categories)
+	if err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	if err = write(proj, f); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	fmt.Printf("exported %d points to %s\n", len(proj.Points), path)
+	return
+}
+
 func (c *Console) eval(l string) error {
 	defer func() {
 		c.cursor.w1 = ""
@@ -0,0 +1,490 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/auxten/go-ctr/feature/embedding/emb"
+	"github.com/auxten/go-ctr/feature/preprocessing"
+	"github.com/olekukonko/tablewriter"
+	"gonum.org/v1/gonum/mat"
+)
+
+// DiagnosticsOptions is the item metadata used to judge the embeddings,
+// all of them are optional.
+type DiagnosticsOptions struct {
+	// K is the number of neighbors of each word
+	K int
+	// Queries is the max number of words whose neighbors are searched, words
+	// are picked evenly if there are more, 0 means all
+	Queries int
+	// Categories of words, like the genres of movies {"1": {"Comedy", "Romance"}}
+	Categories map[string][]string
+	// Frequency of words in the training corpus, for the popularity bias
+	Frequency map[string]int
+	// HeadRatio is the ratio of the most frequent words regarded as popular
+	HeadRatio float64
+	// Items expected to have embeddings, for the coverage
+	Items []string
+}
+
+var DefaultDiagnosticsOptions = DiagnosticsOptions{
+	K:         10,
+	Queries:   1000,
+	HeadRatio: 0.2,
+}
+
+func (opts DiagnosticsOptions) Validate() error {
+	switch {
+	case opts.K <= 0:
+		return fmt.Errorf("invalid k: %d", opts.K)
+	case opts.Queries < 0:
+		return fmt.Errorf("invalid queries: %d", opts.Queries)
+	case opts.HeadRatio <= 0 || opts.HeadRatio >= 1:
+		return fmt.Errorf("head ratio should be in (0, 1), got %v", opts.HeadRatio)
+	}
+	return nil
+}
+
+// Diagnostics is the quality report of embeddings.
+type Diagnostics struct {
+	Words   int `json:"words"`
+	Queries int `json:"queries"`
+	K       int `json:"k"`
+
+	// Purity is the ratio of neighbors sharing a category with the query word,
+	// RandomPurity is the ratio of all words sharing a category with the query
+	// word, good embeddings have Purity much higher than RandomPurity
+	Purity           float64            `json:"purity"`
+	RandomPurity     float64            `json:"randomPurity"`
+	PurityByCategory map[string]float64 `json:"purityByCategory,omitempty"`
+	// CategorizedWords is the number of words with categories
+	CategorizedWords int `json:"categorizedWords"`
+
+	Popularity *PopularityBias `json:"popularity,omitempty"`
+	Norm       NormStats       `json:"norm"`
+	Coverage   *Coverage       `json:"coverage,omitempty"`
+}
+
+// PopularityBias tells whether the embeddings are dominated by popular words.
+type PopularityBias struct {
+	// NormFrequencyCorrelation is the spearman correlation of norms and frequencies
+	NormFrequencyCorrelation float64 `json:"normFrequencyCorrelation"`
+	// NeighborHeadRatio is the ratio of popular words in neighbors, close to
+	// HeadRatio if neighbors are not biased to popular words
+	NeighborHeadRatio float64 `json:"neighborHeadRatio"`
+	HeadRatio         float64 `json:"headRatio"`
+}
+
+// NormStats is the distribution of vector norms.
+type NormStats struct {
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Mean        float64 `json:"mean"`
+	Std         float64 `json:"std"`
+	P50         float64 `json:"p50"`
+	P90         float64 `json:"p90"`
+	P99         float64 `json:"p99"`
+	ZeroVectors int     `json:"zeroVectors"`
+}
+
+// Coverage is the ratio of the expected items having embeddings.
+type Coverage struct {
+	Items       int      `json:"items"`
+	Covered     int      `json:"covered"`
+	MissingRate float64  `json:"missingRate"`
+	Missing     []string `json:"missing,omitempty"`
+}
+
+// Diagnose computes the Diagnostics of the searcher items with opts.
+func (s *Searcher) Diagnose(opts DiagnosticsOptions) (d *Diagnostics, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	if s.Items.Empty() {
+		return nil, fmt.Errorf("no items to diagnose")
+	}
+	d = &Diagnostics{
+		Words: len(s.Items),
+		K:     opts.K,
+		Norm:  normStats(s.Items),
+	}
+	for _, item := range s.Items {
+		if len(opts.Categories[item.Word]) > 0 {
+			d.CategorizedWords++
+		}
+	}
+
+	var head map[string]bool
+	if len(opts.Frequency) > 0 {
+		head = headWords(s, opts.Frequency, opts.HeadRatio)
+		d.Popularity = &PopularityBias{
+			NormFrequencyCorrelation: s.normFrequencyCorrelation(opts.Frequency),
+			HeadRatio:                opts.HeadRatio,
+		}
+	}
+
+	var (
+		purity, randomPurity, neighbors, headNeighbors float64
+		purityQueries                                  int
+		catPurity                                      = make(map[string]float64)
+		catQueries                                     = make(map[string]int)
+	)
+	for _, i := range queryIndexes(len(s.Items), opts.Queries) {
+		q := s.Items[i]
+		nbrs, er := s.Search(q, opts.K, q.Word)
+		if er != nil {
+			return nil, er
+		}
+		d.Queries++
+		for _, n := range nbrs {
+			neighbors++
+			if head[n.Word] {
+				headNeighbors++
+			}
+		}
+
+		cats := opts.Categories[q.Word]
+		if len(cats) == 0 || len(nbrs) == 0 {
+			continue
+		}
+		var same int
+		for _, n := range nbrs {
+			if shareCategory(cats, opts.Categories[n.Word]) {
+				same++
+			}
+		}
+		p := float64(same) / float64(len(nbrs))
+		purity += p
+		randomPurity += s.randomPurity(q.Word, cats, opts.Categories)
+		purityQueries++
+		for _, cat := range cats {
+			catPurity[cat] += p
+			catQueries[cat]++
+		}
+	}
+	if purityQueries > 0 {
+		d.Purity = purity / float64(purityQueries)
+		d.RandomPurity = randomPurity / float64(purityQueries)
+		d.PurityByCategory = make(map[string]float64, len(catPurity))
+		for cat, p := range catPurity {
+			d.PurityByCategory[cat] = p / float64(catQueries[cat])
+		}
+	}
+	if d.Popularity != nil && neighbors > 0 {
+		d.Popularity.NeighborHeadRatio = headNeighbors / neighbors
+	}
+
+	if len(opts.Items) > 0 {
+		d.Coverage = s.coverage(opts.Items)
+	}
+	return
+}
+
+// queryIndexes picks at most max indexes of n evenly.
+func queryIndexes(n, max int) []int {
+	if max == 0 || max > n {
+		max = n
+	}
+	idx := make([]int, max)
+	for i := range idx {
+		idx[i] = i * n / max
+	}
+	return idx
+}
+
+func shareCategory(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// randomPurity is the ratio of the other words sharing a category with word.
+func (s *Searcher) randomPurity(word string, cats []string, categories map[string][]string) float64 {
+	var same, total int
+	for _, item := range s.Items {
+		if item.Word == word {
+			continue
+		}
+		total++
+		if shareCategory(cats, categories[item.Word]) {
+			same++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(same) / float64(total)
+}
+
+// headWords returns the HeadRatio most frequent words of the searcher items.
+func headWords(s *Searcher, freq map[string]int, ratio float64) map[string]bool {
+	words := make([]string, len(s.Items))
+	for i, item := range s.Items {
+		words[i] = item.Word
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return freq[words[i]] > freq[words[j]]
+	})
+	n := int(math.Ceil(float64(len(words)) * ratio))
+	head := make(map[string]bool, n)
+	for _, word := range words[:n] {
+		head[word] = true
+	}
+	return head
+}
+
+func (s *Searcher) normFrequencyCorrelation(freq map[string]int) float64 {
+	var (
+		norms = make([]float64, len(s.Items))
+		freqs = make([]float64, len(s.Items))
+	)
+	for i, item := range s.Items {
+		norms[i] = item.Norm
+		freqs[i] = float64(freq[item.Word])
+	}
+	return pearson(ranks(norms), ranks(freqs))
+}
+
+// ranks returns the ranks of x, ties get the average rank.
+func ranks(x []float64) []float64 {
+	idx := make([]int, len(x))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return x[idx[i]] < x[idx[j]]
+	})
+	r := make([]float64, len(x))
+	for i := 0; i < len(idx); {
+		j := i
+		for j < len(idx) && x[idx[j]] == x[idx[i]] {
+			j++
+		}
+		avg := float64(i+j-1) / 2
+		for k := i; k < j; k++ {
+			r[idx[k]] = avg
+		}
+		i = j
+	}
+	return r
+}
+
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	if n == 0 {
+		return 0
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx, my = mx/n, my/n
+	var sxy, sxx, syy float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+func normStats(items []emb.Embedding) (stats NormStats) {
+	norms := make([]float64, len(items))
+	for i, item := range items {
+		norms[i] = item.Norm
+		stats.Mean += item.Norm
+		if item.Norm == 0 {
+			stats.ZeroVectors++
+		}
+	}
+	sort.Float64s(norms)
+	n := float64(len(norms))
+	stats.Mean /= n
+	for _, x := range norms {
+		stats.Std += (x - stats.Mean) * (x - stats.Mean)
+	}
+	stats.Std = math.Sqrt(stats.Std / n)
+	stats.Min, stats.Max = norms[0], norms[len(norms)-1]
+	percentile := func(p float64) float64 {
+		return norms[int(math.Ceil(p*n))-1]
+	}
+	stats.P50, stats.P90, stats.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	return
+}
+
+func (s *Searcher) coverage(items []string) *Coverage {
+	words := make(map[string]bool, len(s.Items))
+	for _, item := range s.Items {
+		words[item.Word] = true
+	}
+	c := &Coverage{}
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+		c.Items++
+		if words[item] {
+			c.Covered++
+		} else {
+			c.Missing = append(c.Missing, item)
+		}
+	}
+	sort.Strings(c.Missing)
+	c.MissingRate = float64(c.Items-c.Covered) / float64(c.Items)
+	return c
+}
+
+// Describe prints the diagnostics as tables like Neighbors.Describe.
+func (d *Diagnostics) Describe() {
+	writer := tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader([]string{"Metric", "Value"})
+	writer.SetBorder(false)
+	writer.Append([]string{"words", fmt.Sprintf("%d", d.Words)})
+	writer.Append([]string{"queries", fmt.Sprintf("%d", d.Queries)})
+	if d.CategorizedWords > 0 {
+		writer.Append([]string{"categorized words", fmt.Sprintf("%d", d.CategorizedWords)})
+		writer.Append([]string{fmt.Sprintf("purity@%d", d.K), fmt.Sprintf("%f", d.Purity)})
+		writer.Append([]string{"random purity", fmt.Sprintf("%f", d.RandomPurity)})
+	}
+	if d.Popularity != nil {
+		writer.Append([]string{"norm-frequency correlation", fmt.Sprintf("%f", d.Popularity.NormFrequencyCorrelation)})
+		writer.Append([]string{fmt.Sprintf("neighbor head ratio (head %.0f%%)", d.Popularity.HeadRatio*100),
+			fmt.Sprintf("%f", d.Popularity.NeighborHeadRatio)})
+	}
+	writer.Append([]string{"norm min/mean/max", fmt.Sprintf("%f/%f/%f", d.Norm.Min, d.Norm.Mean, d.Norm.Max)})
+	writer.Append([]string{"norm std", fmt.Sprintf("%f", d.Norm.Std)})
+	writer.Append([]string{"norm p50/p90/p99", fmt.Sprintf("%f/%f/%f", d.Norm.P50, d.Norm.P90, d.Norm.P99)})
+	writer.Append([]string{"zero vectors", fmt.Sprintf("%d", d.Norm.ZeroVectors)})
+	if d.Coverage != nil {
+		writer.Append([]string{"coverage", fmt.Sprintf("%d/%d", d.Coverage.Covered, d.Coverage.Items)})
+		writer.Append([]string{"missing rate", fmt.Sprintf("%f", d.Coverage.MissingRate)})
+		if len(d.Coverage.Missing) > 0 {
+			missing := d.Coverage.Missing
+			if len(missing) > 10 {
+				missing = append(missing[:10:10], "...")
+			}
+			writer.Append([]string{"missing", strings.Join(missing, " ")})
+		}
+	}
+	writer.Render()
+
+	if len(d.PurityByCategory) == 0 {
+		return
+	}
+	cats := make([]string, 0, len(d.PurityByCategory))
+	for cat := range d.PurityByCategory {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	writer = tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader([]string{"Category", fmt.Sprintf("Purity@%d", d.K)})
+	writer.SetBorder(false)
+	for _, cat := range cats {
+		writer.Append([]string{cat, fmt.Sprintf("%f", d.PurityByCategory[cat])})
+	}
+	writer.Render()
+}
+
+// Point is a word projected to 2D.
+type Point struct {
+	Word       string   `json:"word"`
+	X          float64  `json:"x"`
+	Y          float64  `json:"y"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// Projection is the 2D PCA projection of the embeddings for plotting.
+type Projection struct {
+	ExplainedVarianceRatio []float64 `json:"explainedVarianceRatio"`
+	Points                 []Point   `json:"points"`
+}
+
+// Project2D projects the searcher items to the first 2 principal components,
+// categories are optional and attached to the points.
+func (s *Searcher) Project2D(categories map[string][]string) (proj *Projection, err error) {
+	if len(s.Items) < 2 {
+		return nil, fmt.Errorf("need at least 2 items to project, got %d", len(s.Items))
+	}
+	if s.Items[0].Dim < 2 {
+		return nil, fmt.Errorf("need at least 2 dimensions to project, got %d", s.Items[0].Dim)
+	}
+	var (
+		dim  = s.Items[0].Dim
+		x    = mat.NewDense(len(s.Items), dim, nil)
+		mean = make([]float64, dim)
+	)
+	for _, item := range s.Items {
+		for j, v := range item.Vector {
+			mean[j] += v
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(s.Items))
+	}
+	for i, item := range s.Items {
+		for j, v := range item.Vector {
+			x.Set(i, j, v-mean[j])
+		}
+	}
+
+	pca := preprocessing.NewPCA()
+	pca.NComponents = 2
+	pca.Fit(x, nil)
+	if pca.Kind()&mat.SVDThinV == 0 {
+		return nil, fmt.Errorf("failed to factorize the %d items", len(s.Items))
+	}
+	if math.IsNaN(pca.ExplainedVarianceRatio[0]) {
+		return nil, fmt.Errorf("all the %d items are the same", len(s.Items))
+	}
+	// the second result is the transformed Y, which is nil
+	xp, _ := pca.Transform(x, nil)
+	proj = &Projection{
+		ExplainedVarianceRatio: append([]float64(nil), pca.ExplainedVarianceRatio[:2]...),
+		Points:                 make([]Point, len(s.Items)),
+	}
+	for i, item := range s.Items {
+		proj.Points[i] = Point{
+			Word:       item.Word,
+			X:          xp.At(i, 0),
+			Y:          xp.At(i, 1),
+			Categories: categories[item.Word],
+		}
+	}
+	return
+}
+
+// WriteTSV writes the points with header "word\tx\ty\tcategories",
+// categories are joined by "|".
+func (p *Projection) WriteTSV(w io.Writer) (err error) {
+	if _, err = fmt.Fprintln(w, "word\tx\ty\tcategories"); err != nil {
+		return
+	}
+	for _, pt := range p.Points {
+		if _, err = fmt.Fprintf(w, "%s\t%g\t%g\t%s\n", pt.Word, pt.X, pt.Y, strings.Join(pt.Categories, "|")); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteJSON writes the projection as JSON.
+func (p *Projection) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(p)
+}
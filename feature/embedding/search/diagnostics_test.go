@@ -0,0 +1,151 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/auxten/go-ctr/feature/embedding/emb"
+	"github.com/auxten/go-ctr/feature/embedding/emb/embutil"
+)
+
+func newEmbedding(word string, vec ...float64) emb.Embedding {
+	return emb.Embedding{
+		Word:   word,
+		Dim:    len(vec),
+		Vector: vec,
+		Norm:   embutil.Norm(vec),
+	}
+}
+
+// two clusters of fruits and animals, "dog" is closer to the fruits.
+func diagnosticsSearcher(t *testing.T) *Searcher {
+	s, err := New(
+		newEmbedding("apple", 1, 0.1, 0),
+		newEmbedding("banana", 1, 0.2, 0),
+		newEmbedding("cherry", 1, 0, 0.1),
+		newEmbedding("cat", 0, 1, 0.1),
+		newEmbedding("cow", 0.1, 1, 0),
+		newEmbedding("dog", 1, 0, 0.2),
+	)
+	require.NoError(t, err)
+	return s
+}
+
+var diagnosticsCategories = map[string][]string{
+	"apple":  {"fruit"},
+	"banana": {"fruit"},
+	"cherry": {"fruit", "red"},
+	"cat":    {"animal"},
+	"cow":    {"animal"},
+	"dog":    {"animal"},
+}
+
+func TestDiagnose(t *testing.T) {
+	s := diagnosticsSearcher(t)
+	opts := DefaultDiagnosticsOptions
+	opts.K = 1
+	opts.Categories = diagnosticsCategories
+	opts.Frequency = map[string]int{"apple": 100, "banana": 50, "cherry": 10, "cat": 5, "cow": 2, "dog": 1}
+	opts.HeadRatio = 0.5
+	opts.Items = []string{"apple", "dog", "egg", "egg"}
+
+	d, err := s.Diagnose(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 6, d.Words)
+	assert.Equal(t, 6, d.Queries)
+	assert.Equal(t, 6, d.CategorizedWords)
+
+	// the nearest neighbor of dog and cherry are each other, all others are pure
+	assert.InDelta(t, 4./6, d.Purity, 1e-9)
+	assert.InDelta(t, 2./5, d.RandomPurity, 1e-9)
+	assert.InDelta(t, 2./3, d.PurityByCategory["fruit"], 1e-9)
+	assert.InDelta(t, 2./3, d.PurityByCategory["animal"], 1e-9)
+	assert.InDelta(t, 0, d.PurityByCategory["red"], 1e-9)
+
+	require.NotNil(t, d.Popularity)
+	assert.Equal(t, 0.5, d.Popularity.HeadRatio)
+	// apple, banana and cherry are the head
+	assert.InDelta(t, 3./6, d.Popularity.NeighborHeadRatio, 1e-9)
+
+	assert.Equal(t, 0, d.Norm.ZeroVectors)
+	assert.True(t, d.Norm.Min <= d.Norm.P50 && d.Norm.P50 <= d.Norm.P90 && d.Norm.P90 <= d.Norm.Max)
+	assert.InDelta(t, math.Sqrt(1.01), d.Norm.Min, 1e-9)
+
+	require.NotNil(t, d.Coverage)
+	assert.Equal(t, &Coverage{Items: 3, Covered: 2, MissingRate: 1. / 3, Missing: []string{"egg"}}, d.Coverage)
+
+	_, err = json.Marshal(d)
+	assert.NoError(t, err)
+
+	opts.K = 0
+	_, err = s.Diagnose(opts)
+	assert.Error(t, err)
+}
+
+func TestDiagnoseWithoutMetadata(t *testing.T) {
+	s := diagnosticsSearcher(t)
+	opts := DefaultDiagnosticsOptions
+	opts.Queries = 2
+	d, err := s.Diagnose(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.Queries)
+	assert.Equal(t, 0, d.CategorizedWords)
+	assert.Nil(t, d.PurityByCategory)
+	assert.Nil(t, d.Popularity)
+	assert.Nil(t, d.Coverage)
+}
+
+func TestRanks(t *testing.T) {
+	assert.Equal(t, []float64{1.5, 0, 1.5, 3}, ranks([]float64{2, 1, 2, 5}))
+	assert.InDelta(t, 1, pearson([]float64{1, 2, 3}, []float64{2, 4, 6}), 1e-9)
+	assert.InDelta(t, -1, pearson([]float64{1, 2, 3}, []float64{3, 2, 1}), 1e-9)
+}
+
+func TestProject2D(t *testing.T) {
+	s := diagnosticsSearcher(t)
+	proj, err := s.Project2D(diagnosticsCategories)
+	require.NoError(t, err)
+	require.Len(t, proj.Points, 6)
+	require.Len(t, proj.ExplainedVarianceRatio, 2)
+	assert.True(t, proj.ExplainedVarianceRatio[0] >= proj.ExplainedVarianceRatio[1])
+
+	// the projection is centered and separates the clusters on the first component
+	var sumX float64
+	for _, p := range proj.Points {
+		sumX += p.X
+	}
+	assert.InDelta(t, 0, sumX, 1e-9)
+	assert.Equal(t, proj.Points[0].X > 0, proj.Points[1].X > 0)
+	assert.NotEqual(t, proj.Points[0].X > 0, proj.Points[3].X > 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, proj.WriteTSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, "word\tx\ty\tcategories", lines[0])
+	assert.True(t, strings.HasPrefix(lines[3], "cherry\t"))
+	assert.True(t, strings.HasSuffix(lines[3], "\tfruit|red"))
+
+	buf.Reset()
+	require.NoError(t, proj.WriteJSON(&buf))
+	var decoded Projection
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *proj, decoded)
+
+	one, err := New(newEmbedding("apple", 1, 0))
+	require.NoError(t, err)
+	_, err = one.Project2D(nil)
+	assert.Error(t, err)
+	_, err = (&Searcher{}).Project2D(nil)
+	assert.Error(t, err)
+	same, err := New(newEmbedding("apple", 1, 0), newEmbedding("banana", 1, 0))
+	require.NoError(t, err)
+	_, err = same.Project2D(nil)
+	assert.Error(t, err)
+}
@@ -1,13 +1,17 @@
 package embedding
 
 import (
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
 	"github.com/auxten/go-ctr/feature/embedding/model"
 	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
 	log "github.com/sirupsen/logrus"
 )
 
-func TrainEmbedding(inputCh <-chan string, window int, dim int, iter int) (mod model.Model, err error) {
-	if mod, err = word2vec.New(
+// DefaultOptions returns the word2vec options used by TrainEmbedding:
+// SkipGram with HierarchicalSoftmax and doc in memory.
+func DefaultOptions(window int, dim int, iter int) word2vec.Options {
+	opts := word2vec.DefaultOptions()
+	for _, fn := range []word2vec.ModelOption{
 		word2vec.Window(window),
 		word2vec.Dim(dim),
 		word2vec.Model(word2vec.SkipGram),
@@ -15,7 +19,19 @@ func TrainEmbedding(inputCh <-chan string, window int, dim int, iter int) (mod m
 		word2vec.Verbose(),
 		word2vec.Iter(iter),
 		word2vec.DocInMemory(),
-	); err != nil {
+	} {
+		fn(&opts)
+	}
+	return opts
+}
+
+func TrainEmbedding(inputCh <-chan string, window int, dim int, iter int) (mod model.Model, err error) {
+	return TrainEmbeddingWithOptions(inputCh, DefaultOptions(window, dim, iter))
+}
+
+// TrainEmbeddingWithOptions is like TrainEmbedding with all word2vec options.
+func TrainEmbeddingWithOptions(inputCh <-chan string, opts word2vec.Options) (mod model.Model, err error) {
+	if mod, err = word2vec.NewForOptions(opts); err != nil {
 		return
 	}
 
@@ -30,3 +46,23 @@ func TrainEmbedding(inputCh <-chan string, window int, dim int, iter int) (mod m
 
 	return
 }
+
+// TrainEmbeddingSeq is like TrainEmbedding but trains with sequences of words,
+// windows never cross sequences.
+func TrainEmbeddingSeq(seqCh <-chan []string, window int, dim int, iter int) (mod model.Model, err error) {
+	return TrainEmbeddingSeqWithOptions(seqCh, DefaultOptions(window, dim, iter))
+}
+
+// TrainEmbeddingSeqWithOptions is like TrainEmbeddingSeq with all word2vec options.
+func TrainEmbeddingSeqWithOptions(seqCh <-chan []string, opts word2vec.Options) (mod model.Model, err error) {
+	return TrainEmbeddingWithOptions(corpus.Flatten(seqCh), opts)
+}
+
+// UpdateEmbedding continues training mod with new words, vectors of the words
+// already in mod are kept unchanged, see model.Model.Update.
+func UpdateEmbedding(mod model.Model, inputCh <-chan string) (err error) {
+	if err = mod.Update(inputCh); err != nil {
+		log.Errorf("failed to update embedding: %v", err)
+	}
+	return
+}
@@ -92,3 +92,26 @@ func TestEmbedding(t *testing.T) {
 		}
 	})
 }
+
+func TestTrainEmbeddingSeq(t *testing.T) {
+	Convey("item embedding with sequences", t, func() {
+		seqCh := make(chan []string, 100)
+		go func() {
+			defer close(seqCh)
+			for i := 0; i < 200; i++ {
+				seqCh <- []string{"a", "b", "c"}
+				seqCh <- []string{"x", "y", "z"}
+			}
+		}()
+		mod, err := TrainEmbeddingSeq(seqCh, 5, Dim, 1)
+		So(err, ShouldBeNil)
+		embMap, err := mod.GenEmbeddingMap32()
+		So(err, ShouldBeNil)
+		So(embMap, ShouldHaveLength, 6)
+		embVec, ok := mod.EmbeddingByWord("a")
+		So(ok, ShouldBeTrue)
+		So(embVec, ShouldHaveLength, Dim)
+		_, ok = mod.EmbeddingByWord("</s>")
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -12,25 +12,23 @@ func SimpleOneHot(value int, size int) []float64 {
 	return result
 }
 
+// HashIndex returns the index of buf in [0, size), it's the index of the one
+// of HashOneHot.
+func HashIndex(buf []byte, size int) int {
+	hash := fnv.New32()
+	_, _ = hash.Write(buf)
+	return int(hash.Sum32() % uint32(size))
+}
+
 func HashOneHot(buf []byte, size int) []float64 {
 	result := make([]float64, size)
-	hash := fnv.New32()
-	_, err := hash.Write(buf)
-	if err != nil {
-		return nil
-	}
-	result[int(hash.Sum32())%size] = 1
+	result[HashIndex(buf, size)] = 1
 	return result
 }
 
 func HashOneHot32(buf []byte, size int) []float32 {
 	result := make([]float32, size)
-	hash := fnv.New32()
-	_, err := hash.Write(buf)
-	if err != nil {
-		return nil
-	}
-	result[int(hash.Sum32())%size] = 1
+	result[HashIndex(buf, size)] = 1
 	return result
 }
 
@@ -0,0 +1,181 @@
+// Package store is an embedded offline feature store keeping timestamped
+// feature snapshots of users and items in SQLite.
+//
+// During training, features are got as of the Sample.Timestamp to avoid
+// leakage. During serving, the latest features are used.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	_ "github.com/mattn/go-sqlite3" //keep
+)
+
+const createTableSql = `create table if not exists feature_snapshot (
+	entity  integer not null,
+	id      integer not null,
+	ts      integer not null,
+	feature blob    not null,
+	primary key (entity, id, ts)
+)`
+
+// Snapshot is the feature of one entity since Timestamp.
+type Snapshot struct {
+	Id        int
+	Timestamp int64
+	Feature   rcmd.Tensor
+}
+
+// Store implements rcmd.UserFeaturer and rcmd.ItemFeaturer with point-in-time lookup.
+type Store struct {
+	DbPath string
+	db     *sql.DB
+	sync.Once
+}
+
+var (
+	_ rcmd.BasicFeatureProvider = &Store{}
+	_ rcmd.PointInTimeFeaturer  = &Store{}
+)
+
+// Open opens or creates the feature store at dbPath.
+func Open(dbPath string) (s *Store, err error) {
+	s = &Store{DbPath: dbPath}
+	if err = s.initDb(); err != nil {
+		s = nil
+	}
+	return
+}
+
+func (s *Store) initDb() (err error) {
+	s.Do(func() {
+		s.db, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?cache=shared", s.DbPath))
+		if err != nil {
+			return
+		}
+		// sqlite does not support concurrent writes
+		s.db.SetMaxOpenConns(1)
+		_, err = s.db.Exec(createTableSql)
+	})
+	return
+}
+
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Put saves the feature snapshot of entity id since ts.
+func (s *Store) Put(ctx context.Context, entity rcmd.EntityType, id int, ts int64, feature rcmd.Tensor) (err error) {
+	return s.PutBatch(ctx, entity, []Snapshot{{Id: id, Timestamp: ts, Feature: feature}})
+}
+
+// PutBatch saves snapshots of entity in one transaction.
+func (s *Store) PutBatch(ctx context.Context, entity rcmd.EntityType, snapshots []Snapshot) (err error) {
+	if err = s.initDb(); err != nil {
+		return
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx,
+		`insert or replace into feature_snapshot (entity, id, ts, feature) values (?, ?, ?, ?)`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	for _, snap := range snapshots {
+		if _, err = stmt.ExecContext(ctx, int(entity), snap.Id, snap.Timestamp, encode(snap.Feature)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// AsOf returns the latest feature of entity id with timestamp <= ts.
+func (s *Store) AsOf(ctx context.Context, entity rcmd.EntityType, id int, ts int64) (feature rcmd.Tensor, err error) {
+	return s.query(ctx, `select feature from feature_snapshot
+		where entity = ? and id = ? and ts <= ? order by ts desc limit 1`, entity, id, ts)
+}
+
+// Latest returns the latest feature of entity id.
+func (s *Store) Latest(ctx context.Context, entity rcmd.EntityType, id int) (feature rcmd.Tensor, err error) {
+	return s.query(ctx, `select feature from feature_snapshot
+		where entity = ? and id = ? order by ts desc limit 1`, entity, id)
+}
+
+func (s *Store) query(ctx context.Context, query string, entity rcmd.EntityType, args ...interface{},
+) (feature rcmd.Tensor, err error) {
+	if err = s.initDb(); err != nil {
+		return
+	}
+	var buf []byte
+	err = s.db.QueryRowContext(ctx, query, append([]interface{}{int(entity)}, args...)...).Scan(&buf)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%s %d not found", entity, args[0])
+		return
+	}
+	if err != nil {
+		return
+	}
+	return decode(buf)
+}
+
+// Get returns feature as of the sample timestamp in rcmd.TrainStage,
+// and the latest feature otherwise.
+func (s *Store) Get(ctx context.Context, entity rcmd.EntityType, id int) (feature rcmd.Tensor, err error) {
+	stage, _ := ctx.Value(rcmd.StageKey).(rcmd.Stage)
+	if ts, ok := rcmd.SampleTimestamp(ctx); ok && stage == rcmd.TrainStage {
+		return s.AsOf(ctx, entity, id, ts)
+	}
+	return s.Latest(ctx, entity, id)
+}
+
+func (s *Store) GetUserFeature(ctx context.Context, userId int) (rcmd.Tensor, error) {
+	return s.Get(ctx, rcmd.UserEntity, userId)
+}
+
+func (s *Store) GetItemFeature(ctx context.Context, itemId int) (rcmd.Tensor, error) {
+	return s.Get(ctx, rcmd.ItemEntity, itemId)
+}
+
+// PointInTime implements rcmd.PointInTimeFeaturer.
+func (s *Store) PointInTime() bool {
+	return true
+}
+
+func encode(feature rcmd.Tensor) []byte {
+	buf := make([]byte, 4*len(feature))
+	for i, v := range feature {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decode(buf []byte) (feature rcmd.Tensor, err error) {
+	if len(buf)%4 != 0 {
+		err = fmt.Errorf("invalid feature length %d", len(buf))
+		return
+	}
+	feature = make(rcmd.Tensor, len(buf)/4)
+	for i := range feature {
+		feature[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return
+}
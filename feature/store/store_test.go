@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "featurestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	Convey("put and get snapshots", t, func() {
+		So(s.PutBatch(ctx, rcmd.UserEntity, []Snapshot{
+			{Id: 1, Timestamp: 100, Feature: rcmd.Tensor{1, 100}},
+			{Id: 1, Timestamp: 200, Feature: rcmd.Tensor{1, 200}},
+			{Id: 2, Timestamp: 150, Feature: rcmd.Tensor{2, 150}},
+		}), ShouldBeNil)
+		So(s.Put(ctx, rcmd.ItemEntity, 1, 50, rcmd.Tensor{-1}), ShouldBeNil)
+
+		f, err := s.AsOf(ctx, rcmd.UserEntity, 1, 150)
+		So(err, ShouldBeNil)
+		So(f, ShouldResemble, rcmd.Tensor{1, 100})
+		f, err = s.AsOf(ctx, rcmd.UserEntity, 1, 200)
+		So(err, ShouldBeNil)
+		So(f, ShouldResemble, rcmd.Tensor{1, 200})
+		_, err = s.AsOf(ctx, rcmd.UserEntity, 1, 99)
+		So(err, ShouldNotBeNil)
+		f, err = s.Latest(ctx, rcmd.UserEntity, 1)
+		So(err, ShouldBeNil)
+		So(f, ShouldResemble, rcmd.Tensor{1, 200})
+
+		// item and user with the same id are different
+		f, err = s.GetItemFeature(ctx, 1)
+		So(err, ShouldBeNil)
+		So(f, ShouldResemble, rcmd.Tensor{-1})
+		_, err = s.GetItemFeature(ctx, 2)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("point in time lookup by stage", t, func() {
+		trainCtx := context.WithValue(ctx, rcmd.StageKey, rcmd.TrainStage)
+		predictCtx := context.WithValue(ctx, rcmd.StageKey, rcmd.PredictStage)
+		userCache := rcmd.NewMemoryFeatureCache(rcmd.UserCacheConfig)
+		itemCache := rcmd.NewMemoryFeatureCache(rcmd.ItemCacheConfig)
+		defer userCache.Close()
+		defer itemCache.Close()
+
+		vec, uWidth, _, err := rcmd.GetSampleVectorWithCaches(trainCtx, userCache, itemCache, s,
+			&rcmd.Sample{UserId: 1, ItemId: 1, Timestamp: 120})
+		So(err, ShouldBeNil)
+		So(uWidth, ShouldEqual, 2)
+		So(vec[:2], ShouldResemble, []float32{1, 100})
+
+		// not cached in train stage, the later sample gets the later snapshot
+		vec, _, _, err = rcmd.GetSampleVectorWithCaches(trainCtx, userCache, itemCache, s,
+			&rcmd.Sample{UserId: 1, ItemId: 1, Timestamp: 250})
+		So(err, ShouldBeNil)
+		So(vec[:2], ShouldResemble, []float32{1, 200})
+		So(userCache.ItemCount(), ShouldEqual, 0)
+
+		vec, _, _, err = rcmd.GetSampleVectorWithCaches(predictCtx, userCache, itemCache, s,
+			&rcmd.Sample{UserId: 1, ItemId: 1, Timestamp: 120})
+		So(err, ShouldBeNil)
+		So(vec[:2], ShouldResemble, []float32{1, 200})
+		So(userCache.ItemCount(), ShouldEqual, 1)
+	})
+}
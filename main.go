@@ -4,11 +4,19 @@ import (
 	"context"
 	"embed"
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
 
+	"github.com/auxten/go-ctr/config"
 	"github.com/auxten/go-ctr/example/movielens"
+	"github.com/auxten/go-ctr/feature/embedding/search"
+	"github.com/auxten/go-ctr/feature/embedding/search/console"
 	"github.com/auxten/go-ctr/model/mlp"
 	nn "github.com/auxten/go-ctr/nn/neural_network"
 	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/recommend/tablerec"
+	"github.com/auxten/go-ctr/schema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,6 +24,10 @@ import (
 var f embed.FS
 
 var verFlag = flag.Bool("v", false, "show binary version")
+var configFlag = flag.String("config", "", "recommender config file in YAML or JSON, see config.RecSysConfig")
+var profileFlag = flag.Bool("profile", false, "print config with column transforms proposed by profiling the tables of -config")
+var diagFlag = flag.Bool("diag", false, "open the search console of the item embeddings after training instead of the api, run :diag in it for the diagnostics")
+var diagCategoryFlag = flag.String("diagCategory", "", "item feature range START:END of one-hot categories for the purity of -diag, movielens genres are used if not set")
 
 var Version = "unknown-version"
 var Commit = "unknown-commit"
@@ -29,7 +41,7 @@ func main() {
 	}
 
 	var (
-		recSys = &movielens.MovielensRec{
+		recSys rcmd.RecSys = &movielens.MovielensRec{
 			DataPath:  "movielens.db",
 			SampleCnt: 80000,
 		}
@@ -39,6 +51,22 @@ func main() {
 	)
 	log.SetLevel(log.DebugLevel)
 
+	if *configFlag != "" {
+		var conf *config.RecSysConfig
+		if conf, err = config.LoadRecSysConfig(*configFlag); err != nil {
+			log.Fatal(err)
+		}
+		if *profileFlag {
+			if err = profileConfig(conf); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if recSys, err = tablerec.New(conf); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	fiter := nn.NewMLPClassifier(
 		[]int{100},
 		"relu", "adam", 1e-5,
@@ -53,5 +81,86 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *diagFlag {
+		if err = itemEmbeddingConsole(trainCtx, recSys); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	rcmd.StartHttpApi(model, "/api/v1/recommend", ":8080", &f)
 }
+
+// itemEmbeddingConsole opens the search console of the item embeddings, with the
+// item frequencies and categories for the diagnostics.
+func itemEmbeddingConsole(ctx context.Context, recSys rcmd.RecSys) (err error) {
+	searcher, err := rcmd.ItemEmbeddingSearcher()
+	if err != nil {
+		return
+	}
+	cons, err := console.New(searcher, search.DefaultDiagnosticsOptions.K)
+	if err != nil {
+		return
+	}
+	cons.Diagnostics.Frequency = rcmd.ItemEmbeddingFrequency()
+	ctx = context.WithValue(ctx, rcmd.StageKey, rcmd.TrainStage)
+	if cons.Diagnostics.Categories, err = itemCategories(ctx, recSys, searcher); err != nil {
+		cons.Close()
+		return
+	}
+	return cons.Run()
+}
+
+// itemCategories returns the genres of movielens, or the argmax of the one-hot
+// item feature range of -diagCategory for other recommenders.
+func itemCategories(ctx context.Context, recSys rcmd.RecSys, searcher *search.Searcher) (map[string][]string, error) {
+	if genres, ok := recSys.(interface {
+		ItemGenres(context.Context) (map[string][]string, error)
+	}); ok {
+		return genres.ItemGenres(ctx)
+	}
+	if *diagCategoryFlag == "" {
+		return nil, nil
+	}
+	var start, end int
+	if _, err := fmt.Sscanf(*diagCategoryFlag, "%d:%d", &start, &end); err != nil || start < 0 || end <= start {
+		return nil, fmt.Errorf("invalid -diagCategory %q, should be START:END", *diagCategoryFlag)
+	}
+	itemIds := make([]int, 0, len(searcher.Items))
+	for _, item := range searcher.Items {
+		if itemId, err := strconv.Atoi(item.Word); err == nil {
+			itemIds = append(itemIds, itemId)
+		}
+	}
+	return rcmd.ItemCategories(ctx, recSys, itemIds, func(feature rcmd.Tensor) []string {
+		if len(feature) < end {
+			return nil
+		}
+		best := start
+		for i := start + 1; i < end; i++ {
+			if feature[i] > feature[best] {
+				best = i
+			}
+		}
+		if feature[best] <= 0 {
+			return nil
+		}
+		return []string{strconv.Itoa(best - start)}
+	})
+}
+
+// profileConfig prints conf with the column transforms of user and item tables proposed.
+func profileConfig(conf *config.RecSysConfig) (err error) {
+	scanner, err := schema.NewScanner(conf.Db)
+	if err != nil {
+		return
+	}
+	if err = schema.DefaultProfiler.ProposeConfig(scanner, conf); err != nil {
+		return
+	}
+	data, err := conf.Marshal()
+	if err != nil {
+		return
+	}
+	_, err = os.Stdout.Write(data)
+	return
+}
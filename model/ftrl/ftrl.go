@@ -0,0 +1,402 @@
+// Package ftrl is the online logistic regression of FTRL-Proximal over hashed
+// sparse features, see "Ad Click Prediction: a View from the Trenches".
+package ftrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/auxten/go-ctr/feature"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gorgonia.org/tensor"
+)
+
+// nStripes is the number of locks of the weights, weight i is locked by i % nStripes
+const nStripes = 64
+
+// Feature is a sparse feature of a sample, hashed by Name
+type Feature struct {
+	Name  string
+	Value float32
+}
+
+// Categorical returns the one hot feature of value of the categorical feature name.
+func Categorical(name, value string) Feature {
+	return Feature{Name: name + "=" + value, Value: 1}
+}
+
+// Sample is an impression of the stream, Label is 1 if clicked
+type Sample struct {
+	Features []Feature
+	Label    float32
+}
+
+// ColumnName is the feature name of column j of TrainSample and tensors of Predict.
+func ColumnName(j int) string {
+	return strconv.Itoa(j)
+}
+
+// Samples returns the samples of the rows of trainSample, zero columns are skipped.
+func Samples(trainSample *rcmd.TrainSample) []Sample {
+	samples := make([]Sample, trainSample.Rows)
+	for i := range samples {
+		samples[i] = vectorSample(trainSample.X[i*trainSample.XCols:(i+1)*trainSample.XCols], trainSample.Y[i])
+	}
+	return samples
+}
+
+// vectorSample returns the sample of the feature vector vec, column j is the
+// feature named ColumnName(j), zero columns are skipped.
+func vectorSample(vec []float32, label float32) (sample Sample) {
+	for j, v := range vec {
+		if v != 0 {
+			sample.Features = append(sample.Features, Feature{Name: ColumnName(j), Value: v})
+		}
+	}
+	sample.Label = label
+	return
+}
+
+// FTRL is a logistic regression updated by PartialFit. PartialFit, Predict and
+// Snapshot are safe for concurrent use, the hyperparameters must be set before.
+type FTRL struct {
+	// Alpha and Beta are the per-coordinate learning rate alpha / (beta + sqrt(n))
+	Alpha float64
+	Beta  float64
+	// L1 and L2 are the regularization strengths, L1 makes the weights sparse
+	L1 float64
+	L2 float64
+	// Size is the number of hash buckets of the features
+	Size int
+
+	// z and n of the Size buckets and the bias at Size
+	z, n    []float64
+	stripes [nStripes]sync.Mutex
+	once    sync.Once
+	// samples is the number of samples fitted
+	samples int64
+}
+
+// NewFTRL returns FTRL with size hash buckets and the default hyperparameters.
+func NewFTRL(size int) *FTRL {
+	return &FTRL{Alpha: 0.1, Beta: 1, L1: 1, L2: 1, Size: size}
+}
+
+func (m *FTRL) validate() error {
+	if m.Size <= 0 {
+		return fmt.Errorf("size must be > 0, got %d", m.Size)
+	}
+	if m.Alpha <= 0 || m.Beta < 0 || m.L1 < 0 || m.L2 < 0 {
+		return fmt.Errorf("alpha must be > 0, beta, l1 and l2 >= 0, got %g, %g, %g, %g", m.Alpha, m.Beta, m.L1, m.L2)
+	}
+	return nil
+}
+
+func (m *FTRL) init() {
+	m.once.Do(func() {
+		if m.z == nil {
+			m.z = make([]float64, m.Size+1)
+			m.n = make([]float64, m.Size+1)
+		}
+	})
+}
+
+// index returns the hash bucket of feature name.
+func (m *FTRL) index(name string) int {
+	return feature.HashIndex([]byte(name), m.Size)
+}
+
+// weight returns the weight of i from z and n, i must be locked. The bias at
+// Size is not regularized.
+func (m *FTRL) weight(i int) float64 {
+	z := m.z[i]
+	if i == m.Size {
+		return -z / ((m.Beta + math.Sqrt(m.n[i])) / m.Alpha)
+	}
+	if math.Abs(z) <= m.L1 {
+		return 0
+	}
+	sign := 1.
+	if z < 0 {
+		sign = -1
+	}
+	return -(z - sign*m.L1) / ((m.Beta+math.Sqrt(m.n[i]))/m.Alpha + m.L2)
+}
+
+// lockedWeight returns the weight of i.
+func (m *FTRL) lockedWeight(i int) float64 {
+	mu := &m.stripes[i%nStripes]
+	mu.Lock()
+	defer mu.Unlock()
+	return m.weight(i)
+}
+
+// update updates z and n of i with the gradient g.
+func (m *FTRL) update(i int, g float64) {
+	mu := &m.stripes[i%nStripes]
+	mu.Lock()
+	defer mu.Unlock()
+	w := m.weight(i)
+	sigma := (math.Sqrt(m.n[i]+g*g) - math.Sqrt(m.n[i])) / m.Alpha
+	m.z[i] += g - sigma*w
+	m.n[i] += g * g
+}
+
+// predict returns the probability of the hashed features.
+func (m *FTRL) predict(indexes []int, values []float32) float64 {
+	logit := m.lockedWeight(m.Size)
+	for k, i := range indexes {
+		logit += m.lockedWeight(i) * float64(values[k])
+	}
+	// avoid the overflow of exp
+	logit = math.Max(math.Min(logit, 35), -35)
+	return 1 / (1 + math.Exp(-logit))
+}
+
+// PartialFit updates the model with each of samples, and returns the mean log
+// loss of the predictions before the updates, the progressive validation loss.
+func (m *FTRL) PartialFit(samples []Sample) (loss float64, err error) {
+	if err = m.validate(); err != nil {
+		return
+	}
+	for i, sample := range samples {
+		if sample.Label != 0 && sample.Label != 1 {
+			return 0, fmt.Errorf("label of sample %d must be 0 or 1, got %g", i, sample.Label)
+		}
+	}
+	if len(samples) == 0 {
+		return
+	}
+	m.init()
+	var (
+		indexes []int
+		values  []float32
+	)
+	for _, sample := range samples {
+		indexes, values = indexes[:0], values[:0]
+		for _, f := range sample.Features {
+			if f.Value != 0 {
+				indexes = append(indexes, m.index(f.Name))
+				values = append(values, f.Value)
+			}
+		}
+		p := m.predict(indexes, values)
+		y := float64(sample.Label)
+		loss -= y*math.Log(p) + (1-y)*math.Log(1-p)
+
+		g := p - y
+		m.update(m.Size, g)
+		for k, i := range indexes {
+			m.update(i, g*float64(values[k]))
+		}
+	}
+	m.stripes[0].Lock()
+	m.samples += int64(len(samples))
+	m.stripes[0].Unlock()
+	return loss / float64(len(samples)), nil
+}
+
+// PredictSamples returns the click probabilities of samples.
+func (m *FTRL) PredictSamples(samples []Sample) []float64 {
+	if m.validate() != nil {
+		return nil
+	}
+	m.init()
+	y := make([]float64, len(samples))
+	var (
+		indexes []int
+		values  []float32
+	)
+	for s, sample := range samples {
+		indexes, values = indexes[:0], values[:0]
+		for _, f := range sample.Features {
+			indexes = append(indexes, m.index(f.Name))
+			values = append(values, f.Value)
+		}
+		y[s] = m.predict(indexes, values)
+	}
+	return y
+}
+
+// Predict returns the click probabilities of the rows of X, column j is the
+// feature named ColumnName(j).
+func (m *FTRL) Predict(X tensor.Tensor) tensor.Tensor {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	x, ok := X.Data().([]float32)
+	if !ok || len(x) != rows*cols {
+		// views or other types are materialized
+		x = make([]float32, rows*cols)
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				val, err := X.At(i, j)
+				if err != nil {
+					return nil
+				}
+				if x[i*cols+j], ok = val.(float32); !ok {
+					return nil
+				}
+			}
+		}
+	}
+	if m.validate() != nil {
+		return nil
+	}
+	m.init()
+	columns := make([]int, cols)
+	for j := range columns {
+		columns[j] = m.index(ColumnName(j))
+	}
+	y := make([]float32, rows)
+	var (
+		indexes []int
+		values  []float32
+	)
+	for i := range y {
+		indexes, values = indexes[:0], values[:0]
+		for j, v := range x[i*cols : (i+1)*cols] {
+			if v != 0 {
+				indexes = append(indexes, columns[j])
+				values = append(values, v)
+			}
+		}
+		y[i] = float32(m.predict(indexes, values))
+	}
+	return tensor.NewDense(tensor.Float32, tensor.Shape{rows, 1}, tensor.WithBacking(y))
+}
+
+// lockAll locks all the stripes in order, see unlockAll.
+func (m *FTRL) lockAll() {
+	for i := range m.stripes {
+		m.stripes[i].Lock()
+	}
+}
+
+func (m *FTRL) unlockAll() {
+	for i := len(m.stripes) - 1; i >= 0; i-- {
+		m.stripes[i].Unlock()
+	}
+}
+
+// Snapshot returns a copy of the model at a point of time, for serving or
+// saving while m keeps on learning. The samples being fitted may be partially
+// in the copy.
+func (m *FTRL) Snapshot() *FTRL {
+	m.init()
+	m.lockAll()
+	defer m.unlockAll()
+	snapshot := &FTRL{Alpha: m.Alpha, Beta: m.Beta, L1: m.L1, L2: m.L2, Size: m.Size, samples: m.samples}
+	snapshot.z = append([]float64(nil), m.z...)
+	snapshot.n = append([]float64(nil), m.n...)
+	return snapshot
+}
+
+// Samples returns the number of samples fitted.
+func (m *FTRL) Samples() int64 {
+	m.stripes[0].Lock()
+	defer m.stripes[0].Unlock()
+	return m.samples
+}
+
+// Weights returns the weights of the hash buckets and the bias, most of them
+// are 0 with L1.
+func (m *FTRL) Weights() (weights []float64, bias float64) {
+	snapshot := m.Snapshot()
+	weights = make([]float64, m.Size)
+	for i := range weights {
+		weights[i] = snapshot.weight(i)
+	}
+	return weights, snapshot.weight(m.Size)
+}
+
+// ftrlJson is the json of FTRL, only the buckets updated are kept.
+type ftrlJson struct {
+	Alpha   float64   `json:"alpha"`
+	Beta    float64   `json:"beta"`
+	L1      float64   `json:"l1"`
+	L2      float64   `json:"l2"`
+	Size    int       `json:"size"`
+	Samples int64     `json:"samples"`
+	Index   []int     `json:"index"`
+	Z       []float64 `json:"z"`
+	N       []float64 `json:"n"`
+}
+
+// Marshal returns the json of a snapshot of the model, the state of the
+// optimizer is kept so the model restored by NewFTRLFromJson keeps on learning.
+func (m *FTRL) Marshal() (data []byte, err error) {
+	snapshot := m.Snapshot()
+	j := ftrlJson{
+		Alpha:   snapshot.Alpha,
+		Beta:    snapshot.Beta,
+		L1:      snapshot.L1,
+		L2:      snapshot.L2,
+		Size:    snapshot.Size,
+		Samples: snapshot.samples,
+	}
+	for i, n := range snapshot.n {
+		if n != 0 {
+			j.Index = append(j.Index, i)
+			j.Z = append(j.Z, snapshot.z[i])
+			j.N = append(j.N, n)
+		}
+	}
+	return json.Marshal(j)
+}
+
+// NewFTRLFromJson restores the FTRL marshaled.
+func NewFTRLFromJson(data []byte) (m *FTRL, err error) {
+	var j ftrlJson
+	if err = json.Unmarshal(data, &j); err != nil {
+		return
+	}
+	m = &FTRL{Alpha: j.Alpha, Beta: j.Beta, L1: j.L1, L2: j.L2, Size: j.Size, samples: j.Samples}
+	if err = m.validate(); err != nil {
+		return nil, err
+	}
+	if len(j.Z) != len(j.Index) || len(j.N) != len(j.Index) {
+		return nil, fmt.Errorf("%d indexes with %d z and %d n", len(j.Index), len(j.Z), len(j.N))
+	}
+	m.init()
+	for k, i := range j.Index {
+		if i < 0 || i > m.Size {
+			return nil, fmt.Errorf("index %d out of %d buckets", i, m.Size)
+		}
+		if j.N[k] < 0 {
+			return nil, fmt.Errorf("n of index %d must be >= 0, got %g", i, j.N[k])
+		}
+		m.z[i], m.n[i] = j.Z[k], j.N[k]
+	}
+	return
+}
+
+// FTRLFitWrap fits Model with the rows of TrainSample for Epochs passes, the
+// model is updated in place so it could keep on learning with PartialFit.
+type FTRLFitWrap struct {
+	Model *FTRL
+	// Epochs is 1 if 0
+	Epochs int
+}
+
+func (fit *FTRLFitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	if fit.Model == nil {
+		return nil, fmt.Errorf("nil ftrl model")
+	}
+	if len(trainSample.X) != trainSample.Rows*trainSample.XCols || len(trainSample.Y) != trainSample.Rows {
+		return nil, fmt.Errorf("sample of %d rows has %d features and %d labels",
+			trainSample.Rows, len(trainSample.X), len(trainSample.Y))
+	}
+	epochs := fit.Epochs
+	if epochs == 0 {
+		epochs = 1
+	}
+	samples := Samples(trainSample)
+	for epoch := 0; epoch < epochs; epoch++ {
+		if _, err := fit.Model.PartialFit(samples); err != nil {
+			return nil, err
+		}
+	}
+	return fit.Model, nil
+}
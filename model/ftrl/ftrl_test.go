@@ -0,0 +1,211 @@
+package ftrl
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/recommend/sampletest"
+	"github.com/auxten/go-ctr/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// clickStream returns impressions of 10 users and 20 items, the first 5 items
+// are clicked 90% of the time and the others 10%.
+func clickStream(n int, seed int64) []Sample {
+	rnd := rand.New(rand.NewSource(seed))
+	samples := make([]Sample, n)
+	for i := range samples {
+		item := rnd.Intn(20)
+		samples[i].Features = []Feature{
+			Categorical("user", fmt.Sprint(rnd.Intn(10))),
+			Categorical("item", fmt.Sprint(item)),
+		}
+		clicked := item < 5
+		if rnd.Float64() < 0.1 {
+			clicked = !clicked
+		}
+		if clicked {
+			samples[i].Label = 1
+		}
+	}
+	return samples
+}
+
+func auc(m *FTRL, samples []Sample) float32 {
+	y := m.PredictSamples(samples)
+	pred, labels := make([]float32, len(y)), make([]float32, len(y))
+	for i, v := range y {
+		pred[i], labels[i] = float32(v), samples[i].Label
+	}
+	return utils.RocAuc32(pred, labels)
+}
+
+// clickSample is the dense TrainSample of a click stream, columns 0 to 9 are
+// the one hot users and 10 to 29 the one hot items, the first 5 items are
+// clicked 90% of the time and the others 10%.
+func clickSample(rows int, seed int64) *rcmd.TrainSample {
+	return sampletest.New(rows, 30, seed, func(rnd *rand.Rand, x []float32) bool {
+		item := rnd.Intn(20)
+		x[rnd.Intn(10)] = 1
+		x[10+item] = 1
+		return (item < 5) != (rnd.Float64() < 0.1)
+	})
+}
+
+func TestFTRL(t *testing.T) {
+	Convey("learn from the stream", t, func() {
+		m := NewFTRL(1 << 10)
+		stream := clickStream(5000, 1)
+		var losses []float64
+		for i := 0; i < len(stream); i += 500 {
+			loss, err := m.PartialFit(stream[i : i+500])
+			So(err, ShouldBeNil)
+			losses = append(losses, loss)
+		}
+		So(losses[len(losses)-1], ShouldBeLessThan, losses[0])
+		So(m.Samples(), ShouldEqual, 5000)
+		So(auc(m, clickStream(1000, 2)), ShouldBeGreaterThan, 0.85)
+		for _, p := range m.PredictSamples(clickStream(100, 3)) {
+			So(p, ShouldBeBetween, 0, 1)
+		}
+	})
+
+	Convey("l1 makes the weights sparse", t, func() {
+		dense, sparse := NewFTRL(1<<10), NewFTRL(1<<10)
+		dense.L1 = 0
+		sparse.L1 = 10
+		stream := clickStream(2000, 1)
+		// noise features of each impression
+		rnd := rand.New(rand.NewSource(1))
+		for i := range stream {
+			stream[i].Features = append(stream[i].Features, Categorical("noise", fmt.Sprint(rnd.Intn(500))))
+		}
+		_, err := dense.PartialFit(stream)
+		So(err, ShouldBeNil)
+		_, err = sparse.PartialFit(stream)
+		So(err, ShouldBeNil)
+		nonZero := func(m *FTRL) (count int) {
+			weights, _ := m.Weights()
+			for _, w := range weights {
+				if w != 0 {
+					count++
+				}
+			}
+			return
+		}
+		So(nonZero(sparse), ShouldBeLessThan, nonZero(dense)/4)
+		So(auc(sparse, clickStream(1000, 2)), ShouldBeGreaterThan, 0.85)
+	})
+
+	Convey("the bias is not regularized", t, func() {
+		m := NewFTRL(1 << 10)
+		m.L1, m.L2 = 1e3, 1e3
+		stream := clickStream(1000, 1)
+		for i := range stream {
+			stream[i].Label = 1
+		}
+		_, err := m.PartialFit(stream)
+		So(err, ShouldBeNil)
+		weights, bias := m.Weights()
+		So(weights, ShouldNotContain, 1.)
+		So(bias, ShouldBeGreaterThan, 1)
+		for _, p := range m.PredictSamples(clickStream(100, 3)) {
+			So(p, ShouldBeGreaterThan, 0.7)
+		}
+	})
+
+	Convey("concurrent updates and snapshots", t, func() {
+		m := NewFTRL(1 << 10)
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(seed int64) {
+				defer wg.Done()
+				stream := clickStream(2000, seed)
+				for i := 0; i < len(stream); i += 100 {
+					if _, err := m.PartialFit(stream[i : i+100]); err != nil {
+						panic(err)
+					}
+					m.Snapshot()
+				}
+			}(int64(g + 10))
+		}
+		wg.Wait()
+		So(m.Samples(), ShouldEqual, 8000)
+		So(auc(m, clickStream(1000, 2)), ShouldBeGreaterThan, 0.85)
+
+		test := clickStream(100, 3)
+		snapshot := m.Snapshot()
+		before := snapshot.PredictSamples(test)
+		So(before, ShouldResemble, m.PredictSamples(test))
+		_, err := m.PartialFit(clickStream(1000, 4))
+		So(err, ShouldBeNil)
+		So(snapshot.PredictSamples(test), ShouldResemble, before)
+		So(m.PredictSamples(test), ShouldNotResemble, before)
+	})
+
+	Convey("marshal and keep on learning", t, func() {
+		m := NewFTRL(1 << 10)
+		_, err := m.PartialFit(clickStream(1000, 1))
+		So(err, ShouldBeNil)
+		data, err := m.Marshal()
+		So(err, ShouldBeNil)
+		restored, err := NewFTRLFromJson(data)
+		So(err, ShouldBeNil)
+		test := clickStream(100, 3)
+		So(restored.PredictSamples(test), ShouldResemble, m.PredictSamples(test))
+		So(restored.Samples(), ShouldEqual, 1000)
+
+		stream := clickStream(1000, 2)
+		_, err = m.PartialFit(stream)
+		So(err, ShouldBeNil)
+		_, err = restored.PartialFit(stream)
+		So(err, ShouldBeNil)
+		So(restored.PredictSamples(test), ShouldResemble, m.PredictSamples(test))
+	})
+
+	Convey("fit and predict TrainSample", t, func() {
+		sample := clickSample(2000, 1)
+		model := NewFTRL(1 << 10)
+		pred, err := (&FTRLFitWrap{Model: model, Epochs: 2}).Fit(sample)
+		So(err, ShouldBeNil)
+		So(model.Samples(), ShouldEqual, 4000)
+
+		x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+		y := pred.Predict(x).Data().([]float32)
+		So(y, ShouldHaveLength, sample.Rows)
+		So(utils.RocAuc32(y, sample.Y), ShouldBeGreaterThan, 0.85)
+		for i, p := range model.PredictSamples(Samples(sample)) {
+			So(y[i], ShouldEqual, float32(p))
+		}
+	})
+
+	Convey("invalid params, labels and json", t, func() {
+		_, err := NewFTRL(0).PartialFit(clickStream(10, 1))
+		So(err, ShouldNotBeNil)
+		m := NewFTRL(16)
+		m.Alpha = 0
+		_, err = m.PartialFit(clickStream(10, 1))
+		So(err, ShouldNotBeNil)
+
+		stream := clickStream(10, 1)
+		stream[3].Label = 2
+		_, err = NewFTRL(16).PartialFit(stream)
+		So(err, ShouldNotBeNil)
+		_, err = (&FTRLFitWrap{}).Fit(clickSample(10, 1))
+		So(err, ShouldNotBeNil)
+
+		_, err = NewFTRLFromJson([]byte("{"))
+		So(err, ShouldNotBeNil)
+		_, err = NewFTRLFromJson([]byte(`{"alpha": 0.1, "size": 0}`))
+		So(err, ShouldNotBeNil)
+		_, err = NewFTRLFromJson([]byte(`{"alpha": 0.1, "size": 4, "index": [5], "z": [1], "n": [1]}`))
+		So(err, ShouldNotBeNil)
+		_, err = NewFTRLFromJson([]byte(`{"alpha": 0.1, "size": 4, "index": [1], "z": [1]}`))
+		So(err, ShouldNotBeNil)
+	})
+}
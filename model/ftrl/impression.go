@@ -0,0 +1,61 @@
+package ftrl
+
+import (
+	"context"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	log "github.com/sirupsen/logrus"
+)
+
+// ImpressionSamples returns the samples of the feature vectors logged in imp
+// labeled by labeler, the samples not labeled yet are skipped. The columns are
+// named as Samples, so the model predicts the served vectors with Predict.
+func ImpressionSamples(ctx context.Context, imp *rcmd.Impression, labeler rcmd.ImpressionLabeler) (samples []Sample, err error) {
+	for i, s := range imp.Samples {
+		if i >= len(imp.Vectors) || len(imp.Vectors[i]) == 0 {
+			continue
+		}
+		label, ok, err := labeler.GetLabel(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			samples = append(samples, vectorSample(imp.Vectors[i], label))
+		}
+	}
+	return
+}
+
+// JoinImpressions streams the samples of the impressions logged under the Dir
+// of joiner labeled by its Labeler, in written order for PartialFit. Like
+// joiner.TrainSample, the impressions failed to be labeled are skipped.
+func JoinImpressions(ctx context.Context, joiner *rcmd.ImpressionJoiner) (ret <-chan Sample, err error) {
+	files, err := rcmd.ImpressionFiles(joiner.Dir, joiner.Prefix)
+	if err != nil {
+		return
+	}
+	impCh, err := rcmd.ReadImpressions(ctx, files)
+	if err != nil {
+		return
+	}
+	ch := make(chan Sample, 1000)
+	go func() {
+		defer close(ch)
+		for imp := range impCh {
+			samples, er := ImpressionSamples(ctx, imp, joiner.Labeler)
+			if er != nil {
+				log.Errorf("label impression %s error: %v", imp.RequestId, er)
+				continue
+			}
+			for _, s := range samples {
+				select {
+				case ch <- s:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	ret = ch
+	return
+}
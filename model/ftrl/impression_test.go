@@ -0,0 +1,105 @@
+package ftrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// itemLabeler labels the impressions of the items, the last item is not
+// labeled yet.
+type itemLabeler map[int]float32
+
+func (l itemLabeler) GetLabel(_ context.Context, sample rcmd.Sample) (float32, bool, error) {
+	if sample.ItemId == 19 {
+		return 0, false, nil
+	}
+	label, ok := l[sample.ItemId]
+	if !ok {
+		return 0, false, errors.New("unknown item")
+	}
+	return label, true, nil
+}
+
+// logClicks logs the rows of sample as impressions of size rows, the ItemId of
+// a row is its item column.
+func logClicks(logger rcmd.ImpressionLogger, sample *rcmd.TrainSample, size int) (labeler itemLabeler, err error) {
+	labeler = make(itemLabeler)
+	for start := 0; start < sample.Rows; start += size {
+		imp := &rcmd.Impression{RequestId: fmt.Sprint(start)}
+		for i := start; i < start+size && i < sample.Rows; i++ {
+			vec := sample.X[i*sample.XCols : (i+1)*sample.XCols]
+			item := 0
+			for vec[10+item] == 0 {
+				item++
+			}
+			// the noisy labels of the sample are replaced by the rule
+			labeler[item] = 0
+			if item < 5 {
+				labeler[item] = 1
+			}
+			imp.Samples = append(imp.Samples, rcmd.Sample{UserId: i, ItemId: item})
+			imp.Vectors = append(imp.Vectors, vec)
+		}
+		if err = logger.LogImpression(context.Background(), imp); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func TestJoinImpressions(t *testing.T) {
+	Convey("learn from the joined impressions", t, func() {
+		dir, err := os.MkdirTemp("", "impression")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		logger, err := rcmd.NewFileImpressionLogger(dir, "imp", 0)
+		So(err, ShouldBeNil)
+		sample := clickSample(2000, 1)
+		labeler, err := logClicks(logger, sample, 100)
+		So(err, ShouldBeNil)
+		So(logger.Close(), ShouldBeNil)
+
+		ch, err := JoinImpressions(context.Background(), &rcmd.ImpressionJoiner{Dir: dir, Prefix: "imp", Labeler: labeler})
+		So(err, ShouldBeNil)
+		var samples []Sample
+		for s := range ch {
+			samples = append(samples, s)
+		}
+		labeled := 0
+		for i := 0; i < sample.Rows; i++ {
+			if sample.X[i*sample.XCols+10+19] == 0 {
+				labeled++
+			}
+		}
+		So(samples, ShouldHaveLength, labeled)
+		So(samples[0].Features, ShouldResemble, Samples(sample)[0].Features)
+
+		m := NewFTRL(1 << 10)
+		_, err = m.PartialFit(samples)
+		So(err, ShouldBeNil)
+		test := clickSample(1000, 2)
+		x := tensor.New(tensor.WithShape(test.Rows, test.XCols), tensor.WithBacking(test.X))
+		So(utils.RocAuc32(m.Predict(x).Data().([]float32), test.Y), ShouldBeGreaterThan, 0.8)
+	})
+
+	Convey("labeler errors", t, func() {
+		sample := clickSample(10, 1)
+		imp := &rcmd.Impression{
+			Samples: []rcmd.Sample{{ItemId: 0}},
+			Vectors: [][]float32{sample.X[:sample.XCols]},
+		}
+		_, err := ImpressionSamples(context.Background(), imp, itemLabeler{})
+		So(err, ShouldNotBeNil)
+		samples, err := ImpressionSamples(context.Background(), imp, itemLabeler{0: 1})
+		So(err, ShouldBeNil)
+		So(samples, ShouldResemble, []Sample{vectorSample(imp.Vectors[0], 1)})
+	})
+}
@@ -0,0 +1,110 @@
+package gbdt
+
+import (
+	"fmt"
+
+	"github.com/auxten/go-ctr/nn/tree"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gonum.org/v1/gonum/mat"
+	"gorgonia.org/tensor"
+)
+
+// toDense converts the float32 tensor X of shape (rows, cols) to float64 mat.Dense.
+func toDense(X tensor.Tensor) (*mat.Dense, error) {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	x64 := make([]float64, rows*cols)
+	if x, ok := X.Data().([]float32); ok && len(x) == len(x64) {
+		for i, v := range x {
+			x64[i] = float64(v)
+		}
+		return mat.NewDense(rows, cols, x64), nil
+	}
+	// views or other types are materialized
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			val, err := X.At(i, j)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := val.(float32)
+			if !ok {
+				return nil, fmt.Errorf("tensor must be float32, got %T", val)
+			}
+			x64[i*cols+j] = float64(v)
+		}
+	}
+	return mat.NewDense(rows, cols, x64), nil
+}
+
+// GBDTPredWrap predicts the probabilities of binary_log_loss, or the values of
+// square_loss, of the fitted GBDT.
+type GBDTPredWrap struct {
+	model *tree.GBDT
+}
+
+func (p *GBDTPredWrap) Predict(X tensor.Tensor) tensor.Tensor {
+	x, err := toDense(X)
+	if err != nil {
+		return nil
+	}
+	numPred, _ := x.Dims()
+	y64 := p.model.PredictProbas(x, nil).RawMatrix().Data
+	y := make([]float32, numPred)
+	for i, v := range y64 {
+		y[i] = float32(v)
+	}
+	return tensor.NewDense(tensor.Float32, tensor.Shape{numPred, 1}, tensor.WithBacking(y))
+}
+
+// FeatureImportances returns the importances of the features of TrainSample,
+// see tree.GBDT.FeatureImportances.
+func (p *GBDTPredWrap) FeatureImportances(importanceType string) []float64 {
+	return p.model.FeatureImportances(importanceType)
+}
+
+// Marshal returns the json of the fitted GBDT, see NewGBDTPredWrapFromJson.
+func (p *GBDTPredWrap) Marshal() (data []byte, err error) {
+	return p.model.Marshal()
+}
+
+// NewGBDTPredWrapFromJson restores the GBDTPredWrap marshaled.
+func NewGBDTPredWrapFromJson(data []byte) (p *GBDTPredWrap, err error) {
+	model := &tree.GBDT{}
+	if err = model.Unmarshal(data); err != nil {
+		return
+	}
+	return &GBDTPredWrap{
+		model: model,
+	}, nil
+}
+
+// GBDTFitWrap fits Model with TrainSample, labels of binary_log_loss must be 0 or 1.
+type GBDTFitWrap struct {
+	Model *tree.GBDT
+}
+
+func (fit *GBDTFitWrap) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	if len(trainSample.X) != trainSample.Rows*trainSample.XCols || len(trainSample.Y) != trainSample.Rows {
+		return nil, fmt.Errorf("sample of %d rows has %d features and %d labels",
+			trainSample.Rows, len(trainSample.X), len(trainSample.Y))
+	}
+	x := tensor.New(tensor.WithShape(trainSample.Rows, trainSample.XCols), tensor.WithBacking(trainSample.X))
+	xDense, err := toDense(x)
+	if err != nil {
+		return
+	}
+	yDense := mat.NewDense(trainSample.Rows, 1, nil)
+	for i, label := range trainSample.Y {
+		yDense.Set(i, 0, float64(label))
+	}
+	// invalid hyperparameters and labels panic in Fit
+	defer func() {
+		if r := recover(); r != nil {
+			pred, err = nil, fmt.Errorf("fit gbdt: %v", r)
+		}
+	}()
+	fit.Model.Fit(xDense, yDense)
+	return &GBDTPredWrap{
+		model: fit.Model,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package gbdt
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"github.com/auxten/go-ctr/nn/tree"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/recommend/sampletest"
+	"github.com/auxten/go-ctr/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// boxSample is labeled 1 if the first 2 columns are both in (-0.5, 0.5), an
+// interaction trees split on but a linear model can't learn, the third column
+// is noise.
+func boxSample(rows int, seed int64) *rcmd.TrainSample {
+	return sampletest.Uniform(rows, 3, seed, -1, 1, func(x []float32) bool {
+		return x[0] > -0.5 && x[0] < 0.5 && x[1] > -0.5 && x[1] < 0.5
+	})
+}
+
+func TestGBDTFitWrap(t *testing.T) {
+	Convey("fit, predict and marshal", t, func() {
+		sample := boxSample(1000, 1)
+		model := tree.NewGBDT("binary_log_loss")
+		model.RandomState = base.NewLockedSource(7)
+		pred, err := (&GBDTFitWrap{Model: model}).Fit(sample)
+		So(err, ShouldBeNil)
+
+		x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+		y := pred.Predict(x).Data().([]float32)
+		So(y, ShouldHaveLength, sample.Rows)
+		So(utils.RocAuc32(y, sample.Y), ShouldBeGreaterThan, 0.99)
+		for _, v := range y {
+			So(v, ShouldBeBetween, 0, 1)
+		}
+
+		importances := pred.(*GBDTPredWrap).FeatureImportances("gain")
+		So(importances[2], ShouldBeLessThan, importances[0])
+		So(importances[2], ShouldBeLessThan, importances[1])
+
+		data, err := pred.(*GBDTPredWrap).Marshal()
+		So(err, ShouldBeNil)
+		restored, err := NewGBDTPredWrapFromJson(data)
+		So(err, ShouldBeNil)
+		So(restored.Predict(x).Data().([]float32), ShouldResemble, y)
+
+		// views are materialized
+		view, err := x.Slice(tensor.S(0, 10))
+		So(err, ShouldBeNil)
+		So(restored.Predict(view).Data().([]float32), ShouldResemble, y[:10])
+	})
+
+	Convey("invalid sample and json", t, func() {
+		sample := boxSample(100, 1)
+		sample.Y[0] = 2
+		_, err := (&GBDTFitWrap{Model: tree.NewGBDT("binary_log_loss")}).Fit(sample)
+		So(err, ShouldNotBeNil)
+		sample.Rows = 99
+		_, err = (&GBDTFitWrap{Model: tree.NewGBDT("binary_log_loss")}).Fit(sample)
+		So(err, ShouldNotBeNil)
+
+		_, err = NewGBDTPredWrapFromJson([]byte("{"))
+		So(err, ShouldNotBeNil)
+	})
+}
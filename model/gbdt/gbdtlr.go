@@ -0,0 +1,207 @@
+package gbdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/auxten/go-ctr/nn/tree"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gonum.org/v1/gonum/mat"
+	"gorgonia.org/tensor"
+)
+
+// leafLR is the logistic regression on the one-hot leaves of the trees, the
+// weight of leaf l of tree t is Weights[Offsets[t]+l].
+type leafLR struct {
+	Offsets   []int     `json:"offsets"`
+	Weights   []float64 `json:"weights"`
+	Intercept float64   `json:"intercept"`
+}
+
+func newLeafLR(trees []*tree.Tree) *leafLR {
+	lr := &leafLR{Offsets: make([]int, len(trees))}
+	n := 0
+	for t, tr := range trees {
+		lr.Offsets[t] = n
+		n += tr.NLeaves
+	}
+	lr.Weights = make([]float64, n)
+	return lr
+}
+
+func (lr *leafLR) logit(leaves []int) float64 {
+	z := lr.Intercept
+	for t, leaf := range leaves {
+		z += lr.Weights[lr.Offsets[t]+leaf]
+	}
+	return z
+}
+
+// fit trains the weights with adagrad on the leaves of rows and labels y.
+func (lr *leafLR) fit(leaves [][]int, y []float64, fit *GBDTLRFitWrap) {
+	epochs, learningRate := fit.Epochs, fit.LearningRate
+	if epochs == 0 {
+		epochs = 10
+	}
+	if learningRate == 0 {
+		learningRate = 0.1
+	}
+	const epsilon = 1e-8
+	sqGrads := make([]float64, len(lr.Weights))
+	var interceptSqGrad float64
+	order := make([]int, len(leaves))
+	for i := range order {
+		order[i] = i
+	}
+	rnd := rand.New(rand.NewSource(fit.Seed))
+	for epoch := 0; epoch < epochs; epoch++ {
+		rnd.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for _, i := range order {
+			g := 1/(1+math.Exp(-lr.logit(leaves[i]))) - y[i]
+			for t, leaf := range leaves[i] {
+				k := lr.Offsets[t] + leaf
+				gk := g + fit.L2*lr.Weights[k]
+				sqGrads[k] += gk * gk
+				lr.Weights[k] -= learningRate * gk / (math.Sqrt(sqGrads[k]) + epsilon)
+			}
+			interceptSqGrad += g * g
+			lr.Intercept -= learningRate * g / (math.Sqrt(interceptSqGrad) + epsilon)
+		}
+	}
+}
+
+// GBDTLRPredWrap predicts the probabilities of the logistic regression on the
+// one-hot encoded leaves of the GBDT.
+type GBDTLRPredWrap struct {
+	trees *tree.GBDT
+	lr    *leafLR
+}
+
+func (p *GBDTLRPredWrap) Predict(X tensor.Tensor) tensor.Tensor {
+	x, err := toDense(X)
+	if err != nil {
+		return nil
+	}
+	leaves := p.trees.Apply(x)
+	y := make([]float32, len(leaves))
+	for i := range leaves {
+		y[i] = float32(1 / (1 + math.Exp(-p.lr.logit(leaves[i]))))
+	}
+	return tensor.NewDense(tensor.Float32, tensor.Shape{len(y), 1}, tensor.WithBacking(y))
+}
+
+type gbdtLRJson struct {
+	Trees json.RawMessage `json:"gbdt"`
+	LR    *leafLR         `json:"lr"`
+}
+
+// Marshal returns the json of both the trees and the logistic regression,
+// see NewGBDTLRPredWrapFromJson.
+func (p *GBDTLRPredWrap) Marshal() (data []byte, err error) {
+	trees, err := p.trees.Marshal()
+	if err != nil {
+		return
+	}
+	return json.Marshal(gbdtLRJson{Trees: trees, LR: p.lr})
+}
+
+// NewGBDTLRPredWrapFromJson restores the GBDTLRPredWrap marshaled.
+func NewGBDTLRPredWrapFromJson(data []byte) (p *GBDTLRPredWrap, err error) {
+	var j gbdtLRJson
+	if err = json.Unmarshal(data, &j); err != nil {
+		return
+	}
+	if j.LR == nil {
+		return nil, fmt.Errorf("lr not set")
+	}
+	trees := &tree.GBDT{}
+	if err = trees.Unmarshal(j.Trees); err != nil {
+		return
+	}
+	if len(j.LR.Offsets) != len(trees.Trees) {
+		return nil, fmt.Errorf("lr has %d trees, gbdt has %d", len(j.LR.Offsets), len(trees.Trees))
+	}
+	expected := newLeafLR(trees.Trees)
+	if !intsEqual(j.LR.Offsets, expected.Offsets) || len(j.LR.Weights) != len(expected.Weights) {
+		return nil, fmt.Errorf("lr weights do not match the leaves of gbdt")
+	}
+	return &GBDTLRPredWrap{
+		trees: trees,
+		lr:    j.LR,
+	}, nil
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GBDTLRFitWrap fits the GBDT+LR model: Trees are fitted first, then a
+// logistic regression on the one-hot encoded indexes of the leaves of the rows.
+type GBDTLRFitWrap struct {
+	// Trees is the GBDT of binary_log_loss
+	Trees *tree.GBDT
+	// Epochs of the logistic regression, default 10
+	Epochs int
+	// LearningRate of adagrad of the logistic regression, default 0.1
+	LearningRate float64
+	// L2 regularization of the weights of the logistic regression
+	L2 float64
+	// LRFraction is the fraction of the last rows fitting the logistic
+	// regression only, the trees are fitted with the others.
+	// 0 fits both with all the rows.
+	LRFraction float64
+	// Seed of the shuffle of the logistic regression
+	Seed int64
+}
+
+func (fit *GBDTLRFitWrap) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	if fit.Trees == nil || !fit.Trees.IsClassifier() {
+		return nil, fmt.Errorf("trees of GBDT+LR must be a GBDT of binary_log_loss")
+	}
+	if fit.LRFraction < 0 || fit.LRFraction >= 1 || fit.Epochs < 0 || fit.LearningRate < 0 || fit.L2 < 0 {
+		return nil, fmt.Errorf("invalid GBDT+LR params LRFraction %g, Epochs %d, LearningRate %g, L2 %g",
+			fit.LRFraction, fit.Epochs, fit.LearningRate, fit.L2)
+	}
+	if len(trainSample.X) != trainSample.Rows*trainSample.XCols || len(trainSample.Y) != trainSample.Rows {
+		return nil, fmt.Errorf("sample of %d rows has %d features and %d labels",
+			trainSample.Rows, len(trainSample.X), len(trainSample.Y))
+	}
+	treeRows := trainSample.Rows - int(float64(trainSample.Rows)*fit.LRFraction)
+	treeSample := *trainSample
+	treeSample.Rows = treeRows
+	treeSample.X = trainSample.X[:treeRows*trainSample.XCols]
+	treeSample.Y = trainSample.Y[:treeRows]
+	if _, err = (&GBDTFitWrap{Model: fit.Trees}).Fit(&treeSample); err != nil {
+		return
+	}
+
+	lrRows := trainSample.Rows - treeRows
+	if lrRows == 0 {
+		lrRows = trainSample.Rows
+	}
+	lrStart := trainSample.Rows - lrRows
+	x := mat.NewDense(lrRows, trainSample.XCols, nil)
+	y := make([]float64, lrRows)
+	for i := 0; i < lrRows; i++ {
+		for j := 0; j < trainSample.XCols; j++ {
+			x.Set(i, j, float64(trainSample.X[(lrStart+i)*trainSample.XCols+j]))
+		}
+		y[i] = float64(trainSample.Y[lrStart+i])
+	}
+	lr := newLeafLR(fit.Trees.Trees)
+	lr.fit(fit.Trees.Apply(x), y, fit)
+	return &GBDTLRPredWrap{
+		trees: fit.Trees,
+		lr:    lr,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package gbdt
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"github.com/auxten/go-ctr/nn/tree"
+	"github.com/auxten/go-ctr/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+func newTrees(nEstimators int) *tree.GBDT {
+	trees := tree.NewGBDT("binary_log_loss")
+	trees.NEstimators = nEstimators
+	trees.MaxLeafNodes = 8
+	trees.RandomState = base.NewLockedSource(7)
+	return trees
+}
+
+func TestGBDTLRFitWrap(t *testing.T) {
+	Convey("fit, predict and marshal one artefact", t, func() {
+		sample := boxSample(2000, 1)
+		fit := &GBDTLRFitWrap{Trees: newTrees(30), L2: 1e-4, LRFraction: 0.5, Seed: 1}
+		pred, err := fit.Fit(sample)
+		So(err, ShouldBeNil)
+		So(fit.Trees.Trees, ShouldHaveLength, 30)
+
+		test := boxSample(3000, 2)
+		x := tensor.New(tensor.WithShape(test.Rows, test.XCols), tensor.WithBacking(test.X))
+		y := pred.Predict(x).Data().([]float32)
+		So(y, ShouldHaveLength, test.Rows)
+		So(utils.RocAuc32(y, test.Y), ShouldBeGreaterThan, 0.98)
+		for _, v := range y {
+			So(v, ShouldBeBetween, 0, 1)
+		}
+
+		data, err := pred.(*GBDTLRPredWrap).Marshal()
+		So(err, ShouldBeNil)
+		restored, err := NewGBDTLRPredWrapFromJson(data)
+		So(err, ShouldBeNil)
+		So(restored.Predict(x).Data().([]float32), ShouldResemble, y)
+	})
+
+	Convey("fit trees and lr with all rows", t, func() {
+		sample := boxSample(1000, 1)
+		pred, err := (&GBDTLRFitWrap{Trees: newTrees(10)}).Fit(sample)
+		So(err, ShouldBeNil)
+		x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+		So(utils.RocAuc32(pred.Predict(x).Data().([]float32), sample.Y), ShouldBeGreaterThan, 0.98)
+	})
+
+	Convey("invalid params and json", t, func() {
+		sample := boxSample(100, 1)
+		_, err := (&GBDTLRFitWrap{Trees: tree.NewGBDT("square_loss")}).Fit(sample)
+		So(err, ShouldNotBeNil)
+		_, err = (&GBDTLRFitWrap{}).Fit(sample)
+		So(err, ShouldNotBeNil)
+		_, err = (&GBDTLRFitWrap{Trees: newTrees(2), LRFraction: 1}).Fit(sample)
+		So(err, ShouldNotBeNil)
+		short := *sample
+		short.Rows++
+		_, err = (&GBDTLRFitWrap{Trees: newTrees(2)}).Fit(&short)
+		So(err, ShouldNotBeNil)
+		short = *sample
+		short.Y = short.Y[1:]
+		_, err = (&GBDTLRFitWrap{Trees: newTrees(2), LRFraction: 0.5}).Fit(&short)
+		So(err, ShouldNotBeNil)
+
+		_, err = NewGBDTLRPredWrapFromJson([]byte("{"))
+		So(err, ShouldNotBeNil)
+		_, err = NewGBDTLRPredWrapFromJson([]byte(`{"gbdt": {"loss_func_name": "binary_log_loss"}}`))
+		So(err, ShouldNotBeNil)
+
+		pred, err := (&GBDTLRFitWrap{Trees: newTrees(2)}).Fit(sample)
+		So(err, ShouldBeNil)
+		p := pred.(*GBDTLRPredWrap)
+		p.lr.Weights = p.lr.Weights[1:]
+		data, err := p.Marshal()
+		So(err, ShouldBeNil)
+		_, err = NewGBDTLRPredWrapFromJson(data)
+		So(err, ShouldNotBeNil)
+	})
+}
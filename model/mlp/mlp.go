@@ -1,6 +1,8 @@
 package mlp
 
 import (
+	"fmt"
+
 	"github.com/auxten/go-ctr/nn/base"
 	nn "github.com/auxten/go-ctr/nn/neural_network"
 	rcmd "github.com/auxten/go-ctr/recommend"
@@ -38,6 +40,27 @@ func (p *SimpleMlpPredWrap) Predict(X tensor.Tensor) tensor.Tensor {
 	return tensor.NewDense(tensor.Float32, tensor.Shape{numPred, 1}, tensor.WithBacking(y))
 }
 
+// Marshal returns the json of the fitted mlp, see NewSimpleMlpPredWrapFromJson.
+func (p *SimpleMlpPredWrap) Marshal() (data []byte, err error) {
+	m, ok := p.pred.(interface{ Marshal() ([]byte, error) })
+	if !ok {
+		return nil, fmt.Errorf("%T could not be marshaled", p.pred)
+	}
+	return m.Marshal()
+}
+
+// NewSimpleMlpPredWrapFromJson restores the SimpleMlpPredWrap marshaled, so the
+// model could be trained once and used for prediction many times.
+func NewSimpleMlpPredWrapFromJson(data []byte) (p *SimpleMlpPredWrap, err error) {
+	mlp := nn.NewMLPClassifier(nil, "", "", 0)
+	if err = mlp.Unmarshal(data); err != nil {
+		return
+	}
+	return &SimpleMlpPredWrap{
+		pred: mlp,
+	}, nil
+}
+
 type SimpleMlpFitWrap struct {
 	Model *nn.MLPClassifier
 }
@@ -63,3 +86,65 @@ func (fit *SimpleMlpFitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbs
 		pred: pred.(base.Predicter),
 	}, nil
 }
+
+// SimpleMlp32PredWrap predicts with the float32 mlp on the backing of the
+// input tensor directly, without converting it to float64.
+type SimpleMlp32PredWrap struct {
+	mlp *nn.BaseMultilayerPerceptron32
+}
+
+func (p *SimpleMlp32PredWrap) Predict(X tensor.Tensor) tensor.Tensor {
+	numPred, xWidth := X.Shape()[0], X.Shape()[1]
+	x, ok := X.Data().([]float32)
+	if !ok || len(x) != numPred*xWidth {
+		// views or other types are materialized
+		x = make([]float32, numPred*xWidth)
+		for i := 0; i < numPred; i++ {
+			for j := 0; j < xWidth; j++ {
+				val, err := X.At(i, j)
+				if err != nil {
+					return nil
+				}
+				x[i*xWidth+j] = val.(float32)
+			}
+		}
+	}
+	y := make([]float32, numPred)
+	p.mlp.PredictProbas(
+		nn.General32{Rows: numPred, Cols: xWidth, Stride: xWidth, Data: x},
+		nn.General32{Rows: numPred, Cols: 1, Stride: 1, Data: y},
+	)
+	return tensor.NewDense(tensor.Float32, tensor.Shape{numPred, 1}, tensor.WithBacking(y))
+}
+
+// Marshal returns the json of the fitted mlp, see NewSimpleMlp32PredWrapFromJson.
+func (p *SimpleMlp32PredWrap) Marshal() (data []byte, err error) {
+	return p.mlp.Marshal()
+}
+
+// NewSimpleMlp32PredWrapFromJson restores the SimpleMlp32PredWrap marshaled.
+func NewSimpleMlp32PredWrapFromJson(data []byte) (p *SimpleMlp32PredWrap, err error) {
+	mlp := nn.NewBaseMultilayerPerceptron32()
+	if err = mlp.Unmarshal(data); err != nil {
+		return
+	}
+	return &SimpleMlp32PredWrap{
+		mlp: mlp,
+	}, nil
+}
+
+// SimpleMlp32FitWrap fits the float32 mlp with TrainSample.X directly,
+// the sample is copied only if Model.Shuffle is set, as the rows are shuffled in place.
+type SimpleMlp32FitWrap struct {
+	Model *nn.BaseMultilayerPerceptron32
+}
+
+func (fit *SimpleMlp32FitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	fit.Model.Fit(
+		nn.General32{Rows: trainSample.Rows, Cols: trainSample.XCols, Stride: trainSample.XCols, Data: trainSample.X},
+		nn.General32{Rows: trainSample.Rows, Cols: 1, Stride: 1, Data: trainSample.Y},
+	)
+	return &SimpleMlp32PredWrap{
+		mlp: fit.Model,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package mlp
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	nn "github.com/auxten/go-ctr/nn/neural_network"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/recommend/sampletest"
+	"github.com/auxten/go-ctr/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// xorSample is labeled 1 if exactly one of the first 2 columns is positive.
+func xorSample(rows int) *rcmd.TrainSample {
+	return sampletest.Uniform(rows, 3, 1, -1, 1, func(x []float32) bool {
+		return (x[0] > 0) != (x[1] > 0)
+	})
+}
+
+func TestSimpleMlpPredWrapMarshal(t *testing.T) {
+	Convey("marshal and new from json", t, func() {
+		sample := xorSample(500)
+		fiter := nn.NewMLPClassifier([]int{16, 8}, "relu", "adam", 1e-5)
+		fiter.RandomState = base.NewLockedSource(7)
+		fiter.MaxIter = 50
+		pred, err := (&SimpleMlpFitWrap{Model: fiter}).Fit(sample)
+		So(err, ShouldBeNil)
+
+		data, err := pred.(*SimpleMlpPredWrap).Marshal()
+		So(err, ShouldBeNil)
+		restored, err := NewSimpleMlpPredWrapFromJson(data)
+		So(err, ShouldBeNil)
+
+		x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+		y := pred.Predict(x).Data().([]float32)
+		So(restored.Predict(x).Data().([]float32), ShouldResemble, y)
+
+		// predictions are probabilities, not classes
+		var fractional bool
+		for _, v := range y {
+			So(v, ShouldBeBetweenOrEqual, 0, 1)
+			fractional = fractional || (v != 0 && v != 1)
+		}
+		So(fractional, ShouldBeTrue)
+	})
+
+	Convey("invalid json", t, func() {
+		_, err := NewSimpleMlpPredWrapFromJson([]byte("{"))
+		So(err, ShouldNotBeNil)
+		_, err = NewSimpleMlpPredWrapFromJson([]byte(`{"coefs_": [[[1]]]}`))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func newMlp32(hiddenLayerSizes []int, maxIter int) *nn.BaseMultilayerPerceptron32 {
+	mlp := nn.NewBaseMultilayerPerceptron32()
+	mlp.HiddenLayerSizes = hiddenLayerSizes
+	mlp.RandomState = base.NewLockedSource(7)
+	mlp.MaxIter = maxIter
+	return mlp
+}
+
+func TestSimpleMlp32(t *testing.T) {
+	Convey("fit and predict probabilities", t, func() {
+		sample := xorSample(1000)
+		x := append([]float32(nil), sample.X...)
+		pred, err := (&SimpleMlp32FitWrap{Model: newMlp32([]int{16, 8}, 200)}).Fit(sample)
+		So(err, ShouldBeNil)
+		// shuffled in a copy
+		So(sample.X, ShouldResemble, x)
+
+		y := pred.Predict(tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))).
+			Data().([]float32)
+		So(y, ShouldHaveLength, sample.Rows)
+		var fractional bool
+		for _, v := range y {
+			So(v, ShouldBeBetweenOrEqual, 0, 1)
+			fractional = fractional || (v != 0 && v != 1)
+		}
+		So(fractional, ShouldBeTrue)
+		So(utils.RocAuc32(y, sample.Y), ShouldBeGreaterThan, 0.9)
+
+		Convey("predict views", func() {
+			x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+			view, err := x.Slice(tensor.S(10, 20))
+			So(err, ShouldBeNil)
+			So(pred.Predict(view).Data().([]float32), ShouldResemble, y[10:20])
+		})
+
+		Convey("marshal and new from json", func() {
+			data, err := pred.(*SimpleMlp32PredWrap).Marshal()
+			So(err, ShouldBeNil)
+			restored, err := NewSimpleMlp32PredWrapFromJson(data)
+			So(err, ShouldBeNil)
+			x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+			So(restored.Predict(x).Data().([]float32), ShouldResemble, y)
+		})
+	})
+}
+
+// The benchmarks compare SimpleMlpFitWrap/SimpleMlpPredWrap converting the
+// samples to float64 with the float32 ones using the backings directly.
+const (
+	benchRows  = 2000
+	benchCols  = 100
+	benchIters = 5
+)
+
+var benchHidden = []int{100}
+
+func benchSample() *rcmd.TrainSample {
+	return sampletest.Uniform(benchRows, benchCols, 1, 0, 1, func(x []float32) bool {
+		return x[0] > 0.5
+	})
+}
+
+func BenchmarkSimpleMlpFit(b *testing.B) {
+	sample := benchSample()
+	for i := 0; i < b.N; i++ {
+		fiter := nn.NewMLPClassifier(benchHidden, "relu", "adam", 1e-5)
+		fiter.RandomState = base.NewLockedSource(7)
+		fiter.MaxIter = benchIters
+		if _, err := (&SimpleMlpFitWrap{Model: fiter}).Fit(sample); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSimpleMlp32Fit(b *testing.B) {
+	sample := benchSample()
+	for i := 0; i < b.N; i++ {
+		if _, err := (&SimpleMlp32FitWrap{Model: newMlp32(benchHidden, benchIters)}).Fit(sample); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSimpleMlpPredict(b *testing.B) {
+	sample := benchSample()
+	fiter := nn.NewMLPClassifier(benchHidden, "relu", "adam", 1e-5)
+	fiter.RandomState = base.NewLockedSource(7)
+	fiter.MaxIter = benchIters
+	pred, err := (&SimpleMlpFitWrap{Model: fiter}).Fit(sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pred.Predict(x)
+	}
+}
+
+func BenchmarkSimpleMlp32Predict(b *testing.B) {
+	sample := benchSample()
+	pred, err := (&SimpleMlp32FitWrap{Model: newMlp32(benchHidden, benchIters)}).Fit(sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	x := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pred.Predict(x)
+	}
+}
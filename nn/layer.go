@@ -27,22 +27,6 @@ func NewLayer(n int, activation ActivationType) *Layer {
 	}
 }
 
-func (l *Layer) fire() {
-	for _, n := range l.Neurons {
-		n.fire()
-	}
-	if l.A == ActivationSoftmax {
-		outs := make([]float64, len(l.Neurons))
-		for i, neuron := range l.Neurons {
-			outs[i] = neuron.Value
-		}
-		sm := Softmax(outs)
-		for i, neuron := range l.Neurons {
-			neuron.Value = sm[i]
-		}
-	}
-}
-
 // Connect fully connects layer l to next, and initializes each
 // synapse with the given weight function
 func (l *Layer) Connect(next *Layer, weight WeightInitializer) {
@@ -0,0 +1,3 @@
+// Package modelselection contains KFold, StratifiedKFold, GroupKFold,
+// TimeSeriesSplit, CrossValScore and CrossValidate
+package modelselection
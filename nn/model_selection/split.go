@@ -0,0 +1,281 @@
+package modelselection
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Split is the indexes of the train and test rows of a fold
+type Split struct{ TrainIndex, TestIndex []int }
+
+// Splitter is the interface for splitters like KFold
+type Splitter interface {
+	// Split returns the splits of the rows of X, Y is the labels (used by StratifiedKFold)
+	Split(X, Y mat.Matrix) ([]Split, error)
+	GetNSplits() int
+}
+
+var (
+	_ Splitter = &KFold{}
+	_ Splitter = &StratifiedKFold{}
+	_ Splitter = &GroupKFold{}
+	_ Splitter = &TimeSeriesSplit{}
+)
+
+// defaultNSplits is used if NSplits is 0
+const defaultNSplits = 5
+
+func nSplits(n int) int {
+	if n == 0 {
+		return defaultNSplits
+	}
+	return n
+}
+
+func checkNSplits(NSplits, NSamples int) error {
+	if NSplits < 2 {
+		return fmt.Errorf("NSplits must be at least 2, got %d", NSplits)
+	}
+	if NSplits > NSamples {
+		return fmt.Errorf("NSplits %d is greater than the number of samples %d", NSplits, NSamples)
+	}
+	return nil
+}
+
+func shuffler(randomState base.RandomState) func(n int, swap func(i, j int)) {
+	if randomState == base.RandomState(nil) {
+		return rand.Shuffle
+	}
+	return rand.New(randomState).Shuffle
+}
+
+// splitsOfFolds returns the splits testing each fold and training the others,
+// fold[i] is the fold of row i.
+func splitsOfFolds(fold []int, NSplits int) []Split {
+	splits := make([]Split, NSplits)
+	for i, f := range fold {
+		for k := range splits {
+			if k == f {
+				splits[k].TestIndex = append(splits[k].TestIndex, i)
+			} else {
+				splits[k].TrainIndex = append(splits[k].TrainIndex, i)
+			}
+		}
+	}
+	return splits
+}
+
+// KFold splits the rows into NSplits consecutive folds (default 5), each fold
+// is the test set once. The rows are shuffled with RandomState before being
+// split if Shuffle.
+type KFold struct {
+	NSplits     int
+	Shuffle     bool
+	RandomState base.RandomState
+}
+
+// Split generate Split structs
+func (splitter *KFold) Split(X, Y mat.Matrix) ([]Split, error) {
+	NSamples, _ := X.Dims()
+	NSplits := nSplits(splitter.NSplits)
+	if err := checkNSplits(NSplits, NSamples); err != nil {
+		return nil, err
+	}
+	order := make([]int, NSamples)
+	for i := range order {
+		order[i] = i
+	}
+	if splitter.Shuffle {
+		shuffler(splitter.RandomState)(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+	// The first NSamples % NSplits folds have size NSamples / NSplits + 1
+	fold := make([]int, NSamples)
+	for f, start := 0, 0; f < NSplits; f++ {
+		NTest := NSamples / NSplits
+		if f < NSamples%NSplits {
+			NTest++
+		}
+		for _, i := range order[start : start+NTest] {
+			fold[i] = f
+		}
+		start += NTest
+	}
+	return splitsOfFolds(fold, NSplits), nil
+}
+
+// GetNSplits for KFold
+func (splitter *KFold) GetNSplits() int {
+	return nSplits(splitter.NSplits)
+}
+
+// StratifiedKFold is KFold preserving the percentage of each class of the
+// first column of Y in the folds.
+type StratifiedKFold struct {
+	NSplits     int
+	Shuffle     bool
+	RandomState base.RandomState
+}
+
+// Split generate Split structs
+func (splitter *StratifiedKFold) Split(X, Y mat.Matrix) ([]Split, error) {
+	NSamples, _ := X.Dims()
+	NSplits := nSplits(splitter.NSplits)
+	if err := checkNSplits(NSplits, NSamples); err != nil {
+		return nil, err
+	}
+	if Y == nil {
+		return nil, fmt.Errorf("StratifiedKFold requires Y")
+	}
+	if NY, _ := Y.Dims(); NY != NSamples {
+		return nil, fmt.Errorf("X has %d rows, Y has %d", NSamples, NY)
+	}
+	classRows := make(map[float64][]int)
+	for i := 0; i < NSamples; i++ {
+		c := Y.At(i, 0)
+		classRows[c] = append(classRows[c], i)
+	}
+	classes := make([]float64, 0, len(classRows))
+	for c := range classRows {
+		classes = append(classes, c)
+	}
+	sort.Float64s(classes)
+
+	shuffle := shuffler(splitter.RandomState)
+	// rows of each class are dealt to the folds in turn, continuing with the
+	// next class, so the folds have the same size as KFold
+	fold := make([]int, NSamples)
+	next := 0
+	for _, c := range classes {
+		rows := classRows[c]
+		if splitter.Shuffle {
+			shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+		}
+		for _, i := range rows {
+			fold[i] = next % NSplits
+			next++
+		}
+	}
+	return splitsOfFolds(fold, NSplits), nil
+}
+
+// GetNSplits for StratifiedKFold
+func (splitter *StratifiedKFold) GetNSplits() int {
+	return nSplits(splitter.NSplits)
+}
+
+// GroupKFold is KFold with the rows of a group in the same fold, e.g. the
+// samples of a user, so no group is in both the train and test set.
+// Groups is the group of each row, the groups are assigned to the fold with
+// the fewest rows, from the largest group.
+type GroupKFold struct {
+	NSplits int
+	Groups  []int
+}
+
+// Split generate Split structs
+func (splitter *GroupKFold) Split(X, Y mat.Matrix) ([]Split, error) {
+	NSamples, _ := X.Dims()
+	NSplits := nSplits(splitter.NSplits)
+	if len(splitter.Groups) != NSamples {
+		return nil, fmt.Errorf("X has %d rows, Groups has %d", NSamples, len(splitter.Groups))
+	}
+	groupSizes := make(map[int]int)
+	for _, g := range splitter.Groups {
+		groupSizes[g]++
+	}
+	if err := checkNSplits(NSplits, len(groupSizes)); err != nil {
+		return nil, fmt.Errorf("groups: %v", err)
+	}
+	groups := make([]int, 0, len(groupSizes))
+	for g := range groupSizes {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groupSizes[groups[i]] != groupSizes[groups[j]] {
+			return groupSizes[groups[i]] > groupSizes[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+	foldSizes := make([]int, NSplits)
+	groupFold := make(map[int]int, len(groups))
+	for _, g := range groups {
+		lightest := 0
+		for f, size := range foldSizes {
+			if size < foldSizes[lightest] {
+				lightest = f
+			}
+		}
+		groupFold[g] = lightest
+		foldSizes[lightest] += groupSizes[g]
+	}
+	fold := make([]int, NSamples)
+	for i, g := range splitter.Groups {
+		fold[i] = groupFold[g]
+	}
+	return splitsOfFolds(fold, NSplits), nil
+}
+
+// GetNSplits for GroupKFold
+func (splitter *GroupKFold) GetNSplits() int {
+	return nSplits(splitter.NSplits)
+}
+
+// TimeSeriesSplit splits the rows ordered by time into NSplits test sets of
+// successive rows, each trained on the rows before it.
+// TestSize is the rows of each test set, default NSamples / (NSplits + 1).
+// MaxTrainSize limits the rows of train sets to the latest ones, 0 means unlimited.
+// Gap is the rows excluded between the train and test set.
+type TimeSeriesSplit struct {
+	NSplits      int
+	MaxTrainSize int
+	TestSize     int
+	Gap          int
+}
+
+// Split generate Split structs
+func (splitter *TimeSeriesSplit) Split(X, Y mat.Matrix) ([]Split, error) {
+	NSamples, _ := X.Dims()
+	NSplits := nSplits(splitter.NSplits)
+	if err := checkNSplits(NSplits+1, NSamples); err != nil {
+		return nil, err
+	}
+	testSize := splitter.TestSize
+	if testSize == 0 {
+		testSize = NSamples / (NSplits + 1)
+	}
+	if splitter.Gap < 0 || splitter.MaxTrainSize < 0 || testSize < 0 {
+		return nil, fmt.Errorf("Gap, MaxTrainSize and TestSize must not be negative")
+	}
+	if NSamples-splitter.Gap-testSize*NSplits <= 0 {
+		return nil, fmt.Errorf("too many splits %d of test size %d and gap %d for %d samples",
+			NSplits, testSize, splitter.Gap, NSamples)
+	}
+	splits := make([]Split, NSplits)
+	for k := range splits {
+		testStart := NSamples - (NSplits-k)*testSize
+		trainEnd := testStart - splitter.Gap
+		trainStart := 0
+		if splitter.MaxTrainSize > 0 && trainEnd > splitter.MaxTrainSize {
+			trainStart = trainEnd - splitter.MaxTrainSize
+		}
+		splits[k] = Split{TrainIndex: indexRange(trainStart, trainEnd), TestIndex: indexRange(testStart, testStart+testSize)}
+	}
+	return splits, nil
+}
+
+// GetNSplits for TimeSeriesSplit
+func (splitter *TimeSeriesSplit) GetNSplits() int {
+	return nSplits(splitter.NSplits)
+}
+
+func indexRange(start, end int) []int {
+	index := make([]int, end-start)
+	for i := range index {
+		index[i] = start + i
+	}
+	return index
+}
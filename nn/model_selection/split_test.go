@@ -0,0 +1,182 @@
+package modelselection
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"gonum.org/v1/gonum/mat"
+)
+
+// checkPartition checks the test sets of splits partition the NSamples rows,
+// and the train set of each split is the complement of the test set.
+func checkPartition(t *testing.T, splits []Split, NSamples int) {
+	t.Helper()
+	tested := make([]int, NSamples)
+	for k, split := range splits {
+		if len(split.TrainIndex)+len(split.TestIndex) != NSamples {
+			t.Errorf("split %d has %d train and %d test rows", k, len(split.TrainIndex), len(split.TestIndex))
+		}
+		all := append(append([]int{}, split.TrainIndex...), split.TestIndex...)
+		sort.Ints(all)
+		for i, row := range all {
+			if row != i {
+				t.Fatalf("split %d rows are not a permutation: %v", k, all)
+			}
+		}
+		for _, row := range split.TestIndex {
+			tested[row]++
+		}
+	}
+	for row, n := range tested {
+		if n != 1 {
+			t.Errorf("row %d is tested %d times", row, n)
+		}
+	}
+}
+
+func TestKFold(t *testing.T) {
+	X := mat.NewDense(10, 2, nil)
+	splits, err := (&KFold{NSplits: 3}).Split(X, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, splits, 10)
+	expected := [][]int{{0, 1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	for k, split := range splits {
+		if !reflect.DeepEqual(split.TestIndex, expected[k]) {
+			t.Errorf("split %d expected test %v, got %v", k, expected[k], split.TestIndex)
+		}
+	}
+
+	splitter := &KFold{NSplits: 3, Shuffle: true, RandomState: base.NewLockedSource(7)}
+	shuffled, err := splitter.Split(X, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, shuffled, 10)
+	if reflect.DeepEqual(shuffled, splits) {
+		t.Error("shuffled splits expected to differ")
+	}
+	if n := splitter.GetNSplits(); n != 3 {
+		t.Errorf("expected 3 splits, got %d", n)
+	}
+
+	if _, err = (&KFold{NSplits: 11}).Split(X, nil); err == nil {
+		t.Error("expected error of more splits than samples")
+	}
+	if _, err = (&KFold{NSplits: 1}).Split(X, nil); err == nil {
+		t.Error("expected error of 1 split")
+	}
+	if n := (&KFold{}).GetNSplits(); n != 5 {
+		t.Errorf("expected default 5 splits, got %d", n)
+	}
+}
+
+func TestStratifiedKFold(t *testing.T) {
+	// 12 negatives and 6 positives
+	Y := mat.NewDense(18, 1, nil)
+	for i := 0; i < 18; i += 3 {
+		Y.Set(i, 0, 1)
+	}
+	X := mat.NewDense(18, 1, nil)
+	for _, shuffle := range []bool{false, true} {
+		splits, err := (&StratifiedKFold{NSplits: 3, Shuffle: shuffle, RandomState: base.NewLockedSource(7)}).Split(X, Y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPartition(t, splits, 18)
+		for k, split := range splits {
+			positives := 0
+			for _, row := range split.TestIndex {
+				positives += int(Y.At(row, 0))
+			}
+			if len(split.TestIndex) != 6 || positives != 2 {
+				t.Errorf("split %d expected 2 positives of 6 test rows, got %d of %d", k, positives, len(split.TestIndex))
+			}
+		}
+	}
+
+	if _, err := (&StratifiedKFold{NSplits: 3}).Split(X, nil); err == nil {
+		t.Error("expected error without Y")
+	}
+}
+
+func TestGroupKFold(t *testing.T) {
+	groups := []int{1, 1, 1, 1, 2, 2, 2, 3, 3, 4, 5, 5}
+	X := mat.NewDense(len(groups), 1, nil)
+	splits, err := (&GroupKFold{NSplits: 3, Groups: groups}).Split(X, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, splits, len(groups))
+	for k, split := range splits {
+		trainGroups := map[int]bool{}
+		for _, row := range split.TrainIndex {
+			trainGroups[groups[row]] = true
+		}
+		for _, row := range split.TestIndex {
+			if trainGroups[groups[row]] {
+				t.Errorf("split %d group %d is in both train and test", k, groups[row])
+			}
+		}
+		if len(split.TestIndex) != 4 {
+			t.Errorf("split %d expected 4 test rows, got %d", k, len(split.TestIndex))
+		}
+	}
+
+	if _, err = (&GroupKFold{NSplits: 6, Groups: groups}).Split(X, nil); err == nil {
+		t.Error("expected error of more splits than groups")
+	}
+	if _, err = (&GroupKFold{NSplits: 2, Groups: groups[1:]}).Split(X, nil); err == nil {
+		t.Error("expected error of groups length")
+	}
+}
+
+func TestTimeSeriesSplit(t *testing.T) {
+	X := mat.NewDense(6, 1, nil)
+	for _, test := range []struct {
+		splitter *TimeSeriesSplit
+		expected []Split
+	}{
+		{&TimeSeriesSplit{NSplits: 5}, []Split{
+			{[]int{0}, []int{1}}, {[]int{0, 1}, []int{2}}, {[]int{0, 1, 2}, []int{3}},
+			{[]int{0, 1, 2, 3}, []int{4}}, {[]int{0, 1, 2, 3, 4}, []int{5}},
+		}},
+		{&TimeSeriesSplit{NSplits: 2, MaxTrainSize: 2}, []Split{
+			{[]int{0, 1}, []int{2, 3}}, {[]int{2, 3}, []int{4, 5}},
+		}},
+		{&TimeSeriesSplit{NSplits: 2, TestSize: 1, Gap: 1}, []Split{
+			{[]int{0, 1, 2}, []int{4}}, {[]int{0, 1, 2, 3}, []int{5}},
+		}},
+	} {
+		splits, err := test.splitter.Split(X, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(splits, test.expected) {
+			t.Errorf("%+v expected %v, got %v", *test.splitter, test.expected, splits)
+		}
+	}
+
+	if _, err := (&TimeSeriesSplit{NSplits: 6}).Split(X, nil); err == nil {
+		t.Error("expected error of too many splits")
+	}
+	if _, err := (&TimeSeriesSplit{NSplits: 2, TestSize: 2, Gap: 2}).Split(X, nil); err == nil {
+		t.Error("expected error of too large gap")
+	}
+}
+
+func ExampleTimeSeriesSplit() {
+	X := mat.NewDense(6, 1, nil)
+	splits, _ := (&TimeSeriesSplit{NSplits: 3}).Split(X, nil)
+	for _, split := range splits {
+		fmt.Println("train:", split.TrainIndex, "test:", split.TestIndex)
+	}
+	// Output:
+	// train: [0 1 2] test: [3]
+	// train: [0 1 2 3] test: [4]
+	// train: [0 1 2 3 4] test: [5]
+}
@@ -0,0 +1,58 @@
+package modelselection
+
+import (
+	"fmt"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"gonum.org/v1/gonum/mat"
+)
+
+// CrossValScore fits a clone of estimator on the train rows of each split of
+// cv, and returns the scores of the predictions of the test rows.
+// scorer is a func(Ytrue,Ypred) float64, e.g. of nn/metrics
+func CrossValScore(estimator base.Predicter, X, Y mat.Matrix, cv Splitter, scorer func(Ytrue, Ypred *mat.Dense) float64) (scores []float64, err error) {
+	return CrossValidate(X, Y, cv, func(split Split) (float64, error) {
+		predicter := estimator.PredicterClone()
+		predicter.Fit(TakeRows(X, split.TrainIndex), TakeRows(Y, split.TrainIndex))
+		Ytest := TakeRows(Y, split.TestIndex)
+		_, NOutputs := Ytest.Dims()
+		Ypred := mat.NewDense(len(split.TestIndex), NOutputs, nil)
+		predicter.Predict(TakeRows(X, split.TestIndex), Ypred)
+		return scorer(Ytest, Ypred), nil
+	})
+}
+
+// CrossValidate returns the scores of the splits of cv, score fits a new
+// model on the train rows of a split and scores it on the test rows.
+func CrossValidate(X, Y mat.Matrix, cv Splitter, score func(split Split) (float64, error)) (scores []float64, err error) {
+	NSamples, _ := X.Dims()
+	if NY, _ := Y.Dims(); NY != NSamples {
+		return nil, fmt.Errorf("X has %d rows, Y has %d", NSamples, NY)
+	}
+	splits, err := cv.Split(X, Y)
+	if err != nil {
+		return
+	}
+	scores = make([]float64, len(splits))
+	for i, split := range splits {
+		if len(split.TrainIndex) == 0 || len(split.TestIndex) == 0 {
+			return nil, fmt.Errorf("split %d has %d train and %d test rows", i, len(split.TrainIndex), len(split.TestIndex))
+		}
+		if scores[i], err = score(split); err != nil {
+			return nil, fmt.Errorf("split %d: %v", i, err)
+		}
+	}
+	return
+}
+
+// TakeRows returns the rows of M in index
+func TakeRows(M mat.Matrix, index []int) *mat.Dense {
+	_, cols := M.Dims()
+	dst := mat.NewDense(len(index), cols, nil)
+	for i, row := range index {
+		for j := 0; j < cols; j++ {
+			dst.Set(i, j, M.At(row, j))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,79 @@
+package modelselection
+
+import (
+	"math"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"github.com/auxten/go-ctr/nn/metrics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// meanPredicter predicts the mean of the labels it's fitted on.
+type meanPredicter struct {
+	mean float64
+}
+
+func (m *meanPredicter) Fit(X, Y mat.Matrix) base.Fiter {
+	rows, _ := Y.Dims()
+	m.mean = 0
+	for i := 0; i < rows; i++ {
+		m.mean += Y.At(i, 0) / float64(rows)
+	}
+	return m
+}
+
+func (m *meanPredicter) GetNOutputs() int { return 1 }
+
+func (m *meanPredicter) Predict(X mat.Matrix, Y mat.Mutable) *mat.Dense {
+	rows, _ := X.Dims()
+	for i := 0; i < rows; i++ {
+		Y.Set(i, 0, m.mean)
+	}
+	return nil
+}
+
+func (m *meanPredicter) Score(X, Y mat.Matrix) float64 { return 0 }
+
+func (m *meanPredicter) IsClassifier() bool { return false }
+
+func (m *meanPredicter) PredicterClone() base.Predicter {
+	clone := *m
+	return &clone
+}
+
+func TestCrossValScore(t *testing.T) {
+	X := mat.NewDense(6, 1, nil)
+	Y := mat.NewDense(6, 1, []float64{1, 1, 2, 2, 3, 3})
+	mse := func(Ytrue, Ypred *mat.Dense) float64 {
+		return metrics.MeanSquaredError(Ytrue, Ypred, nil, "").At(0, 0)
+	}
+	estimator := &meanPredicter{mean: -1}
+	scores, err := CrossValScore(estimator, X, Y, &KFold{NSplits: 3}, mse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the means of the train sets are 2.5, 2 and 1.5
+	expected := []float64{2.25, 0, 2.25}
+	for i := range expected {
+		if math.Abs(scores[i]-expected[i]) > 1e-12 {
+			t.Errorf("expected scores %v, got %v", expected, scores)
+		}
+	}
+	if estimator.mean != -1 {
+		t.Error("estimator expected not to be fitted")
+	}
+
+	scores, err = CrossValScore(estimator, X, Y, &TimeSeriesSplit{NSplits: 2}, mse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the means of the train sets are 1 and 1.5
+	if len(scores) != 2 || math.Abs(scores[0]-1) > 1e-12 || math.Abs(scores[1]-2.25) > 1e-12 {
+		t.Errorf("unexpected time series scores %v", scores)
+	}
+
+	if _, err = CrossValScore(estimator, X, Y.Slice(0, 5, 0, 1), &KFold{NSplits: 3}, mse); err == nil {
+		t.Error("expected error of rows mismatch")
+	}
+}
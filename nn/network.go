@@ -2,13 +2,25 @@ package nn
 
 import (
 	"fmt"
+	"log"
+
+	neuralnetwork "github.com/auxten/go-ctr/nn/neural_network"
+	"gonum.org/v1/gonum/mat"
 )
 
-// Neural is a neural network
+// Neural is a neural network computed by a
+// neuralnetwork.BaseMultilayerPerceptron64.
+//
+// Layers and Biases hold the weights, they are copied to the MLP by Forward,
+// PredictBatch and Train, and updated by Train. If the activation of a neuron
+// differs from the one of the MLP, e.g. Neuron.A is changed, the network is
+// computed neuron by neuron and can't be trained.
 type Neural struct {
 	Layers []*Layer
 	Biases [][]*Synapse
 	Config *Config
+
+	mlp *neuralnetwork.BaseMultilayerPerceptron64
 }
 
 // Config defines the network topology, activations, losses etc
@@ -65,11 +77,14 @@ func NewNeural(c *Config) *Neural {
 		}
 	}
 
-	return &Neural{
+	n := &Neural{
 		Layers: layers,
 		Biases: biases,
 		Config: c,
+		mlp:    newMLP(c),
 	}
+	n.pull()
+	return n
 }
 
 func initializeLayers(c *Config) []*Layer {
@@ -96,15 +111,129 @@ func initializeLayers(c *Config) []*Layer {
 	return layers
 }
 
-func (n *Neural) fire() {
-	for _, b := range n.Biases {
-		for _, s := range b {
-			s.fire(1)
+// newMLP returns the MLP of the layout and activations of c.
+func newMLP(c *Config) *neuralnetwork.BaseMultilayerPerceptron64 {
+	out := c.Activation
+	if c.Mode != ModeDefault {
+		out = OutputActivation(c.Mode)
+	}
+	mlp := neuralnetwork.NewBaseMultilayerPerceptron64()
+	mlp.Activation, mlp.OutActivation = activationNames[c.Activation], activationNames[out]
+	mlp.LossFuncName = lossFuncNames[c.Loss]
+	if mlp.Activation == "" || mlp.OutActivation == "" {
+		log.Panicf("activation %d and output activation %d must be sigmoid, tanh, relu, linear or softmax", c.Activation, out)
+	}
+	// Train keeps the weights and has no regularization
+	mlp.Solver, mlp.Alpha, mlp.WarmStart = "sgd", 0, true
+	mlp.Initialize(append([]int{c.Inputs}, c.Layout...))
+	return mlp
+}
+
+// hasBias tells if the neurons of layer have a bias synapse.
+func (n *Neural) hasBias(layer int) bool {
+	return n.Biases != nil && n.Biases[layer] != nil
+}
+
+// applyBias adds bias synapses of weight 0 to layer.
+func (n *Neural) applyBias(layer int) {
+	if n.Biases == nil {
+		n.Biases = make([][]*Synapse, len(n.Layers))
+	}
+	n.Biases[layer] = n.Layers[layer].ApplyBias(func() float64 { return 0 })
+}
+
+// pull copies the weights of the synapses to the MLP, the bias synapse is
+// the last input of a neuron.
+func (n *Neural) pull() {
+	for i, l := range n.Layers {
+		w, b := n.mlp.Coefs[i], n.mlp.Intercepts[i]
+		for j, neuron := range l.Neurons {
+			for k := 0; k < w.Rows; k++ {
+				w.Data[k*w.Stride+j] = neuron.In[k].Weight
+			}
+			b[j] = 0
+			if len(neuron.In) > w.Rows {
+				b[j] = neuron.In[w.Rows].Weight
+			}
 		}
 	}
-	for _, l := range n.Layers {
-		l.fire()
+}
+
+// push copies the weights of the MLP to the synapses, the MLP trains the
+// intercepts of all layers, so layers without bias get bias synapses once
+// their intercepts are not 0.
+func (n *Neural) push() {
+	for i, l := range n.Layers {
+		w, b := n.mlp.Coefs[i], n.mlp.Intercepts[i]
+		if !n.hasBias(i) {
+			for _, v := range b {
+				if v != 0 {
+					n.applyBias(i)
+					break
+				}
+			}
+		}
+		for j, neuron := range l.Neurons {
+			for k := 0; k < w.Rows; k++ {
+				neuron.In[k].Weight = w.Data[k*w.Stride+j]
+			}
+			if len(neuron.In) > w.Rows {
+				neuron.In[w.Rows].Weight = b[j]
+			}
+		}
+	}
+}
+
+// mlpActivation returns the activation name of layer in the MLP.
+func (n *Neural) mlpActivation(layer int) string {
+	if layer == len(n.Layers)-1 {
+		return n.mlp.OutActivation
+	}
+	return n.mlp.Activation
+}
+
+// uniform tells if the activations of all neurons are the ones of the MLP.
+func (n *Neural) uniform() bool {
+	for i, l := range n.Layers {
+		act := n.mlpActivation(i)
+		for _, neuron := range l.Neurons {
+			if activationNames[neuron.A] != act {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// activations computes the outputs of all layers for the rows of X with the
+// weights pulled, neuron by neuron if the activations are not uniform.
+func (n *Neural) activations(X mat.Matrix) []mat.Matrix {
+	n.pull()
+	outs := make([]mat.Matrix, len(n.Layers))
+	if n.uniform() {
+		for i, out := range n.mlp.Activations(X) {
+			outs[i] = out
+		}
+		return outs
+	}
+	in := X
+	for i, l := range n.Layers {
+		w, b := n.mlp.Coefs[i], n.mlp.Intercepts[i]
+		rows, _ := in.Dims()
+		out := mat.NewDense(rows, w.Cols, nil)
+		out.Mul(in, mat.NewDense(w.Rows, w.Cols, w.Data))
+		for r := 0; r < rows; r++ {
+			row := out.RawRowView(r)
+			for j, neuron := range l.Neurons {
+				row[j] = neuron.Activate(row[j] + b[j])
+			}
+			if l.A == ActivationSoftmax {
+				copy(row, Softmax(row))
+			}
+		}
+		outs[i], in = out, out
 	}
+	return outs
 }
 
 // Forward computes a forward pass
@@ -112,12 +241,12 @@ func (n *Neural) Forward(input []float64) error {
 	if len(input) != n.Config.Inputs {
 		return fmt.Errorf("Invalid input dimension - expected: %d got: %d", n.Config.Inputs, len(input))
 	}
-	for _, n := range n.Layers[0].Neurons {
-		for i := 0; i < len(input); i++ {
-			n.In[i].fire(input[i])
+	activations := n.activations(mat.NewDense(1, len(input), input))
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			neuron.Value = activations[i].At(0, j)
 		}
 	}
-	n.fire()
 	return nil
 }
 
@@ -133,6 +262,16 @@ func (n *Neural) Predict(input []float64) []float64 {
 	return out
 }
 
+// PredictBatch computes the predictions of all rows of X in one pass.
+func (n *Neural) PredictBatch(X mat.Matrix) (*mat.Dense, error) {
+	_, cols := X.Dims()
+	if cols != n.Config.Inputs {
+		return nil, fmt.Errorf("Invalid input dimension - expected: %d got: %d", n.Config.Inputs, cols)
+	}
+	activations := n.activations(X)
+	return mat.DenseCopyOf(activations[len(activations)-1]), nil
+}
+
 // NumWeights returns the number of weights in the network
 func (n *Neural) NumWeights() (num int) {
 	for _, l := range n.Layers {
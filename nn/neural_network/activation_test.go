@@ -0,0 +1,67 @@
+package neuralnetwork
+
+import (
+	"math"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"gonum.org/v1/gonum/diff/fd"
+	"gonum.org/v1/gonum/optimize"
+)
+
+func TestActivations(t *testing.T) {
+	z := []float64{-2, -.5, 0, .5, 2}
+	expected := map[string]func(float64) float64{
+		"identity": func(x float64) float64 { return x },
+		"logistic": func(x float64) float64 { return 1 / (1 + math.Exp(-x)) },
+		"tanh":     math.Tanh,
+		"relu":     func(x float64) float64 { return math.Max(x, 0) },
+	}
+	for name, f := range expected {
+		z64 := blas64General{Rows: 1, Cols: len(z), Stride: len(z), Data: append([]float64(nil), z...)}
+		z32 := blas32General{Rows: 1, Cols: len(z), Stride: len(z), Data: make([]float32, len(z))}
+		for i, v := range z {
+			z32.Data[i] = float32(v)
+		}
+		Activations64[name](z64)
+		Activations32[name](z32)
+		for i, v := range z {
+			if math.Abs(z64.Data[i]-f(v)) > 1e-12 {
+				t.Errorf("%s(%g) expected %g, got %g", name, v, f(v), z64.Data[i])
+			}
+			if math.Abs(float64(z32.Data[i])-f(v)) > 1e-6 {
+				t.Errorf("%s(%g) expected %g, got %g for float32", name, v, f(v), z32.Data[i])
+			}
+		}
+	}
+}
+
+func TestSquareLossGradients(t *testing.T) {
+	X, Y := circleSample(50)
+	for _, out := range []string{"logistic", "tanh"} {
+		mlp := NewBaseMultilayerPerceptron64()
+		mlp.Activation, mlp.Solver, mlp.MaxIter = "logistic", "lbfgs", 5
+		mlp.RandomState = base.NewLockedSource(1)
+		mlp.OutActivation, mlp.LossFuncName = out, "square_loss"
+		mlp.Initialize([]int{2, 4, 1})
+		mlp.WarmStart = true
+		var checked bool
+		mlp.beforeMinimize = func(problem optimize.Problem, initX []float64) {
+			gradFromModel := make([]float64, len(initX))
+			gradFromFD := make([]float64, len(initX))
+			problem.Func(initX)
+			problem.Grad(gradFromModel, initX)
+			fd.Gradient(gradFromFD, problem.Func, initX, &fd.Settings{Step: 1e-7})
+			for i := range initX {
+				if math.Abs(gradFromFD[i]-gradFromModel[i]) > 1e-6 {
+					t.Fatalf("%s: bad gradient of param %d, expected: %g got: %g", out, i, gradFromFD[i], gradFromModel[i])
+				}
+			}
+			checked = true
+		}
+		mlp.Fit(X, Y)
+		if !checked {
+			t.Fatalf("%s: gradients not checked", out)
+		}
+	}
+}
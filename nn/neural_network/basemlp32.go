@@ -23,12 +23,24 @@ import (
 
 // BaseMultilayerPerceptron32 closely matches sklearn/neural_network/multilayer_perceptron.py
 type BaseMultilayerPerceptron32 struct {
-	Activation         string  `json:"activation"`
-	Solver             string  `json:"solver"`
-	Alpha              float32 `json:"alpha"`
-	WeightDecay        float32 `json:"weight_decay"`
-	BatchSize          int     `json:"batch_size"`
-	BatchNormalize     bool
+	Activation     string  `json:"activation"`
+	Solver         string  `json:"solver"`
+	Alpha          float32 `json:"alpha"`
+	WeightDecay    float32 `json:"weight_decay"`
+	BatchSize      int     `json:"batch_size"`
+	BatchNormalize bool
+	// BatchNorm normalizes the hidden layers by the mean and variance of each
+	// batch and learns a scale per unit, Predict uses the running statistics
+	BatchNorm bool `json:"batch_norm"`
+	// BatchNormMomentum is the weight of the batch statistics in the running
+	// mean and variance of BatchNorm, which are used by Predict, default .1
+	BatchNormMomentum float32 `json:"batch_norm_momentum"`
+	// Dropout is the rate of units dropped in training, one rate for all the
+	// hidden layers or one per hidden layer
+	Dropout []float32 `json:"dropout"`
+	// WeightInit is one of xavier_uniform, xavier_normal, he_uniform and he_normal,
+	// default "" draws in [0, sqrt(6/(fanIn+fanOut))), sqrt(2/...) for logistic
+	WeightInit         string           `json:"weight_init"`
 	LearningRate       string           `json:"learning_rate"`
 	LearningRateInit   float32          `json:"learning_rate_init"`
 	PowerT             float32          `json:"power_t"`
@@ -48,15 +60,22 @@ type BaseMultilayerPerceptron32 struct {
 	Beta2              float32          `json:"beta_2"`
 	Epsilon            float32          `json:"epsilon"`
 	NIterNoChange      int              `json:"n_iter_no_change"`
+	// EmbeddingColumns are the integer columns of X looked up in embedding
+	// tables trained jointly, see EmbeddingColumn
+	EmbeddingColumns []EmbeddingColumn `json:"embedding_columns"`
 
 	// Outputs
-	NLayers       int
-	NIter         int
-	NOutputs      int
-	Intercepts    [][]float32     `json:"intercepts_"`
-	Coefs         []blas32General `json:"coefs_"`
-	OutActivation string          `json:"out_activation_"`
-	Loss          float32
+	NLayers        int
+	NIter          int
+	NOutputs       int
+	Intercepts     [][]float32     `json:"intercepts_"`
+	Coefs          []blas32General `json:"coefs_"`
+	OutActivation  string          `json:"out_activation_"`
+	Embeddings     []blas32General `json:"embeddings_"`
+	BatchNormScale [][]float32     `json:"batch_norm_scale_"`
+	BatchNormMean  [][]float32     `json:"batch_norm_mean_"`
+	BatchNormVar   [][]float32     `json:"batch_norm_var_"`
+	Loss           float32
 
 	// internal
 	t                   int
@@ -69,8 +88,19 @@ type BaseMultilayerPerceptron32 struct {
 	packedParameters    []float32
 	packedGrads         []float32 // packedGrads allow tests to check gradients
 	bestParameters      []float32
-	batchNorm           [][]float32
+	batchMaxAbs         [][]float32 // max abs of the hidden activations of the batch
+	batchNormInvStd     [][]float32 // inverse standard deviation of the batch
+	batchNormXhat       [][]float32 // normalized layers of the batch
+	batchNormScaleGrads [][]float32
+	dropoutMasks        [][]float32
+	dropoutRnd          func() float32
 	lb                  *LabelBinarizer32
+	embeddingGrads      []blas32General
+	embeddingOptimizers []sparseOptimizer32
+	embeddingRows       [][]int   // rows of embeddingGrads looked up in the batch
+	embeddingSeen       [][]bool  // embeddingSeen[i][row] tells if row is in embeddingRows[i]
+	embeddingInput      []float32 // input layer with the embeddings looked up
+	embeddingDeltas     []float32 // deltas of the input layer
 	// beforeMinimize allow test to set weights
 	beforeMinimize func(optimize.Problem, []float64)
 }
@@ -88,7 +118,7 @@ var Activations32 = map[string]func(z blas32General){
 	"tanh": func(z blas32General) {
 		for row, zpos := 0, 0; row < z.Rows; row, zpos = row+1, zpos+z.Stride {
 			for col := 0; col < z.Cols; col++ {
-				z.Data[zpos+col] = M32.Tanh(-z.Data[zpos+col])
+				z.Data[zpos+col] = M32.Tanh(z.Data[zpos+col])
 			}
 		}
 	},
@@ -202,6 +232,13 @@ type Optimizer32 interface {
 	updateParams(grads []float32)
 }
 
+// sparseOptimizer32 is the stochastic optimizer updating the params of some
+// rows only, like the rows of an embedding table looked up in a batch.
+type sparseOptimizer32 interface {
+	Optimizer32
+	updateRows(grads []float32, rows []int, dim int)
+}
+
 func addIntercepts32(a blas32General, b []float32) {
 	for arow, apos := 0, 0; arow < a.Rows; arow, apos = arow+1, apos+a.Stride {
 		for c := 0; c < a.Cols; c++ {
@@ -228,14 +265,15 @@ func matRowMean32(a blas32General, b []float32) {
 func NewBaseMultilayerPerceptron32() *BaseMultilayerPerceptron32 {
 	return &BaseMultilayerPerceptron32{
 
-		Activation:       "relu",
-		Solver:           "adam",
-		Alpha:            0.0001,
-		BatchSize:        200,
-		LearningRate:     "constant",
-		LearningRateInit: 0.001,
-		PowerT:           .5,
-		MaxIter:          200,
+		Activation:        "relu",
+		Solver:            "adam",
+		Alpha:             0.0001,
+		BatchSize:         200,
+		BatchNormMomentum: .1,
+		LearningRate:      "constant",
+		LearningRateInit:  0.001,
+		PowerT:            .5,
+		MaxIter:           200,
 		//LossFuncName       string
 		HiddenLayerSizes: []int{100},
 		Shuffle:          true,
@@ -256,16 +294,28 @@ func NewBaseMultilayerPerceptron32() *BaseMultilayerPerceptron32 {
 
 // forwardPass Perform a forward pass on the network by computing the values
 // of the neurons in the hidden layers and the output layer.
-//        activations : []blas32General, length = nLayers - 1
-func (mlp *BaseMultilayerPerceptron32) forwardPass(activations []blas32General) {
+//
+//	activations : []blas32General, length = nLayers - 1
+//
+// Batch normalization uses the batch statistics and dropout is applied only in training.
+func (mlp *BaseMultilayerPerceptron32) forwardPass(activations []blas32General, training bool) {
 	hiddenActivation := Activations32[mlp.Activation]
 	var i int
 	for i = 0; i < mlp.NLayers-1; i++ {
 		gemm32(blas.NoTrans, blas.NoTrans, 1, activations[i], mlp.Coefs[i], 0, activations[i+1])
-		addIntercepts32(activations[i+1], mlp.Intercepts[i])
 		// For the hidden layers
 		if (i + 1) != (mlp.NLayers - 1) {
+			if mlp.BatchNorm {
+				// intercepts follow the normalization
+				mlp.batchNormForward(i, activations[i+1], training)
+			}
+			addIntercepts32(activations[i+1], mlp.Intercepts[i])
 			hiddenActivation(activations[i+1])
+			if training && mlp.dropoutRate(i) > 0 {
+				mlp.dropout(i, activations[i+1])
+			}
+		} else {
+			addIntercepts32(activations[i+1], mlp.Intercepts[i])
 		}
 	}
 	i = mlp.NLayers - 2
@@ -274,11 +324,78 @@ func (mlp *BaseMultilayerPerceptron32) forwardPass(activations []blas32General)
 	outputActivation(activations[i+1])
 }
 
+// batchNormForward normalizes z of hidden layer by the mean and variance of the
+// batch in training, which update the running mean and variance, or by the
+// running mean and variance for prediction, then multiplies it by the scale
+func (mlp *BaseMultilayerPerceptron32) batchNormForward(layer int, z blas32General, training bool) {
+	mean, variance, scale := mlp.BatchNormMean[layer], mlp.BatchNormVar[layer], mlp.BatchNormScale[layer]
+	if !training {
+		for o := 0; o < z.Cols; o++ {
+			invStd := scale[o] / M32.Sqrt(variance[o]+batchNormEpsilon)
+			for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+				z.Data[rpos+o] = (z.Data[rpos+o] - mean[o]) * invStd
+			}
+		}
+		return
+	}
+	invStd, xhat := mlp.batchNormInvStd[layer], mlp.batchNormXhat[layer]
+	momentum := mlp.BatchNormMomentum
+	if strings.EqualFold(mlp.Solver, "lbfgs") {
+		// the batch is the whole sample
+		momentum = 1
+	}
+	n := float32(z.Rows)
+	for o := 0; o < z.Cols; o++ {
+		var mu, v float32
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			mu += z.Data[rpos+o]
+		}
+		mu /= n
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			d := z.Data[rpos+o] - mu
+			v += d * d
+		}
+		v /= n
+		invStd[o] = 1 / M32.Sqrt(v+batchNormEpsilon)
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			x := (z.Data[rpos+o] - mu) * invStd[o]
+			xhat[r*z.Cols+o] = x
+			z.Data[rpos+o] = x * scale[o]
+		}
+		// running variance is unbiased
+		if z.Rows > 1 {
+			v *= n / (n - 1)
+		}
+		mean[o] += momentum * (mu - mean[o])
+		variance[o] += momentum * (v - variance[o])
+	}
+}
+
+// batchNormBackward computes the gradients of the scales and the intercepts
+// which follow the normalization, and back propagates deltas through the normalization
+func (mlp *BaseMultilayerPerceptron32) batchNormBackward(layer int, deltas blas32General, interceptGrads []float32) {
+	matRowMean32(deltas, interceptGrads)
+	invStd, xhat := mlp.batchNormInvStd[layer], mlp.batchNormXhat[layer]
+	scale, scaleGrads := mlp.BatchNormScale[layer], mlp.batchNormScaleGrads[layer]
+	n := float32(deltas.Rows)
+	for o := 0; o < deltas.Cols; o++ {
+		var dscale float32
+		for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
+			dscale += deltas.Data[rpos+o] * xhat[r*deltas.Cols+o]
+		}
+		dscale /= n
+		scaleGrads[o] = dscale
+		for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
+			deltas.Data[rpos+o] = scale[o] * invStd[o] * (deltas.Data[rpos+o] - interceptGrads[o] - xhat[r*deltas.Cols+o]*dscale)
+		}
+	}
+}
+
 // batchNormalize computes norms of activations and divides activations
 func (mlp *BaseMultilayerPerceptron32) batchNormalize(activations []blas32General) {
 	for i := 0; i < mlp.NLayers-2; i++ {
 		activation := activations[i+1]
-		batchNorm := mlp.batchNorm[i]
+		batchNorm := mlp.batchMaxAbs[i]
 		for o := 0; o < activation.Cols; o++ {
 			M := float32(0)
 			// compute max for layer i, output o
@@ -299,7 +416,7 @@ func (mlp *BaseMultilayerPerceptron32) batchNormalize(activations []blas32Genera
 	}
 }
 
-// batchNormalizeDeltas divides deltas by batchNorm
+// batchNormalizeDeltas divides deltas by batchMaxAbs
 func (mlp *BaseMultilayerPerceptron32) batchNormalizeDeltas(deltas blas32General, batchNorm []float32) {
 	for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
 		for o := 0; o < deltas.Cols; o++ {
@@ -308,6 +425,49 @@ func (mlp *BaseMultilayerPerceptron32) batchNormalizeDeltas(deltas blas32General
 	}
 }
 
+// dropoutRate returns the rate of units dropped in hidden layer
+func (mlp *BaseMultilayerPerceptron32) dropoutRate(layer int) float32 {
+	switch len(mlp.Dropout) {
+	case 0:
+		return 0
+	case 1:
+		return mlp.Dropout[0]
+	}
+	return mlp.Dropout[layer]
+}
+
+// dropout zeroes the units of hidden layer with the dropout rate and scales the
+// others by 1/(1-rate), so the activations need no scaling in prediction
+func (mlp *BaseMultilayerPerceptron32) dropout(layer int, a blas32General) {
+	rate := mlp.dropoutRate(layer)
+	scale, mask := 1/(1-rate), mlp.dropoutMasks[layer]
+	for r, rpos := 0, 0; r < a.Rows; r, rpos = r+1, rpos+a.Stride {
+		for o := 0; o < a.Cols; o++ {
+			m := float32(0)
+			if mlp.dropoutRnd() >= rate {
+				m = scale
+			}
+			mask[r*a.Cols+o] = m
+			a.Data[rpos+o] *= m
+		}
+	}
+}
+
+// dropoutDeltas multiplies deltas by the dropout mask of hidden layer, and
+// restores the activations before dropout for the activation derivative
+func (mlp *BaseMultilayerPerceptron32) dropoutDeltas(layer int, a, deltas blas32General) {
+	mask := mlp.dropoutMasks[layer]
+	for r, apos, dpos := 0, 0, 0; r < a.Rows; r, apos, dpos = r+1, apos+a.Stride, dpos+deltas.Stride {
+		for o := 0; o < a.Cols; o++ {
+			m := mask[r*a.Cols+o]
+			deltas.Data[dpos+o] *= m
+			if m != 0 {
+				a.Data[apos+o] /= m
+			}
+		}
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron32) sumCoefSquares() float32 {
 	s := float32(0)
 	for _, c := range mlp.Coefs {
@@ -327,7 +487,10 @@ func (mlp *BaseMultilayerPerceptron32) computeLossGrad(layer, NSamples int, acti
 	gemm32(blas.Trans, blas.NoTrans, 1/float32(NSamples), activations[layer], deltas[layer], 0, coefGrads[layer])
 	axpy32(len(coefGrads[layer].Data), mlp.Alpha/float32(NSamples), mlp.Coefs[layer].Data, coefGrads[layer].Data)
 	// interceptGrads[layer] = np.mean(deltas[layer], 0)
-	matRowMean32(deltas[layer], interceptGrads[layer])
+	// intercepts of batch normalized layers are computed by batchNormBackward
+	if !mlp.BatchNorm || layer == mlp.NLayers-2 {
+		matRowMean32(deltas[layer], interceptGrads[layer])
+	}
 }
 
 // backprop Compute the MLP loss function and its corresponding derivatives with respect to each parameter: weights and bias vectors.
@@ -341,11 +504,15 @@ func (mlp *BaseMultilayerPerceptron32) computeLossGrad(layer, NSamples int, acti
 func (mlp *BaseMultilayerPerceptron32) backprop(X, y blas32General, activations, deltas, coefGrads []blas32General, interceptGrads [][]float32) float32 {
 	nSamples := X.Rows
 	if mlp.WeightDecay > 0 {
-		for iw := range mlp.packedParameters {
-			mlp.packedParameters[iw] *= (1 - mlp.WeightDecay)
+		dense := mlp.packedParameters[:mlp.denseParams()]
+		for iw := range dense {
+			dense[iw] *= (1 - mlp.WeightDecay)
 		}
 	}
-	mlp.forwardPass(activations)
+	if len(mlp.EmbeddingColumns) > 0 {
+		activations[0] = mlp.lookupEmbeddings(X, mlp.embeddingInput)
+	}
+	mlp.forwardPass(activations, true)
 	if mlp.BatchNormalize {
 		// compute norm of activations for non-terminal layers
 		mlp.batchNormalize(activations)
@@ -379,6 +546,13 @@ func (mlp *BaseMultilayerPerceptron32) backprop(X, y blas32General, activations,
 				D.Data[posc] = H.Data[posc] - y.Data[posc]
 			}
 		}
+		// squared loss of other output activations is chained with their derivative
+		if lossFuncName == "square_loss" {
+			if derivative, ok := Derivatives32[mlp.OutActivation]; ok {
+				derivative(blas32General{Rows: y.Rows, Cols: H.Cols, Stride: H.Stride, Data: H.Data},
+					blas32General{Rows: y.Rows, Cols: D.Cols, Stride: D.Stride, Data: D.Data})
+			}
+		}
 	}
 
 	//# Compute gradient for the last layer
@@ -389,13 +563,19 @@ func (mlp *BaseMultilayerPerceptron32) backprop(X, y blas32General, activations,
 	for i := mlp.NLayers - 2; i >= 1; i-- {
 		//deltas[i - 1] = safeSparseDot(deltas[i], self.coefs_[i].T)
 		gemm32(blas.NoTrans, blas.Trans, 1, deltas[i], mlp.Coefs[i], 0, deltas[i-1])
+		if mlp.dropoutRate(i-1) > 0 {
+			mlp.dropoutDeltas(i-1, activations[i], deltas[i-1])
+		}
 
 		inplaceDerivative := Derivatives32[mlp.Activation]
 		// inplaceDerivative multiplies deltas[i-1] by activation derivative
 		inplaceDerivative(activations[i], deltas[i-1])
 		if mlp.BatchNormalize {
-			// divide deltas by batchNorm
-			mlp.batchNormalizeDeltas(deltas[i-1], mlp.batchNorm[i-1])
+			// divide deltas by batchMaxAbs
+			mlp.batchNormalizeDeltas(deltas[i-1], mlp.batchMaxAbs[i-1])
+		}
+		if mlp.BatchNorm {
+			mlp.batchNormBackward(i-1, deltas[i-1], interceptGrads[i-1])
 		}
 
 		mlp.computeLossGrad(
@@ -403,9 +583,96 @@ func (mlp *BaseMultilayerPerceptron32) backprop(X, y blas32General, activations,
 			interceptGrads)
 
 	}
+	if len(mlp.EmbeddingColumns) > 0 {
+		mlp.embeddingBackprop(X, deltas[0])
+	}
 	return loss
 }
 
+// lookupEmbeddings fills in with the input layer of X: the columns not in
+// EmbeddingColumns followed by the embeddings looked up.
+func (mlp *BaseMultilayerPerceptron32) lookupEmbeddings(X blas32General, in []float32) blas32General {
+	var (
+		width = embeddingInputWidth(mlp.EmbeddingColumns, X.Cols)
+		mask  = embeddingMask(mlp.EmbeddingColumns, X.Cols)
+		out   = blas32General{Rows: X.Rows, Cols: width, Stride: width, Data: in[:X.Rows*width]}
+	)
+	for r, xpos, opos := 0, 0, 0; r < X.Rows; r, xpos, opos = r+1, xpos+X.Stride, opos+width {
+		x, o := X.Data[xpos:xpos+X.Cols], out.Data[opos:opos+width]
+		k := 0
+		for c, v := range x {
+			if !mask[c] {
+				o[k] = v
+				k++
+			}
+		}
+		for i, c := range mlp.EmbeddingColumns {
+			row := c.row(float64(x[c.Column]))
+			copy(o[k:k+c.Dim], mlp.Embeddings[i].Data[row*c.Dim:(row+1)*c.Dim])
+			k += c.Dim
+		}
+	}
+	return out
+}
+
+// embeddingBackprop computes the gradients of the embeddings looked up for X
+// with the deltas of the first layer.
+func (mlp *BaseMultilayerPerceptron32) embeddingBackprop(X, delta blas32General) {
+	width := mlp.Coefs[0].Rows
+	// delta may have more rows than X in last batch
+	delta.Rows = X.Rows
+	dIn := blas32General{Rows: X.Rows, Cols: width, Stride: width, Data: mlp.embeddingDeltas[:X.Rows*width]}
+	gemm32(blas.NoTrans, blas.Trans, 1, delta, mlp.Coefs[0], 0, dIn)
+
+	off := width
+	for _, c := range mlp.EmbeddingColumns {
+		off -= c.Dim
+	}
+	for i, c := range mlp.EmbeddingColumns {
+		// only the rows of the last batch are not zero
+		grad, seen := mlp.embeddingGrads[i], mlp.embeddingSeen[i]
+		for _, row := range mlp.embeddingRows[i] {
+			for j := row * c.Dim; j < (row+1)*c.Dim; j++ {
+				grad.Data[j] = 0
+			}
+			seen[row] = false
+		}
+		rows := mlp.embeddingRows[i][:0]
+		for r, xpos, dpos := 0, 0, off; r < X.Rows; r, xpos, dpos = r+1, xpos+X.Stride, dpos+width {
+			row := c.row(float64(X.Data[xpos+c.Column]))
+			if !seen[row] {
+				seen[row] = true
+				rows = append(rows, row)
+			}
+			axpy32(c.Dim, 1/float32(X.Rows), dIn.Data[dpos:dpos+c.Dim], grad.Data[row*c.Dim:(row+1)*c.Dim])
+		}
+		mlp.embeddingRows[i] = rows
+		off += c.Dim
+	}
+}
+
+// denseParams returns the number of packedParameters not in the embedding
+// tables, which follow the others.
+func (mlp *BaseMultilayerPerceptron32) denseParams() int {
+	n := len(mlp.packedParameters)
+	for _, c := range mlp.EmbeddingColumns {
+		n -= (c.Cardinality + 1) * c.Dim
+	}
+	return n
+}
+
+// updateEmbeddings updates the rows of the embedding tables looked up in the
+// last batch, with the learning rate of the optimizer of the other params.
+func (mlp *BaseMultilayerPerceptron32) updateEmbeddings() {
+	for i, c := range mlp.EmbeddingColumns {
+		opt := mlp.embeddingOptimizers[i]
+		if sgd, ok := mlp.optimizer.(*SGDOptimizer32); ok {
+			opt.(*SGDOptimizer32).LearningRate = sgd.LearningRate
+		}
+		opt.updateRows(mlp.embeddingGrads[i].Data, mlp.embeddingRows[i], c.Dim)
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron32) initialize(yCols int, layerUnits []int, isClassifier, isMultiClass bool) {
 	// # set all attributes, allocate weights etc for first call
 	// # Initialize parameters
@@ -436,26 +703,34 @@ func (mlp *BaseMultilayerPerceptron32) initialize(yCols int, layerUnits []int, i
 	for i := 0; i < mlp.NLayers-1; i++ {
 		off += (1 + layerUnits[i]) * layerUnits[i+1]
 	}
+	for _, c := range mlp.EmbeddingColumns {
+		off += (c.Cardinality + 1) * c.Dim
+	}
+	if mlp.BatchNorm {
+		for i := 1; i < mlp.NLayers-1; i++ {
+			off += layerUnits[i]
+		}
+	}
 	mem := make([]float32, off)
 	mlp.packedParameters = mem[0:off]
+	if mlp.BatchNorm {
+		// allocate inverse standard deviations, scales and running statistics for non-terminal layers
+		mlp.batchNormInvStd = make([][]float32, mlp.NLayers-2)
+		mlp.BatchNormScale = make([][]float32, mlp.NLayers-2)
+		mlp.BatchNormMean = make([][]float32, mlp.NLayers-2)
+		mlp.BatchNormVar = make([][]float32, mlp.NLayers-2)
+	}
+
 	if mlp.BatchNormalize {
-		// allocate batchNorm for non-terminal layers
-		mlp.batchNorm = make([][]float32, mlp.NLayers-2)
+		// allocate batchMaxAbs for non-terminal layers
+		mlp.batchMaxAbs = make([][]float32, mlp.NLayers-2)
 	}
 
 	off = 0
 	if mlp.RandomState == (base.RandomState)(nil) {
 		mlp.RandomState = base.NewLockedSource(uint64(time.Now().UnixNano()))
 	}
-	type Float32er interface {
-		Float32() float32
-	}
-	var rndFloat32 func() float32
-	if float32er, ok := mlp.RandomState.(Float32er); ok {
-		rndFloat32 = float32er.Float32
-	} else {
-		rndFloat32 = rand.New(mlp.RandomState).Float32
-	}
+	rndFloat32 := mlp.randomFloat()
 	for i := 0; i < mlp.NLayers-1; i++ {
 		prevOff := off
 		mlp.Intercepts[i] = mem[off : off+layerUnits[i+1]]
@@ -471,17 +746,67 @@ func (mlp *BaseMultilayerPerceptron32) initialize(yCols int, layerUnits []int, i
 		}
 
 		initBound := M32.Sqrt(factor / float32(fanIn+fanOut))
-		for pos := prevOff; pos < off; pos++ {
-			mem[pos] = rndFloat32() * initBound
+		if scale, normal, ok := weightInitScale(mlp.WeightInit, fanIn, fanOut); ok {
+			// intercepts start at zero
+			for pos := prevOff + fanOut; pos < off; pos++ {
+				if normal {
+					mem[pos] = float32(scale * boxMuller(float64(rndFloat32()), float64(rndFloat32())))
+				} else {
+					mem[pos] = float32(scale * (2*float64(rndFloat32()) - 1))
+				}
+			}
+		} else {
+			for pos := prevOff; pos < off; pos++ {
+				mem[pos] = rndFloat32() * initBound
+			}
 		}
 		if mlp.BatchNormalize && i < mlp.NLayers-2 {
-			mlp.batchNorm[i] = make([]float32, layerUnits[i+1])
+			mlp.batchMaxAbs[i] = make([]float32, layerUnits[i+1])
 		}
+		if mlp.BatchNorm && i < mlp.NLayers-2 {
+			mlp.batchNormInvStd[i] = make([]float32, layerUnits[i+1])
+			mlp.BatchNormMean[i] = make([]float32, layerUnits[i+1])
+			mlp.BatchNormVar[i] = make([]float32, layerUnits[i+1])
+			for o := range mlp.BatchNormVar[i] {
+				mlp.BatchNormVar[i][o] = 1
+			}
+		}
+	}
+	// the scales of batch normalized layers follow the layers in packedParameters,
+	// so they are updated by the optimizers
+	for i := 0; i < mlp.NLayers-2 && mlp.BatchNorm; i++ {
+		mlp.BatchNormScale[i] = mem[off : off+layerUnits[i+1]]
+		for pos := range mlp.BatchNormScale[i] {
+			mlp.BatchNormScale[i][pos] = 1
+		}
+		off += layerUnits[i+1]
+	}
+	// the embeddings are the last, they are updated by the optimizers except
+	// the stochastic ones, which update the rows looked up only
+	mlp.Embeddings = make([]blas32General, len(mlp.EmbeddingColumns))
+	for i, c := range mlp.EmbeddingColumns {
+		size := (c.Cardinality + 1) * c.Dim
+		mlp.Embeddings[i] = blas32General{Rows: c.Cardinality + 1, Cols: c.Dim, Stride: c.Dim, Data: mem[off : off+size]}
+		for pos := off; pos < off+size; pos++ {
+			mem[pos] = (rndFloat32() - .5) / float32(c.Dim)
+		}
+		off += size
 	}
 
 	mlp.BestLoss = M32.Inf(1)
 }
 
+// randomFloat returns the Float32 func of RandomState
+func (mlp *BaseMultilayerPerceptron32) randomFloat() func() float32 {
+	type Float32er interface {
+		Float32() float32
+	}
+	if float32er, ok := mlp.RandomState.(Float32er); ok {
+		return float32er.Float32
+	}
+	return rand.New(mlp.RandomState).Float32
+}
+
 func (mlp *BaseMultilayerPerceptron32) fit(X, y blas32General, incremental bool) {
 	// # Validate input parameters.
 	mlp.validateHyperparameters()
@@ -492,9 +817,10 @@ func (mlp *BaseMultilayerPerceptron32) fit(X, y blas32General, incremental bool)
 	}
 	X, y = mlp.validateInput(X, y, incremental)
 	nSamples, nFeatures := X.Rows, X.Cols
+	validateEmbeddingColumns(mlp.EmbeddingColumns, nFeatures, maxEmbeddingCardinality32)
 
 	mlp.NOutputs = y.Cols
-	layerUnits := append([]int{nFeatures}, mlp.HiddenLayerSizes...)
+	layerUnits := append([]int{embeddingInputWidth(mlp.EmbeddingColumns, nFeatures)}, mlp.HiddenLayerSizes...)
 	layerUnits = append(layerUnits, mlp.NOutputs)
 
 	if mlp.RandomState == nil {
@@ -557,6 +883,37 @@ func (mlp *BaseMultilayerPerceptron32) fit(X, y blas32General, incremental bool)
 		CoefsGrads[i] = blas32General{Rows: layerUnits[i], Cols: layerUnits[i+1], Stride: layerUnits[i+1], Data: packedGrads[off : off+layerUnits[i]*layerUnits[i+1]]}
 		off += layerUnits[i] * layerUnits[i+1]
 	}
+	mlp.batchNormScaleGrads = nil
+	for i := 0; i < mlp.NLayers-2 && mlp.BatchNorm; i++ {
+		mlp.batchNormScaleGrads = append(mlp.batchNormScaleGrads, packedGrads[off:off+layerUnits[i+1]])
+		off += layerUnits[i+1]
+	}
+	if len(mlp.EmbeddingColumns) > 0 {
+		mlp.embeddingGrads = make([]blas32General, len(mlp.EmbeddingColumns))
+		mlp.embeddingRows = make([][]int, len(mlp.EmbeddingColumns))
+		mlp.embeddingSeen = make([][]bool, len(mlp.EmbeddingColumns))
+		for i, c := range mlp.EmbeddingColumns {
+			size := (c.Cardinality + 1) * c.Dim
+			mlp.embeddingGrads[i] = blas32General{Rows: c.Cardinality + 1, Cols: c.Dim, Stride: c.Dim, Data: packedGrads[off : off+size]}
+			mlp.embeddingSeen[i] = make([]bool, c.Cardinality+1)
+			off += size
+		}
+		size := mlp.BatchSize * layerUnits[0]
+		mlp.embeddingInput, mlp.embeddingDeltas = make([]float32, size), make([]float32, size)
+	}
+	mlp.batchNormXhat, mlp.dropoutMasks = nil, nil
+	for i := 0; i < mlp.NLayers-2; i++ {
+		size := mlp.BatchSize * layerUnits[i+1]
+		if mlp.BatchNorm {
+			mlp.batchNormXhat = append(mlp.batchNormXhat, make([]float32, size))
+		}
+		if len(mlp.Dropout) > 0 {
+			mlp.dropoutMasks = append(mlp.dropoutMasks, make([]float32, size))
+		}
+	}
+	if len(mlp.Dropout) > 0 {
+		mlp.dropoutRnd = mlp.randomFloat()
+	}
 
 	if strings.EqualFold(mlp.Solver, "lbfgs") {
 		// # Run the LBFGS solver
@@ -623,6 +980,42 @@ func (mlp *BaseMultilayerPerceptron32) Predict(X mat.Matrix, Y Mutable) {
 	FromDense32(Y, yb)
 }
 
+// PredictProbas do forward pass and fills Y with the output activations,
+// which are the probabilities not converted to classes for classifiers.
+// Y must have NOutputs columns.
+func (mlp *BaseMultilayerPerceptron32) PredictProbas(X mat.Matrix, Y Mutable) {
+	yb := ToDense32(Y)
+	mlp.predictProbas(ToDense32(X).RawMatrix(), yb.RawMatrix())
+
+	FromDense32(Y, yb)
+}
+
+// Activations do forward pass and returns the activations of the hidden
+// layers followed by the output activations.
+func (mlp *BaseMultilayerPerceptron32) Activations(X mat.Matrix) []General32 {
+	x := ToDense32(X).RawMatrix()
+	Y := blas32General{Rows: x.Rows, Cols: mlp.NOutputs, Stride: mlp.NOutputs, Data: make([]float32, x.Rows*mlp.NOutputs)}
+	activations := mlp.predictProbas(x, Y)
+	layers := make([]General32, len(activations)-1)
+	for i, a := range activations[1:] {
+		layers[i] = General32(a)
+	}
+	return layers
+}
+
+// Initialize allocates the coefs and intercepts of layerUnits, the units of
+// the input, hidden and output layers, with random weights to be set before
+// Predict or Fit with WarmStart. OutActivation and LossFuncName are kept if set.
+func (mlp *BaseMultilayerPerceptron32) Initialize(layerUnits []int) {
+	nOutputs := layerUnits[len(layerUnits)-1]
+	outActivation, lossFuncName := mlp.OutActivation, mlp.LossFuncName
+	mlp.initialize(nOutputs, layerUnits, true, nOutputs > 1)
+	mlp.HiddenLayerSizes = append([]int(nil), layerUnits[1:len(layerUnits)-1]...)
+	if outActivation != "" && lossFuncName != "" {
+		mlp.OutActivation, mlp.LossFuncName = outActivation, lossFuncName
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron32) validateHyperparameters() {
 	if mlp.MaxIter <= 0 {
 		log.Panicf("maxIter must be > 0, got %d.", mlp.MaxIter)
@@ -651,6 +1044,26 @@ func (mlp *BaseMultilayerPerceptron32) validateHyperparameters() {
 	if mlp.NIterNoChange <= 0 {
 		log.Panicf("nIterNoChange must be > 0, got %d.", mlp.NIterNoChange)
 	}
+	if mlp.BatchNormMomentum == 0 {
+		mlp.BatchNormMomentum = .1
+	}
+	if mlp.BatchNormMomentum < 0 || mlp.BatchNormMomentum > 1 {
+		log.Panicf("batchNormMomentum must be > 0 and <= 1, got %g.", mlp.BatchNormMomentum)
+	}
+	if len(mlp.Dropout) > 0 {
+		if len(mlp.Dropout) != 1 && len(mlp.Dropout) != len(mlp.HiddenLayerSizes) {
+			log.Panicf("dropout must have 1 or %d rates, got %v.", len(mlp.HiddenLayerSizes), mlp.Dropout)
+		}
+		for _, rate := range mlp.Dropout {
+			if rate < 0 || rate >= 1 {
+				log.Panicf("dropout must be >= 0 and < 1, got %v.", mlp.Dropout)
+			}
+		}
+		if strings.EqualFold(mlp.Solver, "lbfgs") {
+			log.Panicf("dropout is not supported by the lbfgs solver.")
+		}
+	}
+	validateWeightInit(mlp.WeightInit)
 	//# raise ValueError if not registered
 
 	supportedActivations := []string{}
@@ -725,30 +1138,49 @@ func (mlp *BaseMultilayerPerceptron32) fitLbfgs(X, y blas32General, activations,
 	if res.Status != optimize.GradientThreshold && res.Status != optimize.FunctionConvergence {
 		log.Printf("lbfgs optimizer: Maximum iterations (%d) reached and the optimization hasn't converged yet.\n", mlp.MaxIter)
 	}
+	// the last evaluation may be a line search trial, restore the final location
+	for i := range res.X {
+		mlp.packedParameters[i] = float32(res.X[i])
+	}
+	mlp.Loss = float32(res.F)
+	if mlp.BatchNorm {
+		// compute the statistics of the final location
+		mlp.backprop(X, y, activations, deltas, coefGrads, interceptGrads)
+	}
+}
+
+// newOptimizer returns the stochastic optimizer of Solver updating params.
+func (mlp *BaseMultilayerPerceptron32) newOptimizer(params []float32) sparseOptimizer32 {
+	switch mlp.Solver {
+	case "sgd":
+		return &SGDOptimizer32{
+			Params:           params,
+			LearningRateInit: mlp.LearningRateInit,
+			LearningRate:     mlp.LearningRateInit,
+			LRSchedule:       mlp.LearningRate,
+			PowerT:           mlp.PowerT,
+			Momentum:         mlp.Momentum,
+			Nesterov:         mlp.NesterovsMomentum}
+	case "adam":
+		return &AdamOptimizer32{
+			Params:           params,
+			LearningRateInit: mlp.LearningRateInit,
+			LearningRate:     mlp.LearningRateInit,
+			Beta1:            mlp.Beta1, Beta2: mlp.Beta2, Epsilon: mlp.Epsilon,
+		}
+	}
+	return nil
 }
 
 func (mlp *BaseMultilayerPerceptron32) fitStochastic(X, y blas32General, activations, deltas, coefGrads []blas32General,
 	interceptGrads [][]float32, packedGrads []float32, layerUnits []int, incremental bool) {
 	if !incremental || mlp.optimizer == Optimizer32(nil) {
-		params := mlp.packedParameters
-		switch mlp.Solver {
-		case "sgd":
-			mlp.optimizer = &SGDOptimizer32{
-				Params:           params,
-				LearningRateInit: mlp.LearningRateInit,
-				LearningRate:     mlp.LearningRateInit,
-				LRSchedule:       mlp.LearningRate,
-				PowerT:           mlp.PowerT,
-				Momentum:         mlp.Momentum,
-				Nesterov:         mlp.NesterovsMomentum}
-		case "adam":
-			mlp.optimizer = &AdamOptimizer32{
-				Params:           params,
-				LearningRateInit: mlp.LearningRateInit,
-				LearningRate:     mlp.LearningRateInit,
-				Beta1:            mlp.Beta1, Beta2: mlp.Beta2, Epsilon: mlp.Epsilon,
-			}
+		params := mlp.packedParameters[:mlp.denseParams()]
+		mlp.embeddingOptimizers = make([]sparseOptimizer32, len(mlp.Embeddings))
+		for i, e := range mlp.Embeddings {
+			mlp.embeddingOptimizers[i] = mlp.newOptimizer(e.Data)
 		}
+		mlp.optimizer = mlp.newOptimizer(params)
 	}
 	// # earlyStopping in partialFit doesn"t make sense
 	earlyStopping := mlp.EarlyStopping && !incremental
@@ -797,8 +1229,10 @@ func (mlp *BaseMultilayerPerceptron32) fitStochastic(X, y blas32General, activat
 				Ybatch := blas32General(General32(y).RowSlice(batch[0], batch[1]))
 
 				activations[0] = Xbatch
-				for _, a := range activations {
-					a.Rows = Xbatch.Rows
+				// the last batch may be smaller
+				for i := 1; i < len(activations); i++ {
+					activations[i].Rows = Xbatch.Rows
+					deltas[i-1].Rows = Xbatch.Rows
 				}
 
 				//X, y blas32General, activations, deltas, coefGrads []blas32General, interceptGrads
@@ -806,7 +1240,10 @@ func (mlp *BaseMultilayerPerceptron32) fitStochastic(X, y blas32General, activat
 				accumulatedLoss += batchLoss * float32(batch[1]-batch[0])
 
 				//# update weights
-				mlp.optimizer.updateParams(packedGrads)
+				mlp.optimizer.updateParams(packedGrads[:mlp.denseParams()])
+				if len(mlp.EmbeddingColumns) > 0 {
+					mlp.updateEmbeddings()
+				}
 			}
 			mlp.NIter++
 			mlp.Loss = accumulatedLoss / float32(nSamples)
@@ -894,7 +1331,10 @@ func (mlp *BaseMultilayerPerceptron32) updateNoImprovementCount(earlyStopping bo
 	}
 }
 
-func (mlp *BaseMultilayerPerceptron32) predictProbas(X, Y blas32General) {
+func (mlp *BaseMultilayerPerceptron32) predictProbas(X, Y blas32General) []blas32General {
+	if len(mlp.EmbeddingColumns) > 0 {
+		X = mlp.lookupEmbeddings(X, make([]float32, X.Rows*mlp.Coefs[0].Rows))
+	}
 	_, nFeatures := X.Rows, X.Cols
 
 	layerUnits := append([]int{nFeatures}, mlp.HiddenLayerSizes...)
@@ -911,7 +1351,8 @@ func (mlp *BaseMultilayerPerceptron32) predictProbas(X, Y blas32General) {
 		activations = append(activations, activation)
 	}
 	// # forward propagate
-	mlp.forwardPass(activations)
+	mlp.forwardPass(activations, false)
+	return activations
 }
 
 func (mlp *BaseMultilayerPerceptron32) predict(X, Y blas32General) {
@@ -1027,17 +1468,32 @@ func (opt *SGDOptimizer32) updateParams(grads []float32) {
 	if opt.velocities == nil {
 		opt.velocities = make([]float32, len(grads))
 	}
-	for i := range grads {
-		update := opt.Momentum*opt.velocities[i] - opt.LearningRate*grads[i]
-		velocity := update
-		opt.velocities[i] = velocity
-		if opt.Nesterov {
-			opt.Params[i] += opt.Momentum*velocity - opt.LearningRate*grads[i]
-		} else {
-			opt.Params[i] += update
+	for i, grad := range grads {
+		opt.update(i, grad)
+	}
+}
+
+// updateRows is like updateParams but updates the rows of dim params only.
+func (opt *SGDOptimizer32) updateRows(grads []float32, rows []int, dim int) {
+	if opt.velocities == nil {
+		opt.velocities = make([]float32, len(grads))
+	}
+	for _, row := range rows {
+		for i := row * dim; i < (row+1)*dim; i++ {
+			opt.update(i, grads[i])
 		}
 	}
+}
 
+func (opt *SGDOptimizer32) update(i int, grad float32) {
+	update := opt.Momentum*opt.velocities[i] - opt.LearningRate*grad
+	velocity := update
+	opt.velocities[i] = velocity
+	if opt.Nesterov {
+		opt.Params[i] += opt.Momentum*velocity - opt.LearningRate*grad
+	} else {
+		opt.Params[i] += update
+	}
 }
 
 // AdamOptimizer32 is the stochastic adam optimizer
@@ -1071,6 +1527,28 @@ func (opt *AdamOptimizer32) updateParams(grads []float32) {
 	}
 }
 
+// updateRows is like updateParams but updates the rows of dim params only, the
+// moments of the other rows are not decayed, like the lazy adam.
+func (opt *AdamOptimizer32) updateRows(grads []float32, rows []int, dim int) {
+	if opt.t == 0 {
+		opt.ms = make([]float32, len(grads))
+		opt.vs = make([]float32, len(grads))
+		opt.beta1t, opt.beta2t = 1, 1
+	}
+	opt.t++
+	opt.beta1t *= opt.Beta1
+	opt.beta2t *= opt.Beta2
+	opt.LearningRate = opt.LearningRateInit * M32.Sqrt(1-opt.beta2t) / (1. - opt.beta1t)
+	for _, row := range rows {
+		for i := row * dim; i < (row+1)*dim; i++ {
+			grad := grads[i]
+			opt.ms[i] = opt.Beta1*opt.ms[i] + (1-opt.Beta1)*grad
+			opt.vs[i] = opt.Beta2*opt.vs[i] + (1-opt.Beta2)*grad*grad
+			opt.Params[i] -= opt.LearningRate * opt.ms[i] / (M32.Sqrt(opt.vs[i]) + opt.Epsilon)
+		}
+	}
+}
+
 func toLogits32(ym blas32General) {
 	for i, ypos := 0, 0; i < ym.Rows; i, ypos = i+1, ypos+ym.Stride {
 		if ym.Cols == 1 {
@@ -1141,22 +1619,89 @@ func (mlp *BaseMultilayerPerceptron32) SetParams(params map[string]interface{})
 	r := reflect.Indirect(reflect.ValueOf(mlp))
 	for k, v := range params {
 		field := r.FieldByNameFunc(func(s string) bool {
-			return strings.EqualFold(s, k)
+			return paramMatches(s, k)
 		})
 		if field.Kind() != 0 {
-			field.Set(reflect.ValueOf(v))
+			setParam(field, v)
 		}
 	}
 }
 
+// Marshal returns the json of params, coefs_ and intercepts_ in the format
+// of Unmarshal, so a fitted mlp could be restored for prediction.
+func (mlp *BaseMultilayerPerceptron32) Marshal() ([]byte, error) {
+	coefs := make([][][]float32, len(mlp.Coefs))
+	for i, c := range mlp.Coefs {
+		coefs[i] = rowsOf32(c)
+	}
+	embeddings := make([][][]float32, len(mlp.Embeddings))
+	for i, e := range mlp.Embeddings {
+		embeddings[i] = rowsOf32(e)
+	}
+	mp := map[string]interface{}{
+		"activation":          mlp.Activation,
+		"solver":              mlp.Solver,
+		"alpha":               mlp.Alpha,
+		"weight_decay":        mlp.WeightDecay,
+		"batch_size":          mlp.BatchSize,
+		"batch_normalize":     mlp.BatchNormalize,
+		"batch_norm":          mlp.BatchNorm,
+		"batch_norm_momentum": mlp.BatchNormMomentum,
+		"dropout":             mlp.Dropout,
+		"weight_init":         mlp.WeightInit,
+		"learning_rate":       mlp.LearningRate,
+		"learning_rate_init":  mlp.LearningRateInit,
+		"power_t":             mlp.PowerT,
+		"max_iter":            mlp.MaxIter,
+		"loss_func_name":      mlp.LossFuncName,
+		"hidden_layer_sizes":  mlp.HiddenLayerSizes,
+		"shuffle":             mlp.Shuffle,
+		"tol":                 mlp.Tol,
+		"verbose":             mlp.Verbose,
+		"warm_start":          mlp.WarmStart,
+		"momentum":            mlp.Momentum,
+		"nesterovs_momentum":  mlp.NesterovsMomentum,
+		"early_stopping":      mlp.EarlyStopping,
+		"validation_fraction": mlp.ValidationFraction,
+		"beta_1":              mlp.Beta1,
+		"beta_2":              mlp.Beta2,
+		"epsilon":             mlp.Epsilon,
+		"n_iter_no_change":    mlp.NIterNoChange,
+		"embedding_columns":   mlp.EmbeddingColumns,
+		"out_activation_":     mlp.OutActivation,
+		"intercepts_":         mlp.Intercepts,
+		"coefs_":              coefs,
+		"embeddings_":         embeddings,
+		"batch_norm_scale_":   mlp.BatchNormScale,
+		"batch_norm_mean_":    mlp.BatchNormMean,
+		"batch_norm_var_":     mlp.BatchNormVar,
+	}
+	if mlp.lb != nil {
+		mp["classes_"] = mlp.lb.Classes
+	}
+	return json.Marshal(mp)
+}
+
 // Unmarshal init params intercepts_ coefs_ from json
 func (mlp *BaseMultilayerPerceptron32) Unmarshal(buf []byte) error {
 	type Map = map[string]interface{}
 	mp := Map{}
 	err := json.Unmarshal(buf, &mp)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	var embs struct {
+		EmbeddingColumns []EmbeddingColumn `json:"embedding_columns"`
+		Embeddings       [][][]float32     `json:"embeddings_"`
+		Dropout          []float32         `json:"dropout"`
+		BatchNormScale   [][]float32       `json:"batch_norm_scale_"`
+		BatchNormMean    [][]float32       `json:"batch_norm_mean_"`
+		BatchNormVar     [][]float32       `json:"batch_norm_var_"`
+	}
+	if err = json.Unmarshal(buf, &embs); err != nil {
+		return err
 	}
+	mlp.EmbeddingColumns, mlp.Dropout = embs.EmbeddingColumns, embs.Dropout
 	if params, ok := mp["params"]; ok {
 		if pmap, ok := params.(Map); ok {
 			mlp.SetParams(pmap)
@@ -1195,7 +1740,13 @@ func (mlp *BaseMultilayerPerceptron32) Unmarshal(buf []byte) error {
 				packedSize += (1 + layerUnits[il]) * layerUnits[il+1]
 			}
 			layerUnits[mlp.NLayers-1] = mlp.NOutputs
+			// keep the output of a marshaled regressor
+			outActivation, lossFuncName := mlp.OutActivation, mlp.LossFuncName
 			mlp.initialize(mlp.NOutputs, layerUnits, true, mlp.NOutputs > 1)
+			copy(mlp.HiddenLayerSizes, layerUnits[1:mlp.NLayers-1])
+			if outActivation != "" && lossFuncName != "" {
+				mlp.OutActivation, mlp.LossFuncName = outActivation, lossFuncName
+			}
 
 			for i := 0; i < mlp.NLayers-1; i++ {
 				intercept64 := floats64FromInterface(intercepts2[i])
@@ -1205,13 +1756,63 @@ func (mlp *BaseMultilayerPerceptron32) Unmarshal(buf []byte) error {
 				g := General32(mlp.Coefs[i])
 				(&g).Copy(General64(b64coefs[i]))
 			}
+			if len(embs.Embeddings) != len(mlp.Embeddings) {
+				return fmt.Errorf("embeddings_ must have %d tables, got %d", len(mlp.Embeddings), len(embs.Embeddings))
+			}
+			for i, table := range embs.Embeddings {
+				e := mlp.Embeddings[i]
+				if len(table) != e.Rows {
+					return fmt.Errorf("embeddings_[%d] must have %d rows, got %d", i, e.Rows, len(table))
+				}
+				for r, row := range table {
+					if len(row) != e.Cols {
+						return fmt.Errorf("embeddings_[%d] must have %d cols, got %d", i, e.Cols, len(row))
+					}
+					copy(e.Data[r*e.Stride:], row)
+				}
+			}
+			// models saved without batch normalization parameters keep
+			// scale 1, mean 0 and variance 1
+			if embs.BatchNormMean != nil {
+				if err = copyBatchNormParams32(mlp.BatchNormScale, embs.BatchNormScale); err != nil {
+					return err
+				}
+				if err = copyBatchNormParams32(mlp.BatchNormMean, embs.BatchNormMean); err != nil {
+					return err
+				}
+				if err = copyBatchNormParams32(mlp.BatchNormVar, embs.BatchNormVar); err != nil {
+					return err
+				}
+			}
 		} else {
 			return fmt.Errorf("coefs_ must be [][][]float64, found %T", coefs)
 		}
 	}
+	if classes, ok := mp["classes_"].([]interface{}); ok {
+		mlp.lb = NewLabelBinarizer32(0, 1)
+		mlp.lb.Classes = make([][]float32, len(classes))
+		for i, c := range classes {
+			for _, v := range floats64FromInterface(c) {
+				mlp.lb.Classes[i] = append(mlp.lb.Classes[i], float32(v))
+			}
+		}
+	}
 	return err
 }
 
+func copyBatchNormParams32(dst, src [][]float32) error {
+	if len(src) != len(dst) {
+		return fmt.Errorf("batch norm parameters must have %d layers, got %d", len(dst), len(src))
+	}
+	for i := range src {
+		if len(src[i]) != len(dst[i]) {
+			return fmt.Errorf("batch norm parameters of layer %d must have %d units, got %d", i, len(dst[i]), len(src[i]))
+		}
+		copy(dst[i], src[i])
+	}
+	return nil
+}
+
 // ToDense32 returns w view of m if m is a RawMatrixer, et returns a dense copy of m
 func ToDense32(m Matrix) General32 {
 	if d, ok := m.(General32); ok {
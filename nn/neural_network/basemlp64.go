@@ -23,12 +23,24 @@ import (
 
 // BaseMultilayerPerceptron64 closely matches sklearn/neural_network/multilayer_perceptron.py
 type BaseMultilayerPerceptron64 struct {
-	Activation         string  `json:"activation"`
-	Solver             string  `json:"solver"`
-	Alpha              float64 `json:"alpha"`
-	WeightDecay        float64 `json:"weight_decay"`
-	BatchSize          int     `json:"batch_size"`
-	BatchNormalize     bool
+	Activation     string  `json:"activation"`
+	Solver         string  `json:"solver"`
+	Alpha          float64 `json:"alpha"`
+	WeightDecay    float64 `json:"weight_decay"`
+	BatchSize      int     `json:"batch_size"`
+	BatchNormalize bool
+	// BatchNorm normalizes the hidden layers by the mean and variance of each
+	// batch and learns a scale per unit, Predict uses the running statistics
+	BatchNorm bool `json:"batch_norm"`
+	// BatchNormMomentum is the weight of the batch statistics in the running
+	// mean and variance of BatchNorm, which are used by Predict, default .1
+	BatchNormMomentum float64 `json:"batch_norm_momentum"`
+	// Dropout is the rate of units dropped in training, one rate for all the
+	// hidden layers or one per hidden layer
+	Dropout []float64 `json:"dropout"`
+	// WeightInit is one of xavier_uniform, xavier_normal, he_uniform and he_normal,
+	// default "" draws in [0, sqrt(6/(fanIn+fanOut))), sqrt(2/...) for logistic
+	WeightInit         string           `json:"weight_init"`
 	LearningRate       string           `json:"learning_rate"`
 	LearningRateInit   float64          `json:"learning_rate_init"`
 	PowerT             float64          `json:"power_t"`
@@ -48,15 +60,22 @@ type BaseMultilayerPerceptron64 struct {
 	Beta2              float64          `json:"beta_2"`
 	Epsilon            float64          `json:"epsilon"`
 	NIterNoChange      int              `json:"n_iter_no_change"`
+	// EmbeddingColumns are the integer columns of X looked up in embedding
+	// tables trained jointly, see EmbeddingColumn
+	EmbeddingColumns []EmbeddingColumn `json:"embedding_columns"`
 
 	// Outputs
-	NLayers       int
-	NIter         int
-	NOutputs      int
-	Intercepts    [][]float64     `json:"intercepts_"`
-	Coefs         []blas64General `json:"coefs_"`
-	OutActivation string          `json:"out_activation_"`
-	Loss          float64
+	NLayers        int
+	NIter          int
+	NOutputs       int
+	Intercepts     [][]float64     `json:"intercepts_"`
+	Coefs          []blas64General `json:"coefs_"`
+	OutActivation  string          `json:"out_activation_"`
+	Embeddings     []blas64General `json:"embeddings_"`
+	BatchNormScale [][]float64     `json:"batch_norm_scale_"`
+	BatchNormMean  [][]float64     `json:"batch_norm_mean_"`
+	BatchNormVar   [][]float64     `json:"batch_norm_var_"`
+	Loss           float64
 
 	// internal
 	t                   int
@@ -69,8 +88,19 @@ type BaseMultilayerPerceptron64 struct {
 	packedParameters    []float64
 	packedGrads         []float64 // packedGrads allow tests to check gradients
 	bestParameters      []float64
-	batchNorm           [][]float64
+	batchMaxAbs         [][]float64 // max abs of the hidden activations of the batch
+	batchNormInvStd     [][]float64 // inverse standard deviation of the batch
+	batchNormXhat       [][]float64 // normalized layers of the batch
+	batchNormScaleGrads [][]float64
+	dropoutMasks        [][]float64
+	dropoutRnd          func() float64
 	lb                  *LabelBinarizer64
+	embeddingGrads      []blas64General
+	embeddingOptimizers []sparseOptimizer64
+	embeddingRows       [][]int   // rows of embeddingGrads looked up in the batch
+	embeddingSeen       [][]bool  // embeddingSeen[i][row] tells if row is in embeddingRows[i]
+	embeddingInput      []float64 // input layer with the embeddings looked up
+	embeddingDeltas     []float64 // deltas of the input layer
 	// beforeMinimize allow test to set weights
 	beforeMinimize func(optimize.Problem, []float64)
 }
@@ -88,7 +118,7 @@ var Activations64 = map[string]func(z blas64General){
 	"tanh": func(z blas64General) {
 		for row, zpos := 0, 0; row < z.Rows; row, zpos = row+1, zpos+z.Stride {
 			for col := 0; col < z.Cols; col++ {
-				z.Data[zpos+col] = M64.Tanh(-z.Data[zpos+col])
+				z.Data[zpos+col] = M64.Tanh(z.Data[zpos+col])
 			}
 		}
 	},
@@ -202,6 +232,13 @@ type Optimizer64 interface {
 	updateParams(grads []float64)
 }
 
+// sparseOptimizer64 is the stochastic optimizer updating the params of some
+// rows only, like the rows of an embedding table looked up in a batch.
+type sparseOptimizer64 interface {
+	Optimizer64
+	updateRows(grads []float64, rows []int, dim int)
+}
+
 func addIntercepts64(a blas64General, b []float64) {
 	for arow, apos := 0, 0; arow < a.Rows; arow, apos = arow+1, apos+a.Stride {
 		for c := 0; c < a.Cols; c++ {
@@ -227,14 +264,15 @@ func matRowMean64(a blas64General, b []float64) {
 // NewBaseMultilayerPerceptron64 returns a BaseMultilayerPerceptron64 with defaults
 func NewBaseMultilayerPerceptron64() *BaseMultilayerPerceptron64 {
 	return &BaseMultilayerPerceptron64{
-		Activation:       "relu",
-		Solver:           "adam",
-		Alpha:            0.0001,
-		BatchSize:        200,
-		LearningRate:     "constant",
-		LearningRateInit: 0.001,
-		PowerT:           .5,
-		MaxIter:          200,
+		Activation:        "relu",
+		Solver:            "adam",
+		Alpha:             0.0001,
+		BatchSize:         200,
+		BatchNormMomentum: .1,
+		LearningRate:      "constant",
+		LearningRateInit:  0.001,
+		PowerT:            .5,
+		MaxIter:           200,
 		//LossFuncName       string
 		HiddenLayerSizes: []int{100},
 		Shuffle:          true,
@@ -255,16 +293,28 @@ func NewBaseMultilayerPerceptron64() *BaseMultilayerPerceptron64 {
 
 // forwardPass Perform a forward pass on the network by computing the values
 // of the neurons in the hidden layers and the output layer.
-//        activations : []blas64General, length = nLayers - 1
-func (mlp *BaseMultilayerPerceptron64) forwardPass(activations []blas64General) {
+//
+//	activations : []blas64General, length = nLayers - 1
+//
+// Batch normalization uses the batch statistics and dropout is applied only in training.
+func (mlp *BaseMultilayerPerceptron64) forwardPass(activations []blas64General, training bool) {
 	hiddenActivation := Activations64[mlp.Activation]
 	var i int
 	for i = 0; i < mlp.NLayers-1; i++ {
 		gemm64(blas.NoTrans, blas.NoTrans, 1, activations[i], mlp.Coefs[i], 0, activations[i+1])
-		addIntercepts64(activations[i+1], mlp.Intercepts[i])
 		// For the hidden layers
 		if (i + 1) != (mlp.NLayers - 1) {
+			if mlp.BatchNorm {
+				// intercepts follow the normalization
+				mlp.batchNormForward(i, activations[i+1], training)
+			}
+			addIntercepts64(activations[i+1], mlp.Intercepts[i])
 			hiddenActivation(activations[i+1])
+			if training && mlp.dropoutRate(i) > 0 {
+				mlp.dropout(i, activations[i+1])
+			}
+		} else {
+			addIntercepts64(activations[i+1], mlp.Intercepts[i])
 		}
 	}
 	i = mlp.NLayers - 2
@@ -273,11 +323,78 @@ func (mlp *BaseMultilayerPerceptron64) forwardPass(activations []blas64General)
 	outputActivation(activations[i+1])
 }
 
+// batchNormForward normalizes z of hidden layer by the mean and variance of the
+// batch in training, which update the running mean and variance, or by the
+// running mean and variance for prediction, then multiplies it by the scale
+func (mlp *BaseMultilayerPerceptron64) batchNormForward(layer int, z blas64General, training bool) {
+	mean, variance, scale := mlp.BatchNormMean[layer], mlp.BatchNormVar[layer], mlp.BatchNormScale[layer]
+	if !training {
+		for o := 0; o < z.Cols; o++ {
+			invStd := scale[o] / M64.Sqrt(variance[o]+batchNormEpsilon)
+			for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+				z.Data[rpos+o] = (z.Data[rpos+o] - mean[o]) * invStd
+			}
+		}
+		return
+	}
+	invStd, xhat := mlp.batchNormInvStd[layer], mlp.batchNormXhat[layer]
+	momentum := mlp.BatchNormMomentum
+	if strings.EqualFold(mlp.Solver, "lbfgs") {
+		// the batch is the whole sample
+		momentum = 1
+	}
+	n := float64(z.Rows)
+	for o := 0; o < z.Cols; o++ {
+		var mu, v float64
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			mu += z.Data[rpos+o]
+		}
+		mu /= n
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			d := z.Data[rpos+o] - mu
+			v += d * d
+		}
+		v /= n
+		invStd[o] = 1 / M64.Sqrt(v+batchNormEpsilon)
+		for r, rpos := 0, 0; r < z.Rows; r, rpos = r+1, rpos+z.Stride {
+			x := (z.Data[rpos+o] - mu) * invStd[o]
+			xhat[r*z.Cols+o] = x
+			z.Data[rpos+o] = x * scale[o]
+		}
+		// running variance is unbiased
+		if z.Rows > 1 {
+			v *= n / (n - 1)
+		}
+		mean[o] += momentum * (mu - mean[o])
+		variance[o] += momentum * (v - variance[o])
+	}
+}
+
+// batchNormBackward computes the gradients of the scales and the intercepts
+// which follow the normalization, and back propagates deltas through the normalization
+func (mlp *BaseMultilayerPerceptron64) batchNormBackward(layer int, deltas blas64General, interceptGrads []float64) {
+	matRowMean64(deltas, interceptGrads)
+	invStd, xhat := mlp.batchNormInvStd[layer], mlp.batchNormXhat[layer]
+	scale, scaleGrads := mlp.BatchNormScale[layer], mlp.batchNormScaleGrads[layer]
+	n := float64(deltas.Rows)
+	for o := 0; o < deltas.Cols; o++ {
+		var dscale float64
+		for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
+			dscale += deltas.Data[rpos+o] * xhat[r*deltas.Cols+o]
+		}
+		dscale /= n
+		scaleGrads[o] = dscale
+		for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
+			deltas.Data[rpos+o] = scale[o] * invStd[o] * (deltas.Data[rpos+o] - interceptGrads[o] - xhat[r*deltas.Cols+o]*dscale)
+		}
+	}
+}
+
 // batchNormalize computes norms of activations and divides activations
 func (mlp *BaseMultilayerPerceptron64) batchNormalize(activations []blas64General) {
 	for i := 0; i < mlp.NLayers-2; i++ {
 		activation := activations[i+1]
-		batchNorm := mlp.batchNorm[i]
+		batchNorm := mlp.batchMaxAbs[i]
 		for o := 0; o < activation.Cols; o++ {
 			M := float64(0)
 			// compute max for layer i, output o
@@ -298,7 +415,7 @@ func (mlp *BaseMultilayerPerceptron64) batchNormalize(activations []blas64Genera
 	}
 }
 
-// batchNormalizeDeltas divides deltas by batchNorm
+// batchNormalizeDeltas divides deltas by batchMaxAbs
 func (mlp *BaseMultilayerPerceptron64) batchNormalizeDeltas(deltas blas64General, batchNorm []float64) {
 	for r, rpos := 0, 0; r < deltas.Rows; r, rpos = r+1, rpos+deltas.Stride {
 		for o := 0; o < deltas.Cols; o++ {
@@ -307,6 +424,49 @@ func (mlp *BaseMultilayerPerceptron64) batchNormalizeDeltas(deltas blas64General
 	}
 }
 
+// dropoutRate returns the rate of units dropped in hidden layer
+func (mlp *BaseMultilayerPerceptron64) dropoutRate(layer int) float64 {
+	switch len(mlp.Dropout) {
+	case 0:
+		return 0
+	case 1:
+		return mlp.Dropout[0]
+	}
+	return mlp.Dropout[layer]
+}
+
+// dropout zeroes the units of hidden layer with the dropout rate and scales the
+// others by 1/(1-rate), so the activations need no scaling in prediction
+func (mlp *BaseMultilayerPerceptron64) dropout(layer int, a blas64General) {
+	rate := mlp.dropoutRate(layer)
+	scale, mask := 1/(1-rate), mlp.dropoutMasks[layer]
+	for r, rpos := 0, 0; r < a.Rows; r, rpos = r+1, rpos+a.Stride {
+		for o := 0; o < a.Cols; o++ {
+			m := float64(0)
+			if mlp.dropoutRnd() >= rate {
+				m = scale
+			}
+			mask[r*a.Cols+o] = m
+			a.Data[rpos+o] *= m
+		}
+	}
+}
+
+// dropoutDeltas multiplies deltas by the dropout mask of hidden layer, and
+// restores the activations before dropout for the activation derivative
+func (mlp *BaseMultilayerPerceptron64) dropoutDeltas(layer int, a, deltas blas64General) {
+	mask := mlp.dropoutMasks[layer]
+	for r, apos, dpos := 0, 0, 0; r < a.Rows; r, apos, dpos = r+1, apos+a.Stride, dpos+deltas.Stride {
+		for o := 0; o < a.Cols; o++ {
+			m := mask[r*a.Cols+o]
+			deltas.Data[dpos+o] *= m
+			if m != 0 {
+				a.Data[apos+o] /= m
+			}
+		}
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron64) sumCoefSquares() float64 {
 	s := float64(0)
 	for _, c := range mlp.Coefs {
@@ -326,7 +486,10 @@ func (mlp *BaseMultilayerPerceptron64) computeLossGrad(layer, NSamples int, acti
 	gemm64(blas.Trans, blas.NoTrans, 1/float64(NSamples), activations[layer], deltas[layer], 0, coefGrads[layer])
 	axpy64(len(coefGrads[layer].Data), mlp.Alpha/float64(NSamples), mlp.Coefs[layer].Data, coefGrads[layer].Data)
 	// interceptGrads[layer] = np.mean(deltas[layer], 0)
-	matRowMean64(deltas[layer], interceptGrads[layer])
+	// intercepts of batch normalized layers are computed by batchNormBackward
+	if !mlp.BatchNorm || layer == mlp.NLayers-2 {
+		matRowMean64(deltas[layer], interceptGrads[layer])
+	}
 }
 
 // backprop Compute the MLP loss function and its corresponding derivatives with respect to each parameter: weights and bias vectors.
@@ -340,11 +503,15 @@ func (mlp *BaseMultilayerPerceptron64) computeLossGrad(layer, NSamples int, acti
 func (mlp *BaseMultilayerPerceptron64) backprop(X, y blas64General, activations, deltas, coefGrads []blas64General, interceptGrads [][]float64) float64 {
 	nSamples := X.Rows
 	if mlp.WeightDecay > 0 {
-		for iw := range mlp.packedParameters {
-			mlp.packedParameters[iw] *= (1 - mlp.WeightDecay)
+		dense := mlp.packedParameters[:mlp.denseParams()]
+		for iw := range dense {
+			dense[iw] *= (1 - mlp.WeightDecay)
 		}
 	}
-	mlp.forwardPass(activations)
+	if len(mlp.EmbeddingColumns) > 0 {
+		activations[0] = mlp.lookupEmbeddings(X, mlp.embeddingInput)
+	}
+	mlp.forwardPass(activations, true)
 	if mlp.BatchNormalize {
 		// compute norm of activations for non-terminal layers
 		mlp.batchNormalize(activations)
@@ -378,6 +545,13 @@ func (mlp *BaseMultilayerPerceptron64) backprop(X, y blas64General, activations,
 				D.Data[posc] = H.Data[posc] - y.Data[posc]
 			}
 		}
+		// squared loss of other output activations is chained with their derivative
+		if lossFuncName == "square_loss" {
+			if derivative, ok := Derivatives64[mlp.OutActivation]; ok {
+				derivative(blas64General{Rows: y.Rows, Cols: H.Cols, Stride: H.Stride, Data: H.Data},
+					blas64General{Rows: y.Rows, Cols: D.Cols, Stride: D.Stride, Data: D.Data})
+			}
+		}
 	}
 
 	//# Compute gradient for the last layer
@@ -388,13 +562,19 @@ func (mlp *BaseMultilayerPerceptron64) backprop(X, y blas64General, activations,
 	for i := mlp.NLayers - 2; i >= 1; i-- {
 		//deltas[i - 1] = safeSparseDot(deltas[i], self.coefs_[i].T)
 		gemm64(blas.NoTrans, blas.Trans, 1, deltas[i], mlp.Coefs[i], 0, deltas[i-1])
+		if mlp.dropoutRate(i-1) > 0 {
+			mlp.dropoutDeltas(i-1, activations[i], deltas[i-1])
+		}
 
 		inplaceDerivative := Derivatives64[mlp.Activation]
 		// inplaceDerivative multiplies deltas[i-1] by activation derivative
 		inplaceDerivative(activations[i], deltas[i-1])
 		if mlp.BatchNormalize {
-			// divide deltas by batchNorm
-			mlp.batchNormalizeDeltas(deltas[i-1], mlp.batchNorm[i-1])
+			// divide deltas by batchMaxAbs
+			mlp.batchNormalizeDeltas(deltas[i-1], mlp.batchMaxAbs[i-1])
+		}
+		if mlp.BatchNorm {
+			mlp.batchNormBackward(i-1, deltas[i-1], interceptGrads[i-1])
 		}
 
 		mlp.computeLossGrad(
@@ -402,9 +582,96 @@ func (mlp *BaseMultilayerPerceptron64) backprop(X, y blas64General, activations,
 			interceptGrads)
 
 	}
+	if len(mlp.EmbeddingColumns) > 0 {
+		mlp.embeddingBackprop(X, deltas[0])
+	}
 	return loss
 }
 
+// lookupEmbeddings fills in with the input layer of X: the columns not in
+// EmbeddingColumns followed by the embeddings looked up.
+func (mlp *BaseMultilayerPerceptron64) lookupEmbeddings(X blas64General, in []float64) blas64General {
+	var (
+		width = embeddingInputWidth(mlp.EmbeddingColumns, X.Cols)
+		mask  = embeddingMask(mlp.EmbeddingColumns, X.Cols)
+		out   = blas64General{Rows: X.Rows, Cols: width, Stride: width, Data: in[:X.Rows*width]}
+	)
+	for r, xpos, opos := 0, 0, 0; r < X.Rows; r, xpos, opos = r+1, xpos+X.Stride, opos+width {
+		x, o := X.Data[xpos:xpos+X.Cols], out.Data[opos:opos+width]
+		k := 0
+		for c, v := range x {
+			if !mask[c] {
+				o[k] = v
+				k++
+			}
+		}
+		for i, c := range mlp.EmbeddingColumns {
+			row := c.row(float64(x[c.Column]))
+			copy(o[k:k+c.Dim], mlp.Embeddings[i].Data[row*c.Dim:(row+1)*c.Dim])
+			k += c.Dim
+		}
+	}
+	return out
+}
+
+// embeddingBackprop computes the gradients of the embeddings looked up for X
+// with the deltas of the first layer.
+func (mlp *BaseMultilayerPerceptron64) embeddingBackprop(X, delta blas64General) {
+	width := mlp.Coefs[0].Rows
+	// delta may have more rows than X in last batch
+	delta.Rows = X.Rows
+	dIn := blas64General{Rows: X.Rows, Cols: width, Stride: width, Data: mlp.embeddingDeltas[:X.Rows*width]}
+	gemm64(blas.NoTrans, blas.Trans, 1, delta, mlp.Coefs[0], 0, dIn)
+
+	off := width
+	for _, c := range mlp.EmbeddingColumns {
+		off -= c.Dim
+	}
+	for i, c := range mlp.EmbeddingColumns {
+		// only the rows of the last batch are not zero
+		grad, seen := mlp.embeddingGrads[i], mlp.embeddingSeen[i]
+		for _, row := range mlp.embeddingRows[i] {
+			for j := row * c.Dim; j < (row+1)*c.Dim; j++ {
+				grad.Data[j] = 0
+			}
+			seen[row] = false
+		}
+		rows := mlp.embeddingRows[i][:0]
+		for r, xpos, dpos := 0, 0, off; r < X.Rows; r, xpos, dpos = r+1, xpos+X.Stride, dpos+width {
+			row := c.row(float64(X.Data[xpos+c.Column]))
+			if !seen[row] {
+				seen[row] = true
+				rows = append(rows, row)
+			}
+			axpy64(c.Dim, 1/float64(X.Rows), dIn.Data[dpos:dpos+c.Dim], grad.Data[row*c.Dim:(row+1)*c.Dim])
+		}
+		mlp.embeddingRows[i] = rows
+		off += c.Dim
+	}
+}
+
+// denseParams returns the number of packedParameters not in the embedding
+// tables, which follow the others.
+func (mlp *BaseMultilayerPerceptron64) denseParams() int {
+	n := len(mlp.packedParameters)
+	for _, c := range mlp.EmbeddingColumns {
+		n -= (c.Cardinality + 1) * c.Dim
+	}
+	return n
+}
+
+// updateEmbeddings updates the rows of the embedding tables looked up in the
+// last batch, with the learning rate of the optimizer of the other params.
+func (mlp *BaseMultilayerPerceptron64) updateEmbeddings() {
+	for i, c := range mlp.EmbeddingColumns {
+		opt := mlp.embeddingOptimizers[i]
+		if sgd, ok := mlp.optimizer.(*SGDOptimizer64); ok {
+			opt.(*SGDOptimizer64).LearningRate = sgd.LearningRate
+		}
+		opt.updateRows(mlp.embeddingGrads[i].Data, mlp.embeddingRows[i], c.Dim)
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron64) initialize(yCols int, layerUnits []int, isClassifier, isMultiClass bool) {
 	// # set all attributes, allocate weights etc for first call
 	// # Initialize parameters
@@ -435,26 +702,34 @@ func (mlp *BaseMultilayerPerceptron64) initialize(yCols int, layerUnits []int, i
 	for i := 0; i < mlp.NLayers-1; i++ {
 		off += (1 + layerUnits[i]) * layerUnits[i+1]
 	}
+	for _, c := range mlp.EmbeddingColumns {
+		off += (c.Cardinality + 1) * c.Dim
+	}
+	if mlp.BatchNorm {
+		for i := 1; i < mlp.NLayers-1; i++ {
+			off += layerUnits[i]
+		}
+	}
 	mem := make([]float64, off)
 	mlp.packedParameters = mem[0:off]
+	if mlp.BatchNorm {
+		// allocate inverse standard deviations, scales and running statistics for non-terminal layers
+		mlp.batchNormInvStd = make([][]float64, mlp.NLayers-2)
+		mlp.BatchNormScale = make([][]float64, mlp.NLayers-2)
+		mlp.BatchNormMean = make([][]float64, mlp.NLayers-2)
+		mlp.BatchNormVar = make([][]float64, mlp.NLayers-2)
+	}
+
 	if mlp.BatchNormalize {
-		// allocate batchNorm for non-terminal layers
-		mlp.batchNorm = make([][]float64, mlp.NLayers-2)
+		// allocate batchMaxAbs for non-terminal layers
+		mlp.batchMaxAbs = make([][]float64, mlp.NLayers-2)
 	}
 
 	off = 0
 	if mlp.RandomState == (base.RandomState)(nil) {
 		mlp.RandomState = base.NewLockedSource(uint64(time.Now().UnixNano()))
 	}
-	type Float64er interface {
-		Float64() float64
-	}
-	var rndFloat64 func() float64
-	if float64er, ok := mlp.RandomState.(Float64er); ok {
-		rndFloat64 = float64er.Float64
-	} else {
-		rndFloat64 = rand.New(mlp.RandomState).Float64
-	}
+	rndFloat64 := mlp.randomFloat()
 	for i := 0; i < mlp.NLayers-1; i++ {
 		prevOff := off
 		mlp.Intercepts[i] = mem[off : off+layerUnits[i+1]]
@@ -470,17 +745,67 @@ func (mlp *BaseMultilayerPerceptron64) initialize(yCols int, layerUnits []int, i
 		}
 
 		initBound := M64.Sqrt(factor / float64(fanIn+fanOut))
-		for pos := prevOff; pos < off; pos++ {
-			mem[pos] = rndFloat64() * initBound
+		if scale, normal, ok := weightInitScale(mlp.WeightInit, fanIn, fanOut); ok {
+			// intercepts start at zero
+			for pos := prevOff + fanOut; pos < off; pos++ {
+				if normal {
+					mem[pos] = scale * boxMuller(rndFloat64(), rndFloat64())
+				} else {
+					mem[pos] = scale * (2*rndFloat64() - 1)
+				}
+			}
+		} else {
+			for pos := prevOff; pos < off; pos++ {
+				mem[pos] = rndFloat64() * initBound
+			}
 		}
 		if mlp.BatchNormalize && i < mlp.NLayers-2 {
-			mlp.batchNorm[i] = make([]float64, layerUnits[i+1])
+			mlp.batchMaxAbs[i] = make([]float64, layerUnits[i+1])
 		}
+		if mlp.BatchNorm && i < mlp.NLayers-2 {
+			mlp.batchNormInvStd[i] = make([]float64, layerUnits[i+1])
+			mlp.BatchNormMean[i] = make([]float64, layerUnits[i+1])
+			mlp.BatchNormVar[i] = make([]float64, layerUnits[i+1])
+			for o := range mlp.BatchNormVar[i] {
+				mlp.BatchNormVar[i][o] = 1
+			}
+		}
+	}
+	// the scales of batch normalized layers follow the layers in packedParameters,
+	// so they are updated by the optimizers
+	for i := 0; i < mlp.NLayers-2 && mlp.BatchNorm; i++ {
+		mlp.BatchNormScale[i] = mem[off : off+layerUnits[i+1]]
+		for pos := range mlp.BatchNormScale[i] {
+			mlp.BatchNormScale[i][pos] = 1
+		}
+		off += layerUnits[i+1]
+	}
+	// the embeddings are the last, they are updated by the optimizers except
+	// the stochastic ones, which update the rows looked up only
+	mlp.Embeddings = make([]blas64General, len(mlp.EmbeddingColumns))
+	for i, c := range mlp.EmbeddingColumns {
+		size := (c.Cardinality + 1) * c.Dim
+		mlp.Embeddings[i] = blas64General{Rows: c.Cardinality + 1, Cols: c.Dim, Stride: c.Dim, Data: mem[off : off+size]}
+		for pos := off; pos < off+size; pos++ {
+			mem[pos] = (rndFloat64() - .5) / float64(c.Dim)
+		}
+		off += size
 	}
 
 	mlp.BestLoss = M64.Inf(1)
 }
 
+// randomFloat returns the Float64 func of RandomState
+func (mlp *BaseMultilayerPerceptron64) randomFloat() func() float64 {
+	type Float64er interface {
+		Float64() float64
+	}
+	if float64er, ok := mlp.RandomState.(Float64er); ok {
+		return float64er.Float64
+	}
+	return rand.New(mlp.RandomState).Float64
+}
+
 func (mlp *BaseMultilayerPerceptron64) fit(X, y blas64General, incremental bool) {
 	// # Validate input parameters.
 	mlp.validateHyperparameters()
@@ -491,9 +816,10 @@ func (mlp *BaseMultilayerPerceptron64) fit(X, y blas64General, incremental bool)
 	}
 	X, y = mlp.validateInput(X, y, incremental)
 	nSamples, nFeatures := X.Rows, X.Cols
+	validateEmbeddingColumns(mlp.EmbeddingColumns, nFeatures, maxEmbeddingCardinality64)
 
 	mlp.NOutputs = y.Cols
-	layerUnits := append([]int{nFeatures}, mlp.HiddenLayerSizes...)
+	layerUnits := append([]int{embeddingInputWidth(mlp.EmbeddingColumns, nFeatures)}, mlp.HiddenLayerSizes...)
 	layerUnits = append(layerUnits, mlp.NOutputs)
 
 	if mlp.RandomState == nil {
@@ -556,6 +882,37 @@ func (mlp *BaseMultilayerPerceptron64) fit(X, y blas64General, incremental bool)
 		CoefsGrads[i] = blas64General{Rows: layerUnits[i], Cols: layerUnits[i+1], Stride: layerUnits[i+1], Data: packedGrads[off : off+layerUnits[i]*layerUnits[i+1]]}
 		off += layerUnits[i] * layerUnits[i+1]
 	}
+	mlp.batchNormScaleGrads = nil
+	for i := 0; i < mlp.NLayers-2 && mlp.BatchNorm; i++ {
+		mlp.batchNormScaleGrads = append(mlp.batchNormScaleGrads, packedGrads[off:off+layerUnits[i+1]])
+		off += layerUnits[i+1]
+	}
+	if len(mlp.EmbeddingColumns) > 0 {
+		mlp.embeddingGrads = make([]blas64General, len(mlp.EmbeddingColumns))
+		mlp.embeddingRows = make([][]int, len(mlp.EmbeddingColumns))
+		mlp.embeddingSeen = make([][]bool, len(mlp.EmbeddingColumns))
+		for i, c := range mlp.EmbeddingColumns {
+			size := (c.Cardinality + 1) * c.Dim
+			mlp.embeddingGrads[i] = blas64General{Rows: c.Cardinality + 1, Cols: c.Dim, Stride: c.Dim, Data: packedGrads[off : off+size]}
+			mlp.embeddingSeen[i] = make([]bool, c.Cardinality+1)
+			off += size
+		}
+		size := mlp.BatchSize * layerUnits[0]
+		mlp.embeddingInput, mlp.embeddingDeltas = make([]float64, size), make([]float64, size)
+	}
+	mlp.batchNormXhat, mlp.dropoutMasks = nil, nil
+	for i := 0; i < mlp.NLayers-2; i++ {
+		size := mlp.BatchSize * layerUnits[i+1]
+		if mlp.BatchNorm {
+			mlp.batchNormXhat = append(mlp.batchNormXhat, make([]float64, size))
+		}
+		if len(mlp.Dropout) > 0 {
+			mlp.dropoutMasks = append(mlp.dropoutMasks, make([]float64, size))
+		}
+	}
+	if len(mlp.Dropout) > 0 {
+		mlp.dropoutRnd = mlp.randomFloat()
+	}
 
 	if strings.EqualFold(mlp.Solver, "lbfgs") {
 		// # Run the LBFGS solver
@@ -622,6 +979,42 @@ func (mlp *BaseMultilayerPerceptron64) Predict(X mat.Matrix, Y Mutable) {
 	FromDense64(Y, yb)
 }
 
+// PredictProbas do forward pass and fills Y with the output activations,
+// which are the probabilities not converted to classes for classifiers.
+// Y must have NOutputs columns.
+func (mlp *BaseMultilayerPerceptron64) PredictProbas(X mat.Matrix, Y Mutable) {
+	yb := ToDense64(Y)
+	mlp.predictProbas(ToDense64(X).RawMatrix(), yb.RawMatrix())
+
+	FromDense64(Y, yb)
+}
+
+// Activations do forward pass and returns the activations of the hidden
+// layers followed by the output activations.
+func (mlp *BaseMultilayerPerceptron64) Activations(X mat.Matrix) []General64 {
+	x := ToDense64(X).RawMatrix()
+	Y := blas64General{Rows: x.Rows, Cols: mlp.NOutputs, Stride: mlp.NOutputs, Data: make([]float64, x.Rows*mlp.NOutputs)}
+	activations := mlp.predictProbas(x, Y)
+	layers := make([]General64, len(activations)-1)
+	for i, a := range activations[1:] {
+		layers[i] = General64(a)
+	}
+	return layers
+}
+
+// Initialize allocates the coefs and intercepts of layerUnits, the units of
+// the input, hidden and output layers, with random weights to be set before
+// Predict or Fit with WarmStart. OutActivation and LossFuncName are kept if set.
+func (mlp *BaseMultilayerPerceptron64) Initialize(layerUnits []int) {
+	nOutputs := layerUnits[len(layerUnits)-1]
+	outActivation, lossFuncName := mlp.OutActivation, mlp.LossFuncName
+	mlp.initialize(nOutputs, layerUnits, true, nOutputs > 1)
+	mlp.HiddenLayerSizes = append([]int(nil), layerUnits[1:len(layerUnits)-1]...)
+	if outActivation != "" && lossFuncName != "" {
+		mlp.OutActivation, mlp.LossFuncName = outActivation, lossFuncName
+	}
+}
+
 func (mlp *BaseMultilayerPerceptron64) validateHyperparameters() {
 	if mlp.MaxIter <= 0 {
 		log.Panicf("maxIter must be > 0, got %d.", mlp.MaxIter)
@@ -650,6 +1043,26 @@ func (mlp *BaseMultilayerPerceptron64) validateHyperparameters() {
 	if mlp.NIterNoChange <= 0 {
 		log.Panicf("nIterNoChange must be > 0, got %d.", mlp.NIterNoChange)
 	}
+	if mlp.BatchNormMomentum == 0 {
+		mlp.BatchNormMomentum = .1
+	}
+	if mlp.BatchNormMomentum < 0 || mlp.BatchNormMomentum > 1 {
+		log.Panicf("batchNormMomentum must be > 0 and <= 1, got %g.", mlp.BatchNormMomentum)
+	}
+	if len(mlp.Dropout) > 0 {
+		if len(mlp.Dropout) != 1 && len(mlp.Dropout) != len(mlp.HiddenLayerSizes) {
+			log.Panicf("dropout must have 1 or %d rates, got %v.", len(mlp.HiddenLayerSizes), mlp.Dropout)
+		}
+		for _, rate := range mlp.Dropout {
+			if rate < 0 || rate >= 1 {
+				log.Panicf("dropout must be >= 0 and < 1, got %v.", mlp.Dropout)
+			}
+		}
+		if strings.EqualFold(mlp.Solver, "lbfgs") {
+			log.Panicf("dropout is not supported by the lbfgs solver.")
+		}
+	}
+	validateWeightInit(mlp.WeightInit)
 	//# raise ValueError if not registered
 
 	supportedActivations := []string{}
@@ -724,31 +1137,50 @@ func (mlp *BaseMultilayerPerceptron64) fitLbfgs(X, y blas64General, activations,
 	if res.Status != optimize.GradientThreshold && res.Status != optimize.FunctionConvergence {
 		log.Printf("lbfgs optimizer: Maximum iterations (%d) reached and the optimization hasn't converged yet.\n", mlp.MaxIter)
 	}
+	// the last evaluation may be a line search trial, restore the final location
+	for i := range res.X {
+		mlp.packedParameters[i] = float64(res.X[i])
+	}
+	mlp.Loss = float64(res.F)
+	if mlp.BatchNorm {
+		// compute the statistics of the final location
+		mlp.backprop(X, y, activations, deltas, coefGrads, interceptGrads)
+	}
+}
+
+// newOptimizer returns the stochastic optimizer of Solver updating params.
+func (mlp *BaseMultilayerPerceptron64) newOptimizer(params []float64) sparseOptimizer64 {
+	switch mlp.Solver {
+	case "sgd":
+		return &SGDOptimizer64{
+			Params:           params,
+			LearningRateInit: mlp.LearningRateInit,
+			LearningRate:     mlp.LearningRateInit,
+			LRSchedule:       mlp.LearningRate,
+			PowerT:           mlp.PowerT,
+			Momentum:         mlp.Momentum,
+			Nesterov:         mlp.NesterovsMomentum}
+	case "adam":
+		return &AdamOptimizer64{
+			Params:           params,
+			LearningRateInit: mlp.LearningRateInit,
+			LearningRate:     mlp.LearningRateInit,
+			LRSchedule:       mlp.LearningRate,
+			Beta1:            mlp.Beta1, Beta2: mlp.Beta2, Epsilon: mlp.Epsilon,
+		}
+	}
+	return nil
 }
 
 func (mlp *BaseMultilayerPerceptron64) fitStochastic(X, y blas64General, activations, deltas, coefGrads []blas64General,
 	interceptGrads [][]float64, packedGrads []float64, layerUnits []int, incremental bool) {
 	if !incremental || mlp.optimizer == Optimizer64(nil) {
-		params := mlp.packedParameters
-		switch mlp.Solver {
-		case "sgd":
-			mlp.optimizer = &SGDOptimizer64{
-				Params:           params,
-				LearningRateInit: mlp.LearningRateInit,
-				LearningRate:     mlp.LearningRateInit,
-				LRSchedule:       mlp.LearningRate,
-				PowerT:           mlp.PowerT,
-				Momentum:         mlp.Momentum,
-				Nesterov:         mlp.NesterovsMomentum}
-		case "adam":
-			mlp.optimizer = &AdamOptimizer64{
-				Params:           params,
-				LearningRateInit: mlp.LearningRateInit,
-				LearningRate:     mlp.LearningRateInit,
-				LRSchedule:       mlp.LearningRate,
-				Beta1:            mlp.Beta1, Beta2: mlp.Beta2, Epsilon: mlp.Epsilon,
-			}
+		params := mlp.packedParameters[:mlp.denseParams()]
+		mlp.embeddingOptimizers = make([]sparseOptimizer64, len(mlp.Embeddings))
+		for i, e := range mlp.Embeddings {
+			mlp.embeddingOptimizers[i] = mlp.newOptimizer(e.Data)
 		}
+		mlp.optimizer = mlp.newOptimizer(params)
 	}
 	// # earlyStopping in partialFit doesn"t make sense
 	earlyStopping := mlp.EarlyStopping && !incremental
@@ -797,8 +1229,10 @@ func (mlp *BaseMultilayerPerceptron64) fitStochastic(X, y blas64General, activat
 				Ybatch := blas64General(General64(y).RowSlice(batch[0], batch[1]))
 
 				activations[0] = Xbatch
-				for _, a := range activations {
-					a.Rows = Xbatch.Rows
+				// the last batch may be smaller
+				for i := 1; i < len(activations); i++ {
+					activations[i].Rows = Xbatch.Rows
+					deltas[i-1].Rows = Xbatch.Rows
 				}
 
 				//X, y blas64General, activations, deltas, coefGrads []blas64General, interceptGrads
@@ -806,7 +1240,10 @@ func (mlp *BaseMultilayerPerceptron64) fitStochastic(X, y blas64General, activat
 				accumulatedLoss += batchLoss * float64(batch[1]-batch[0])
 
 				//# update weights
-				mlp.optimizer.updateParams(packedGrads)
+				mlp.optimizer.updateParams(packedGrads[:mlp.denseParams()])
+				if len(mlp.EmbeddingColumns) > 0 {
+					mlp.updateEmbeddings()
+				}
 			}
 			mlp.NIter++
 			mlp.Loss = accumulatedLoss / float64(nSamples)
@@ -894,7 +1331,10 @@ func (mlp *BaseMultilayerPerceptron64) updateNoImprovementCount(earlyStopping bo
 	}
 }
 
-func (mlp *BaseMultilayerPerceptron64) predictProbas(X, Y blas64General) {
+func (mlp *BaseMultilayerPerceptron64) predictProbas(X, Y blas64General) []blas64General {
+	if len(mlp.EmbeddingColumns) > 0 {
+		X = mlp.lookupEmbeddings(X, make([]float64, X.Rows*mlp.Coefs[0].Rows))
+	}
 	_, nFeatures := X.Rows, X.Cols
 
 	layerUnits := append([]int{nFeatures}, mlp.HiddenLayerSizes...)
@@ -911,7 +1351,8 @@ func (mlp *BaseMultilayerPerceptron64) predictProbas(X, Y blas64General) {
 		activations = append(activations, activation)
 	}
 	// # forward propagate
-	mlp.forwardPass(activations)
+	mlp.forwardPass(activations, false)
+	return activations
 }
 
 func (mlp *BaseMultilayerPerceptron64) predict(X, Y blas64General) {
@@ -1025,17 +1466,32 @@ func (opt *SGDOptimizer64) updateParams(grads []float64) {
 	if opt.velocities == nil {
 		opt.velocities = make([]float64, len(grads))
 	}
-	for i := range grads {
-		update := opt.Momentum*opt.velocities[i] - opt.LearningRate*grads[i]
-		velocity := update
-		opt.velocities[i] = velocity
-		if opt.Nesterov {
-			opt.Params[i] += opt.Momentum*velocity - opt.LearningRate*grads[i]
-		} else {
-			opt.Params[i] += update
+	for i, grad := range grads {
+		opt.update(i, grad)
+	}
+}
+
+// updateRows is like updateParams but updates the rows of dim params only.
+func (opt *SGDOptimizer64) updateRows(grads []float64, rows []int, dim int) {
+	if opt.velocities == nil {
+		opt.velocities = make([]float64, len(grads))
+	}
+	for _, row := range rows {
+		for i := row * dim; i < (row+1)*dim; i++ {
+			opt.update(i, grads[i])
 		}
 	}
+}
 
+func (opt *SGDOptimizer64) update(i int, grad float64) {
+	update := opt.Momentum*opt.velocities[i] - opt.LearningRate*grad
+	velocity := update
+	opt.velocities[i] = velocity
+	if opt.Nesterov {
+		opt.Params[i] += opt.Momentum*velocity - opt.LearningRate*grad
+	} else {
+		opt.Params[i] += update
+	}
 }
 
 // AdamOptimizer64 is the stochastic adam optimizer
@@ -1090,6 +1546,28 @@ func (opt *AdamOptimizer64) updateParams(grads []float64) {
 	}
 }
 
+// updateRows is like updateParams but updates the rows of dim params only, the
+// moments of the other rows are not decayed, like the lazy adam.
+func (opt *AdamOptimizer64) updateRows(grads []float64, rows []int, dim int) {
+	if opt.t == 0 {
+		opt.ms = make([]float64, len(grads))
+		opt.vs = make([]float64, len(grads))
+		opt.beta1t, opt.beta2t = 1, 1
+	}
+	opt.t++
+	opt.beta1t *= opt.Beta1
+	opt.beta2t *= opt.Beta2
+	opt.LearningRate = opt.LearningRateInit * M64.Sqrt(1-opt.beta2t) / (1. - opt.beta1t)
+	for _, row := range rows {
+		for i := row * dim; i < (row+1)*dim; i++ {
+			grad := grads[i]
+			opt.ms[i] = opt.Beta1*opt.ms[i] + (1-opt.Beta1)*grad
+			opt.vs[i] = opt.Beta2*opt.vs[i] + (1-opt.Beta2)*grad*grad
+			opt.Params[i] -= opt.LearningRate * opt.ms[i] / (M64.Sqrt(opt.vs[i]) + opt.Epsilon)
+		}
+	}
+}
+
 func toLogits64(ym blas64General) {
 	for i, ypos := 0, 0; i < ym.Rows; i, ypos = i+1, ypos+ym.Stride {
 		if ym.Cols == 1 {
@@ -1160,22 +1638,89 @@ func (mlp *BaseMultilayerPerceptron64) SetParams(params map[string]interface{})
 	r := reflect.Indirect(reflect.ValueOf(mlp))
 	for k, v := range params {
 		field := r.FieldByNameFunc(func(s string) bool {
-			return strings.EqualFold(s, k)
+			return paramMatches(s, k)
 		})
 		if field.Kind() != 0 {
-			field.Set(reflect.ValueOf(v))
+			setParam(field, v)
 		}
 	}
 }
 
+// Marshal returns the json of params, coefs_ and intercepts_ in the format
+// of Unmarshal, so a fitted mlp could be restored for prediction.
+func (mlp *BaseMultilayerPerceptron64) Marshal() ([]byte, error) {
+	coefs := make([][][]float64, len(mlp.Coefs))
+	for i, c := range mlp.Coefs {
+		coefs[i] = rowsOf64(c)
+	}
+	embeddings := make([][][]float64, len(mlp.Embeddings))
+	for i, e := range mlp.Embeddings {
+		embeddings[i] = rowsOf64(e)
+	}
+	mp := map[string]interface{}{
+		"activation":          mlp.Activation,
+		"solver":              mlp.Solver,
+		"alpha":               mlp.Alpha,
+		"weight_decay":        mlp.WeightDecay,
+		"batch_size":          mlp.BatchSize,
+		"batch_normalize":     mlp.BatchNormalize,
+		"batch_norm":          mlp.BatchNorm,
+		"batch_norm_momentum": mlp.BatchNormMomentum,
+		"dropout":             mlp.Dropout,
+		"weight_init":         mlp.WeightInit,
+		"learning_rate":       mlp.LearningRate,
+		"learning_rate_init":  mlp.LearningRateInit,
+		"power_t":             mlp.PowerT,
+		"max_iter":            mlp.MaxIter,
+		"loss_func_name":      mlp.LossFuncName,
+		"hidden_layer_sizes":  mlp.HiddenLayerSizes,
+		"shuffle":             mlp.Shuffle,
+		"tol":                 mlp.Tol,
+		"verbose":             mlp.Verbose,
+		"warm_start":          mlp.WarmStart,
+		"momentum":            mlp.Momentum,
+		"nesterovs_momentum":  mlp.NesterovsMomentum,
+		"early_stopping":      mlp.EarlyStopping,
+		"validation_fraction": mlp.ValidationFraction,
+		"beta_1":              mlp.Beta1,
+		"beta_2":              mlp.Beta2,
+		"epsilon":             mlp.Epsilon,
+		"n_iter_no_change":    mlp.NIterNoChange,
+		"embedding_columns":   mlp.EmbeddingColumns,
+		"out_activation_":     mlp.OutActivation,
+		"intercepts_":         mlp.Intercepts,
+		"coefs_":              coefs,
+		"embeddings_":         embeddings,
+		"batch_norm_scale_":   mlp.BatchNormScale,
+		"batch_norm_mean_":    mlp.BatchNormMean,
+		"batch_norm_var_":     mlp.BatchNormVar,
+	}
+	if mlp.lb != nil {
+		mp["classes_"] = mlp.lb.Classes
+	}
+	return json.Marshal(mp)
+}
+
 // Unmarshal init params intercepts_ coefs_ from json
 func (mlp *BaseMultilayerPerceptron64) Unmarshal(buf []byte) error {
 	type Map = map[string]interface{}
 	mp := Map{}
 	err := json.Unmarshal(buf, &mp)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	var embs struct {
+		EmbeddingColumns []EmbeddingColumn `json:"embedding_columns"`
+		Embeddings       [][][]float64     `json:"embeddings_"`
+		Dropout          []float64         `json:"dropout"`
+		BatchNormScale   [][]float64       `json:"batch_norm_scale_"`
+		BatchNormMean    [][]float64       `json:"batch_norm_mean_"`
+		BatchNormVar     [][]float64       `json:"batch_norm_var_"`
+	}
+	if err = json.Unmarshal(buf, &embs); err != nil {
+		return err
 	}
+	mlp.EmbeddingColumns, mlp.Dropout = embs.EmbeddingColumns, embs.Dropout
 	if params, ok := mp["params"]; ok {
 		if pmap, ok := params.(Map); ok {
 			mlp.SetParams(pmap)
@@ -1214,7 +1759,13 @@ func (mlp *BaseMultilayerPerceptron64) Unmarshal(buf []byte) error {
 				packedSize += (1 + layerUnits[il]) * layerUnits[il+1]
 			}
 			layerUnits[mlp.NLayers-1] = mlp.NOutputs
+			// keep the output of a marshaled regressor
+			outActivation, lossFuncName := mlp.OutActivation, mlp.LossFuncName
 			mlp.initialize(mlp.NOutputs, layerUnits, true, mlp.NOutputs > 1)
+			copy(mlp.HiddenLayerSizes, layerUnits[1:mlp.NLayers-1])
+			if outActivation != "" && lossFuncName != "" {
+				mlp.OutActivation, mlp.LossFuncName = outActivation, lossFuncName
+			}
 
 			for i := 0; i < mlp.NLayers-1; i++ {
 				intercept64 := floats64FromInterface(intercepts2[i])
@@ -1224,13 +1775,63 @@ func (mlp *BaseMultilayerPerceptron64) Unmarshal(buf []byte) error {
 				g := General64(mlp.Coefs[i])
 				(&g).Copy(General64(b64coefs[i]))
 			}
+			if len(embs.Embeddings) != len(mlp.Embeddings) {
+				return fmt.Errorf("embeddings_ must have %d tables, got %d", len(mlp.Embeddings), len(embs.Embeddings))
+			}
+			for i, table := range embs.Embeddings {
+				e := mlp.Embeddings[i]
+				if len(table) != e.Rows {
+					return fmt.Errorf("embeddings_[%d] must have %d rows, got %d", i, e.Rows, len(table))
+				}
+				for r, row := range table {
+					if len(row) != e.Cols {
+						return fmt.Errorf("embeddings_[%d] must have %d cols, got %d", i, e.Cols, len(row))
+					}
+					copy(e.Data[r*e.Stride:], row)
+				}
+			}
+			// models saved without batch normalization parameters keep
+			// scale 1, mean 0 and variance 1
+			if embs.BatchNormMean != nil {
+				if err = copyBatchNormParams64(mlp.BatchNormScale, embs.BatchNormScale); err != nil {
+					return err
+				}
+				if err = copyBatchNormParams64(mlp.BatchNormMean, embs.BatchNormMean); err != nil {
+					return err
+				}
+				if err = copyBatchNormParams64(mlp.BatchNormVar, embs.BatchNormVar); err != nil {
+					return err
+				}
+			}
 		} else {
 			return fmt.Errorf("coefs_ must be [][][]float64, found %T", coefs)
 		}
 	}
+	if classes, ok := mp["classes_"].([]interface{}); ok {
+		mlp.lb = NewLabelBinarizer64(0, 1)
+		mlp.lb.Classes = make([][]float64, len(classes))
+		for i, c := range classes {
+			for _, v := range floats64FromInterface(c) {
+				mlp.lb.Classes[i] = append(mlp.lb.Classes[i], float64(v))
+			}
+		}
+	}
 	return err
 }
 
+func copyBatchNormParams64(dst, src [][]float64) error {
+	if len(src) != len(dst) {
+		return fmt.Errorf("batch norm parameters must have %d layers, got %d", len(dst), len(src))
+	}
+	for i := range src {
+		if len(src[i]) != len(dst[i]) {
+			return fmt.Errorf("batch norm parameters of layer %d must have %d units, got %d", i, len(dst[i]), len(src[i]))
+		}
+		copy(dst[i], src[i])
+	}
+	return nil
+}
+
 // ToDense64 returns w view of m if m is a RawMatrixer, et returns a dense copy of m
 func ToDense64(m Matrix) General64 {
 	if d, ok := m.(General64); ok {
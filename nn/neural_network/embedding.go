@@ -0,0 +1,74 @@
+package neuralnetwork
+
+import (
+	"log"
+	"math"
+)
+
+// EmbeddingColumn is an integer column of X, like ids of high cardinality,
+// looked up in an embedding table of Cardinality+1 rows and Dim columns
+// trained jointly with the layers, instead of being one-hot encoded.
+// Values out of [0, Cardinality) or not integers share the last row.
+// The ids are exact in X up to 2^24 for float32 and 2^53 for float64, so
+// Cardinality must not be greater than them.
+// The sgd and adam solvers update the rows looked up in a batch only, and the
+// embeddings are not regularized by Alpha or WeightDecay.
+type EmbeddingColumn struct {
+	Column      int `json:"column"`
+	Cardinality int `json:"cardinality"`
+	Dim         int `json:"dim"`
+}
+
+// the max cardinality of ids exact in float32 and float64
+const (
+	maxEmbeddingCardinality32 = 1 << 24
+	maxEmbeddingCardinality64 = 1 << 53
+)
+
+// row returns the row of v in the embedding table.
+func (c EmbeddingColumn) row(v float64) int {
+	if v >= 0 && v < float64(c.Cardinality) && v == math.Trunc(v) {
+		return int(v)
+	}
+	return c.Cardinality
+}
+
+// embeddingInputWidth returns the width of the input layer for X of nFeatures
+// columns, the columns not looked up followed by the embeddings.
+func embeddingInputWidth(cols []EmbeddingColumn, nFeatures int) int {
+	width := nFeatures
+	for _, c := range cols {
+		width += c.Dim - 1
+	}
+	return width
+}
+
+// embeddingMask tells if each of the nFeatures columns is looked up.
+func embeddingMask(cols []EmbeddingColumn, nFeatures int) []bool {
+	mask := make([]bool, nFeatures)
+	for _, c := range cols {
+		mask[c.Column] = true
+	}
+	return mask
+}
+
+func validateEmbeddingColumns(cols []EmbeddingColumn, nFeatures int, maxCardinality int64) {
+	seen := make(map[int]bool, len(cols))
+	for _, c := range cols {
+		if c.Column < 0 || c.Column >= nFeatures {
+			log.Panicf("embedding column %d out of %d features.", c.Column, nFeatures)
+		}
+		if seen[c.Column] {
+			log.Panicf("embedding column %d is duplicated.", c.Column)
+		}
+		if c.Cardinality <= 0 || c.Dim <= 0 {
+			log.Panicf("cardinality and dim of embedding column %d must be > 0, got %d and %d.",
+				c.Column, c.Cardinality, c.Dim)
+		}
+		if int64(c.Cardinality) > maxCardinality {
+			log.Panicf("cardinality of embedding column %d must be <= %d to keep ids exact, got %d.",
+				c.Column, maxCardinality, c.Cardinality)
+		}
+		seen[c.Column] = true
+	}
+}
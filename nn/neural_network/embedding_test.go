@@ -0,0 +1,211 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/diff/fd"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+)
+
+// idSample has a noise column and an id column, labeled by a hash bit of the
+// id, which could not be learned from the id value as a dense feature.
+func idSample(n, cardinality int) (X, Y *mat.Dense) {
+	rnd := rand.New(rand.NewSource(1))
+	X, Y = mat.NewDense(n, 2, nil), mat.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		id := rnd.Intn(cardinality)
+		X.Set(i, 0, rnd.Float64())
+		X.Set(i, 1, float64(id))
+		Y.Set(i, 0, float64((id*7919/3)%2))
+	}
+	return
+}
+
+func TestEmbeddingColumnRow(t *testing.T) {
+	c := EmbeddingColumn{Column: 0, Cardinality: 3, Dim: 2}
+	for v, row := range map[float64]int{0: 0, 2: 2, 3: 3, -1: 3, 1.5: 3, math.NaN(): 3} {
+		if got := c.row(v); got != row {
+			t.Errorf("row of %v expected %d, got %d", v, row, got)
+		}
+	}
+	if width := embeddingInputWidth([]EmbeddingColumn{c, {Column: 2, Cardinality: 5, Dim: 4}}, 5); width != 5-2+2+4 {
+		t.Errorf("unexpected input width %d", width)
+	}
+}
+
+func TestEmbeddingColumnGradients(t *testing.T) {
+	X, Y := idSample(50, 10)
+	mlp := NewMLPClassifier([]int{3}, "logistic", "lbfgs", 0)
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.EmbeddingColumns = []EmbeddingColumn{{Column: 1, Cardinality: 8, Dim: 2}}
+	mlp.MaxIter = 5
+	var checked bool
+	mlp.beforeMinimize = func(problem optimize.Problem, initX []float64) {
+		gradFromModel := make([]float64, len(initX))
+		gradFromFD := make([]float64, len(initX))
+		problem.Func(initX)
+		problem.Grad(gradFromModel, initX)
+		fd.Gradient(gradFromFD, problem.Func, initX, &fd.Settings{Step: 1e-8})
+		for i := range initX {
+			if math.Abs(gradFromFD[i]-gradFromModel[i]) > 1e-6 {
+				t.Fatalf("bad gradient of param %d, expected: %g got: %g", i, gradFromFD[i], gradFromModel[i])
+			}
+		}
+		checked = true
+	}
+	mlp.Fit(X, Y)
+	if !checked {
+		t.Fatal("gradients not checked")
+	}
+	// ids 8 and 9 share the last row
+	if rows := mlp.Embeddings[0].Rows; rows != 9 {
+		t.Errorf("embedding table expected 9 rows, got %d", rows)
+	}
+}
+
+func TestEmbeddingColumns(t *testing.T) {
+	X, Y := idSample(2000, 50)
+	cols := []EmbeddingColumn{{Column: 1, Cardinality: 50, Dim: 4}}
+	testCases := []struct {
+		name string
+		mlp  interface {
+			Fit(X, Y Matrix)
+			PredictProbas(X mat.Matrix, Y Mutable)
+			Marshal() ([]byte, error)
+			Unmarshal(buf []byte) error
+		}
+		restored interface {
+			PredictProbas(X mat.Matrix, Y Mutable)
+			Unmarshal(buf []byte) error
+		}
+	}{
+		{"float64", func() *BaseMultilayerPerceptron64 {
+			mlp := NewBaseMultilayerPerceptron64()
+			mlp.HiddenLayerSizes = []int{16}
+			mlp.RandomState = base.NewLockedSource(1)
+			mlp.EmbeddingColumns = cols
+			mlp.LearningRateInit = .01
+			return mlp
+		}(), NewBaseMultilayerPerceptron64()},
+		{"float32", func() *BaseMultilayerPerceptron32 {
+			mlp := NewBaseMultilayerPerceptron32()
+			mlp.HiddenLayerSizes = []int{16}
+			mlp.RandomState = base.NewLockedSource(1)
+			mlp.EmbeddingColumns = cols
+			mlp.LearningRateInit = .01
+			return mlp
+		}(), NewBaseMultilayerPerceptron32()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mlp.Fit(X, Y)
+			nSamples, _ := X.Dims()
+			Ypred := mat.NewDense(nSamples, 1, nil)
+			tc.mlp.PredictProbas(X, Ypred)
+			var correct int
+			for i := 0; i < nSamples; i++ {
+				if (Ypred.At(i, 0) > .5) == (Y.At(i, 0) == 1) {
+					correct++
+				}
+			}
+			if accuracy := float64(correct) / float64(nSamples); accuracy < .95 {
+				t.Errorf("accuracy expected >= 0.95, got %g", accuracy)
+			}
+
+			// unknown ids share the same embedding
+			unknown := mat.NewDense(2, 2, []float64{.5, 50, .5, -1})
+			Yunknown := mat.NewDense(2, 1, nil)
+			tc.mlp.PredictProbas(unknown, Yunknown)
+			if Yunknown.At(0, 0) != Yunknown.At(1, 0) {
+				t.Errorf("unknown ids expected same prediction, got %v", Yunknown.RawMatrix().Data)
+			}
+
+			buf, err := tc.mlp.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = tc.restored.Unmarshal(buf); err != nil {
+				t.Fatal(err)
+			}
+			Yrestored := mat.NewDense(nSamples, 1, nil)
+			tc.restored.PredictProbas(X, Yrestored)
+			if !mat.Equal(Ypred, Yrestored) {
+				t.Error("restored mlp predicts differently")
+			}
+		})
+	}
+}
+
+func TestEmbeddingSparseUpdate(t *testing.T) {
+	// the first batch looks up id 0 and the second id 1
+	batch := func(id float64) (X, Y blas64General) {
+		x, y := mat.NewDense(10, 2, nil), mat.NewDense(10, 1, nil)
+		for i := 0; i < 10; i++ {
+			x.Set(i, 0, float64(i)/10)
+			x.Set(i, 1, id)
+			y.Set(i, 0, float64(i%2))
+		}
+		return blas64General(x.RawMatrix()), blas64General(y.RawMatrix())
+	}
+	for _, solver := range []string{"adam", "sgd"} {
+		mlp := NewBaseMultilayerPerceptron64()
+		mlp.Solver = solver
+		mlp.HiddenLayerSizes = []int{4}
+		mlp.RandomState = base.NewLockedSource(1)
+		mlp.EmbeddingColumns = []EmbeddingColumn{{Column: 1, Cardinality: 10, Dim: 2}}
+		mlp.Momentum = .9
+		mlp.MaxIter = 1
+		mlp.BatchSize = 10
+		mlp.Shuffle = false
+
+		X, Y := batch(0)
+		mlp.fit(X, Y, false)
+		table := mlp.Embeddings[0]
+		before := append([]float64(nil), table.Data...)
+		X, Y = batch(1)
+		mlp.fit(X, Y, true)
+
+		for row := 0; row < table.Rows; row++ {
+			changed := !floats.Equal(table.Data[row*2:row*2+2], before[row*2:row*2+2])
+			if changed != (row == 1) {
+				t.Errorf("%s: row %d changed %v", solver, row, changed)
+			}
+		}
+		// only the gradients of the rows looked up are not zero
+		for row := 0; row < table.Rows; row++ {
+			grad := mlp.embeddingGrads[0].Data[row*2 : row*2+2]
+			if nonZero := grad[0] != 0 || grad[1] != 0; nonZero != (row == 1) {
+				t.Errorf("%s: gradient of row %d non zero %v", solver, row, nonZero)
+			}
+		}
+	}
+}
+
+func TestEmbeddingColumnCardinality(t *testing.T) {
+	X, Y := idSample(10, 5)
+	mlp := NewBaseMultilayerPerceptron32()
+	mlp.EmbeddingColumns = []EmbeddingColumn{{Column: 1, Cardinality: 1<<24 + 1, Dim: 2}}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("cardinality over 2^24 of float32 expected to panic")
+		}
+	}()
+	mlp.Fit(X, Y)
+}
+
+func ExampleEmbeddingColumn() {
+	// column 1 of X is the item id in [0, 1000), which is looked up in an
+	// embedding table of 8 dims instead of being one-hot encoded
+	mlp := NewBaseMultilayerPerceptron32()
+	mlp.HiddenLayerSizes = []int{32}
+	mlp.EmbeddingColumns = []EmbeddingColumn{{Column: 1, Cardinality: 1000, Dim: 8}}
+	fmt.Println(embeddingInputWidth(mlp.EmbeddingColumns, 3))
+	// Output:
+	// 10
+}
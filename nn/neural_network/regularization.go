@@ -0,0 +1,40 @@
+package neuralnetwork
+
+import (
+	"log"
+	"math"
+	"strings"
+)
+
+// batchNormEpsilon is added to the variance of batch normalized layers
+const batchNormEpsilon = 1e-5
+
+// weightInitScale returns the bound of the uniform distribution, or the
+// standard deviation of the normal distribution, of the weights of a layer
+// for WeightInit. ok is false for the default initialization.
+func weightInitScale(weightInit string, fanIn, fanOut int) (scale float64, normal, ok bool) {
+	switch strings.ToLower(weightInit) {
+	case "xavier_uniform":
+		return math.Sqrt(6 / float64(fanIn+fanOut)), false, true
+	case "xavier_normal":
+		return math.Sqrt(2 / float64(fanIn+fanOut)), true, true
+	case "he_uniform":
+		return math.Sqrt(6 / float64(fanIn)), false, true
+	case "he_normal":
+		return math.Sqrt(2 / float64(fanIn)), true, true
+	}
+	return 0, false, false
+}
+
+func validateWeightInit(weightInit string) {
+	switch strings.ToLower(weightInit) {
+	case "", "xavier_uniform", "xavier_normal", "he_uniform", "he_normal":
+	default:
+		log.Panicf("weight init %s is not supported.", weightInit)
+	}
+}
+
+// boxMuller returns a standard normal sample from the uniform samples u1 and u2 in [0, 1).
+func boxMuller(u1, u2 float64) float64 {
+	return math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+}
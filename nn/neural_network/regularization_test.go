@@ -0,0 +1,269 @@
+package neuralnetwork
+
+import (
+	"math"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/diff/fd"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+	"gonum.org/v1/gonum/stat"
+)
+
+// circleSample is labeled by being inside the circle of radius 1 at 0, with
+// one feature of a larger scale.
+func circleSample(n int) (X, Y *mat.Dense) {
+	rnd := rand.New(rand.NewSource(1))
+	X, Y = mat.NewDense(n, 2, nil), mat.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		x0, x1 := rnd.Float64()*3-1.5, rnd.Float64()*3-1.5
+		X.Set(i, 0, x0)
+		X.Set(i, 1, 100*x1)
+		if x0*x0+x1*x1 < 1 {
+			Y.Set(i, 0, 1)
+		}
+	}
+	return
+}
+
+func TestBatchNormGradients(t *testing.T) {
+	X, Y := circleSample(50)
+	mlp := NewMLPClassifier([]int{4, 3}, "logistic", "lbfgs", 1e-3)
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.BatchNorm = true
+	mlp.MaxIter = 5
+	var checked bool
+	mlp.beforeMinimize = func(problem optimize.Problem, initX []float64) {
+		gradFromModel := make([]float64, len(initX))
+		gradFromFD := make([]float64, len(initX))
+		problem.Func(initX)
+		problem.Grad(gradFromModel, initX)
+		fd.Gradient(gradFromFD, problem.Func, initX, &fd.Settings{Step: 1e-7})
+		for i := range initX {
+			if math.Abs(gradFromFD[i]-gradFromModel[i]) > 1e-6 {
+				t.Fatalf("bad gradient of param %d, expected: %g got: %g", i, gradFromFD[i], gradFromModel[i])
+			}
+		}
+		checked = true
+	}
+	mlp.Fit(X, Y)
+	if !checked {
+		t.Fatal("gradients not checked")
+	}
+}
+
+func TestBatchNorm(t *testing.T) {
+	X, Y := circleSample(1000)
+	for _, tc := range []struct {
+		solver, activation string
+		maxIter            int
+	}{
+		{"adam", "relu", 200},
+		{"lbfgs", "logistic", 1000},
+	} {
+		t.Run(tc.solver, func(t *testing.T) {
+			mlp := NewBaseMultilayerPerceptron64()
+			mlp.Solver, mlp.Activation, mlp.MaxIter = tc.solver, tc.activation, tc.maxIter
+			mlp.HiddenLayerSizes = []int{16, 8}
+			mlp.RandomState = base.NewLockedSource(1)
+			mlp.BatchNorm = true
+			mlp.BatchSize = 64
+			mlp.LearningRateInit = .01
+			mlp.Fit(X, Y)
+
+			nSamples, _ := X.Dims()
+			Ypred := mat.NewDense(nSamples, 1, nil)
+			mlp.PredictProbas(X, Ypred)
+			var correct int
+			for i := 0; i < nSamples; i++ {
+				if (Ypred.At(i, 0) > .5) == (Y.At(i, 0) == 1) {
+					correct++
+				}
+			}
+			if accuracy := float64(correct) / float64(nSamples); accuracy < .95 {
+				t.Errorf("accuracy expected >= 0.95, got %g", accuracy)
+			}
+			// prediction uses the running statistics, not the ones of the rows predicted
+			for _, i := range []int{0, 10, 100} {
+				y := mat.NewDense(1, 1, nil)
+				mlp.PredictProbas(X.Slice(i, i+1, 0, 2), y)
+				if math.Abs(y.At(0, 0)-Ypred.At(i, 0)) > 1e-12 {
+					t.Errorf("prediction of row %d alone expected %g, got %g", i, Ypred.At(i, 0), y.At(0, 0))
+				}
+			}
+			if mlp.BatchNormMean[0][0] == 0 || mlp.BatchNormVar[0][0] == 1 {
+				t.Errorf("running statistics not updated: %v %v", mlp.BatchNormMean[0], mlp.BatchNormVar[0])
+			}
+		})
+	}
+}
+
+func TestBatchNormalize(t *testing.T) {
+	mlp := NewBaseMultilayerPerceptron64()
+	mlp.HiddenLayerSizes = []int{3}
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.BatchNormalize = true
+	mlp.BatchNormMomentum = 0
+	mlp.MaxIter = 1
+	X, Y := circleSample(100)
+	mlp.Fit(X, Y)
+	if mlp.BatchNormMomentum != .1 {
+		t.Errorf("batchNormMomentum expected to default to 0.1, got %g", mlp.BatchNormMomentum)
+	}
+	if mlp.BatchNormMean != nil || mlp.BatchNormScale != nil {
+		t.Error("batchNormalize expected not to allocate batch norm parameters")
+	}
+
+	// hidden activations are divided by their max abs
+	mlp.NLayers = 3
+	mlp.batchMaxAbs = [][]float64{make([]float64, 2)}
+	hidden := blas64General{Rows: 3, Cols: 2, Stride: 2, Data: []float64{1, -4, 2, 2, -0.5, 1}}
+	mlp.batchNormalize([]blas64General{{}, hidden, {}})
+	expected := []float64{.5, -1, 1, .5, -.25, .25}
+	for i, v := range hidden.Data {
+		if math.Abs(v-expected[i]) > 1e-12 {
+			t.Fatalf("normalized activations expected %v, got %v", expected, hidden.Data)
+		}
+	}
+	if mlp.batchMaxAbs[0][0] != 2 || mlp.batchMaxAbs[0][1] != 4 {
+		t.Errorf("norms expected [2 4], got %v", mlp.batchMaxAbs[0])
+	}
+}
+
+func TestDropout(t *testing.T) {
+	mlp := NewBaseMultilayerPerceptron32()
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.Dropout = []float32{.25}
+	mlp.dropoutRnd = mlp.randomFloat()
+	mlp.dropoutMasks = [][]float32{make([]float32, 1000)}
+	a := blas32General{Rows: 100, Cols: 10, Stride: 10, Data: make([]float32, 1000)}
+	for i := range a.Data {
+		a.Data[i] = 1
+	}
+	mlp.dropout(0, a)
+	var dropped int
+	for _, x := range a.Data {
+		switch x {
+		case 0:
+			dropped++
+		case 1 / .75:
+		default:
+			t.Fatalf("activation expected 0 or %g, got %g", 1/.75, x)
+		}
+	}
+	if dropped < 200 || dropped > 300 {
+		t.Errorf("expected about 250 dropped, got %d", dropped)
+	}
+
+	// activations are restored for the derivatives
+	deltas := blas32General{Rows: 100, Cols: 10, Stride: 10, Data: make([]float32, 1000)}
+	for i := range deltas.Data {
+		deltas.Data[i] = 1
+	}
+	mlp.dropoutDeltas(0, a, deltas)
+	for i := range a.Data {
+		if deltas.Data[i] != mlp.dropoutMasks[0][i] || (deltas.Data[i] != 0 && a.Data[i] != 1) {
+			t.Fatalf("bad deltas %g or activation %g for mask %g", deltas.Data[i], a.Data[i], mlp.dropoutMasks[0][i])
+		}
+	}
+
+	X, Y := circleSample(1000)
+	mlp = NewBaseMultilayerPerceptron32()
+	mlp.HiddenLayerSizes = []int{32}
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.Dropout = []float32{.1}
+	mlp.LearningRateInit = .01
+	mlp.Fit(X, Y)
+	Ypred1, Ypred2 := mat.NewDense(1000, 1, nil), mat.NewDense(1000, 1, nil)
+	mlp.PredictProbas(X, Ypred1)
+	mlp.PredictProbas(X, Ypred2)
+	if !mat.Equal(Ypred1, Ypred2) {
+		t.Error("prediction must not drop units")
+	}
+	if score := mlp.Score(X, Y); score < .9 {
+		t.Errorf("accuracy expected >= 0.9, got %g", score)
+	}
+}
+
+func TestWeightInit(t *testing.T) {
+	for _, tc := range []struct {
+		init   string
+		std    float64
+		normal bool
+	}{
+		{"xavier_uniform", math.Sqrt(6./(200+100)) / math.Sqrt(3), false},
+		{"xavier_normal", math.Sqrt(2. / (200 + 100)), true},
+		{"he_uniform", math.Sqrt(6./200) / math.Sqrt(3), false},
+		{"he_normal", math.Sqrt(2. / 200), true},
+	} {
+		mlp := NewBaseMultilayerPerceptron64()
+		mlp.RandomState = base.NewLockedSource(1)
+		mlp.WeightInit = tc.init
+		mlp.initialize(1, []int{200, 100, 1}, true, false)
+		coefs := mlp.Coefs[0].Data
+		mean, std := stat.MeanStdDev(coefs, nil)
+		if math.Abs(mean) > .05*tc.std || math.Abs(std-tc.std) > .02*tc.std {
+			t.Errorf("%s: expected mean 0 and std %g, got %g and %g", tc.init, tc.std, mean, std)
+		}
+		for _, b := range mlp.Intercepts[0] {
+			if b != 0 {
+				t.Errorf("%s: intercepts expected 0, got %v", tc.init, mlp.Intercepts[0])
+				break
+			}
+		}
+		if bound := tc.std * math.Sqrt(3); !tc.normal && (floats64Max(coefs) > bound || -floats64Min(coefs) > bound) {
+			t.Errorf("%s: coefs out of bound %g", tc.init, bound)
+		}
+	}
+}
+
+func floats64Max(a []float64) float64 {
+	m := a[0]
+	for _, x := range a {
+		m = math.Max(m, x)
+	}
+	return m
+}
+
+func floats64Min(a []float64) float64 {
+	m := a[0]
+	for _, x := range a {
+		m = math.Min(m, x)
+	}
+	return m
+}
+
+func TestRegularizationMarshal(t *testing.T) {
+	X, Y := circleSample(500)
+	mlp := NewBaseMultilayerPerceptron32()
+	mlp.HiddenLayerSizes = []int{16, 8}
+	mlp.RandomState = base.NewLockedSource(1)
+	mlp.MaxIter = 20
+	mlp.BatchNorm = true
+	mlp.BatchNormMomentum = .2
+	mlp.Dropout = []float32{.1, .2}
+	mlp.WeightInit = "he_normal"
+	mlp.Fit(X, Y)
+	buf, err := mlp.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewBaseMultilayerPerceptron32()
+	if err = restored.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.BatchNorm || restored.BatchNormMomentum != .2 || restored.WeightInit != "he_normal" ||
+		len(restored.Dropout) != 2 || restored.Dropout[1] != .2 {
+		t.Errorf("params not restored: %v %v %v %v", restored.BatchNorm, restored.BatchNormMomentum,
+			restored.WeightInit, restored.Dropout)
+	}
+	Ypred, Yrestored := mat.NewDense(500, 1, nil), mat.NewDense(500, 1, nil)
+	mlp.PredictProbas(X, Ypred)
+	restored.PredictProbas(X, Yrestored)
+	if !mat.Equal(Ypred, Yrestored) {
+		t.Error("restored mlp predicts differently")
+	}
+}
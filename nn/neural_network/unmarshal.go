@@ -1,5 +1,10 @@
 package neuralnetwork
 
+import (
+	"reflect"
+	"strings"
+)
+
 func floats64FromInterface(in interface{}) []float64 {
 	t1 := in.([]interface{})
 	t2 := make([]float64, len(t1))
@@ -24,3 +29,43 @@ func blas64FromInterface(in interface{}) blas64General {
 	}
 	return t2
 }
+
+// paramMatches tells if the key of a param like "learning_rate_init" or
+// "LearningRateInit" is the name of field.
+func paramMatches(field, key string) bool {
+	return strings.EqualFold(field, strings.ReplaceAll(key, "_", ""))
+}
+
+// setParam sets the value decoded from json to field, numbers are converted to
+// the kind of field, values of other types not assignable are ignored.
+func setParam(field reflect.Value, v interface{}) {
+	if !field.CanSet() || v == nil {
+		return
+	}
+	val := reflect.ValueOf(v)
+	if val.Type().AssignableTo(field.Type()) {
+		field.Set(val)
+	} else if isNumberKind(val.Kind()) && isNumberKind(field.Kind()) {
+		field.Set(val.Convert(field.Type()))
+	}
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+func rowsOf64(m blas64General) [][]float64 {
+	rows := make([][]float64, m.Rows)
+	for r, pos := 0, 0; r < m.Rows; r, pos = r+1, pos+m.Stride {
+		rows[r] = m.Data[pos : pos+m.Cols]
+	}
+	return rows
+}
+
+func rowsOf32(m blas32General) [][]float32 {
+	rows := make([][]float32, m.Rows)
+	for r, pos := 0, 0; r < m.Rows; r, pos = r+1, pos+m.Stride {
+		rows[r] = m.Data[pos : pos+m.Cols]
+	}
+	return rows
+}
@@ -15,19 +15,6 @@ func NewNeuron(activation ActivationType) *Neuron {
 	}
 }
 
-func (n *Neuron) fire() {
-	var sum float64
-	for _, s := range n.In {
-		sum += s.Out
-	}
-	n.Value = n.Activate(sum)
-
-	nVal := n.Value
-	for _, s := range n.Out {
-		s.fire(nVal)
-	}
-}
-
 // Activate applies the neurons activation
 func (n *Neuron) Activate(x float64) float64 {
 	return GetActivation(n.A).F(x)
@@ -40,7 +27,8 @@ func (n *Neuron) DActivate(x float64) float64 {
 
 // Synapse is an edge between neurons
 type Synapse struct {
-	Weight  float64
+	Weight float64
+	// Deprecated: In and Out are not set, the network is computed by an MLP
 	In, Out float64 `json:"-"`
 	IsBias  bool
 }
@@ -49,8 +37,3 @@ type Synapse struct {
 func NewSynapse(weight float64) *Synapse {
 	return &Synapse{Weight: weight}
 }
-
-func (s *Synapse) fire(value float64) {
-	s.In = value
-	s.Out = s.In * s.Weight
-}
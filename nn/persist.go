@@ -2,6 +2,10 @@ package nn
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+
+	neuralnetwork "github.com/auxten/go-ctr/nn/neural_network"
 )
 
 // Dump is a neural network dump
@@ -10,15 +14,20 @@ type Dump struct {
 	Weights [][][]float64
 }
 
-// ApplyWeights sets the weights from a three-dimensional slice
+// ApplyWeights sets the weights from a three-dimensional slice, a weight
+// after the inputs of a neuron is its bias.
 func (n *Neural) ApplyWeights(weights [][][]float64) {
 	for i, l := range n.Layers {
+		if !n.hasBias(i) && len(weights[i]) > 0 && len(weights[i][0]) > len(l.Neurons[0].In) {
+			n.applyBias(i)
+		}
 		for j := range l.Neurons {
 			for k := range l.Neurons[j].In {
 				n.Layers[i].Neurons[j].In[k].Weight = weights[i][j][k]
 			}
 		}
 	}
+	n.pull()
 }
 
 // Weights returns all weights in sequence
@@ -52,16 +61,110 @@ func FromDump(dump *Dump) *Neural {
 	return n
 }
 
+// model is the JSON of a network, the coefs_ and intercepts_ are in the
+// format of neuralnetwork.BaseMultilayerPerceptron64.
+type model struct {
+	Config        *Config       `json:"config"`
+	Activation    string        `json:"activation,omitempty"`
+	OutActivation string        `json:"out_activation_,omitempty"`
+	LossFuncName  string        `json:"loss_func_name,omitempty"`
+	Coefs         [][][]float64 `json:"coefs_"`
+	Intercepts    [][]float64   `json:"intercepts_"`
+
+	// Weights is set by the Dump format
+	Weights [][][]float64 `json:"Weights,omitempty"`
+}
+
+// activationNames are the names of activations in neuralnetwork
+var activationNames = map[ActivationType]string{
+	ActivationSigmoid: "logistic",
+	ActivationTanh:    "tanh",
+	ActivationReLU:    "relu",
+	ActivationLinear:  "identity",
+	ActivationSoftmax: "softmax",
+}
+
+// lossFuncNames are the names of losses in neuralnetwork
+var lossFuncNames = map[LossType]string{
+	LossCrossEntropy:       "log_loss",
+	LossBinaryCrossEntropy: "binary_log_loss",
+	LossMeanSquared:        "square_loss",
+}
+
+func (n Neural) model() *model {
+	m := &model{
+		Config:        n.Config,
+		Activation:    n.mlp.Activation,
+		OutActivation: n.mlp.OutActivation,
+		LossFuncName:  n.mlp.LossFuncName,
+		Coefs:         make([][][]float64, len(n.mlp.Coefs)),
+		Intercepts:    n.mlp.Intercepts,
+	}
+	for i, w := range n.mlp.Coefs {
+		m.Coefs[i] = make([][]float64, w.Rows)
+		for k := range m.Coefs[i] {
+			m.Coefs[i][k] = w.Data[k*w.Stride : k*w.Stride+w.Cols]
+		}
+	}
+	return m
+}
+
+func fromModel(m *model) (*Neural, error) {
+	if m.Config == nil {
+		return nil, errors.New("config not set")
+	}
+	n := NewNeural(m.Config)
+	coefs, intercepts := n.mlp.Coefs, n.mlp.Intercepts
+	if len(m.Coefs) != len(coefs) || len(m.Intercepts) != len(coefs) {
+		return nil, fmt.Errorf("coefs_ and intercepts_ must have %d layers", len(coefs))
+	}
+	for i, w := range coefs {
+		if len(m.Coefs[i]) != w.Rows || len(m.Intercepts[i]) != w.Cols {
+			return nil, fmt.Errorf("layer %d must have %d inputs and %d outputs", i, w.Rows, w.Cols)
+		}
+		for k, row := range m.Coefs[i] {
+			if len(row) != w.Cols {
+				return nil, fmt.Errorf("layer %d must have %d outputs, got %d", i, w.Cols, len(row))
+			}
+			copy(w.Data[k*w.Stride:], row)
+		}
+		copy(intercepts[i], m.Intercepts[i])
+	}
+	n.push()
+	return n, nil
+}
+
 // Marshal marshals to JSON from network
 func (n Neural) Marshal() ([]byte, error) {
-	return json.Marshal(n.Dump())
+	return json.Marshal(n.model())
 }
 
-// Unmarshal restores network from a JSON blob
+// Unmarshal restores network from a JSON blob, of Marshal or of a Dump
 func Unmarshal(bytes []byte) (*Neural, error) {
+	var m model
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		return nil, err
+	}
+	if m.Weights != nil {
+		return FromDump(&Dump{Config: m.Config, Weights: m.Weights}), nil
+	}
+	return fromModel(&m)
+}
+
+// ConvertDump converts the JSON of a Dump to the format of Marshal
+func ConvertDump(data []byte) ([]byte, error) {
 	var dump Dump
-	if err := json.Unmarshal(bytes, &dump); err != nil {
+	if err := json.Unmarshal(data, &dump); err != nil {
 		return nil, err
 	}
-	return FromDump(&dump), nil
+	if dump.Config == nil || dump.Weights == nil {
+		return nil, errors.New("not a network dump")
+	}
+	return FromDump(&dump).Marshal()
+}
+
+// MLP returns the neuralnetwork.BaseMultilayerPerceptron64 computing the
+// network, which shares the weights.
+func (n Neural) MLP() *neuralnetwork.BaseMultilayerPerceptron64 {
+	return n.mlp
 }
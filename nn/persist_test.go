@@ -1,10 +1,13 @@
 package nn
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 
+	neuralnetwork "github.com/auxten/go-ctr/nn/neural_network"
 	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
 )
 
 func Test_RestoreFromDump(t *testing.T) {
@@ -55,3 +58,65 @@ func Test_Marshal(t *testing.T) {
 	assert.Equal(t, n.String(), new.String())
 	assert.Equal(t, n.Predict([]float64{0}), new.Predict([]float64{0}))
 }
+
+func Test_UnmarshalDump(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 2},
+		Activation: ActivationTanh,
+		Mode:       ModeMultiClass,
+		Weight:     NewUniform(0.5, 0),
+		Bias:       true,
+	})
+	old, err := json.Marshal(n.Dump())
+	assert.Nil(t, err)
+
+	restored, err := Unmarshal(old)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Predict([]float64{1, 2}), restored.Predict([]float64{1, 2}))
+
+	converted, err := ConvertDump(old)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(converted), "Weights")
+	restored, err = Unmarshal(converted)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Weights(), restored.Weights())
+	assert.Equal(t, n.Predict([]float64{1, 2}), restored.Predict([]float64{1, 2}))
+
+	_, err = ConvertDump([]byte(`{"config": {}}`))
+	assert.NotNil(t, err)
+}
+
+func Test_MLP(t *testing.T) {
+	rand.Seed(0)
+
+	X := mat.NewDense(6, 2, nil)
+	for i := 0; i < 6; i++ {
+		X.SetRow(i, []float64{rand.NormFloat64(), rand.NormFloat64()})
+	}
+	for _, c := range []*Config{
+		{Inputs: 2, Layout: []int{4, 3}, Activation: ActivationTanh, Mode: ModeMultiClass, Bias: true},
+		{Inputs: 2, Layout: []int{4, 4, 1}, Activation: ActivationReLU, Mode: ModeBinary, Bias: true},
+		{Inputs: 2, Layout: []int{4, 1}, Activation: ActivationSigmoid, Mode: ModeRegression, Bias: true},
+		{Inputs: 2, Layout: []int{4, 2}, Activation: ActivationSigmoid, Mode: ModeMultiLabel},
+	} {
+		c.Weight = NewNormal(1, 0)
+		n := NewNeural(c)
+		expected, err := n.PredictBatch(X)
+		assert.Nil(t, err)
+
+		// the json of the network restores the MLP
+		buf, err := n.Marshal()
+		assert.Nil(t, err)
+		mlp := neuralnetwork.NewBaseMultilayerPerceptron64()
+		assert.Nil(t, mlp.Unmarshal(buf))
+		pred := mat.NewDense(6, c.Layout[len(c.Layout)-1], nil)
+		mlp.PredictProbas(X, pred)
+		assert.True(t, mat.EqualApprox(expected, pred, 1e-9), "%v", c)
+		assert.Equal(t, n.MLP().Coefs, mlp.Coefs)
+	}
+
+	assert.Panics(t, func() { NewNeural(&Config{Inputs: 2, Layout: []int{4, 1}, Activation: ActivationType(9)}) })
+}
@@ -0,0 +1,108 @@
+package nn
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Example is an input-target pair
+type Example struct {
+	Input    []float64
+	Response []float64
+}
+
+// Examples is a set of input-output pairs
+type Examples []Example
+
+// TrainConfig defines the mini-batch gradient descent of Train
+type TrainConfig struct {
+	// Number of passes over the examples, default 100
+	Epochs int
+	// Number of examples of a gradient step, default 32
+	BatchSize int
+	// Step size, default 0.01
+	LearningRate float64
+	// Momentum of the updates, 0 is plain SGD
+	Momentum float64
+	// Use Nesterov's momentum
+	Nesterov bool
+	// Shuffle the examples before each epoch
+	Shuffle bool
+	// Print the loss of each epoch
+	Verbose bool
+}
+
+func (c TrainConfig) withDefaults() TrainConfig {
+	if c.Epochs <= 0 {
+		c.Epochs = 100
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 32
+	}
+	if c.LearningRate <= 0 {
+		c.LearningRate = 0.01
+	}
+	return c
+}
+
+// trainable tells if the MLP computes the gradients of the Config.Loss with
+// the output activation: the cross entropies need softmax or sigmoid outputs,
+// the mean squared error any output but softmax.
+func (n *Neural) trainable() bool {
+	switch n.Config.Loss {
+	case LossCrossEntropy:
+		return n.mlp.OutActivation == "softmax" || n.mlp.OutActivation == "logistic"
+	case LossBinaryCrossEntropy:
+		return n.mlp.OutActivation == "logistic"
+	case LossMeanSquared:
+		return n.mlp.OutActivation != "softmax"
+	}
+	return false
+}
+
+// Train fits the weights to examples with mini-batch gradient descent on the
+// Config.Loss, and returns the mean loss of the batches of each epoch.
+func (n *Neural) Train(examples Examples, cfg TrainConfig) (losses []float64, err error) {
+	if len(examples) == 0 {
+		return nil, errors.New("no examples to train")
+	}
+	outputs := len(n.Layers[len(n.Layers)-1].Neurons)
+	X := mat.NewDense(len(examples), n.Config.Inputs, nil)
+	Y := mat.NewDense(len(examples), outputs, nil)
+	for i, e := range examples {
+		if len(e.Input) != n.Config.Inputs {
+			return nil, fmt.Errorf("example %d: Invalid input dimension - expected: %d got: %d", i, n.Config.Inputs, len(e.Input))
+		}
+		if len(e.Response) != outputs {
+			return nil, fmt.Errorf("example %d: Invalid response dimension - expected: %d got: %d", i, outputs, len(e.Response))
+		}
+		X.SetRow(i, e.Input)
+		Y.SetRow(i, e.Response)
+	}
+	if !n.trainable() {
+		return nil, fmt.Errorf("loss %s is not supported with output activation %s", n.Config.Loss, n.mlp.OutActivation)
+	}
+	if !n.uniform() {
+		return nil, errors.New("neurons with activations other than the ones of their layers can't be trained")
+	}
+	cfg = cfg.withDefaults()
+	if cfg.BatchSize > len(examples) {
+		cfg.BatchSize = len(examples)
+	}
+
+	mlp := n.mlp
+	mlp.LearningRateInit, mlp.Momentum, mlp.NesterovsMomentum = cfg.LearningRate, cfg.Momentum, cfg.Nesterov
+	mlp.BatchSize, mlp.MaxIter, mlp.Shuffle, mlp.Verbose = cfg.BatchSize, cfg.Epochs, cfg.Shuffle, cfg.Verbose
+	// run all the epochs
+	mlp.NIterNoChange = cfg.Epochs
+	mlp.RandomState = base.NewLockedSource(rand.Uint64())
+	start := len(mlp.LossCurve)
+	n.pull()
+	mlp.Fit(X, Y)
+	n.push()
+	return mlp.LossCurve[start:], nil
+}
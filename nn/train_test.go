@@ -0,0 +1,178 @@
+package nn
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
+)
+
+func xorExamples() Examples {
+	return Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+}
+
+func Test_TrainXOR(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{5, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeBinary,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	losses, err := n.Train(xorExamples(), TrainConfig{
+		Epochs:       2000,
+		BatchSize:    4,
+		LearningRate: 0.5,
+		Momentum:     0.9,
+		Nesterov:     true,
+		Shuffle:      true,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, losses, 2000)
+	assert.Less(t, losses[len(losses)-1], losses[0])
+
+	for _, e := range xorExamples() {
+		assert.InDelta(t, e.Response[0], n.Predict(e.Input)[0], 0.1)
+	}
+	// the synapses are updated with the trained weights
+	restored := FromDump(n.Dump())
+	assert.Equal(t, n.Predict([]float64{0, 1}), restored.Predict([]float64{0, 1}))
+}
+
+func Test_TrainRegression(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     1,
+		Layout:     []int{8, 1},
+		Activation: ActivationSigmoid,
+		Mode:       ModeRegression,
+		Weight:     NewUniform(0.5, 0),
+		Bias:       true,
+	})
+	var examples Examples
+	for i := 0; i < 64; i++ {
+		x := float64(i)/32 - 1
+		examples = append(examples, Example{Input: []float64{x}, Response: []float64{x * x}})
+	}
+	losses, err := n.Train(examples, TrainConfig{Epochs: 500, BatchSize: 8, LearningRate: 0.1, Momentum: 0.9, Shuffle: true})
+	assert.Nil(t, err)
+	assert.Less(t, losses[len(losses)-1], 0.002)
+
+	// the output layer gets the bias trained by the MLP
+	assert.NotNil(t, n.Biases[1])
+	restored := FromDump(n.Dump())
+	assert.Equal(t, n.Predict([]float64{0.5}), restored.Predict([]float64{0.5}))
+}
+
+func Test_TrainInvalid(t *testing.T) {
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{1}, Mode: ModeBinary})
+
+	_, err := n.Train(nil, TrainConfig{})
+	assert.NotNil(t, err)
+	_, err = n.Train(Examples{{Input: []float64{1}, Response: []float64{1}}}, TrainConfig{})
+	assert.NotNil(t, err)
+	_, err = n.Train(Examples{{Input: []float64{1, 2}, Response: []float64{1, 2}}}, TrainConfig{})
+	assert.NotNil(t, err)
+	// the gradient of MSE with softmax is not computed
+	n = NewNeural(&Config{Inputs: 2, Layout: []int{2}, Mode: ModeMultiClass, Loss: LossMeanSquared})
+	_, err = n.Train(Examples{{Input: []float64{1, 2}, Response: []float64{1, 0}}}, TrainConfig{})
+	assert.NotNil(t, err)
+	// neurons of other activations are computed but not trained
+	n = NewNeural(&Config{Inputs: 2, Layout: []int{2, 1}, Mode: ModeBinary})
+	n.Layers[0].Neurons[1].A = ActivationReLU
+	_, err = n.Train(Examples{{Input: []float64{1, 2}, Response: []float64{1}}}, TrainConfig{})
+	assert.NotNil(t, err)
+}
+
+func Test_TrainDefault(t *testing.T) {
+	rand.Seed(0)
+
+	// sigmoid outputs with the default MSE loss
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{5, 1}, Weight: NewNormal(1, 0), Bias: true})
+	losses, err := n.Train(xorExamples(), TrainConfig{Epochs: 3000, BatchSize: 4, LearningRate: 2, Momentum: 0.9})
+	assert.Nil(t, err)
+	assert.Less(t, losses[len(losses)-1], losses[0])
+	for _, e := range xorExamples() {
+		assert.InDelta(t, e.Response[0], n.Predict(e.Input)[0], 0.2)
+	}
+}
+
+func Test_ForwardSynapses(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     3,
+		Layout:     []int{4, 3},
+		Activation: ActivationReLU,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	input := []float64{0.1, 0.2, 0.7}
+	before := n.Predict(input)
+	// weights set directly are used
+	for _, neuron := range n.Layers[1].Neurons {
+		for _, s := range neuron.In {
+			s.Weight = 0
+		}
+	}
+	for _, p := range n.Predict(input) {
+		assert.InDelta(t, 1./3, p, 1e-12)
+	}
+	assert.NotEqual(t, before, n.Predict(input))
+
+	// the activation of a neuron is used in Predict and PredictBatch
+	n = NewNeural(&Config{Inputs: 3, Layout: []int{4, 1}, Activation: ActivationReLU, Mode: ModeRegression, Weight: NewNormal(1, 0)})
+	n.Layers[0].Neurons[0].A = ActivationLinear
+	for _, s := range n.Layers[0].Neurons[0].In {
+		s.Weight = -1
+	}
+	for k, s := range n.Layers[1].Neurons[0].In {
+		s.Weight = 0
+		if k == 0 {
+			s.Weight = 1
+		}
+	}
+	assert.InDelta(t, -1, n.Predict([]float64{0.1, 0.2, 0.7})[0], 1e-12)
+	pred, err := n.PredictBatch(mat.NewDense(1, 3, input))
+	assert.Nil(t, err)
+	assert.InDelta(t, -1, pred.At(0, 0), 1e-12)
+}
+
+func Test_PredictBatch(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     3,
+		Layout:     []int{4, 4, 3},
+		Activation: ActivationReLU,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	X := mat.NewDense(5, 3, nil)
+	for i := 0; i < 5; i++ {
+		X.SetRow(i, []float64{rand.Float64(), rand.Float64(), rand.Float64()})
+	}
+	pred, err := n.PredictBatch(X)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		expected := n.Predict(X.RawRowView(i))
+		for j := range expected {
+			assert.InDelta(t, expected[j], pred.At(i, j), 1e-12)
+		}
+	}
+
+	_, err = n.PredictBatch(mat.NewDense(1, 2, nil))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,95 @@
+package tree
+
+import (
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// binSubsample is the max number of rows used to compute the bin thresholds
+const binSubsample = 200000
+
+// binMapper maps the values of features to bins, bin b of feature f has the
+// values in (thresholds[f][b-1], thresholds[f][b]], NaN is in bin 0.
+type binMapper struct {
+	thresholds [][]float64
+}
+
+// newBinMapper computes at most maxBins quantile bins of each feature of X.
+func newBinMapper(X mat.Matrix, maxBins int) *binMapper {
+	rows, cols := X.Dims()
+	step := 1
+	if rows > binSubsample {
+		step = (rows + binSubsample - 1) / binSubsample
+	}
+	bm := &binMapper{thresholds: make([][]float64, cols)}
+	values := make([]float64, 0, rows/step+1)
+	for f := 0; f < cols; f++ {
+		values = values[:0]
+		for i := 0; i < rows; i += step {
+			if v := X.At(i, f); !math.IsNaN(v) {
+				values = append(values, v)
+			}
+		}
+		sort.Float64s(values)
+		bm.thresholds[f] = binThresholds(values, maxBins)
+	}
+	return bm
+}
+
+// binThresholds returns the thresholds of the sorted values, the midpoints of
+// distinct values if there are no more than maxBins of them, or else the quantiles.
+func binThresholds(sorted []float64, maxBins int) []float64 {
+	var distinct []float64
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			distinct = append(distinct, v)
+		}
+	}
+	if len(distinct) <= maxBins {
+		thresholds := make([]float64, 0, len(distinct))
+		for i := 1; i < len(distinct); i++ {
+			thresholds = append(thresholds, (distinct[i-1]+distinct[i])/2)
+		}
+		return thresholds
+	}
+	thresholds := make([]float64, 0, maxBins-1)
+	last := distinct[len(distinct)-1]
+	for k := 1; k < maxBins; k++ {
+		v := sorted[k*len(sorted)/maxBins]
+		if v == last {
+			break
+		}
+		if len(thresholds) == 0 || v > thresholds[len(thresholds)-1] {
+			thresholds = append(thresholds, v)
+		}
+	}
+	return thresholds
+}
+
+// nBins returns the number of bins of feature f.
+func (bm *binMapper) nBins(f int) int {
+	return len(bm.thresholds[f]) + 1
+}
+
+// bin returns the bin of value v of feature f.
+func (bm *binMapper) bin(f int, v float64) uint8 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return uint8(sort.SearchFloat64s(bm.thresholds[f], v))
+}
+
+// transform returns the bins of X by feature, the bin of row i of feature f
+// is at f*rows+i.
+func (bm *binMapper) transform(X mat.Matrix) []uint8 {
+	rows, cols := X.Dims()
+	bins := make([]uint8, rows*cols)
+	for f := 0; f < cols; f++ {
+		for i := 0; i < rows; i++ {
+			bins[f*rows+i] = bm.bin(f, X.At(i, f))
+		}
+	}
+	return bins
+}
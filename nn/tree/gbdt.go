@@ -0,0 +1,373 @@
+// Package tree contains a histogram gradient boosting decision tree (GBDT)
+// for binary classification with log loss and regression with square loss.
+//
+// The features are mapped to at most MaxBins quantile bins, trees are grown
+// leaf-wise on the histograms of the gradients, the histogram of the larger
+// child of a split is the parent's minus the smaller one's.
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"github.com/auxten/go-ctr/nn/metrics"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// GBDT is a gradient boosting decision tree, it implements base.Predicter
+type GBDT struct {
+	// LossFuncName is "binary_log_loss" for binary classification or "square_loss" for regression
+	LossFuncName string `json:"loss_func_name"`
+	// NEstimators is the number of trees
+	NEstimators  int     `json:"n_estimators"`
+	LearningRate float64 `json:"learning_rate"`
+	// MaxLeafNodes is the max number of leaves of a tree
+	MaxLeafNodes int `json:"max_leaf_nodes"`
+	// MaxDepth is the max depth of a tree, 0 means unlimited
+	MaxDepth int `json:"max_depth"`
+	// MinSamplesLeaf is the min number of rows of a leaf
+	MinSamplesLeaf int `json:"min_samples_leaf"`
+	// MinChildWeight is the min sum of hessians of a leaf
+	MinChildWeight float64 `json:"min_child_weight"`
+	// MinGainToSplit is the min loss reduction of a split
+	MinGainToSplit   float64 `json:"min_gain_to_split"`
+	L2Regularization float64 `json:"l2_regularization"`
+	// MaxBins is the max number of bins of a feature, at most 256
+	MaxBins int `json:"max_bins"`
+	// Subsample is the fraction of rows sampled for each tree
+	Subsample   float64          `json:"subsample"`
+	RandomState base.RandomState `json:"-"`
+	// NJobs is the number of goroutines building histograms, 0 means runtime.NumCPU()
+	NJobs   int  `json:"n_jobs"`
+	Verbose bool `json:"verbose"`
+
+	// Outputs
+	NFeatures int       `json:"n_features_"`
+	BaseScore float64   `json:"base_score_"`
+	Trees     []*Tree   `json:"trees_"`
+	LossCurve []float64 `json:"loss_curve_"`
+}
+
+var _ base.Predicter = &GBDT{}
+
+// NewGBDT returns a GBDT of lossFuncName with the default hyperparameters,
+// lossFuncName is "binary_log_loss" or "square_loss".
+func NewGBDT(lossFuncName string) *GBDT {
+	return &GBDT{
+		LossFuncName:   lossFuncName,
+		NEstimators:    100,
+		LearningRate:   0.1,
+		MaxLeafNodes:   31,
+		MinSamplesLeaf: 20,
+		MinChildWeight: 1e-3,
+		MaxBins:        255,
+		Subsample:      1,
+	}
+}
+
+func (m *GBDT) validateHyperparameters() {
+	switch m.LossFuncName {
+	case "binary_log_loss", "square_loss":
+	default:
+		log.Panicf("loss %s is not supported.", m.LossFuncName)
+	}
+	if m.NEstimators <= 0 {
+		log.Panicf("NEstimators must be > 0, got %d.", m.NEstimators)
+	}
+	if m.LearningRate <= 0 {
+		log.Panicf("LearningRate must be > 0, got %g.", m.LearningRate)
+	}
+	if m.MaxLeafNodes < 2 {
+		log.Panicf("MaxLeafNodes must be >= 2, got %d.", m.MaxLeafNodes)
+	}
+	if m.MaxDepth < 0 {
+		log.Panicf("MaxDepth must be >= 0, got %d.", m.MaxDepth)
+	}
+	if m.MinSamplesLeaf < 1 {
+		log.Panicf("MinSamplesLeaf must be >= 1, got %d.", m.MinSamplesLeaf)
+	}
+	if m.MinChildWeight < 0 || m.MinGainToSplit < 0 || m.L2Regularization < 0 {
+		log.Panicf("MinChildWeight, MinGainToSplit and L2Regularization must be >= 0.")
+	}
+	if m.MaxBins < 2 || m.MaxBins > 256 {
+		log.Panicf("MaxBins must be in [2, 256], got %d.", m.MaxBins)
+	}
+	if m.Subsample <= 0 || m.Subsample > 1 {
+		log.Panicf("Subsample must be in (0, 1], got %g.", m.Subsample)
+	}
+}
+
+// IsClassifier returns true for binary_log_loss
+func (m *GBDT) IsClassifier() bool { return m.LossFuncName == "binary_log_loss" }
+
+// GetNOutputs returns 1
+func (m *GBDT) GetNOutputs() int { return 1 }
+
+// PredicterClone returns an (possibly unfitted) copy of predicter
+func (m *GBDT) PredicterClone() base.Predicter {
+	clone := *m
+	if sourceCloner, ok := clone.RandomState.(base.SourceCloner); ok && sourceCloner != base.SourceCloner(nil) {
+		clone.RandomState = sourceCloner.SourceClone()
+	}
+	return &clone
+}
+
+// gradients computes the gradients and hessians of the loss of raw scores.
+func (m *GBDT) gradients(y, raw, grad, hess []float64) {
+	if m.IsClassifier() {
+		for i := range y {
+			p := sigmoid(raw[i])
+			grad[i], hess[i] = p-y[i], p*(1-p)
+		}
+		return
+	}
+	for i := range y {
+		grad[i], hess[i] = raw[i]-y[i], 1
+	}
+}
+
+// loss returns the mean loss of the raw scores.
+func (m *GBDT) loss(y, raw []float64) float64 {
+	var sum float64
+	for i := range y {
+		if m.IsClassifier() {
+			// log(1+exp(raw)) - y*raw, stable for large |raw|
+			sum += math.Max(raw[i], 0) + math.Log1p(math.Exp(-math.Abs(raw[i]))) - y[i]*raw[i]
+		} else {
+			d := raw[i] - y[i]
+			sum += d * d / 2
+		}
+	}
+	return sum / float64(len(y))
+}
+
+// Fit grows NEstimators trees on X and the first column of Y, labels of
+// binary_log_loss are 0 or 1.
+func (m *GBDT) Fit(X, Y mat.Matrix) base.Fiter {
+	m.validateHyperparameters()
+	rows, cols := X.Dims()
+	if yRows, _ := Y.Dims(); yRows != rows {
+		log.Panicf("X has %d rows, Y has %d.", rows, yRows)
+	}
+	if rows == 0 {
+		log.Panicf("X has no rows.")
+	}
+	if m.RandomState == base.RandomState(nil) {
+		m.RandomState = base.NewLockedSource(uint64(time.Now().UnixNano()))
+	}
+	rnd := rand.New(m.RandomState)
+
+	y := make([]float64, rows)
+	var mean float64
+	for i := range y {
+		y[i] = Y.At(i, 0)
+		if m.IsClassifier() && y[i] != 0 && y[i] != 1 {
+			log.Panicf("labels of binary_log_loss must be 0 or 1, got %g.", y[i])
+		}
+		mean += y[i] / float64(rows)
+	}
+	m.NFeatures = cols
+	m.BaseScore = mean
+	if m.IsClassifier() {
+		p := math.Min(math.Max(mean, 1e-15), 1-1e-15)
+		m.BaseScore = math.Log(p / (1 - p))
+	}
+
+	bm := newBinMapper(X, m.MaxBins)
+	bins := bm.transform(X)
+	raw := make([]float64, rows)
+	for i := range raw {
+		raw[i] = m.BaseScore
+	}
+	grad, hess := make([]float64, rows), make([]float64, rows)
+	gr := newGrower(m, bm, bins, rows, grad, hess)
+	m.Trees = make([]*Tree, 0, m.NEstimators)
+	m.LossCurve = m.LossCurve[:0]
+	sample := make([]int, 0, rows)
+	for iter := 0; iter < m.NEstimators; iter++ {
+		m.gradients(y, raw, grad, hess)
+		sample = sample[:0]
+		for i := 0; i < rows; i++ {
+			if m.Subsample == 1 || rnd.Float64() < m.Subsample {
+				sample = append(sample, i)
+			}
+		}
+		if len(sample) == 0 {
+			continue
+		}
+		tree := gr.grow(sample)
+		m.Trees = append(m.Trees, tree)
+		for i := range raw {
+			raw[i] += gr.binnedLeaf(i).Value
+		}
+		loss := m.loss(y, raw)
+		m.LossCurve = append(m.LossCurve, loss)
+		if m.Verbose {
+			fmt.Printf("Iteration %d, leaves %d, loss = %.8f\n", iter+1, tree.NLeaves, loss)
+		}
+	}
+	return m
+}
+
+// decisionFunction returns the raw scores of the rows of X.
+func (m *GBDT) decisionFunction(X mat.Matrix) []float64 {
+	rows, cols := X.Dims()
+	if cols != m.NFeatures {
+		log.Panicf("X has %d features, expected %d.", cols, m.NFeatures)
+	}
+	raw := make([]float64, rows)
+	x := make([]float64, cols)
+	for i := range raw {
+		mat.Row(x, i, X)
+		raw[i] = m.BaseScore
+		for _, tree := range m.Trees {
+			raw[i] += tree.leaf(x).Value
+		}
+	}
+	return raw
+}
+
+// output fills the first column of Y with values, Y is allocated if nil.
+func output(Y mat.Mutable, values []float64) *mat.Dense {
+	if Y == nil {
+		return mat.NewDense(len(values), 1, values)
+	}
+	for i, v := range values {
+		Y.Set(i, 0, v)
+	}
+	if d, ok := Y.(*mat.Dense); ok {
+		return d
+	}
+	return mat.NewDense(len(values), 1, values)
+}
+
+// DecisionFunction fills Y with the raw scores, the log odds of binary_log_loss
+func (m *GBDT) DecisionFunction(X mat.Matrix, Y mat.Mutable) *mat.Dense {
+	return output(Y, m.decisionFunction(X))
+}
+
+// PredictProbas fills Y with the probabilities of class 1 of binary_log_loss,
+// or the predictions of square_loss.
+func (m *GBDT) PredictProbas(X mat.Matrix, Y mat.Mutable) *mat.Dense {
+	raw := m.decisionFunction(X)
+	if m.IsClassifier() {
+		for i, v := range raw {
+			raw[i] = sigmoid(v)
+		}
+	}
+	return output(Y, raw)
+}
+
+// Predict fills Y with the classes 0 or 1 of binary_log_loss, or the
+// predictions of square_loss.
+func (m *GBDT) Predict(X mat.Matrix, Y mat.Mutable) *mat.Dense {
+	raw := m.decisionFunction(X)
+	if m.IsClassifier() {
+		for i, v := range raw {
+			raw[i] = 0
+			if v >= 0 {
+				raw[i] = 1
+			}
+		}
+	}
+	return output(Y, raw)
+}
+
+// Score returns the accuracy of binary_log_loss, or the R2 score of square_loss
+func (m *GBDT) Score(X, Y mat.Matrix) float64 {
+	rows, _ := X.Dims()
+	Ypred := m.Predict(X, mat.NewDense(rows, 1, nil))
+	if m.IsClassifier() {
+		return metrics.AccuracyScore(Y, Ypred, true, nil)
+	}
+	return metrics.R2Score(Y, Ypred, nil, "").At(0, 0)
+}
+
+// Apply returns the index of the leaf of each row of X in the leaves of each tree,
+// which are in [0, Trees[t].NLeaves).
+func (m *GBDT) Apply(X mat.Matrix) [][]int {
+	rows, cols := X.Dims()
+	if cols != m.NFeatures {
+		log.Panicf("X has %d features, expected %d.", cols, m.NFeatures)
+	}
+	leaves := make([][]int, rows)
+	x := make([]float64, cols)
+	for i := range leaves {
+		mat.Row(x, i, X)
+		leaves[i] = make([]int, len(m.Trees))
+		for t, tree := range m.Trees {
+			leaves[i][t] = tree.leaf(x).Leaf
+		}
+	}
+	return leaves
+}
+
+// FeatureImportances returns the importance of features normalized to sum 1,
+// importanceType is "gain" for the total gain of the splits of a feature, or
+// "split" for the number of splits.
+func (m *GBDT) FeatureImportances(importanceType string) []float64 {
+	importances := make([]float64, m.NFeatures)
+	byGain := true
+	switch strings.ToLower(importanceType) {
+	case "", "gain":
+	case "split":
+		byGain = false
+	default:
+		log.Panicf("importance type %s is not supported.", importanceType)
+	}
+	var total float64
+	for _, tree := range m.Trees {
+		for _, node := range tree.Nodes {
+			if node.Feature < 0 {
+				continue
+			}
+			v := 1.
+			if byGain {
+				v = node.Gain
+			}
+			importances[node.Feature] += v
+			total += v
+		}
+	}
+	if total > 0 {
+		for f := range importances {
+			importances[f] /= total
+		}
+	}
+	return importances
+}
+
+// Marshal returns the json of the hyperparameters and trees
+func (m *GBDT) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Unmarshal restores the GBDT marshaled
+func (m *GBDT) Unmarshal(buf []byte) error {
+	var restored GBDT
+	if err := json.Unmarshal(buf, &restored); err != nil {
+		return err
+	}
+	switch restored.LossFuncName {
+	case "binary_log_loss", "square_loss":
+	default:
+		return fmt.Errorf("loss %s is not supported", restored.LossFuncName)
+	}
+	for i, tree := range restored.Trees {
+		if tree == nil {
+			return fmt.Errorf("tree %d is null", i)
+		}
+		if err := tree.validate(restored.NFeatures); err != nil {
+			return fmt.Errorf("tree %d: %v", i, err)
+		}
+	}
+	restored.RandomState = m.RandomState
+	*m = restored
+	return nil
+}
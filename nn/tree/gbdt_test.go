@@ -0,0 +1,234 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/auxten/go-ctr/nn/base"
+	"github.com/auxten/go-ctr/nn/metrics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// xorData is labeled 1 if exactly one of the first 2 features is positive,
+// the third feature is noise.
+func xorData(rows int, seed int64) (X, Y *mat.Dense) {
+	rnd := rand.New(rand.NewSource(seed))
+	X, Y = mat.NewDense(rows, 3, nil), mat.NewDense(rows, 1, nil)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < 3; j++ {
+			X.Set(i, j, rnd.Float64()*2-1)
+		}
+		if (X.At(i, 0) > 0) != (X.At(i, 1) > 0) {
+			Y.Set(i, 0, 1)
+		}
+	}
+	return
+}
+
+// regressionData is sin(3*x0) + x1^2, the third feature is noise.
+func regressionData(rows int, seed int64) (X, Y *mat.Dense) {
+	rnd := rand.New(rand.NewSource(seed))
+	X, Y = mat.NewDense(rows, 3, nil), mat.NewDense(rows, 1, nil)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < 3; j++ {
+			X.Set(i, j, rnd.Float64()*2-1)
+		}
+		Y.Set(i, 0, math.Sin(3*X.At(i, 0))+X.At(i, 1)*X.At(i, 1))
+	}
+	return
+}
+
+func TestBinThresholds(t *testing.T) {
+	if th := binThresholds([]float64{1, 1, 2, 4}, 255); !reflect.DeepEqual(th, []float64{1.5, 3}) {
+		t.Errorf("expected midpoints [1.5 3], got %v", th)
+	}
+	sorted := make([]float64, 1000)
+	for i := range sorted {
+		sorted[i] = float64(i)
+	}
+	th := binThresholds(sorted, 4)
+	if !reflect.DeepEqual(th, []float64{250, 500, 750}) {
+		t.Errorf("expected quantiles [250 500 750], got %v", th)
+	}
+	bm := &binMapper{thresholds: [][]float64{th}}
+	for v, expected := range map[float64]uint8{-1: 0, 250: 0, 251: 1, 750: 2, 999: 3, math.NaN(): 0} {
+		if b := bm.bin(0, v); b != expected {
+			t.Errorf("expected bin %d of %g, got %d", expected, v, b)
+		}
+	}
+}
+
+func TestGBDTClassifier(t *testing.T) {
+	X, Y := xorData(2000, 1)
+	m := NewGBDT("binary_log_loss")
+	m.RandomState = base.NewLockedSource(7)
+	m.Subsample = 0.8
+	m.Fit(X, Y)
+	if len(m.Trees) != m.NEstimators || len(m.LossCurve) != m.NEstimators {
+		t.Fatalf("expected %d trees, got %d", m.NEstimators, len(m.Trees))
+	}
+	if m.LossCurve[len(m.LossCurve)-1] >= m.LossCurve[0] {
+		t.Errorf("loss expected to decrease: %g -> %g", m.LossCurve[0], m.LossCurve[len(m.LossCurve)-1])
+	}
+	for _, tree := range m.Trees {
+		if tree.NLeaves > m.MaxLeafNodes {
+			t.Errorf("tree has %d leaves > %d", tree.NLeaves, m.MaxLeafNodes)
+		}
+	}
+
+	// the loss of the binned training predictions is the loss of the raw features
+	raw := m.DecisionFunction(X, nil).RawMatrix().Data
+	if loss := m.loss(Y.RawMatrix().Data, raw); math.Abs(loss-m.LossCurve[len(m.LossCurve)-1]) > 1e-9 {
+		t.Errorf("expected loss %g, got %g", m.LossCurve[len(m.LossCurve)-1], loss)
+	}
+
+	Xtest, Ytest := xorData(1000, 2)
+	if acc := m.Score(Xtest, Ytest); acc < .95 {
+		t.Errorf("expected accuracy >= .95, got %g", acc)
+	}
+	probas := m.PredictProbas(Xtest, mat.NewDense(1000, 1, nil))
+	if auc := metrics.ROCAUCScore(Ytest, probas, "", nil); auc < .98 {
+		t.Errorf("expected auc >= .98, got %g", auc)
+	}
+
+	importances := m.FeatureImportances("gain")
+	if importances[2] > importances[0]/5 || importances[2] > importances[1]/5 {
+		t.Errorf("noise feature expected to be less important: %v", importances)
+	}
+	splits := m.FeatureImportances("split")
+	if sum := splits[0] + splits[1] + splits[2]; math.Abs(sum-1) > 1e-9 {
+		t.Errorf("importances expected to sum 1, got %g", sum)
+	}
+}
+
+func TestGBDTRegressor(t *testing.T) {
+	X, Y := regressionData(2000, 1)
+	m := NewGBDT("square_loss")
+	m.MaxDepth = 3
+	m.NEstimators = 200
+	m.Fit(X, Y)
+	for _, tree := range m.Trees {
+		if d := depth(tree, 0); d > 3 {
+			t.Errorf("tree has depth %d > 3", d)
+		}
+	}
+	Xtest, Ytest := regressionData(500, 2)
+	if r2 := m.Score(Xtest, Ytest); r2 < .95 {
+		t.Errorf("expected r2 >= .95, got %g", r2)
+	}
+	if m.IsClassifier() {
+		t.Error("square_loss is not a classifier")
+	}
+}
+
+func depth(tree *Tree, node int) int {
+	n := tree.Nodes[node]
+	if n.Feature < 0 {
+		return 0
+	}
+	l, r := depth(tree, n.Left), depth(tree, n.Right)
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
+func TestGBDTApply(t *testing.T) {
+	X, Y := xorData(500, 1)
+	m := NewGBDT("binary_log_loss")
+	m.NEstimators = 10
+	m.Fit(X, Y)
+	leaves := m.Apply(X)
+	raw := m.DecisionFunction(X, nil)
+	for i, rowLeaves := range leaves {
+		sum := m.BaseScore
+		for ti, leaf := range rowLeaves {
+			tree := m.Trees[ti]
+			if leaf < 0 || leaf >= tree.NLeaves {
+				t.Fatalf("leaf %d out of range %d", leaf, tree.NLeaves)
+			}
+			for _, node := range tree.Nodes {
+				if node.Feature < 0 && node.Leaf == leaf {
+					sum += node.Value
+				}
+			}
+		}
+		if math.Abs(sum-raw.At(i, 0)) > 1e-12 {
+			t.Fatalf("row %d: sum of leaves %g, raw score %g", i, sum, raw.At(i, 0))
+		}
+	}
+
+	// NaN goes to the left
+	nan := mat.NewDense(1, 3, []float64{math.NaN(), math.NaN(), math.NaN()})
+	left := mat.NewDense(1, 3, []float64{-10, -10, -10})
+	if a, b := m.DecisionFunction(nan, nil).At(0, 0), m.DecisionFunction(left, nil).At(0, 0); a != b {
+		t.Errorf("expected NaN prediction %g, got %g", b, a)
+	}
+}
+
+func TestGBDTMarshal(t *testing.T) {
+	X, Y := xorData(500, 1)
+	m := NewGBDT("binary_log_loss")
+	m.NEstimators = 20
+	m.Fit(X, Y)
+	buf, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &GBDT{}
+	if err = restored.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !mat.Equal(m.PredictProbas(X, nil), restored.PredictProbas(X, nil)) {
+		t.Error("restored predictions differ")
+	}
+	if restored.LearningRate != m.LearningRate || restored.MaxLeafNodes != m.MaxLeafNodes {
+		t.Error("restored hyperparameters differ")
+	}
+
+	for _, invalid := range []string{
+		`{`,
+		`{"loss_func_name": "hinge"}`,
+		`{"loss_func_name": "square_loss", "n_features_": 1, "trees_": [{"nodes": [{"feature": 2, "left": 1, "right": 2}]}]}`,
+		`{"loss_func_name": "square_loss", "n_features_": 1, "trees_": [{"nodes": [{"feature": 0, "left": 0, "right": 0}]}]}`,
+		`{"loss_func_name": "square_loss", "n_features_": 1, "trees_": [{"nodes": [{"feature": -1, "leaf": 0}], "n_leaves": 2}]}`,
+	} {
+		if err = (&GBDT{}).Unmarshal([]byte(invalid)); err == nil {
+			t.Errorf("expected error of %s", invalid)
+		}
+	}
+}
+
+func TestGBDTValidate(t *testing.T) {
+	X, Y := xorData(10, 1)
+	for _, modify := range []func(m *GBDT){
+		func(m *GBDT) { m.LossFuncName = "hinge" },
+		func(m *GBDT) { m.MaxBins = 300 },
+		func(m *GBDT) { m.Subsample = 0 },
+		func(m *GBDT) { m.MaxLeafNodes = 1 },
+	} {
+		m := NewGBDT("binary_log_loss")
+		modify(m)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic of %+v", m)
+				}
+			}()
+			m.Fit(X, Y)
+		}()
+	}
+}
+
+func ExampleGBDT_FeatureImportances() {
+	X, Y := regressionData(1000, 1)
+	m := NewGBDT("square_loss")
+	m.Fit(X, Y)
+	importances := m.FeatureImportances("gain")
+	fmt.Println(importances[0] > importances[2], importances[1] > importances[2])
+	// Output:
+	// true true
+}
@@ -0,0 +1,281 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/auxten/go-ctr/nn/base"
+)
+
+// Node is a split or a leaf of a Tree
+type Node struct {
+	// Feature of the split, -1 for leaves
+	Feature int `json:"feature"`
+	// Threshold of the split, rows with x <= Threshold or NaN go to Left
+	Threshold float64 `json:"threshold"`
+	Left      int     `json:"left"`
+	Right     int     `json:"right"`
+	// Value is the output of leaves, scaled by the learning rate
+	Value float64 `json:"value"`
+	// Leaf is the index of a leaf in the leaves of the tree, -1 for splits
+	Leaf int `json:"leaf"`
+	// Gain is the loss reduction of the split
+	Gain float64 `json:"gain"`
+	// Count is the number of training rows of the node
+	Count int `json:"count"`
+}
+
+// Tree is a regression tree, Nodes[0] is the root
+type Tree struct {
+	Nodes   []Node `json:"nodes"`
+	NLeaves int    `json:"n_leaves"`
+}
+
+// leaf returns the leaf node of row x
+func (t *Tree) leaf(x []float64) *Node {
+	node := &t.Nodes[0]
+	for node.Feature >= 0 {
+		if x[node.Feature] > node.Threshold {
+			node = &t.Nodes[node.Right]
+		} else {
+			node = &t.Nodes[node.Left]
+		}
+	}
+	return node
+}
+
+// validate checks the nodes of a tree unmarshaled.
+func (t *Tree) validate(nFeatures int) error {
+	if len(t.Nodes) == 0 {
+		return fmt.Errorf("tree has no nodes")
+	}
+	leaves := 0
+	for i, node := range t.Nodes {
+		if node.Feature < 0 {
+			if node.Leaf != leaves {
+				return fmt.Errorf("leaf node %d has index %d, expected %d", i, node.Leaf, leaves)
+			}
+			leaves++
+			continue
+		}
+		if node.Feature >= nFeatures {
+			return fmt.Errorf("node %d splits feature %d of %d features", i, node.Feature, nFeatures)
+		}
+		// children are always after the parent, so there is no cycle
+		if node.Left <= i || node.Left >= len(t.Nodes) || node.Right <= i || node.Right >= len(t.Nodes) {
+			return fmt.Errorf("node %d has invalid children %d and %d", i, node.Left, node.Right)
+		}
+	}
+	if leaves != t.NLeaves {
+		return fmt.Errorf("tree has %d leaves, expected %d", leaves, t.NLeaves)
+	}
+	return nil
+}
+
+// histBin is the sums of gradients and hessians of the rows in a bin
+type histBin struct {
+	g, h float64
+	n    int
+}
+
+// split is the best split of a leaf
+type split struct {
+	gain         float64
+	feature, bin int
+	gl, hl       float64
+	nl           int
+}
+
+// growingLeaf is a leaf not finished
+type growingLeaf struct {
+	node  int
+	rows  []int
+	depth int
+	g, h  float64
+	hist  []histBin
+	best  split
+}
+
+// grower grows a tree leaf-wise: the leaf with the best split is split first.
+type grower struct {
+	params    *GBDT
+	bins      []uint8 // by feature, see binMapper.transform
+	nRows     int
+	binMapper *binMapper
+	offsets   []int // offsets of features in histograms
+	grad      []float64
+	hess      []float64
+
+	tree      *Tree
+	splitBins []int // bin of the splits by node
+}
+
+func newGrower(params *GBDT, bm *binMapper, bins []uint8, nRows int, grad, hess []float64) *grower {
+	gr := &grower{params: params, bins: bins, nRows: nRows, binMapper: bm, grad: grad, hess: hess}
+	gr.offsets = make([]int, len(bm.thresholds)+1)
+	for f := range bm.thresholds {
+		gr.offsets[f+1] = gr.offsets[f] + bm.nBins(f)
+	}
+	return gr
+}
+
+// histogram builds the histogram of rows in parallel by feature.
+func (gr *grower) histogram(rows []int) []histBin {
+	hist := make([]histBin, gr.offsets[len(gr.offsets)-1])
+	nFeatures := len(gr.offsets) - 1
+	base.Parallelize(gr.params.NJobs, nFeatures, func(th, start, end int) {
+		for f := start; f < end; f++ {
+			fbins := gr.bins[f*gr.nRows : (f+1)*gr.nRows]
+			fhist := hist[gr.offsets[f]:gr.offsets[f+1]]
+			for _, i := range rows {
+				b := &fhist[fbins[i]]
+				b.g += gr.grad[i]
+				b.h += gr.hess[i]
+				b.n++
+			}
+		}
+	})
+	return hist
+}
+
+// subtract returns parent - child, the histogram of the sibling of child.
+func subtract(parent, child []histBin) []histBin {
+	for i := range parent {
+		parent[i].g -= child[i].g
+		parent[i].h -= child[i].h
+		parent[i].n -= child[i].n
+	}
+	return parent
+}
+
+func (gr *grower) score(g, h float64) float64 {
+	return g * g / (h + gr.params.L2Regularization)
+}
+
+// findSplit finds the best split of leaf, the gain is 0 if it could not be split.
+func (gr *grower) findSplit(leaf *growingLeaf) {
+	p := gr.params
+	leaf.best = split{}
+	if (p.MaxDepth > 0 && leaf.depth >= p.MaxDepth) || len(leaf.rows) < 2*p.MinSamplesLeaf {
+		return
+	}
+	parentScore := gr.score(leaf.g, leaf.h)
+	for f := 0; f < len(gr.offsets)-1; f++ {
+		fhist := leaf.hist[gr.offsets[f]:gr.offsets[f+1]]
+		var gl, hl float64
+		var nl int
+		for b := 0; b < len(fhist)-1; b++ {
+			gl, hl, nl = gl+fhist[b].g, hl+fhist[b].h, nl+fhist[b].n
+			nr := len(leaf.rows) - nl
+			if nl < p.MinSamplesLeaf || hl < p.MinChildWeight {
+				continue
+			}
+			if nr < p.MinSamplesLeaf {
+				break
+			}
+			gr_, hr := leaf.g-gl, leaf.h-hl
+			if hr < p.MinChildWeight {
+				break
+			}
+			gain := gr.score(gl, hl) + gr.score(gr_, hr) - parentScore
+			if gain > leaf.best.gain && gain > p.MinGainToSplit {
+				leaf.best = split{gain: gain, feature: f, bin: b, gl: gl, hl: hl, nl: nl}
+			}
+		}
+	}
+}
+
+func (gr *grower) newLeaf(rows []int, depth int, g, h float64, hist []histBin) *growingLeaf {
+	gr.tree.Nodes = append(gr.tree.Nodes, Node{Feature: -1, Leaf: -1, Count: len(rows)})
+	gr.splitBins = append(gr.splitBins, -1)
+	leaf := &growingLeaf{node: len(gr.tree.Nodes) - 1, rows: rows, depth: depth, g: g, h: h, hist: hist}
+	gr.findSplit(leaf)
+	return leaf
+}
+
+// grow returns the tree of rows, rows are reordered.
+func (gr *grower) grow(rows []int) *Tree {
+	p := gr.params
+	gr.tree = &Tree{}
+	gr.splitBins = nil
+	var g, h float64
+	for _, i := range rows {
+		g += gr.grad[i]
+		h += gr.hess[i]
+	}
+	leaves := []*growingLeaf{gr.newLeaf(rows, 0, g, h, gr.histogram(rows))}
+	for len(leaves) < p.MaxLeafNodes {
+		// the leaf with the best split
+		best := -1
+		for i, leaf := range leaves {
+			if leaf.best.gain > 0 && (best < 0 || leaf.best.gain > leaves[best].best.gain) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		leaf := leaves[best]
+		leaves = append(leaves[:best], leaves[best+1:]...)
+
+		s := leaf.best
+		fbins := gr.bins[s.feature*gr.nRows : (s.feature+1)*gr.nRows]
+		l := 0
+		for r, i := range leaf.rows {
+			if int(fbins[i]) <= s.bin {
+				leaf.rows[l], leaf.rows[r] = leaf.rows[r], leaf.rows[l]
+				l++
+			}
+		}
+		leftRows, rightRows := leaf.rows[:l], leaf.rows[l:]
+		var leftHist, rightHist []histBin
+		if len(leftRows) < len(rightRows) {
+			leftHist = gr.histogram(leftRows)
+			rightHist = subtract(leaf.hist, leftHist)
+		} else {
+			rightHist = gr.histogram(rightRows)
+			leftHist = subtract(leaf.hist, rightHist)
+		}
+		leaf.hist = nil
+
+		node := &gr.tree.Nodes[leaf.node]
+		node.Feature = s.feature
+		node.Threshold = gr.binMapper.thresholds[s.feature][s.bin]
+		node.Gain = s.gain
+		gr.splitBins[leaf.node] = s.bin
+		left := gr.newLeaf(leftRows, leaf.depth+1, s.gl, s.hl, leftHist)
+		right := gr.newLeaf(rightRows, leaf.depth+1, leaf.g-s.gl, leaf.h-s.hl, rightHist)
+		gr.tree.Nodes[leaf.node].Left, gr.tree.Nodes[leaf.node].Right = left.node, right.node
+		leaves = append(leaves, left, right)
+	}
+
+	for _, leaf := range leaves {
+		gr.tree.Nodes[leaf.node].Value = -p.LearningRate * leaf.g / (leaf.h + p.L2Regularization)
+	}
+	for i := range gr.tree.Nodes {
+		if gr.tree.Nodes[i].Feature < 0 {
+			gr.tree.Nodes[i].Leaf = gr.tree.NLeaves
+			gr.tree.NLeaves++
+		}
+	}
+	return gr.tree
+}
+
+// binnedLeaf returns the leaf node of row i of the training bins.
+func (gr *grower) binnedLeaf(i int) *Node {
+	n := 0
+	for gr.tree.Nodes[n].Feature >= 0 {
+		node := &gr.tree.Nodes[n]
+		if int(gr.bins[node.Feature*gr.nRows+i]) <= gr.splitBins[n] {
+			n = node.Left
+		} else {
+			n = node.Right
+		}
+	}
+	return &gr.tree.Nodes[n]
+}
+
+// sigmoid is the inverse of the logit
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
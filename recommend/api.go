@@ -1,6 +1,7 @@
 package recommend
 
 import (
+	"crypto/subtle"
 	"embed"
 	"github.com/gin-gonic/gin"
 	"io/fs"
@@ -15,6 +16,18 @@ type RecApiRequest struct {
 
 type RecApiResponse struct {
 	ItemScoreList []ItemScore `json:"itemScoreList"`
+	// Degraded items are those failed to get features, see PredictOptions
+	Degraded []DegradedItem `json:"degraded,omitempty"`
+}
+
+// CacheAdminToken enables POST /admin/cache/invalidate of StartHttpApi if not
+// empty, requests must have the header "Authorization: Bearer <CacheAdminToken>".
+var CacheAdminToken string
+
+type CacheInvalidateRequest struct {
+	Stage  string   `json:"stage"`  // train, predict, default predict
+	Entity string   `json:"entity"` // user, item, default both
+	Keys   []string `json:"keys"`
 }
 
 // StartHttpApi starts the http api for recommendation
@@ -103,6 +116,10 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 		return
 	})
 
+	if CacheAdminToken != "" {
+		registerCacheAdmin(engine, CacheAdminToken)
+	}
+
 	engine.Any(path, func(c *gin.Context) {
 		// bind request to RecApiRequest
 		var (
@@ -119,12 +136,13 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 		} else {
 			resp := RecApiResponse{}
 			// get features in request from gin Context
-			scores, err := Rank(c, predict, req.UserId, req.ItemIdList)
+			scores, degraded, err := RankWithOptions(c, predict, req.UserId, req.ItemIdList, DefaultPredictOptions)
 			if err != nil {
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
 			resp.ItemScoreList = scores
+			resp.Degraded = degraded
 			c.JSON(200, resp)
 			return
 		}
@@ -151,3 +169,62 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 
 	return engine.Run(addr)
 }
+
+// registerCacheAdmin registers the cache admin api authorized by token.
+// Invalidate feature cache by:
+//
+//	curl --request POST \
+//	  --header "Authorization: Bearer $TOKEN" \
+//	  --data '{"stage":"predict","entity":"item","keys":["1","2"]}' \
+//	  http://localhost:8080/admin/cache/invalidate
+//
+// all keys are invalidated if keys is empty
+func registerCacheAdmin(engine *gin.Engine, token string) {
+	admin := engine.Group("/admin", func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	})
+	admin.POST("/cache/invalidate", func(c *gin.Context) {
+		var req CacheInvalidateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var stage Stage
+		switch req.Stage {
+		case TrainStage.String():
+			stage = TrainStage
+		case PredictStage.String(), "":
+			stage = PredictStage
+		default:
+			c.JSON(400, gin.H{"error": "unknown stage: " + req.Stage})
+			return
+		}
+		var entities []EntityType
+		switch req.Entity {
+		case UserEntity.String():
+			entities = []EntityType{UserEntity}
+		case ItemEntity.String():
+			entities = []EntityType{ItemEntity}
+		case "":
+			entities = []EntityType{UserEntity, ItemEntity}
+		default:
+			c.JSON(400, gin.H{"error": "unknown entity: " + req.Entity})
+			return
+		}
+		var deleted int
+		for _, entity := range entities {
+			n, err := InvalidateFeatureCache(stage, entity, req.Keys...)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			deleted += n
+		}
+		c.JSON(200, gin.H{"deleted": deleted})
+	})
+}
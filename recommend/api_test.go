@@ -0,0 +1,51 @@
+package recommend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheAdmin(t *testing.T) {
+	CloseFeatureCaches()
+	defer CloseFeatureCaches()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	registerCacheAdmin(engine, "secret")
+	invalidate := func(auth, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/invalidate", strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("invalidate needs the token", t, func() {
+		cache, err := GetFeatureCache(PredictStage, ItemEntity)
+		So(err, ShouldBeNil)
+		cache.Set("1", Tensor{1})
+		cache.Set("2", Tensor{2})
+
+		So(invalidate("", `{"entity":"item"}`).Code, ShouldEqual, 401)
+		So(invalidate("Bearer wrong", `{"entity":"item"}`).Code, ShouldEqual, 401)
+		So(cache.ItemCount(), ShouldEqual, 2)
+
+		w := invalidate("Bearer secret", `{"stage":"predict","entity":"item","keys":["1","3"]}`)
+		So(w.Code, ShouldEqual, 200)
+		So(w.Body.String(), ShouldEqual, `{"deleted":1}`)
+		_, ok := cache.Get("2")
+		So(ok, ShouldBeTrue)
+
+		So(invalidate("Bearer secret", `{"stage":"serve"}`).Code, ShouldEqual, 400)
+		So(invalidate("Bearer secret", `{"entity":"shop"}`).Code, ShouldEqual, 400)
+		w = invalidate("Bearer secret", `{}`)
+		So(w.Code, ShouldEqual, 200)
+		So(w.Body.String(), ShouldEqual, `{"deleted":1}`)
+	})
+}
@@ -0,0 +1,290 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchItemFeaturer is an optional interface for Predictor. If implemented,
+// BatchPredict fetches all item features missing in the item FeatureCache with one call.
+// Items not found should be just absent in the returned map.
+type BatchItemFeaturer interface {
+	GetItemFeatures(ctx context.Context, itemIds []int) (features map[int]Tensor, err error)
+}
+
+// BatchUserBehavior is an optional interface for Predictor. If implemented with
+// UserBehavior, BatchPredict fetches behavior sequences of all users with the
+// same maxTs with one call. See UserBehavior for the meaning of params.
+// Users without behavior could be absent in the returned map.
+type BatchUserBehavior interface {
+	GetUserBehaviors(ctx context.Context, userIds []int,
+		maxLen int64, maxPk int64, maxTs int64) (itemSeqs map[int][]int, err error)
+}
+
+type ubKey struct {
+	userId int
+	maxTs  int64
+}
+
+// prefetched holds features batch fetched for one BatchPredict request.
+// Keys absent in the maps are fetched one by one as usual with the caches.
+type prefetched struct {
+	userFeatureCache FeatureCache
+	itemFeatureCache FeatureCache
+
+	itemFeatures map[int]Tensor
+	itemErrs     map[int]error
+	itemSeqs     map[ubKey][]int
+}
+
+func (pre *prefetched) itemSeq(userId int, maxTs int64) (seq []int, ok bool) {
+	if pre == nil {
+		return
+	}
+	seq, ok = pre.itemSeqs[ubKey{userId: userId, maxTs: maxTs}]
+	return
+}
+
+func (pre *prefetched) itemFeature(itemId int) (feature Tensor, ok bool, err error) {
+	if pre == nil {
+		return
+	}
+	if err, ok = pre.itemErrs[itemId]; ok {
+		return
+	}
+	feature, ok = pre.itemFeatures[itemId]
+	return
+}
+
+// flightCall is an in-flight or completed batch fetch of one key.
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+	// failed is true if the batch fetch of the key failed as a whole
+	failed bool
+}
+
+// batchFlight is like singleflight.Group but for batch fetching: keys already
+// being fetched by other goroutines are waited for, only the rest are fetched.
+type batchFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+var (
+	itemFeatureFlight batchFlight
+	itemSeqFlight     batchFlight
+)
+
+// Do calls fetch with keys not in flight, and returns values of all keys.
+// fetch should return values of the keys found, missing keys get errNotFound.
+// Keys of a failed fetch are in neither vals nor errs, so they could be fetched
+// one by one. Keys waited for get the error of ctx if it is done first, the
+// context of the fetch is the one of the goroutine fetching.
+func (g *batchFlight) Do(ctx context.Context, keys []string,
+	fetch func(keys []string) (map[string]interface{}, error),
+	errNotFound func(key string) error,
+) (vals map[string]interface{}, errs map[string]error) {
+	var (
+		own     = make([]string, 0, len(keys))
+		ownCall = make(map[string]*flightCall, len(keys))
+		waiting = make(map[string]*flightCall)
+	)
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	for _, k := range keys {
+		if _, ok := ownCall[k]; ok {
+			continue
+		}
+		if c, ok := g.calls[k]; ok {
+			waiting[k] = c
+			continue
+		}
+		c := &flightCall{done: make(chan struct{})}
+		g.calls[k] = c
+		ownCall[k] = c
+		own = append(own, k)
+	}
+	g.mu.Unlock()
+
+	if len(own) != 0 {
+		fetched, err := fetch(own)
+		if err != nil {
+			log.Warnf("batch fetch of %d keys failed, fetch them one by one: %v", len(own), err)
+		}
+		for _, k := range own {
+			c := ownCall[k]
+			if err != nil {
+				c.failed = true
+			} else if v, ok := fetched[k]; ok {
+				c.val = v
+			} else {
+				c.err = errNotFound(k)
+			}
+			close(c.done)
+		}
+		g.mu.Lock()
+		for _, k := range own {
+			delete(g.calls, k)
+		}
+		g.mu.Unlock()
+	}
+
+	vals = make(map[string]interface{}, len(keys))
+	errs = make(map[string]error)
+	collect := func(k string, c *flightCall) {
+		if c.failed {
+			return
+		}
+		if c.err != nil {
+			errs[k] = c.err
+		} else {
+			vals[k] = c.val
+		}
+	}
+	for k, c := range ownCall {
+		collect(k, c)
+	}
+	for k, c := range waiting {
+		select {
+		case <-c.done:
+			collect(k, c)
+		case <-ctx.Done():
+			errs[k] = ctx.Err()
+		}
+	}
+	return
+}
+
+// prefetch batch fetches item features and user behaviors of sampleKeys if
+// recSys implements BatchItemFeaturer or BatchUserBehavior.
+func prefetch(ctx context.Context, recSys Predictor, itemFeatureCache FeatureCache, sampleKeys []Sample,
+) (pre *prefetched) {
+	pre = &prefetched{}
+	if batchItem, ok := recSys.(BatchItemFeaturer); ok {
+		pre.itemFeatures, pre.itemErrs = prefetchItemFeatures(ctx, batchItem, itemFeatureCache, sampleKeys)
+	}
+	if getItemEmbeddings() != nil {
+		_, isUb := recSys.(UserBehavior)
+		if batchUb, ok := recSys.(BatchUserBehavior); ok && isUb {
+			pre.itemSeqs = prefetchItemSeqs(ctx, batchUb, sampleKeys)
+		}
+	}
+	return
+}
+
+// prefetchItemFeatures looks up itemFeatureCache first, and only batch fetches the misses.
+// Fetched features are put into itemFeatureCache.
+func prefetchItemFeatures(ctx context.Context, batchItem BatchItemFeaturer,
+	itemFeatureCache FeatureCache, sampleKeys []Sample,
+) (features map[int]Tensor, errs map[int]error) {
+	features = make(map[int]Tensor)
+	errs = make(map[int]error)
+	missing := make([]string, 0)
+	for _, sKey := range sampleKeys {
+		if _, ok := features[sKey.ItemId]; ok {
+			continue
+		}
+		itemIdStr := strconv.Itoa(sKey.ItemId)
+		if feature, ok := itemFeatureCache.Get(itemIdStr); ok {
+			features[sKey.ItemId] = feature
+			continue
+		}
+		// mark as seen, will be replaced by fetched value
+		features[sKey.ItemId] = nil
+		missing = append(missing, itemIdStr)
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	vals, fetchErrs := itemFeatureFlight.Do(ctx, missing, func(keys []string) (ret map[string]interface{}, err error) {
+		ids := make([]int, len(keys))
+		for i, k := range keys {
+			ids[i], _ = strconv.Atoi(k)
+		}
+		fetched, err := batchItem.GetItemFeatures(ctx, ids)
+		if err != nil {
+			return
+		}
+		ret = make(map[string]interface{}, len(fetched))
+		for id, f := range fetched {
+			key := strconv.Itoa(id)
+			itemFeatureCache.Set(key, f)
+			ret[key] = f
+		}
+		return
+	}, func(key string) error {
+		return fmt.Errorf("itemId %s not found", key)
+	})
+	for _, k := range missing {
+		id, _ := strconv.Atoi(k)
+		if v, ok := vals[k]; ok {
+			features[id] = v.(Tensor)
+		} else if err, ok := fetchErrs[k]; ok {
+			delete(features, id)
+			errs[id] = err
+		} else {
+			// left to GetItemFeature if the batch failed
+			delete(features, id)
+		}
+	}
+	return
+}
+
+// prefetchItemSeqs fetches user behaviors grouped by maxTs.
+func prefetchItemSeqs(ctx context.Context, batchUb BatchUserBehavior, sampleKeys []Sample,
+) (itemSeqs map[ubKey][]int) {
+	var (
+		tsUsers = make(map[int64][]int)
+		seen    = make(map[ubKey]bool)
+	)
+	itemSeqs = make(map[ubKey][]int)
+	for _, sKey := range sampleKeys {
+		k := ubKey{userId: sKey.UserId, maxTs: sKey.Timestamp}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		tsUsers[sKey.Timestamp] = append(tsUsers[sKey.Timestamp], sKey.UserId)
+	}
+	for maxTs, userIds := range tsUsers {
+		keys := make([]string, len(userIds))
+		for i, userId := range userIds {
+			keys[i] = fmt.Sprintf("%d@%d", userId, maxTs)
+		}
+		ts := maxTs
+		vals, _ := itemSeqFlight.Do(ctx, keys, func(keys []string) (ret map[string]interface{}, err error) {
+			ids := make([]int, len(keys))
+			for i, k := range keys {
+				fmt.Sscanf(k, "%d@", &ids[i])
+			}
+			seqs, err := batchUb.GetUserBehaviors(ctx, ids, UserBehaviorLen, -1, ts)
+			if err != nil {
+				return
+			}
+			// users absent in seqs have no behavior
+			ret = make(map[string]interface{}, len(ids))
+			for i, userId := range ids {
+				ret[keys[i]] = seqs[userId]
+			}
+			return
+		}, func(key string) error {
+			return fmt.Errorf("user behavior of %s not found", key)
+		})
+		// users failed are left to GetUserBehavior
+		for i, userId := range userIds {
+			if v, ok := vals[keys[i]]; ok {
+				itemSeqs[ubKey{userId: userId, maxTs: maxTs}] = v.([]int)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,167 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type batchPredictor struct {
+	fakePredictor
+	mu         sync.Mutex
+	singleCnt  int32
+	batchCalls [][]int
+	// batchErr fails GetItemFeatures if not nil
+	batchErr error
+}
+
+func (b *batchPredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	atomic.AddInt32(&b.singleCnt, 1)
+	return b.fakePredictor.GetItemFeature(ctx, itemId)
+}
+
+// GetItemFeatures has no feature for item 9
+func (b *batchPredictor) GetItemFeatures(ctx context.Context, itemIds []int) (features map[int]Tensor, err error) {
+	b.mu.Lock()
+	b.batchCalls = append(b.batchCalls, itemIds)
+	b.mu.Unlock()
+	if b.batchErr != nil {
+		return nil, b.batchErr
+	}
+	features = make(map[int]Tensor)
+	for _, id := range itemIds {
+		if id != 9 {
+			features[id], _ = b.fakePredictor.GetItemFeature(ctx, id)
+		}
+	}
+	return
+}
+
+func TestBatchItemFeaturer(t *testing.T) {
+	CloseFeatureCaches()
+	defer CloseFeatureCaches()
+
+	Convey("only cache misses are batch fetched", t, func() {
+		pred := &batchPredictor{}
+		scores, degraded, err := RankWithOptions(context.Background(), pred, 1, []int{1, 2, 2, 9}, DefaultPredictOptions)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{1, 1}, {2, 2}, {2, 2}, {9, 0}})
+		So(degraded, ShouldHaveLength, 1)
+		So(degraded[0].Reason, ShouldEqual, "itemId 9 not found")
+		So(pred.batchCalls, ShouldResemble, [][]int{{1, 2, 9}})
+		So(pred.singleCnt, ShouldEqual, 0)
+
+		_, _, err = RankWithOptions(context.Background(), pred, 1, []int{2, 3, 1}, DefaultPredictOptions)
+		So(err, ShouldBeNil)
+		So(pred.batchCalls[1], ShouldResemble, []int{3})
+		So(pred.singleCnt, ShouldEqual, 0)
+	})
+
+	Convey("items of a failed batch are fetched one by one", t, func() {
+		CloseFeatureCaches()
+		pred := &batchPredictor{batchErr: errors.New("batch down")}
+		scores, degraded, err := RankWithOptions(context.Background(), pred, 1, []int{1, 2, 9}, DefaultPredictOptions)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{1, 1}, {2, 2}, {9, 9}})
+		So(degraded, ShouldBeEmpty)
+		So(pred.batchCalls, ShouldHaveLength, 1)
+		So(pred.singleCnt, ShouldEqual, 3)
+	})
+
+	Convey("concurrent fetches of the same key are coalesced", t, func(c C) {
+		var (
+			g       batchFlight
+			fetched int32
+			wg      sync.WaitGroup
+			started = make(chan struct{})
+			release = make(chan struct{})
+		)
+		fetch := func(keys []string) (map[string]interface{}, error) {
+			atomic.AddInt32(&fetched, int32(len(keys)))
+			close(started)
+			<-release
+			ret := make(map[string]interface{})
+			for _, k := range keys {
+				ret[k] = k
+			}
+			return ret, nil
+		}
+		notFound := func(key string) error { return fmt.Errorf("%s not found", key) }
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals, errs := g.Do(context.Background(), []string{"a", "b"}, fetch, notFound)
+			c.So(errs, ShouldBeEmpty)
+			c.So(vals, ShouldHaveLength, 2)
+		}()
+		<-started
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// "a" is already waited for when "c" is fetched, so the first
+			// fetch is released only after the second Do joined it.
+			vals, errs := g.Do(context.Background(), []string{"a", "c"}, func(keys []string) (map[string]interface{}, error) {
+				atomic.AddInt32(&fetched, int32(len(keys)))
+				close(release)
+				return map[string]interface{}{"c": "c"}, nil
+			}, notFound)
+			c.So(errs, ShouldBeEmpty)
+			c.So(vals["a"], ShouldEqual, "a")
+			c.So(vals["c"], ShouldEqual, "c")
+		}()
+		wg.Wait()
+		So(fetched, ShouldEqual, 3)
+	})
+	Convey("waiters get the error of their own context", t, func(c C) {
+		var (
+			g       batchFlight
+			wg      sync.WaitGroup
+			started = make(chan struct{})
+			release = make(chan struct{})
+			joined  = make(chan struct{})
+		)
+		notFound := func(key string) error { return fmt.Errorf("%s not found", key) }
+		ownerCtx, cancelOwner := context.WithCancel(context.Background())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals, errs := g.Do(ownerCtx, []string{"a"}, func(keys []string) (map[string]interface{}, error) {
+				close(started)
+				<-release
+				return nil, ownerCtx.Err()
+			}, notFound)
+			// the keys of the failed fetch are left to single fetches
+			c.So(vals, ShouldBeEmpty)
+			c.So(errs, ShouldBeEmpty)
+		}()
+		<-started
+
+		waiterCtx, cancelWaiter := context.WithCancel(context.Background())
+		cancelWaiter()
+		vals, errs := g.Do(waiterCtx, []string{"a"}, nil, notFound)
+		So(vals, ShouldBeEmpty)
+		So(errs["a"], ShouldEqual, context.Canceled)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// "b" is fetched after "a" is joined
+			vals, errs := g.Do(context.Background(), []string{"a", "b"}, func(keys []string) (map[string]interface{}, error) {
+				close(joined)
+				return map[string]interface{}{"b": "b"}, nil
+			}, notFound)
+			c.So(vals, ShouldResemble, map[string]interface{}{"b": "b"})
+			c.So(errs, ShouldBeEmpty)
+		}()
+		<-joined
+		cancelOwner()
+		close(release)
+		wg.Wait()
+	})
+}
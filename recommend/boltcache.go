@@ -0,0 +1,291 @@
+package recommend
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var featureBucket = []byte("features")
+
+// boltBatchSize is the number of Set buffered before written in one transaction
+const boltBatchSize = 256
+
+type pendingFeature struct {
+	value  Tensor
+	expire time.Time
+}
+
+// BoltFeatureCache is an on disk FeatureCache backed by bbolt.
+// Every value is stored as 8 bytes expire unix nano followed by little endian float32s.
+// Set is buffered in memory and written every boltBatchSize features, or by
+// Flush, Delete, Clear, ItemCount and Close. The buffered features are kept if
+// the write fails, and retried by the next write. If MaxSize of CacheConfig is
+// greater than 0, the features expiring first are evicted when there are more
+// than MaxSize features after a write.
+type BoltFeatureCache struct {
+	db      *bolt.DB
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	pending map[string]pendingFeature
+	// count is the number of features written, counted once by Open
+	count int
+}
+
+var _ FeatureCache = &BoltFeatureCache{}
+
+// BoltFeatureCacheFactory returns a FeatureCacheFactory which creates
+// BoltFeatureCache in dir, one file per stage and entity type.
+func BoltFeatureCacheFactory(dir string) FeatureCacheFactory {
+	return func(stage Stage, entity EntityType, conf CacheConfig) (FeatureCache, error) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		return NewBoltFeatureCache(filepath.Join(dir, fmt.Sprintf("%s_%s.db", stage, entity)), conf)
+	}
+}
+
+func NewBoltFeatureCache(path string, conf CacheConfig) (cache *BoltFeatureCache, err error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return
+	}
+	var count int
+	if err = db.Update(func(tx *bolt.Tx) error {
+		b, er := tx.CreateBucketIfNotExists(featureBucket)
+		if er != nil {
+			return er
+		}
+		count = b.Stats().KeyN
+		return nil
+	}); err != nil {
+		db.Close()
+		return
+	}
+	cache = &BoltFeatureCache{
+		db:      db,
+		ttl:     conf.TTL,
+		maxSize: int(conf.MaxSize),
+		pending: make(map[string]pendingFeature),
+		count:   count,
+	}
+	return
+}
+
+func encodeFeature(value Tensor, expire time.Time) []byte {
+	buf := make([]byte, 8+4*len(value))
+	binary.LittleEndian.PutUint64(buf, uint64(expire.UnixNano()))
+	for i, v := range value {
+		binary.LittleEndian.PutUint32(buf[8+4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeFeature(buf []byte) (value Tensor, expire time.Time, err error) {
+	if len(buf) < 8 || (len(buf)-8)%4 != 0 {
+		err = fmt.Errorf("invalid feature length %d", len(buf))
+		return
+	}
+	expire = time.Unix(0, int64(binary.LittleEndian.Uint64(buf)))
+	value = make(Tensor, (len(buf)-8)/4)
+	for i := range value {
+		value[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[8+4*i:]))
+	}
+	return
+}
+
+func (c *BoltFeatureCache) Get(key string) (value Tensor, ok bool) {
+	var expire time.Time
+	c.mu.Lock()
+	p, ok := c.pending[key]
+	c.mu.Unlock()
+	if ok {
+		value, expire = p.value, p.expire
+	} else {
+		_ = c.db.View(func(tx *bolt.Tx) (err error) {
+			buf := tx.Bucket(featureBucket).Get([]byte(key))
+			if buf == nil {
+				return
+			}
+			// buf is only valid in the transaction, decode copies it
+			if value, expire, err = decodeFeature(buf); err != nil {
+				return
+			}
+			ok = true
+			return
+		})
+	}
+	if ok && time.Now().After(expire) {
+		c.Delete(key)
+		return nil, false
+	}
+	return
+}
+
+func (c *BoltFeatureCache) Set(key string, value Tensor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[key] = pendingFeature{value: value, expire: time.Now().Add(c.ttl)}
+	if len(c.pending) >= boltBatchSize {
+		_ = c.flushLocked()
+	}
+}
+
+// Flush writes the buffered features in one transaction.
+func (c *BoltFeatureCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *BoltFeatureCache) flushLocked() (err error) {
+	if len(c.pending) == 0 {
+		return
+	}
+	count := c.count
+	err = c.db.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket(featureBucket)
+		for key, p := range c.pending {
+			if b.Get([]byte(key)) == nil {
+				count++
+			}
+			if err = b.Put([]byte(key), encodeFeature(p.value, p.expire)); err != nil {
+				return
+			}
+		}
+		if c.maxSize > 0 && count > c.maxSize {
+			var evicted int
+			evicted, err = evict(b, c.maxSize)
+			count -= evicted
+		}
+		return
+	})
+	if err != nil {
+		// the transaction is rolled back, keep pending to retry
+		return
+	}
+	c.count = count
+	c.pending = make(map[string]pendingFeature)
+	return
+}
+
+// evict deletes the expired features, and the features expiring first until
+// b has at most 99% of maxSize features, and returns the number deleted.
+func evict(b *bolt.Bucket, maxSize int) (deleted int, err error) {
+	type keyExpire struct {
+		key    []byte
+		expire int64
+	}
+	var (
+		now  = time.Now().UnixNano()
+		keys []keyExpire
+		dead [][]byte
+	)
+	err = b.ForEach(func(k, v []byte) error {
+		if len(v) < 8 {
+			dead = append(dead, append([]byte(nil), k...))
+			return nil
+		}
+		expire := int64(binary.LittleEndian.Uint64(v))
+		if expire < now {
+			dead = append(dead, append([]byte(nil), k...))
+		} else {
+			keys = append(keys, keyExpire{key: append([]byte(nil), k...), expire: expire})
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if keep := maxSize - maxSize/100; len(keys) > keep {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].expire < keys[j].expire })
+		for _, k := range keys[:len(keys)-keep] {
+			dead = append(dead, k.key)
+		}
+	}
+	for _, k := range dead {
+		if err = b.Delete(k); err != nil {
+			return
+		}
+		deleted++
+	}
+	return
+}
+
+func (c *BoltFeatureCache) Fetch(key string, fetch func() (Tensor, error)) (value Tensor, err error) {
+	var ok bool
+	if value, ok = c.Get(key); ok {
+		return
+	}
+	if value, err = fetch(); err != nil {
+		return
+	}
+	c.Set(key, value)
+	return
+}
+
+func (c *BoltFeatureCache) Delete(key string) (deleted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[key]; ok {
+		delete(c.pending, key)
+		deleted = true
+	}
+	_ = c.flushLocked()
+	var inDB bool
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(featureBucket)
+		if b.Get([]byte(key)) == nil {
+			return nil
+		}
+		inDB = true
+		return b.Delete([]byte(key))
+	}); err == nil && inDB {
+		c.count--
+		deleted = true
+	}
+	return
+}
+
+func (c *BoltFeatureCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = make(map[string]pendingFeature)
+	err := c.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = tx.DeleteBucket(featureBucket); err != nil {
+			return
+		}
+		_, err = tx.CreateBucket(featureBucket)
+		return
+	})
+	if err == nil {
+		c.count = 0
+	}
+	return err
+}
+
+func (c *BoltFeatureCache) ItemCount() (count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.flushLocked()
+	return c.count
+}
+
+func (c *BoltFeatureCache) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.flushLocked()
+	if er := c.db.Close(); er != nil {
+		err = er
+	}
+	return
+}
@@ -0,0 +1,234 @@
+package recommend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+// EntityType is the type of entity features are cached for.
+type EntityType int
+
+const (
+	UserEntity EntityType = iota
+	ItemEntity
+)
+
+func (e EntityType) String() string {
+	switch e {
+	case UserEntity:
+		return "user"
+	case ItemEntity:
+		return "item"
+	default:
+		return fmt.Sprintf("EntityType(%d)", int(e))
+	}
+}
+
+func (s Stage) String() string {
+	switch s {
+	case TrainStage:
+		return "train"
+	case PredictStage:
+		return "predict"
+	default:
+		return fmt.Sprintf("Stage(%d)", int(s))
+	}
+}
+
+// FeatureCache caches user or item features by id.
+type FeatureCache interface {
+	// Get returns the cached feature if it is not expired.
+	Get(key string) (Tensor, bool)
+	Set(key string, value Tensor)
+	// Fetch returns the cached feature, or calls fetch and caches the result if no error.
+	Fetch(key string, fetch func() (Tensor, error)) (Tensor, error)
+	Delete(key string) bool
+	Clear() error
+	ItemCount() int
+	Close() error
+}
+
+// CacheConfig is the config of feature cache of one entity type.
+type CacheConfig struct {
+	// TTL is the time to live of cached features.
+	TTL time.Duration
+	// MaxSize is the max item count of the cache, 0 means no limit for BoltFeatureCache.
+	MaxSize int64
+}
+
+// FeatureCacheFactory creates the FeatureCache of entity used in stage.
+type FeatureCacheFactory func(stage Stage, entity EntityType, conf CacheConfig) (FeatureCache, error)
+
+var (
+	UserCacheConfig = CacheConfig{
+		TTL:     time.Hour * 24,
+		MaxSize: userFeatureCacheSize,
+	}
+	ItemCacheConfig = CacheConfig{
+		TTL:     time.Hour * 24,
+		MaxSize: itemFeatureCacheSize,
+	}
+	// NewFeatureCache is used to create feature caches, default is in memory cache.
+	// Set it before Train or BatchPredict to use other backends like BoltFeatureCacheFactory.
+	NewFeatureCache FeatureCacheFactory = func(_ Stage, _ EntityType, conf CacheConfig) (FeatureCache, error) {
+		return NewMemoryFeatureCache(conf), nil
+	}
+	// ShareStageCache makes PredictStage reuse the feature caches of TrainStage.
+	ShareStageCache bool
+
+	featureCachesMu sync.Mutex
+	featureCaches   = make(map[Stage]map[EntityType]FeatureCache)
+)
+
+func cacheConfigOf(entity EntityType) CacheConfig {
+	if entity == UserEntity {
+		return UserCacheConfig
+	}
+	return ItemCacheConfig
+}
+
+// GetFeatureCache returns the FeatureCache of entity in stage, it is created
+// by NewFeatureCache on first use. The deprecated UserFeatureCache and
+// ItemFeatureCache are used for both stages if not nil.
+func GetFeatureCache(stage Stage, entity EntityType) (cache FeatureCache, err error) {
+	if entity == UserEntity && UserFeatureCache != nil {
+		return WrapCCache(UserFeatureCache, UserCacheConfig.TTL), nil
+	}
+	if entity == ItemEntity && ItemFeatureCache != nil {
+		return WrapCCache(ItemFeatureCache, ItemCacheConfig.TTL), nil
+	}
+	if ShareStageCache {
+		stage = TrainStage
+	}
+	featureCachesMu.Lock()
+	defer featureCachesMu.Unlock()
+	if cache = featureCaches[stage][entity]; cache != nil {
+		return
+	}
+	if cache, err = NewFeatureCache(stage, entity, cacheConfigOf(entity)); err != nil {
+		return
+	}
+	if featureCaches[stage] == nil {
+		featureCaches[stage] = make(map[EntityType]FeatureCache)
+	}
+	featureCaches[stage][entity] = cache
+	return
+}
+
+// getFeatureCaches returns user and item feature cache of stage.
+func getFeatureCaches(stage Stage) (userCache, itemCache FeatureCache, err error) {
+	if userCache, err = GetFeatureCache(stage, UserEntity); err != nil {
+		return
+	}
+	itemCache, err = GetFeatureCache(stage, ItemEntity)
+	return
+}
+
+// InvalidateFeatureCache deletes keys from the feature cache of entity in stage,
+// all features are cleared if keys is empty. It returns the number of keys deleted.
+func InvalidateFeatureCache(stage Stage, entity EntityType, keys ...string) (deleted int, err error) {
+	cache, err := GetFeatureCache(stage, entity)
+	if err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		deleted = cache.ItemCount()
+		err = cache.Clear()
+		return
+	}
+	for _, key := range keys {
+		if cache.Delete(key) {
+			deleted++
+		}
+	}
+	return
+}
+
+// CloseFeatureCaches closes and forgets all feature caches.
+func CloseFeatureCaches() (err error) {
+	featureCachesMu.Lock()
+	defer featureCachesMu.Unlock()
+	for _, caches := range featureCaches {
+		for _, cache := range caches {
+			if er := cache.Close(); er != nil && err == nil {
+				err = er
+			}
+		}
+	}
+	featureCaches = make(map[Stage]map[EntityType]FeatureCache)
+	return
+}
+
+// MemoryFeatureCache is a FeatureCache in memory backed by ccache.
+type MemoryFeatureCache struct {
+	cache *ccache.Cache
+	ttl   time.Duration
+	// wrapped caches are not stopped by Close
+	wrapped bool
+}
+
+var _ FeatureCache = &MemoryFeatureCache{}
+
+func NewMemoryFeatureCache(conf CacheConfig) *MemoryFeatureCache {
+	return &MemoryFeatureCache{
+		cache: ccache.New(
+			ccache.Configure().MaxSize(conf.MaxSize).ItemsToPrune(uint32(conf.MaxSize/100 + 1)),
+		),
+		ttl: conf.TTL,
+	}
+}
+
+// WrapCCache returns the FeatureCache of the ccache c, features are cached for ttl.
+// c is not stopped by Close.
+func WrapCCache(c *ccache.Cache, ttl time.Duration) *MemoryFeatureCache {
+	return &MemoryFeatureCache{
+		cache:   c,
+		ttl:     ttl,
+		wrapped: true,
+	}
+}
+
+func (c *MemoryFeatureCache) Get(key string) (Tensor, bool) {
+	item := c.cache.Get(key)
+	if item == nil || item.Expired() {
+		return nil, false
+	}
+	return item.Value().(Tensor), true
+}
+
+func (c *MemoryFeatureCache) Set(key string, value Tensor) {
+	c.cache.Set(key, value, c.ttl)
+}
+
+func (c *MemoryFeatureCache) Fetch(key string, fetch func() (Tensor, error)) (Tensor, error) {
+	item, err := c.cache.Fetch(key, c.ttl, func() (interface{}, error) {
+		return fetch()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item.Value().(Tensor), nil
+}
+
+func (c *MemoryFeatureCache) Delete(key string) bool {
+	return c.cache.Delete(key)
+}
+
+func (c *MemoryFeatureCache) Clear() error {
+	c.cache.Clear()
+	return nil
+}
+
+func (c *MemoryFeatureCache) ItemCount() int {
+	return c.cache.ItemCount()
+}
+
+func (c *MemoryFeatureCache) Close() error {
+	if !c.wrapped {
+		c.cache.Stop()
+	}
+	return nil
+}
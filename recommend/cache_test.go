@@ -0,0 +1,218 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	. "github.com/smartystreets/goconvey/convey"
+	bolt "go.etcd.io/bbolt"
+)
+
+func testFeatureCache(cache FeatureCache) {
+	So(cache.Clear(), ShouldBeNil)
+	_, ok := cache.Get("1")
+	So(ok, ShouldBeFalse)
+
+	cache.Set("1", Tensor{1, 2})
+	v, ok := cache.Get("1")
+	So(ok, ShouldBeTrue)
+	So(v, ShouldResemble, Tensor{1, 2})
+
+	var fetched int
+	fetch := func() (Tensor, error) {
+		fetched++
+		return Tensor{3}, nil
+	}
+	v, err := cache.Fetch("2", fetch)
+	So(err, ShouldBeNil)
+	So(v, ShouldResemble, Tensor{3})
+	v, err = cache.Fetch("2", fetch)
+	So(err, ShouldBeNil)
+	So(v, ShouldResemble, Tensor{3})
+	So(fetched, ShouldEqual, 1)
+
+	_, err = cache.Fetch("3", func() (Tensor, error) {
+		return nil, fmt.Errorf("not found")
+	})
+	So(err, ShouldNotBeNil)
+	So(cache.ItemCount(), ShouldEqual, 2)
+
+	So(cache.Delete("1"), ShouldBeTrue)
+	So(cache.Delete("1"), ShouldBeFalse)
+	So(cache.Clear(), ShouldBeNil)
+	So(cache.ItemCount(), ShouldEqual, 0)
+}
+
+func TestFeatureCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "featurecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("memory feature cache", t, func() {
+		cache := NewMemoryFeatureCache(UserCacheConfig)
+		defer cache.Close()
+		testFeatureCache(cache)
+	})
+
+	Convey("bolt feature cache", t, func() {
+		cache, err := NewBoltFeatureCache(filepath.Join(dir, "test.db"), CacheConfig{TTL: time.Hour})
+		So(err, ShouldBeNil)
+		defer cache.Close()
+		testFeatureCache(cache)
+	})
+
+	Convey("bolt feature cache expire", t, func() {
+		cache, err := NewBoltFeatureCache(filepath.Join(dir, "expire.db"), CacheConfig{TTL: time.Millisecond})
+		So(err, ShouldBeNil)
+		defer cache.Close()
+		cache.Set("1", Tensor{1})
+		time.Sleep(5 * time.Millisecond)
+		_, ok := cache.Get("1")
+		So(ok, ShouldBeFalse)
+		So(cache.ItemCount(), ShouldEqual, 0)
+	})
+
+	Convey("caches are separated by stage", t, func() {
+		newFeatureCache := NewFeatureCache
+		NewFeatureCache = BoltFeatureCacheFactory(dir)
+		defer func() {
+			So(CloseFeatureCaches(), ShouldBeNil)
+			NewFeatureCache = newFeatureCache
+		}()
+		So(CloseFeatureCaches(), ShouldBeNil)
+
+		trainCache, err := GetFeatureCache(TrainStage, ItemEntity)
+		So(err, ShouldBeNil)
+		predictCache, err := GetFeatureCache(PredictStage, ItemEntity)
+		So(err, ShouldBeNil)
+		So(trainCache, ShouldNotEqual, predictCache)
+		_, err = os.Stat(filepath.Join(dir, "predict_item.db"))
+		So(err, ShouldBeNil)
+
+		trainCache.Set("1", Tensor{1})
+		predictCache.Set("1", Tensor{2})
+		predictCache.Set("2", Tensor{2})
+		deleted, err := InvalidateFeatureCache(PredictStage, ItemEntity, "1", "3")
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 1)
+		_, ok := trainCache.Get("1")
+		So(ok, ShouldBeTrue)
+		deleted, err = InvalidateFeatureCache(PredictStage, ItemEntity)
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 1)
+		So(predictCache.ItemCount(), ShouldEqual, 0)
+
+		ShareStageCache = true
+		defer func() { ShareStageCache = false }()
+		sharedCache, err := GetFeatureCache(PredictStage, ItemEntity)
+		So(err, ShouldBeNil)
+		So(sharedCache, ShouldEqual, trainCache)
+	})
+}
+
+func TestBoltFeatureCacheBatchAndEvict(t *testing.T) {
+	dir, err := os.MkdirTemp("", "boltcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("buffered sets are visible and flushed", t, func() {
+		path := filepath.Join(dir, "batch.db")
+		cache, err := NewBoltFeatureCache(path, CacheConfig{TTL: time.Hour})
+		So(err, ShouldBeNil)
+		cache.Set("1", Tensor{1})
+		v, ok := cache.Get("1")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, Tensor{1})
+		So(cache.Close(), ShouldBeNil)
+
+		cache, err = NewBoltFeatureCache(path, CacheConfig{TTL: time.Hour})
+		So(err, ShouldBeNil)
+		defer cache.Close()
+		v, ok = cache.Get("1")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, Tensor{1})
+		So(cache.ItemCount(), ShouldEqual, 1)
+		cache.Set("1", Tensor{2})
+		cache.Set("2", Tensor{2})
+		So(cache.ItemCount(), ShouldEqual, 2)
+		So(cache.Delete("1"), ShouldBeTrue)
+		So(cache.Delete("1"), ShouldBeFalse)
+		So(cache.ItemCount(), ShouldEqual, 1)
+		So(cache.Clear(), ShouldBeNil)
+		So(cache.ItemCount(), ShouldEqual, 0)
+	})
+
+	Convey("buffered sets are kept if the write fails", t, func() {
+		path := filepath.Join(dir, "failed.db")
+		cache, err := NewBoltFeatureCache(path, CacheConfig{TTL: time.Hour})
+		So(err, ShouldBeNil)
+		cache.Set("1", Tensor{1})
+		So(cache.db.Close(), ShouldBeNil)
+		So(cache.Flush(), ShouldNotBeNil)
+		v, ok := cache.Get("1")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, Tensor{1})
+
+		cache.db, err = bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+		So(err, ShouldBeNil)
+		So(cache.Flush(), ShouldBeNil)
+		So(cache.ItemCount(), ShouldEqual, 1)
+		So(cache.Close(), ShouldBeNil)
+		cache, err = NewBoltFeatureCache(path, CacheConfig{TTL: time.Hour})
+		So(err, ShouldBeNil)
+		defer cache.Close()
+		So(cache.ItemCount(), ShouldEqual, 1)
+		v, ok = cache.Get("1")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, Tensor{1})
+	})
+
+	Convey("features expiring first are evicted beyond MaxSize", t, func() {
+		cache, err := NewBoltFeatureCache(filepath.Join(dir, "evict.db"), CacheConfig{TTL: time.Hour, MaxSize: 500})
+		So(err, ShouldBeNil)
+		defer cache.Close()
+		for i := 0; i < 1000; i++ {
+			cache.Set(fmt.Sprint(i), Tensor{float32(i)})
+		}
+		So(cache.ItemCount(), ShouldBeLessThanOrEqualTo, 500)
+		_, ok := cache.Get("0")
+		So(ok, ShouldBeFalse)
+		v, ok := cache.Get("999")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, Tensor{999})
+	})
+}
+
+func TestDeprecatedCCacheGlobals(t *testing.T) {
+	Convey("deprecated ccache globals are used for both stages", t, func() {
+		ItemFeatureCache = ccache.New(ccache.Configure())
+		defer func() {
+			ItemFeatureCache.Stop()
+			ItemFeatureCache = nil
+		}()
+		for _, stage := range []Stage{TrainStage, PredictStage} {
+			cache, err := GetFeatureCache(stage, ItemEntity)
+			So(err, ShouldBeNil)
+			cache.Set(stage.String(), Tensor{1})
+			So(cache.Close(), ShouldBeNil)
+		}
+		So(ItemFeatureCache.ItemCount(), ShouldEqual, 2)
+
+		vec, uWidth, iWidth, err := GetSampleVector(context.Background(), ccache.New(ccache.Configure()), ItemFeatureCache,
+			&fakePredictor{}, &Sample{UserId: 1, ItemId: 2})
+		So(err, ShouldBeNil)
+		So(uWidth, ShouldEqual, 1)
+		So(iWidth, ShouldEqual, 2)
+		So(vec[0], ShouldEqual, 1)
+		So(ItemFeatureCache.Get("2"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,342 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorgonia.org/tensor"
+)
+
+const (
+	impressionFileExt        = ".jsonl"
+	defaultImpressionMaxSize = 128 << 20 // 128MB
+)
+
+var (
+	// ImpressionLog is used by BatchPredict to record what the model saw
+	// at serve time if not nil. See FileImpressionLogger.
+	ImpressionLog ImpressionLogger
+	// ModelVersion is written into every impression record
+	ModelVersion string
+
+	impressionSeq int64
+)
+
+// Impression is what the model saw during one BatchPredict request.
+// Vectors[i] is exactly the feature vector got from GetSampleVector for Samples[i],
+// and Scores[i] is the model output for it.
+type Impression struct {
+	RequestId    string      `json:"requestId"`
+	Timestamp    int64       `json:"timestamp"`
+	ModelVersion string      `json:"modelVersion"`
+	Info         SampleInfo  `json:"info"`
+	Samples      []Sample    `json:"samples"`
+	Vectors      [][]float32 `json:"vectors"`
+	Scores       []float32   `json:"scores"`
+}
+
+func newImpressionRequestId() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddInt64(&impressionSeq, 1))
+}
+
+func logImpression(ctx context.Context, sampleKeys []Sample,
+	xData []float32, xWidth, uWidth, iWidth int, y tensor.Tensor,
+) (err error) {
+	imp := &Impression{
+		RequestId:    newImpressionRequestId(),
+		Timestamp:    time.Now().Unix(),
+		ModelVersion: ModelVersion,
+		Info:         newSampleInfo(uWidth, iWidth),
+		Samples:      sampleKeys,
+		Vectors:      make([][]float32, len(sampleKeys)),
+		Scores:       make([]float32, len(sampleKeys)),
+	}
+	for i := range sampleKeys {
+		imp.Vectors[i] = xData[i*xWidth : (i+1)*xWidth]
+		var score interface{}
+		if score, err = y.At(i, 0); err != nil {
+			return
+		}
+		s, ok := score.(float32)
+		if !ok {
+			return fmt.Errorf("score of sample %d must be float32, got %T", i, score)
+		}
+		imp.Scores[i] = s
+	}
+	return ImpressionLog.LogImpression(ctx, imp)
+}
+
+// ImpressionLogger records impressions for training-serving consistency.
+type ImpressionLogger interface {
+	LogImpression(ctx context.Context, imp *Impression) error
+}
+
+// ImpressionLabeler is used to attach the later observed label to a logged sample.
+// ok == false means the label is not available yet, the sample will be skipped.
+type ImpressionLabeler interface {
+	GetLabel(ctx context.Context, sample Sample) (label float32, ok bool, err error)
+}
+
+// FileImpressionLogger writes impressions as JSON lines into local files under Dir.
+// A new file is opened when the current one exceeds MaxSize bytes.
+type FileImpressionLogger struct {
+	Dir     string
+	Prefix  string
+	MaxSize int64
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	written int64
+	seq     int64
+}
+
+var _ ImpressionLogger = &FileImpressionLogger{}
+
+func NewFileImpressionLogger(dir, prefix string, maxSize int64) (logger *FileImpressionLogger, err error) {
+	if maxSize <= 0 {
+		maxSize = defaultImpressionMaxSize
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	logger = &FileImpressionLogger{
+		Dir:     dir,
+		Prefix:  prefix,
+		MaxSize: maxSize,
+	}
+	return
+}
+
+func (l *FileImpressionLogger) LogImpression(_ context.Context, imp *Impression) (err error) {
+	line, err := json.Marshal(imp)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.written+int64(len(line)) > l.MaxSize {
+		if err = l.rotate(); err != nil {
+			return
+		}
+	}
+	n, err := l.writer.Write(line)
+	l.written += int64(n)
+	if err != nil {
+		return
+	}
+	return l.writer.Flush()
+}
+
+// rotate closes current file and opens a new one, l.mu must be held.
+func (l *FileImpressionLogger) rotate() (err error) {
+	if err = l.closeFile(); err != nil {
+		return
+	}
+	l.seq++
+	name := fmt.Sprintf("%s-%s-%04d%s", l.Prefix,
+		time.Now().Format("20060102T150405"), l.seq, impressionFileExt)
+	l.file, err = os.OpenFile(filepath.Join(l.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	l.writer = bufio.NewWriter(l.file)
+	l.written = 0
+	return
+}
+
+func (l *FileImpressionLogger) closeFile() (err error) {
+	if l.file == nil {
+		return
+	}
+	if err = l.writer.Flush(); err != nil {
+		return
+	}
+	err = l.file.Close()
+	l.file = nil
+	l.writer = nil
+	return
+}
+
+// Close flushes and closes the current impression file.
+func (l *FileImpressionLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closeFile()
+}
+
+// ImpressionFiles returns impression files with prefix under dir in written order.
+func ImpressionFiles(dir, prefix string) (files []string, err error) {
+	files, err = filepath.Glob(filepath.Join(dir, prefix+"-*"+impressionFileExt))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	return
+}
+
+// ReadImpressions reads all impressions in files, one impression per line.
+func ReadImpressions(ctx context.Context, files []string) (<-chan *Impression, error) {
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return nil, err
+		}
+	}
+	ch := make(chan *Impression, 100)
+	go func() {
+		defer close(ch)
+		for _, f := range files {
+			if err := readImpressionFile(ctx, f, ch); err != nil {
+				log.Errorf("read impression file %s error: %v", f, err)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func readImpressionFile(ctx context.Context, path string, ch chan<- *Impression) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		var line string
+		line, err = reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			imp := &Impression{}
+			if er := json.Unmarshal([]byte(line), imp); er != nil {
+				// the last line may be partially written
+				log.Warnf("skip broken impression line in %s: %v", path, er)
+			} else {
+				select {
+				case ch <- imp:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// ImpressionJoiner joins logged impressions with labels got later.
+// It implements Trainer so it could be used as a sample source, and TrainSample
+// builds the train sample from the logged feature vectors directly, so there is
+// no feature skew between training and serving.
+type ImpressionJoiner struct {
+	Dir     string
+	Prefix  string
+	Labeler ImpressionLabeler
+}
+
+type labeledVec struct {
+	sample Sample
+	vec    []float32
+	info   SampleInfo
+}
+
+var _ Trainer = &ImpressionJoiner{}
+
+func (j *ImpressionJoiner) join(ctx context.Context) (ret <-chan labeledVec, err error) {
+	files, err := ImpressionFiles(j.Dir, j.Prefix)
+	if err != nil {
+		return
+	}
+	impCh, err := ReadImpressions(ctx, files)
+	if err != nil {
+		return
+	}
+	ch := make(chan labeledVec, 1000)
+	go func() {
+		defer close(ch)
+		for imp := range impCh {
+			for i, s := range imp.Samples {
+				label, ok, er := j.Labeler.GetLabel(ctx, s)
+				if er != nil {
+					log.Errorf("get label of user %d item %d error: %v", s.UserId, s.ItemId, er)
+					continue
+				}
+				if !ok {
+					continue
+				}
+				s.Label = label
+				lv := labeledVec{sample: s, info: imp.Info}
+				if i < len(imp.Vectors) {
+					lv.vec = imp.Vectors[i]
+				}
+				select {
+				case ch <- lv:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	ret = ch
+	return
+}
+
+// SampleGenerator yields logged samples with labels attached.
+func (j *ImpressionJoiner) SampleGenerator(ctx context.Context) (ret <-chan Sample, err error) {
+	lvCh, err := j.join(ctx)
+	if err != nil {
+		return
+	}
+	ch := make(chan Sample, 1000)
+	go func() {
+		defer close(ch)
+		for lv := range lvCh {
+			ch <- lv.sample
+		}
+	}()
+	ret = ch
+	return
+}
+
+// TrainSample builds TrainSample from logged feature vectors and joined labels.
+func (j *ImpressionJoiner) TrainSample(ctx context.Context) (sample *TrainSample, err error) {
+	lvCh, err := j.join(ctx)
+	if err != nil {
+		return
+	}
+	sample = &TrainSample{}
+	for lv := range lvCh {
+		if len(lv.vec) == 0 {
+			continue
+		}
+		if sample.XCols == 0 {
+			sample.XCols = len(lv.vec)
+			sample.Info = lv.info
+		}
+		if len(lv.vec) != sample.XCols {
+			err = fmt.Errorf("sample width mismatch: %v:%v", sample.XCols, len(lv.vec))
+			return
+		}
+		sample.X = append(sample.X, lv.vec...)
+		sample.Y = append(sample.Y, lv.sample.Label)
+		sample.Rows++
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package recommend
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+type fakePredictor struct{}
+
+func (f *fakePredictor) GetUserFeature(_ context.Context, userId int) (Tensor, error) {
+	return Tensor{float32(userId)}, nil
+}
+
+func (f *fakePredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	return Tensor{float32(itemId), 1}, nil
+}
+
+// Predict returns the item id feature as score
+func (f *fakePredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	y := make([]float32, rows)
+	for i := 0; i < rows; i++ {
+		v, _ := X.At(i, cols-2)
+		y[i] = v.(float32)
+	}
+	return tensor.NewDense(tensor.Float32, tensor.Shape{rows, 1}, tensor.WithBacking(y))
+}
+
+type fakeLabeler struct{}
+
+// GetLabel labels even items as positive, item 3 is not labeled yet
+func (l *fakeLabeler) GetLabel(_ context.Context, sample Sample) (float32, bool, error) {
+	if sample.ItemId == 3 {
+		return 0, false, nil
+	}
+	return float32(1 - sample.ItemId%2), true, nil
+}
+
+func TestImpressionLog(t *testing.T) {
+	Convey("log and join impressions", t, func() {
+		dir, err := os.MkdirTemp("", "impression")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		logger, err := NewFileImpressionLogger(dir, "imp", 200)
+		So(err, ShouldBeNil)
+		ImpressionLog = logger
+		ModelVersion = "v1"
+		defer func() {
+			ImpressionLog = nil
+			ModelVersion = ""
+		}()
+
+		scores, err := Rank(context.Background(), &fakePredictor{}, 7, []int{1, 2, 3, 4})
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 4)
+		_, err = Rank(context.Background(), &fakePredictor{}, 8, []int{5, 6})
+		So(err, ShouldBeNil)
+		So(logger.Close(), ShouldBeNil)
+
+		files, err := ImpressionFiles(dir, "imp")
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 2)
+
+		impCh, err := ReadImpressions(context.Background(), files)
+		So(err, ShouldBeNil)
+		var imps []*Impression
+		for imp := range impCh {
+			imps = append(imps, imp)
+		}
+		So(imps, ShouldHaveLength, 2)
+		So(imps[0].ModelVersion, ShouldEqual, "v1")
+		So(imps[0].Samples, ShouldHaveLength, 4)
+		So(imps[0].Scores, ShouldResemble, []float32{1, 2, 3, 4})
+		So(imps[0].Vectors[1][0], ShouldEqual, 7)
+		So(imps[0].Info.CtxFeatureRange, ShouldResemble, [2]int{1 + ItemEmbDim*(UserBehaviorLen+1), 3 + ItemEmbDim*(UserBehaviorLen+1)})
+
+		joiner := &ImpressionJoiner{Dir: dir, Prefix: "imp", Labeler: &fakeLabeler{}}
+		sample, err := joiner.TrainSample(context.Background())
+		So(err, ShouldBeNil)
+		So(sample.Rows, ShouldEqual, 5)
+		So(sample.Y, ShouldResemble, []float32{0, 1, 1, 0, 1})
+		So(sample.XCols, ShouldEqual, len(imps[0].Vectors[0]))
+		So(sample.X[:sample.XCols], ShouldResemble, imps[0].Vectors[0])
+
+		sampleCh, err := joiner.SampleGenerator(context.Background())
+		So(err, ShouldBeNil)
+		var cnt int
+		for s := range sampleCh {
+			So(s.ItemId, ShouldNotEqual, 3)
+			cnt++
+		}
+		So(cnt, ShouldEqual, 5)
+	})
+}
+
+func TestLogImpressionScoreType(t *testing.T) {
+	Convey("non float32 scores", t, func() {
+		ImpressionLog = &FileImpressionLogger{}
+		defer func() {
+			ImpressionLog = nil
+		}()
+		y := tensor.NewDense(tensor.Float64, tensor.Shape{1, 1}, tensor.WithBacking([]float64{0.5}))
+		err := logImpression(context.Background(), []Sample{{UserId: 1, ItemId: 2}}, []float32{1, 2}, 2, 1, 1, y)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,198 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/emb"
+	"github.com/auxten/go-ctr/feature/embedding/emb/embutil"
+	"github.com/auxten/go-ctr/feature/embedding/model"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	"github.com/auxten/go-ctr/feature/embedding/search"
+)
+
+// ItemColdStarter gives the items without item embedding, e.g. the items added
+// after training, a fallback embedding. See embedding.FeatureAverage for the
+// embedding averaged from content features, and embedding.CooccurrenceAverage
+// for the one averaged from co-occurring items.
+type ItemColdStarter interface {
+	ColdStartEmbedding(ctx context.Context, itemId int) ([]float32, bool)
+}
+
+// ItemColdStartFunc adapts a function to ItemColdStarter.
+type ItemColdStartFunc func(ctx context.Context, itemId int) ([]float32, bool)
+
+func (f ItemColdStartFunc) ColdStartEmbedding(ctx context.Context, itemId int) ([]float32, bool) {
+	return f(ctx, itemId)
+}
+
+// EmbeddingGetter gets the embedding of an item by its id string, it's
+// implemented by word2vec.EmbeddingMap32 and emb.BinaryEmbeddings.
+type EmbeddingGetter interface {
+	Get(word string) ([]float32, bool)
+}
+
+var itemEmbeddingUpdateMu sync.Mutex
+
+// ItemEmbColdStart is used if not nil when an item has no item embedding,
+// otherwise zero embedding is used.
+var ItemEmbColdStart ItemColdStarter
+
+// ItemEmbeddings returns the item embeddings of the last Train, UpdateItemEmbedding
+// or SetItemEmbeddings, nil if none. They should not be modified.
+func ItemEmbeddings() EmbeddingGetter {
+	return getItemEmbeddings()
+}
+
+// SetItemEmbeddings serves embs as the item embeddings instead of the ones
+// trained by Train, e.g. the emb.BinaryEmbeddings of a file saved by SaveBinary
+// of the item2vec model. UpdateItemEmbedding fails after it as there is no
+// model to update. The vectors of dimension other than ItemEmbDim are ignored.
+func SetItemEmbeddings(embs EmbeddingGetter) {
+	setItemEmbedding(nil, embs)
+}
+
+func getItemEmbeddings() EmbeddingGetter {
+	itemEmbeddingMu.RLock()
+	defer itemEmbeddingMu.RUnlock()
+	return itemEmbeddings
+}
+
+func setItemEmbedding(mod model.Model, embs EmbeddingGetter) {
+	itemEmbeddingMu.Lock()
+	defer itemEmbeddingMu.Unlock()
+	itemEmbeddingModel, itemEmbeddings = mod, embs
+}
+
+// embeddingMap32 returns embMap as EmbeddingGetter, nil if it's empty.
+func embeddingMap32(embMap map[string][]float32) EmbeddingGetter {
+	if len(embMap) == 0 {
+		return nil
+	}
+	return word2vec.EmbeddingMap32(embMap)
+}
+
+// getItemEmbedding returns the embedding of itemId in embs,
+// or the one from ItemEmbColdStart if not found.
+func getItemEmbedding(ctx context.Context, embs EmbeddingGetter, itemId int) (emb []float32, ok bool) {
+	if emb, ok = embs.Get(strconv.Itoa(itemId)); ok && len(emb) == ItemEmbDim {
+		return
+	}
+	emb, ok = nil, false
+	if ItemEmbColdStart != nil {
+		if emb, ok = ItemEmbColdStart.ColdStartEmbedding(ctx, itemId); ok && len(emb) != ItemEmbDim {
+			return nil, false
+		}
+	}
+	return
+}
+
+// UpdateItemEmbedding continues training the item embedding model of the last
+// Train with a fresh item sequence, sequences could be separated by corpus.EOS.
+// New items get their embeddings while the embeddings of existing items are kept
+// unchanged, so the model trained with them needs no retraining.
+func UpdateItemEmbedding(ctx context.Context, itemSeq <-chan string) (err error) {
+	// updates are serialized, while predictions keep using the embedding map
+	// got before until the update is done.
+	itemEmbeddingUpdateMu.Lock()
+	defer itemEmbeddingUpdateMu.Unlock()
+
+	itemEmbeddingMu.RLock()
+	mod := itemEmbeddingModel
+	itemEmbeddingMu.RUnlock()
+	if mod == nil {
+		return fmt.Errorf("item embedding is not trained")
+	}
+
+	if err = embedding.UpdateEmbedding(mod, itemSeq); err != nil {
+		return
+	}
+	embMap, err := mod.GenEmbeddingMap32()
+	if err != nil {
+		return
+	}
+	setItemEmbedding(mod, embeddingMap32(embMap))
+	return
+}
+
+// ItemEmbeddingSearcher returns the searcher of the item embeddings for
+// search/console, see ItemEmbeddingFrequency and ItemCategories for the
+// diagnostics options.
+func ItemEmbeddingSearcher() (searcher *search.Searcher, err error) {
+	var items emb.Embeddings
+	add := func(word string, vec []float32) {
+		item := emb.Embedding{Word: word, Dim: len(vec), Vector: make([]float64, len(vec))}
+		for i, v := range vec {
+			item.Vector[i] = float64(v)
+		}
+		item.Norm = embutil.Norm(item.Vector)
+		items = append(items, item)
+	}
+	switch embs := getItemEmbeddings().(type) {
+	case nil:
+		return nil, fmt.Errorf("item embedding is not trained")
+	case word2vec.EmbeddingMap32:
+		for word, vec := range embs {
+			add(word, vec)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Word < items[j].Word })
+	case *emb.BinaryEmbeddings:
+		for i := 0; i < embs.Len(); i++ {
+			add(embs.Word(i), embs.Vector(i))
+		}
+	default:
+		return nil, fmt.Errorf("item embeddings of %T could not be listed", embs)
+	}
+	return search.New(items...)
+}
+
+// ItemEmbeddingFrequency returns the counts of items in the item2vec corpus of
+// the last Train or UpdateItemEmbedding, nil if not trained. It waits for the
+// UpdateItemEmbedding running, which updates the counts.
+func ItemEmbeddingFrequency() map[string]int {
+	itemEmbeddingUpdateMu.Lock()
+	defer itemEmbeddingUpdateMu.Unlock()
+	itemEmbeddingMu.RLock()
+	mod := itemEmbeddingModel
+	itemEmbeddingMu.RUnlock()
+	if mod == nil {
+		return nil
+	}
+	return mod.Frequency()
+}
+
+// ItemCategories returns the categories of itemIds keyed by the item embedding
+// words, categorize tells the categories from the item feature, e.g. the argmax
+// of a one-hot encoded slice. BatchItemFeaturer is used if implemented by featurer.
+// The result is the categories of search.DiagnosticsOptions.
+func ItemCategories(ctx context.Context, featurer ItemFeaturer, itemIds []int,
+	categorize func(Tensor) []string,
+) (categories map[string][]string, err error) {
+	categories = make(map[string][]string, len(itemIds))
+	if batch, ok := featurer.(BatchItemFeaturer); ok {
+		features, er := batch.GetItemFeatures(ctx, itemIds)
+		if er != nil {
+			return nil, er
+		}
+		for itemId, feature := range features {
+			if cats := categorize(feature); len(cats) > 0 {
+				categories[strconv.Itoa(itemId)] = cats
+			}
+		}
+		return
+	}
+	for _, itemId := range itemIds {
+		feature, er := featurer.GetItemFeature(ctx, itemId)
+		if er != nil {
+			return nil, er
+		}
+		if cats := categorize(feature); len(cats) > 0 {
+			categories[strconv.Itoa(itemId)] = cats
+		}
+	}
+	return
+}
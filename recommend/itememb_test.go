@@ -0,0 +1,137 @@
+package recommend
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/emb"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateItemEmbedding(t *testing.T) {
+	defer setItemEmbedding(nil, nil)
+
+	Convey("update before train", t, func() {
+		setItemEmbedding(nil, nil)
+		So(UpdateItemEmbedding(context.Background(), make(chan string)), ShouldNotBeNil)
+		_, err := ItemEmbeddingSearcher()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("update and cold start", t, func() {
+		opts := DefaultTrainOptions
+		opts.ItemEmbedding.Verbose = false
+		opts.ItemEmbedding.MinCount = 2
+		recSys := &fakeSeqRecSys{sampleItems: []int{1, 2, 3, 4}}
+		_, err := TrainWithOptions(context.Background(), recSys, &fakeFitter{}, opts)
+		So(err, ShouldBeNil)
+		before := ItemEmbeddings().(word2vec.EmbeddingMap32)
+		So(before, ShouldHaveLength, 4)
+
+		seq := make(chan string, 1000)
+		for i := 0; i < 50; i++ {
+			for _, item := range []string{"1", "6", "2", corpus.EOS, "6", "3", corpus.EOS} {
+				seq <- item
+			}
+		}
+		close(seq)
+		So(UpdateItemEmbedding(context.Background(), seq), ShouldBeNil)
+		after := ItemEmbeddings().(word2vec.EmbeddingMap32)
+		So(after, ShouldHaveLength, 5)
+		So(after["1"], ShouldResemble, before["1"])
+		So(after["6"], ShouldHaveLength, ItemEmbDim)
+		searcher, err := ItemEmbeddingSearcher()
+		So(err, ShouldBeNil)
+		So(searcher.Items, ShouldHaveLength, 5)
+		So(searcher.Items[0].Word, ShouldEqual, "1")
+		So(ItemEmbeddingFrequency()["6"], ShouldEqual, 100)
+
+		// frequencies are read while the dictionary is updated
+		seq = make(chan string, 1000)
+		for i := 0; i < 50; i++ {
+			for _, item := range []string{"1", "7", "2", corpus.EOS, "7", "3", corpus.EOS} {
+				seq <- item
+			}
+		}
+		close(seq)
+		done := make(chan error)
+		go func() { done <- UpdateItemEmbedding(context.Background(), seq) }()
+		for i := 0; i < 10; i++ {
+			So(ItemEmbeddingFrequency()["1"], ShouldBeGreaterThan, 0)
+		}
+		So(<-done, ShouldBeNil)
+		So(ItemEmbeddingFrequency()["7"], ShouldEqual, 100)
+
+		ctx := context.Background()
+		_, ok := getItemEmbedding(ctx, after, 7)
+		So(ok, ShouldBeFalse)
+		ItemEmbColdStart = ItemColdStartFunc(func(_ context.Context, itemId int) ([]float32, bool) {
+			if itemId == 7 {
+				return after["6"], true
+			}
+			return nil, false
+		})
+		defer func() { ItemEmbColdStart = nil }()
+		emb, ok := getItemEmbedding(ctx, after, 7)
+		So(ok, ShouldBeTrue)
+		So(emb, ShouldResemble, after["6"])
+		_, ok = getItemEmbedding(ctx, after, 8)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("serve binary embeddings", t, func() {
+		vec := make([]float32, ItemEmbDim)
+		vec[0] = 1
+		path := filepath.Join(t.TempDir(), "item.emb")
+		So(emb.SaveBinaryFile(path, map[string][]float32{"1": vec}), ShouldBeNil)
+		embs, err := emb.OpenBinary(path)
+		So(err, ShouldBeNil)
+		defer embs.Close()
+
+		SetItemEmbeddings(embs)
+		So(ItemEmbeddings(), ShouldEqual, embs)
+		got, ok := getItemEmbedding(context.Background(), ItemEmbeddings(), 1)
+		So(ok, ShouldBeTrue)
+		So(got, ShouldResemble, vec)
+		_, ok = getItemEmbedding(context.Background(), ItemEmbeddings(), 2)
+		So(ok, ShouldBeFalse)
+		So(UpdateItemEmbedding(context.Background(), make(chan string)), ShouldNotBeNil)
+		searcher, err := ItemEmbeddingSearcher()
+		So(err, ShouldBeNil)
+		So(searcher.Items, ShouldHaveLength, 1)
+		So(searcher.Items[0].Vector[0], ShouldEqual, 1)
+		So(ItemEmbeddingFrequency(), ShouldBeNil)
+
+		// vectors of other dimension are ignored
+		SetItemEmbeddings(word2vec.EmbeddingMap32{"1": {1, 2}})
+		_, ok = getItemEmbedding(context.Background(), ItemEmbeddings(), 1)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestItemCategories(t *testing.T) {
+	parity := func(feature Tensor) []string {
+		if int(feature[0])%2 == 0 {
+			return []string{"even"}
+		}
+		return []string{"odd"}
+	}
+
+	Convey("single item featurer", t, func() {
+		cats, err := ItemCategories(context.Background(), &fakePredictor{}, []int{1, 2}, parity)
+		So(err, ShouldBeNil)
+		So(cats, ShouldResemble, map[string][]string{"1": {"odd"}, "2": {"even"}})
+	})
+
+	Convey("batch item featurer", t, func() {
+		pred := &batchPredictor{}
+		cats, err := ItemCategories(context.Background(), pred, []int{1, 2, 9}, parity)
+		So(err, ShouldBeNil)
+		So(cats, ShouldResemble, map[string][]string{"1": {"odd"}, "2": {"even"}})
+		So(pred.batchCalls, ShouldResemble, [][]int{{1, 2, 9}})
+		So(pred.singleCnt, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,313 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorgonia.org/tensor"
+)
+
+// FailurePolicy decides what BatchPredict does with the samples whose features
+// failed to fetch.
+type FailurePolicy int
+
+const (
+	// DefaultOnError fills DefaultUserFeature or DefaultItemFeature if not nil,
+	// otherwise the whole sample vector is filled with zeros.
+	DefaultOnError FailurePolicy = iota
+	// DropOnError drops the failed samples from the result.
+	DropOnError
+	// FailOnError fails the whole request.
+	FailOnError
+)
+
+func (p FailurePolicy) String() string {
+	switch p {
+	case DefaultOnError:
+		return "default"
+	case DropOnError:
+		return "drop"
+	case FailOnError:
+		return "fail"
+	default:
+		return fmt.Sprintf("FailurePolicy(%d)", int(p))
+	}
+}
+
+// PredictOptions controls the feature fetching of BatchPredictWithOptions.
+type PredictOptions struct {
+	// Timeout is the deadline of feature fetching for the whole request,
+	// 0 means no deadline other than the one in ctx.
+	Timeout time.Duration
+	// Concurrency is the max number of samples fetching features at the same time.
+	Concurrency int
+	// FailurePolicy decides what to do with the samples failed to get features.
+	FailurePolicy FailurePolicy
+}
+
+// DefaultPredictOptions is used by BatchPredict and Rank.
+var DefaultPredictOptions = PredictOptions{
+	Concurrency:   SampleAssembler,
+	FailurePolicy: DefaultOnError,
+}
+
+// DegradedItem is a sample that did not get all its features.
+type DegradedItem struct {
+	Index   int    `json:"index"`
+	UserId  int    `json:"userId"`
+	ItemId  int    `json:"itemId"`
+	Dropped bool   `json:"dropped"`
+	Reason  string `json:"reason"`
+}
+
+// PredictResult is the result of BatchPredictWithOptions.
+// Y is aligned with Samples, which are the sample keys not dropped.
+type PredictResult struct {
+	Y        tensor.Tensor
+	Samples  []Sample
+	Degraded []DegradedItem
+}
+
+type predictVec struct {
+	vec    []float32
+	uWidth int
+	iWidth int
+	// reason is not empty if default features were used
+	reason string
+	err    error
+}
+
+// BatchPredictWithOptions fetches features of sampleKeys in parallel and predicts them.
+func BatchPredictWithOptions(ctx context.Context, recSys Predictor, sampleKeys []Sample, opts PredictOptions,
+) (result *PredictResult, err error) {
+	ctx = context.WithValue(ctx, StageKey, PredictStage)
+	userFeatureCache, itemFeatureCache, err := getFeatureCaches(PredictStage)
+	if err != nil {
+		return
+	}
+	if preRanker, ok := recSys.(PreRanker); ok {
+		err = preRanker.PreRank(ctx)
+		if err != nil {
+			log.Errorf("pre rank error: %v", err)
+			return
+		}
+	}
+	if len(sampleKeys) == 0 {
+		err = fmt.Errorf("no sample to predict")
+		return
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	pre := prefetch(ctx, recSys, itemFeatureCache, sampleKeys)
+	pre.userFeatureCache, pre.itemFeatureCache = userFeatureCache, itemFeatureCache
+	vecs := fetchPredictVecs(ctx, recSys, sampleKeys, pre, opts)
+
+	var (
+		xWidth, uWidth, iWidth int
+		firstErr               error
+	)
+	for _, pv := range vecs {
+		if pv.err == nil {
+			xWidth, uWidth, iWidth = len(pv.vec), pv.uWidth, pv.iWidth
+			break
+		} else if firstErr == nil {
+			firstErr = pv.err
+		}
+	}
+	if xWidth == 0 {
+		err = fmt.Errorf("get sample vector error: %v", firstErr)
+		log.Error(err)
+		return
+	}
+
+	result = &PredictResult{
+		Samples: make([]Sample, 0, len(sampleKeys)),
+	}
+	var (
+		xData    = make([]float32, 0, len(sampleKeys)*xWidth)
+		debugIds = make([]int, 0)
+	)
+	for i, sKey := range sampleKeys {
+		pv := vecs[i]
+		if pv.err == nil && len(pv.vec) != xWidth {
+			pv.err = fmt.Errorf("x slice length %d != x col %d", len(pv.vec), xWidth)
+		}
+		if pv.err != nil {
+			degraded := DegradedItem{
+				Index:  i,
+				UserId: sKey.UserId,
+				ItemId: sKey.ItemId,
+				Reason: pv.err.Error(),
+			}
+			switch opts.FailurePolicy {
+			case FailOnError:
+				err = fmt.Errorf("get sample vector of user %d item %d error: %v", sKey.UserId, sKey.ItemId, pv.err)
+				result = nil
+				return
+			case DropOnError:
+				degraded.Dropped = true
+				result.Degraded = append(result.Degraded, degraded)
+				continue
+			default:
+				pv.vec = make([]float32, xWidth)
+				result.Degraded = append(result.Degraded, degraded)
+			}
+		} else if pv.reason != "" {
+			result.Degraded = append(result.Degraded, DegradedItem{
+				Index:  i,
+				UserId: sKey.UserId,
+				ItemId: sKey.ItemId,
+				Reason: pv.reason,
+			})
+		}
+		xData = append(xData, pv.vec...)
+		result.Samples = append(result.Samples, sKey)
+
+		if DebugItemId == sKey.ItemId &&
+			(DebugUserId == 0 || DebugUserId == sKey.UserId) {
+			log.Infof("user %d: item %d: feature %v", sKey.UserId, sKey.ItemId, pv.vec)
+			debugIds = append(debugIds, len(result.Samples)-1)
+		}
+	}
+	if len(result.Samples) == 0 {
+		err = fmt.Errorf("all %d samples dropped, first error: %v", len(sampleKeys), firstErr)
+		result = nil
+		return
+	}
+	if len(result.Degraded) != 0 {
+		log.Debugf("%d of %d samples degraded", len(result.Degraded), len(sampleKeys))
+	}
+
+	xDense := tensor.NewDense(tensor.Float32, tensor.Shape{len(result.Samples), xWidth}, tensor.WithBacking(xData))
+
+	y := recSys.Predict(xDense)
+	if y == nil {
+		err = fmt.Errorf("predict %d samples failed", len(result.Samples))
+		result = nil
+		return
+	}
+	result.Y = y
+	if ImpressionLog != nil {
+		if er := logImpression(ctx, result.Samples, xData, xWidth, uWidth, iWidth, y); er != nil {
+			log.Errorf("log impression error: %v", er)
+		}
+	}
+	for _, i := range debugIds {
+		score, er := y.At(i, 0)
+		if er != nil {
+			log.Errorf("get score of line:%d error: %v", i, er)
+			return
+		}
+		log.Infof("user %d: item %d: score %v", result.Samples[i].UserId, result.Samples[i].ItemId, score)
+	}
+	return
+}
+
+// fetchPredictVecs gets sample vectors with at most opts.Concurrency goroutines.
+// Samples not finished before ctx is done get ctx.Err() as error.
+func fetchPredictVecs(ctx context.Context, recSys Predictor, sampleKeys []Sample,
+	pre *prefetched, opts PredictOptions,
+) []predictVec {
+	type indexedVec struct {
+		idx int
+		predictVec
+	}
+	var (
+		concurrency = opts.Concurrency
+		vecs        = make([]predictVec, len(sampleKeys))
+		finished    = make([]bool, len(sampleKeys))
+		idxCh       = make(chan int, len(sampleKeys))
+		// buffered so that workers never block after we stop waiting
+		resultCh = make(chan indexedVec, len(sampleKeys))
+		wg       sync.WaitGroup
+	)
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(sampleKeys) {
+		concurrency = len(sampleKeys)
+	}
+	for i := range sampleKeys {
+		idxCh <- i
+	}
+	close(idxCh)
+
+	for c := 0; c < concurrency; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				iv := indexedVec{idx: i}
+				if err := ctx.Err(); err != nil {
+					iv.err = err
+				} else {
+					iv.predictVec = getPredictVec(ctx, recSys, &sampleKeys[i], pre, opts.FailurePolicy)
+				}
+				resultCh <- iv
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	for {
+		select {
+		case iv, ok := <-resultCh:
+			if !ok {
+				return vecs
+			}
+			vecs[iv.idx] = iv.predictVec
+			finished[iv.idx] = true
+		case <-ctx.Done():
+			for i := range vecs {
+				if !finished[i] {
+					vecs[i].err = ctx.Err()
+				}
+			}
+			return vecs
+		}
+	}
+}
+
+func getPredictVec(ctx context.Context, recSys Predictor, sampleKey *Sample,
+	pre *prefetched, policy FailurePolicy,
+) (pv predictVec) {
+	var reasons []string
+	ctx = context.WithValue(ctx, SampleTimestampKey, sampleKey.Timestamp)
+	userFeature, err := getUserFeature(ctx, pre.userFeatureCache, recSys, sampleKey.UserId)
+	if err != nil {
+		if policy != DefaultOnError || DefaultUserFeature == nil {
+			pv.err = err
+			return
+		}
+		userFeature = DefaultUserFeature
+		reasons = append(reasons, fmt.Sprintf("default user feature: %v", err))
+	}
+	itemFeature, ok, err := pre.itemFeature(sampleKey.ItemId)
+	if !ok {
+		itemFeature, err = getItemFeature(ctx, pre.itemFeatureCache, recSys, sampleKey.ItemId)
+	}
+	if err != nil {
+		if policy != DefaultOnError || DefaultItemFeature == nil {
+			pv.err = err
+			return
+		}
+		itemFeature = DefaultItemFeature
+		reasons = append(reasons, fmt.Sprintf("default item feature: %v", err))
+	}
+	pv.vec, pv.uWidth, pv.iWidth, pv.err = assembleSampleVector(ctx, recSys, sampleKey, userFeature, itemFeature, pre)
+	if len(reasons) != 0 {
+		pv.reason = strings.Join(reasons, "; ")
+	}
+	return
+}
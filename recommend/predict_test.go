@@ -0,0 +1,95 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyPredictor has no feature for item 3 and is slow on item 4
+type flakyPredictor struct {
+	fakePredictor
+}
+
+func (f *flakyPredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	switch itemId {
+	case 3:
+		return nil, fmt.Errorf("itemId %d not found", itemId)
+	case 4:
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return f.fakePredictor.GetItemFeature(ctx, itemId)
+}
+
+func TestBatchPredictWithOptions(t *testing.T) {
+	// start with empty feature caches
+	CloseFeatureCaches()
+	defer CloseFeatureCaches()
+	keys := []Sample{{UserId: 1, ItemId: 1}, {UserId: 1, ItemId: 2}, {UserId: 1, ItemId: 3}}
+
+	Convey("default on error", t, func() {
+		result, err := BatchPredictWithOptions(context.Background(), &flakyPredictor{}, keys, PredictOptions{
+			Concurrency:   2,
+			FailurePolicy: DefaultOnError,
+		})
+		So(err, ShouldBeNil)
+		So(result.Samples, ShouldResemble, keys)
+		So(result.Degraded, ShouldHaveLength, 1)
+		So(result.Degraded[0].ItemId, ShouldEqual, 3)
+		So(result.Degraded[0].Dropped, ShouldBeFalse)
+		score, err := result.Y.At(2, 0)
+		So(err, ShouldBeNil)
+		So(score, ShouldEqual, 0)
+	})
+
+	Convey("default item feature", t, func() {
+		DefaultItemFeature = []float32{-1, 0}
+		defer func() { DefaultItemFeature = nil }()
+		scores, degraded, err := RankWithOptions(context.Background(), &flakyPredictor{}, 1, []int{1, 3}, DefaultPredictOptions)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{1, 1}, {3, -1}})
+		So(degraded, ShouldHaveLength, 1)
+		So(degraded[0].Reason, ShouldContainSubstring, "default item feature")
+	})
+
+	Convey("drop on error", t, func() {
+		scores, degraded, err := RankWithOptions(context.Background(), &flakyPredictor{}, 1, []int{1, 2, 3}, PredictOptions{
+			FailurePolicy: DropOnError,
+		})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{1, 1}, {2, 2}})
+		So(degraded, ShouldResemble, []DegradedItem{{
+			Index: 2, UserId: 1, ItemId: 3, Dropped: true, Reason: "itemId 3 not found",
+		}})
+	})
+
+	Convey("fail on error", t, func() {
+		result, err := BatchPredictWithOptions(context.Background(), &flakyPredictor{}, keys, PredictOptions{
+			FailurePolicy: FailOnError,
+		})
+		So(err, ShouldNotBeNil)
+		So(result, ShouldBeNil)
+	})
+
+	Convey("timeout", t, func() {
+		start := time.Now()
+		scores, degraded, err := RankWithOptions(context.Background(), &flakyPredictor{}, 1, []int{4, 1, 2}, PredictOptions{
+			Timeout:       50 * time.Millisecond,
+			Concurrency:   3,
+			FailurePolicy: DropOnError,
+		})
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{1, 1}, {2, 2}})
+		So(degraded, ShouldHaveLength, 1)
+		So(degraded[0].ItemId, ShouldEqual, 4)
+		So(degraded[0].Reason, ShouldEqual, context.DeadlineExceeded.Error())
+	})
+}
@@ -8,8 +8,8 @@ import (
 	"time"
 
 	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
 	"github.com/auxten/go-ctr/feature/embedding/model"
-	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
 	"github.com/auxten/go-ctr/utils"
 	"github.com/karlseguin/ccache/v2"
 	log "github.com/sirupsen/logrus"
@@ -19,6 +19,7 @@ import (
 const (
 	SampleAssembler       = 16
 	StageKey              = "stage"
+	SampleTimestampKey    = "sampleTimestamp"
 	ItemEmbDim            = 16
 	ItemEmbWindow         = 5
 	UserBehaviorLen       = 10
@@ -28,11 +29,17 @@ const (
 )
 
 var (
+	// itemEmbeddingModel and itemEmbeddings are guarded by itemEmbeddingMu
 	itemEmbeddingModel model.Model
-	itemEmbeddingMap   word2vec.EmbeddingMap32
-	//TODO: maybe a switch to control whether to reuse training cache when predict
-	UserFeatureCache  *ccache.Cache
-	ItemFeatureCache  *ccache.Cache
+	itemEmbeddings     EmbeddingGetter
+	itemEmbeddingMu    sync.RWMutex
+
+	// Deprecated: UserFeatureCache and ItemFeatureCache are used as the feature
+	// caches of both stages if not nil, use NewFeatureCache and WrapCCache instead.
+	UserFeatureCache *ccache.Cache
+	// Deprecated: see UserFeatureCache.
+	ItemFeatureCache *ccache.Cache
+	// Deprecated: user behaviors are not cached by ccache.
 	UserBehaviorCache *ccache.Cache
 
 	// DefaultUserFeature and DefaultItemFeature are backup if not nil
@@ -42,6 +49,11 @@ var (
 
 	DebugUserId int
 	DebugItemId int
+
+	// ItemEmbSessionGap splits the item sequences of ItemSequenceEmbedding into
+	// sessions if adjacent items are interacted more than ItemEmbSessionGap
+	// seconds apart, 0 means no splitting.
+	ItemEmbSessionGap int64
 )
 
 type Tensor []float32
@@ -63,6 +75,7 @@ type TrainSample struct {
 }
 
 type sampleVec struct {
+	itemId int
 	vec    []float32
 	label  float32
 	iWidth int
@@ -96,6 +109,28 @@ type Fitter interface {
 	Fit(sample *TrainSample) (PredictAbstract, error)
 }
 
+// PointInTimeFeaturer could be implemented by UserFeaturer and ItemFeaturer whose
+// features in TrainStage are as of the Sample.Timestamp got by SampleTimestamp(ctx).
+// Features of them are not cached in TrainStage, as they differ by timestamp.
+type PointInTimeFeaturer interface {
+	PointInTime() bool
+}
+
+// SampleTimestamp returns the timestamp of the sample being assembled.
+func SampleTimestamp(ctx context.Context) (ts int64, ok bool) {
+	ts, ok = ctx.Value(SampleTimestampKey).(int64)
+	return
+}
+
+func isPointInTime(ctx context.Context, featureProvider interface{}) bool {
+	pit, ok := featureProvider.(PointInTimeFeaturer)
+	if !ok || !pit.PointInTime() {
+		return false
+	}
+	stage, _ := ctx.Value(StageKey).(Stage)
+	return stage == TrainStage
+}
+
 type ItemFeaturer interface {
 	GetItemFeature(context.Context, int) (Tensor, error)
 }
@@ -125,10 +160,20 @@ type UserBehavior interface {
 // ItemEmbedding is an interface used to generate item embedding with item2vec model
 // by just providing a behavior based item sequence.
 // Example: user liked items sequence, user bought items sequence, user viewed items sequence
+// Sequences of different users could be separated by corpus.EOS, so that
+// item2vec windows never cross them.
 type ItemEmbedding interface {
 	ItemSeqGenerator(context.Context) (<-chan string, error)
 }
 
+// ItemSequenceEmbedding is like ItemEmbedding but generates the item sequence
+// of each user ordered by timestamp, item2vec windows never cross sequences.
+// Sequences are split into sessions by ItemEmbSessionGap.
+// It takes precedence over ItemEmbedding if both are implemented.
+type ItemSequenceEmbedding interface {
+	ItemSequenceGenerator(context.Context) (<-chan []corpus.TimedWord, error)
+}
+
 type SampleInfo struct {
 	UserProfileRange  [2]int // [start, end)
 	UserBehaviorRange [2]int // [start, end)
@@ -194,6 +239,17 @@ type Sample struct {
 }
 
 func Train(ctx context.Context, recSys RecSys, mlp Fitter) (model Predictor, err error) {
+	return TrainWithOptions(ctx, recSys, mlp, DefaultTrainOptions)
+}
+
+// TrainWithOptions trains the item embedding with opts if ItemEmbedding or
+// ItemSequenceEmbedding is implemented, then fits mlp with the samples.
+// The item embedding coverage of samples is logged and could be got by
+// ItemEmbeddingCoverage.
+func TrainWithOptions(ctx context.Context, recSys RecSys, mlp Fitter, opts TrainOptions) (model Predictor, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
 	ctx = context.WithValue(ctx, StageKey, TrainStage)
 
 	if preTrain, ok := recSys.(PreTrainer); ok {
@@ -204,18 +260,21 @@ func Train(ctx context.Context, recSys RecSys, mlp Fitter) (model Predictor, err
 		}
 	}
 
-	if itemEbd, ok := recSys.(ItemEmbedding); ok {
-		itemEmbeddingModel, err = GetItemEmbeddingModelFromUb(ctx, itemEbd)
-		if err != nil {
-			log.Errorf("get item embedding model error: %v", err)
-			return
-		}
-		itemEmbeddingMap, err = itemEmbeddingModel.GenEmbeddingMap32()
-		if err != nil {
+	embModel, err := trainItemEmbedding(ctx, recSys, opts.ItemEmbedding)
+	if err != nil {
+		log.Errorf("get item embedding model error: %v", err)
+		return
+	}
+	var embs EmbeddingGetter
+	if embModel != nil {
+		var embMap map[string][]float32
+		if embMap, err = embModel.GenEmbeddingMap32(); err != nil {
 			log.Errorf("get item embedding map error: %v", err)
 			return
 		}
+		embs = embeddingMap32(embMap)
 	}
+	setItemEmbedding(embModel, embs)
 
 	trainSample, err := GetSample(recSys, ctx)
 	if err != nil {
@@ -246,6 +305,14 @@ func Train(ctx context.Context, recSys RecSys, mlp Fitter) (model Predictor, err
 }
 
 func Rank(ctx context.Context, recSys Predictor, userId int, itemIds []int) (itemScores []ItemScore, err error) {
+	itemScores, _, err = RankWithOptions(ctx, recSys, userId, itemIds, DefaultPredictOptions)
+	return
+}
+
+// RankWithOptions ranks itemIds for userId with opts, items degraded by
+// opts.FailurePolicy are reported in degraded.
+func RankWithOptions(ctx context.Context, recSys Predictor, userId int, itemIds []int, opts PredictOptions,
+) (itemScores []ItemScore, degraded []DegradedItem, err error) {
 	sampleKeys := make([]Sample, len(itemIds))
 	for i, itemId := range itemIds {
 		sampleKeys[i] = Sample{
@@ -254,85 +321,33 @@ func Rank(ctx context.Context, recSys Predictor, userId int, itemIds []int) (ite
 			Timestamp: time.Now().Unix(),
 		}
 	}
-	y, err := BatchPredict(ctx, recSys, sampleKeys)
+	result, err := BatchPredictWithOptions(ctx, recSys, sampleKeys, opts)
 	if err != nil {
 		return
 	}
-	itemScores = make([]ItemScore, len(itemIds))
+	itemScores = make([]ItemScore, len(result.Samples))
 	var score interface{}
-	for i, itemId := range itemIds {
-		if score, err = y.At(i, 0); err != nil {
+	for i, sKey := range result.Samples {
+		if score, err = result.Y.At(i, 0); err != nil {
 			itemScores = nil
 			return
 		}
 		itemScores[i] = ItemScore{
-			ItemId: itemId,
+			ItemId: sKey.ItemId,
 			Score:  score.(float32),
 		}
 	}
+	degraded = result.Degraded
 
 	return
 }
 
 func BatchPredict(ctx context.Context, recSys Predictor, sampleKeys []Sample) (y tensor.Tensor, err error) {
-	ctx = context.WithValue(ctx, StageKey, PredictStage)
-	if preRanker, ok := recSys.(PreRanker); ok {
-		err = preRanker.PreRank(ctx)
-		if err != nil {
-			log.Errorf("pre rank error: %v", err)
-			return
-		}
-	}
-
-	var (
-		xData      []float32
-		xWidth     int
-		zeroSliceX []float32
-		debugIds   = make([]int, 0)
-	)
-
-	for i, sKey := range sampleKeys {
-		var (
-			xSlice []float32
-		)
-		xSlice, _, _, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &sKey)
-		if err != nil {
-			if i == 0 {
-				log.Errorf("get sample vector error: %v", err)
-				return
-			} else {
-				zeroSliceX = make([]float32, xWidth)
-				xSlice = zeroSliceX
-			}
-		}
-		if i == 0 {
-			xWidth = len(xSlice)
-			xData = make([]float32, len(sampleKeys)*xWidth)
-		}
-
-		if len(xSlice) != xWidth {
-			log.Errorf("x slice length %d != x col %d", len(xSlice), xWidth)
-			return
-		}
-		copy(xData[i*xWidth:], xSlice)
-
-		if DebugItemId == sKey.ItemId &&
-			(DebugUserId == 0 || DebugUserId == sKey.UserId) {
-			log.Infof("user %d: item %d: feature %v", sKey.UserId, sKey.ItemId, xSlice)
-			debugIds = append(debugIds, i)
-		}
-	}
-	xDense := tensor.NewDense(tensor.Float32, tensor.Shape{len(sampleKeys), xWidth}, tensor.WithBacking(xData))
-
-	y = recSys.Predict(xDense)
-	for _, i := range debugIds {
-		score, er := y.At(i, 0)
-		if er != nil {
-			log.Errorf("get score of line:%d error: %v", i, er)
-			return
-		}
-		log.Infof("user %d: item %d: score %v", sampleKeys[i].UserId, sampleKeys[i].ItemId, score)
+	result, err := BatchPredictWithOptions(ctx, recSys, sampleKeys, DefaultPredictOptions)
+	if err != nil {
+		return
 	}
+	y = result.Y
 	return
 }
 
@@ -341,23 +356,11 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		userFeatureWidth int
 		itemFeatureWidth int
 	)
-	if UserFeatureCache == nil {
-		UserFeatureCache = ccache.New(
-			ccache.Configure().MaxSize(userFeatureCacheSize).ItemsToPrune(userFeatureCacheSize / 100),
-		)
-	}
-	if ItemFeatureCache == nil {
-		ItemFeatureCache = ccache.New(
-			ccache.Configure().MaxSize(itemFeatureCacheSize).ItemsToPrune(itemFeatureCacheSize / 100),
-		)
+	userFeatureCache, itemFeatureCache, err := getFeatureCaches(TrainStage)
+	if err != nil {
+		return
 	}
 
-	//defer func() {
-	//	UserFeatureCache.Clear()
-	//	ItemFeatureCache.Clear()
-	//	UserBehaviorCache.Clear()
-	//}()
-
 	sampleGen, ok := recSys.(Trainer)
 	if !ok {
 		panic("sample generator not implemented")
@@ -380,11 +383,12 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 					err  error
 					sVec sampleVec
 				)
-				sVec.vec, sVec.uWidth, sVec.iWidth, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &s)
+				sVec.vec, sVec.uWidth, sVec.iWidth, err = GetSampleVectorWithCaches(ctx, userFeatureCache, itemFeatureCache, recSys, &s)
 				if err != nil {
 					log.Debugf("get sample vector error: %v", err)
 					continue
 				}
+				sVec.itemId = s.ItemId
 				sVec.label = s.Label
 				sampleVecCh <- &sVec
 			}
@@ -396,17 +400,16 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		close(sampleVecCh)
 	}()
 
+	var coverage *coverageCounter
+	if embs := getItemEmbeddings(); embs != nil {
+		coverage = newCoverageCounter(embs)
+	}
 	sample = &TrainSample{}
 	for sv := range sampleVecCh {
 		if userFeatureWidth == 0 {
 			userFeatureWidth = sv.uWidth
-			sample.Info.UserProfileRange[0] = 0
-			sample.Info.UserProfileRange[1] = userFeatureWidth
-			sample.Info.UserBehaviorRange[0] = sample.Info.UserProfileRange[1]
-			sample.Info.UserBehaviorRange[1] = sample.Info.UserProfileRange[1] + ItemEmbDim*UserBehaviorLen
-			// item feature here is only embeddings
-			sample.Info.ItemFeatureRange[0] = sample.Info.UserBehaviorRange[1]
-			sample.Info.ItemFeatureRange[1] = sample.Info.UserBehaviorRange[1] + ItemEmbDim
+			itemFeatureWidth = sv.iWidth
+			sample.Info = newSampleInfo(userFeatureWidth, itemFeatureWidth)
 		}
 		if sv.uWidth != userFeatureWidth {
 			err = fmt.Errorf("user feature length mismatch: %v:%v",
@@ -414,12 +417,6 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 			return
 		}
 
-		if itemFeatureWidth == 0 {
-			itemFeatureWidth = sv.iWidth
-			// non embedding item feature is treated as ctx feature
-			sample.Info.CtxFeatureRange[0] = sample.Info.ItemFeatureRange[1]
-			sample.Info.CtxFeatureRange[1] = sample.Info.ItemFeatureRange[1] + itemFeatureWidth
-		}
 		if sv.iWidth != itemFeatureWidth {
 			err = fmt.Errorf("item feature length mismatch: %v:%v",
 				itemFeatureWidth, sv.iWidth)
@@ -438,10 +435,13 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		sample.X = append(sample.X, sv.vec...)
 		sample.Y = append(sample.Y, sv.label)
 		sample.Rows++
+		if coverage != nil {
+			coverage.add(sv.itemId)
+		}
 		if sample.Rows%1000 == 0 {
 			log.Infof("sample size: %d, uc: %d, ic: %d", sample.Rows,
-				UserFeatureCache.ItemCount(),
-				ItemFeatureCache.ItemCount(),
+				userFeatureCache.ItemCount(),
+				itemFeatureCache.ItemCount(),
 			)
 		}
 	}
@@ -456,39 +456,96 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		return
 	}
 
+	lastCoverageMu.Lock()
+	lastCoverage = EmbeddingCoverage{}
+	if coverage != nil {
+		lastCoverage = coverage.report()
+		log.Infof("item embedding coverage: %s", lastCoverage)
+	}
+	lastCoverageMu.Unlock()
+
+	return
+}
+
+// newSampleInfo returns the layout of vector got from GetSampleVector.
+func newSampleInfo(userFeatureWidth, itemFeatureWidth int) (info SampleInfo) {
+	info.UserProfileRange[0] = 0
+	info.UserProfileRange[1] = userFeatureWidth
+	info.UserBehaviorRange[0] = info.UserProfileRange[1]
+	info.UserBehaviorRange[1] = info.UserProfileRange[1] + ItemEmbDim*UserBehaviorLen
+	// item feature here is only embeddings
+	info.ItemFeatureRange[0] = info.UserBehaviorRange[1]
+	info.ItemFeatureRange[1] = info.UserBehaviorRange[1] + ItemEmbDim
+	// non embedding item feature is treated as ctx feature
+	info.CtxFeatureRange[0] = info.ItemFeatureRange[1]
+	info.CtxFeatureRange[1] = info.ItemFeatureRange[1] + itemFeatureWidth
 	return
 }
 
+// GetSampleVector returns the sample vector of sampleKey with features cached in
+// ccache for 24 hours.
+//
+// Deprecated: use GetSampleVectorWithCaches.
 func GetSampleVector(ctx context.Context,
 	userFeatureCache *ccache.Cache, itemFeatureCache *ccache.Cache,
 	featureProvider BasicFeatureProvider, sampleKey *Sample,
 ) (vec []float32, userFeatureWidth int, itemFeatureWidth int, err error) {
-	var (
-		zeroItemEmb       [ItemEmbDim]float32
-		zeroUserBehaviors [ItemEmbDim * UserBehaviorLen]float32
+	return GetSampleVectorWithCaches(ctx,
+		WrapCCache(userFeatureCache, time.Hour*24), WrapCCache(itemFeatureCache, time.Hour*24),
+		featureProvider, sampleKey)
+}
 
-		user, item *ccache.Item
-	)
-	userIdStr := strconv.Itoa(sampleKey.UserId)
-	user, err = userFeatureCache.Fetch(userIdStr, time.Hour*24, func() (ci interface{}, err error) {
-		ci, err = featureProvider.GetUserFeature(ctx, sampleKey.UserId)
+// GetSampleVectorWithCaches returns the sample vector of sampleKey, user and
+// item features are cached in userFeatureCache and itemFeatureCache.
+func GetSampleVectorWithCaches(ctx context.Context,
+	userFeatureCache FeatureCache, itemFeatureCache FeatureCache,
+	featureProvider BasicFeatureProvider, sampleKey *Sample,
+) (vec []float32, userFeatureWidth int, itemFeatureWidth int, err error) {
+	ctx = context.WithValue(ctx, SampleTimestampKey, sampleKey.Timestamp)
+	userFeature, err := getUserFeature(ctx, userFeatureCache, featureProvider, sampleKey.UserId)
+	if err != nil {
 		return
-	})
+	}
+	itemFeature, err := getItemFeature(ctx, itemFeatureCache, featureProvider, sampleKey.ItemId)
 	if err != nil {
 		return
 	}
-	userFeature := user.Value().(Tensor)
-	userFeatureWidth = len(userFeature)
+	return assembleSampleVector(ctx, featureProvider, sampleKey, userFeature, itemFeature, nil)
+}
 
-	itemIdStr := strconv.Itoa(sampleKey.ItemId)
-	item, err = itemFeatureCache.Fetch(itemIdStr, time.Hour*24, func() (ci interface{}, err error) {
-		ci, err = featureProvider.GetItemFeature(ctx, sampleKey.ItemId)
-		return
+func getUserFeature(ctx context.Context, userFeatureCache FeatureCache,
+	featureProvider UserFeaturer, userId int,
+) (userFeature Tensor, err error) {
+	if isPointInTime(ctx, featureProvider) {
+		return featureProvider.GetUserFeature(ctx, userId)
+	}
+	return userFeatureCache.Fetch(strconv.Itoa(userId), func() (Tensor, error) {
+		return featureProvider.GetUserFeature(ctx, userId)
 	})
-	if err != nil {
-		return
+}
+
+func getItemFeature(ctx context.Context, itemFeatureCache FeatureCache,
+	featureProvider ItemFeaturer, itemId int,
+) (itemFeature Tensor, err error) {
+	if isPointInTime(ctx, featureProvider) {
+		return featureProvider.GetItemFeature(ctx, itemId)
 	}
-	itemFeature := item.Value().(Tensor)
+	return itemFeatureCache.Fetch(strconv.Itoa(itemId), func() (Tensor, error) {
+		return featureProvider.GetItemFeature(ctx, itemId)
+	})
+}
+
+// assembleSampleVector concatenates user feature, user behavior embeddings,
+// item embedding and item feature into one sample vector.
+// User behavior is got from pre if prefetched.
+func assembleSampleVector(ctx context.Context, featureProvider BasicFeatureProvider, sampleKey *Sample,
+	userFeature, itemFeature Tensor, pre *prefetched,
+) (vec []float32, userFeatureWidth int, itemFeatureWidth int, err error) {
+	var (
+		zeroItemEmb       [ItemEmbDim]float32
+		zeroUserBehaviors [ItemEmbDim * UserBehaviorLen]float32
+	)
+	userFeatureWidth = len(userFeature)
 	itemFeatureWidth = len(itemFeature)
 
 	// if ItemEmbedding interface is implemented, use item embedding,
@@ -496,10 +553,11 @@ func GetSampleVector(ctx context.Context,
 	var (
 		itemEmb       = zeroItemEmb[:]
 		userBehaviors = zeroUserBehaviors[:]
+		embs          = getItemEmbeddings()
 		ok            bool
 	)
-	if len(itemEmbeddingMap) != 0 {
-		if itemEmb, ok = itemEmbeddingMap.Get(strconv.Itoa(sampleKey.ItemId)); !ok {
+	if embs != nil {
+		if itemEmb, ok = getItemEmbedding(ctx, embs, sampleKey.ItemId); !ok {
 			itemEmb = zeroItemEmb[:]
 			log.Debugf("item embedding not found: %d, using zeros", sampleKey.ItemId)
 		}
@@ -508,15 +566,18 @@ func GetSampleVector(ctx context.Context,
 		//	else use zero embedding.
 		if recSysUb, ok := featureProvider.(UserBehavior); ok {
 			getUbfunc := func(userId int, maxLen int64, maxPk int64, maxTs int64) (ubTensor Tensor, err error) {
-				itemSeq, err := recSysUb.GetUserBehavior(
-					ctx, userId, maxLen, maxPk, maxTs)
-				if err != nil {
-					return
+				itemSeq, ok := pre.itemSeq(userId, maxTs)
+				if !ok {
+					itemSeq, err = recSysUb.GetUserBehavior(
+						ctx, userId, maxLen, maxPk, maxTs)
+					if err != nil {
+						return
+					}
 				}
 				//query items embedding, fill them into user behavior
 				ubTensor = make(Tensor, ItemEmbDim*UserBehaviorLen)
 				for i, itemId := range itemSeq {
-					if itemEmb, ok := itemEmbeddingMap.Get(strconv.Itoa(itemId)); ok {
+					if itemEmb, ok := getItemEmbedding(ctx, embs, itemId); ok {
 						copy(ubTensor[i*ItemEmbDim:], itemEmb)
 					}
 				}
@@ -543,3 +604,9 @@ func GetItemEmbeddingModelFromUb(ctx context.Context, iSeq ItemEmbedding) (mod m
 	mod, err = embedding.TrainEmbedding(itemSeq, ItemEmbWindow, ItemEmbDim, 1)
 	return
 }
+
+// GetItemEmbeddingModelFromSeq trains item2vec model with the item sequences
+// split into sessions by ItemEmbSessionGap.
+func GetItemEmbeddingModelFromSeq(ctx context.Context, iSeq ItemSequenceEmbedding) (mod model.Model, err error) {
+	return trainItemEmbedding(ctx, iSeq, DefaultTrainOptions.ItemEmbedding)
+}
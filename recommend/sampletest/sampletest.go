@@ -0,0 +1,37 @@
+// Package sampletest builds synthetic TrainSamples for model tests.
+package sampletest
+
+import (
+	"math/rand"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+)
+
+// New returns a sample of rows by cols, row fills the zeroed features of a row
+// from rnd and tells whether it is labeled 1.
+func New(rows, cols int, seed int64, row func(rnd *rand.Rand, x []float32) bool) *rcmd.TrainSample {
+	rnd := rand.New(rand.NewSource(seed))
+	sample := &rcmd.TrainSample{
+		X:     make([]float32, rows*cols),
+		Y:     make([]float32, rows),
+		Rows:  rows,
+		XCols: cols,
+	}
+	for i := 0; i < rows; i++ {
+		if row(rnd, sample.X[i*cols:(i+1)*cols]) {
+			sample.Y[i] = 1
+		}
+	}
+	return sample
+}
+
+// Uniform returns a sample whose features are uniform in [lo, hi), label
+// tells whether a row is labeled 1.
+func Uniform(rows, cols int, seed int64, lo, hi float32, label func(x []float32) bool) *rcmd.TrainSample {
+	return New(rows, cols, seed, func(rnd *rand.Rand, x []float32) bool {
+		for j := range x {
+			x[j] = rnd.Float32()*(hi-lo) + lo
+		}
+		return label(x)
+	})
+}
@@ -0,0 +1,432 @@
+// Package tablerec implements a generic rcmd.RecSys from database tables
+// declared by config.RecSysConfig, no Go code is required for a new dataset.
+//
+// Features of all users and items are fitted and computed in PreTrain with
+// the transforms of config.ColumnConfig, samples are read from the
+// interaction table.
+package tablerec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/auxten/go-ctr/config"
+	"github.com/auxten/go-ctr/feature"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultHashSize is the width of hash transform inferred for non-numeric columns
+var DefaultHashSize = 32
+
+type numericalTransformer interface {
+	Fit(vals []float64)
+	Transform(val float64) float64
+}
+
+type expandingTransformer interface {
+	Fit(vals []string)
+	NumFeatures() int
+	Transform(val string) []float64
+}
+
+// TableRec is the rcmd.RecSys composed of Samples of the interaction table,
+// and Features of the user and item tables.
+type TableRec struct {
+	Conf    *config.RecSysConfig
+	Samples *Samples
+	User    *Features
+	Item    *Features
+}
+
+var (
+	_ rcmd.RecSys     = &TableRec{}
+	_ rcmd.PreTrainer = &TableRec{}
+)
+
+// New creates TableRec with the TableScanner of conf.Db.
+func New(conf *config.RecSysConfig) (recSys *TableRec, err error) {
+	scanner, err := schema.NewScanner(conf.Db)
+	if err != nil {
+		return
+	}
+	return NewWithScanner(conf, scanner)
+}
+
+// NewWithScanner creates TableRec reading tables with scanner.
+func NewWithScanner(conf *config.RecSysConfig, scanner schema.TableScanner) (recSys *TableRec, err error) {
+	if err = conf.Validate(); err != nil {
+		return
+	}
+	recSys = &TableRec{
+		Conf:    conf,
+		Samples: &Samples{Conf: conf.Interaction, Scanner: scanner},
+		User:    &Features{Conf: conf.User, Scanner: scanner},
+		Item:    &Features{Conf: conf.Item, Scanner: scanner},
+	}
+	return
+}
+
+// PreTrain fits the column transformers and computes features of all users and items.
+func (recSys *TableRec) PreTrain(ctx context.Context) (err error) {
+	if err = recSys.User.Load(); err != nil {
+		return fmt.Errorf("load user table: %v", err)
+	}
+	if err = recSys.Item.Load(); err != nil {
+		return fmt.Errorf("load item table: %v", err)
+	}
+	log.Infof("user feature width %d of %d users, item feature width %d of %d items",
+		recSys.User.Width(), recSys.User.Len(), recSys.Item.Width(), recSys.Item.Len())
+	return
+}
+
+func (recSys *TableRec) GetUserFeature(ctx context.Context, userId int) (tensor rcmd.Tensor, err error) {
+	return recSys.User.GetUserFeature(ctx, userId)
+}
+
+func (recSys *TableRec) GetItemFeature(ctx context.Context, itemId int) (tensor rcmd.Tensor, err error) {
+	return recSys.Item.GetItemFeature(ctx, itemId)
+}
+
+func (recSys *TableRec) SampleGenerator(ctx context.Context) (ret <-chan rcmd.Sample, err error) {
+	return recSys.Samples.SampleGenerator(ctx)
+}
+
+// Samples implements rcmd.Trainer streaming samples from the interaction table of Scanner.
+type Samples struct {
+	Conf    config.InteractionConfig
+	Scanner schema.TableScanner
+}
+
+var _ rcmd.Trainer = &Samples{}
+
+// SampleGenerator reads samples from the interaction table ordered by timestamp,
+// until all are read or ctx is done.
+func (s *Samples) SampleGenerator(ctx context.Context) (ret <-chan rcmd.Sample, err error) {
+	in := s.Conf
+	ts := in.TimestampColumn
+	if ts == "" {
+		ts = "0"
+	}
+	query := fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s",
+		in.UserColumn, in.ItemColumn, in.LabelColumn, ts, in.Table)
+	if in.TimestampColumn != "" {
+		query += fmt.Sprintf(" ORDER BY %s, %s", in.TimestampColumn, in.UserColumn)
+	}
+	if in.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", in.Limit)
+	}
+	rows, err := s.Scanner.GetRows(query)
+	if err != nil {
+		return
+	}
+
+	sampleCh := make(chan rcmd.Sample, 10000)
+	go func() {
+		var i int
+		defer func() {
+			log.Debugf("sample generator finished: %d", i)
+			rows.Close()
+			close(sampleCh)
+		}()
+		for rows.Next() {
+			var (
+				userId, itemId int
+				label          float64
+				timestamp      sql.NullInt64
+			)
+			if err := rows.Scan(&userId, &itemId, &label, &timestamp); err != nil {
+				log.Errorf("failed to scan %s: %v", in.Table, err)
+				return
+			}
+			if in.LabelThreshold != nil {
+				if label > *in.LabelThreshold {
+					label = 1
+				} else {
+					label = 0
+				}
+			}
+			sample := rcmd.Sample{
+				UserId:    userId,
+				ItemId:    itemId,
+				Label:     float32(label),
+				Timestamp: timestamp.Int64,
+			}
+			select {
+			case sampleCh <- sample:
+				i++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ret = sampleCh
+	return
+}
+
+// Features implements rcmd.UserFeaturer and rcmd.ItemFeaturer with the
+// features of the entity table of Scanner, which are computed by Load.
+type Features struct {
+	Conf    config.EntityConfig
+	Scanner schema.TableScanner
+	table   *entityTable
+}
+
+var (
+	_ rcmd.UserFeaturer = &Features{}
+	_ rcmd.ItemFeaturer = &Features{}
+	_ rcmd.PreTrainer   = &Features{}
+)
+
+// Load fits the column transformers and computes the features of all rows.
+func (f *Features) Load() (err error) {
+	table, err := loadEntityTable(f.Scanner, f.Conf)
+	if err != nil {
+		return
+	}
+	f.table = table
+	return
+}
+
+func (f *Features) PreTrain(context.Context) error {
+	return f.Load()
+}
+
+// Width returns the width of features.
+func (f *Features) Width() int {
+	if f.table == nil {
+		return 0
+	}
+	return f.table.width
+}
+
+// Len returns the count of entities.
+func (f *Features) Len() int {
+	if f.table == nil {
+		return 0
+	}
+	return len(f.table.features)
+}
+
+func (f *Features) GetUserFeature(_ context.Context, userId int) (rcmd.Tensor, error) {
+	return f.table.get("userId", userId)
+}
+
+func (f *Features) GetItemFeature(_ context.Context, itemId int) (rcmd.Tensor, error) {
+	return f.table.get("itemId", itemId)
+}
+
+type entityTable struct {
+	columns  []*column
+	features map[int]rcmd.Tensor
+	width    int
+}
+
+type column struct {
+	config.ColumnConfig
+	numerical numericalTransformer
+	expanding expandingTransformer
+}
+
+func (t *entityTable) get(name string, id int) (tensor rcmd.Tensor, err error) {
+	if t == nil {
+		err = fmt.Errorf("features not computed, PreTrain first")
+		return
+	}
+	var ok bool
+	if tensor, ok = t.features[id]; !ok {
+		err = fmt.Errorf("%s %d not found", name, id)
+	}
+	return
+}
+
+// resolveColumns returns the columns of conf with transforms inferred from
+// tableSchema if not set. All columns except IdColumn are used if conf.Columns is empty.
+func resolveColumns(conf config.EntityConfig, tableSchema *schema.Schema) (columns []*column, err error) {
+	types := make(map[string]string, len(tableSchema.Columns))
+	for _, col := range tableSchema.Columns {
+		types[col.Name] = col.Type
+	}
+	if _, ok := types[conf.IdColumn]; !ok {
+		err = fmt.Errorf("id column %s not found in %s", conf.IdColumn, conf.Table)
+		return
+	}
+	colConfs := conf.Columns
+	if len(colConfs) == 0 {
+		for _, col := range tableSchema.Columns {
+			if col.Name != conf.IdColumn {
+				colConfs = append(colConfs, config.ColumnConfig{Name: col.Name})
+			}
+		}
+	}
+
+	for _, colConf := range colConfs {
+		colType, ok := types[colConf.Name]
+		if !ok {
+			err = fmt.Errorf("column %s not found in %s", colConf.Name, conf.Table)
+			return
+		}
+		if colConf.Transform == "" {
+			if schema.IsNumericType(colType) {
+				colConf.Transform = config.TransformStandard
+			} else {
+				colConf.Transform = config.TransformHash
+				colConf.Size = DefaultHashSize
+			}
+		}
+		if err = colConf.Validate(); err != nil {
+			return
+		}
+		col := &column{ColumnConfig: colConf}
+		switch colConf.Transform {
+		case config.TransformSkip:
+			continue
+		case config.TransformIdentity:
+			col.numerical = &feature.Identity{}
+		case config.TransformStandard:
+			col.numerical = &feature.StandardScaler{}
+		case config.TransformMinMax:
+			col.numerical = &feature.MinMaxScaler{}
+		case config.TransformQuantile:
+			col.numerical = &feature.QuantileScaler{}
+		case config.TransformOneHot:
+			col.expanding = &feature.OneHotEncoder{}
+		case config.TransformTFIDF:
+			tfidf := &feature.TFIDFVectorizer{}
+			tfidf.Separator = colConf.Separator
+			col.expanding = tfidf
+		}
+		columns = append(columns, col)
+	}
+	return
+}
+
+func loadEntityTable(scanner schema.TableScanner, conf config.EntityConfig) (table *entityTable, err error) {
+	tableSchema, err := scanner.GetSchema(conf.Table)
+	if err != nil {
+		return
+	}
+	table = &entityTable{}
+	if table.columns, err = resolveColumns(conf, tableSchema); err != nil {
+		return
+	}
+
+	names := []string{conf.IdColumn}
+	for _, col := range table.columns {
+		names = append(names, col.Name)
+	}
+	rows, err := scanner.GetRows(fmt.Sprintf("SELECT %s FROM %s", strings.Join(names, ", "), conf.Table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var (
+		ids    []int
+		values [][]sql.NullString
+	)
+	for rows.Next() {
+		var (
+			id   int
+			row  = make([]sql.NullString, len(table.columns))
+			dest = make([]interface{}, len(names))
+		)
+		dest[0] = &id
+		for i := range row {
+			dest[i+1] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		ids = append(ids, id)
+		values = append(values, row)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for i, col := range table.columns {
+		col.fit(values, i)
+		table.width += col.width()
+	}
+	table.features = make(map[int]rcmd.Tensor, len(ids))
+	for r, id := range ids {
+		tensor := make(rcmd.Tensor, 0, table.width)
+		for i, col := range table.columns {
+			tensor = append(tensor, col.transform(values[r][i])...)
+		}
+		table.features[id] = tensor
+	}
+	return
+}
+
+func parseFloat(v sql.NullString) (f float64, ok bool) {
+	if !v.Valid {
+		return
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v.String), 64)
+	return f, err == nil
+}
+
+func (col *column) fit(values [][]sql.NullString, i int) {
+	switch {
+	case col.numerical != nil:
+		vals := make([]float64, 0, len(values))
+		for _, row := range values {
+			if f, ok := parseFloat(row[i]); ok {
+				vals = append(vals, f)
+			}
+		}
+		col.numerical.Fit(vals)
+	case col.expanding != nil:
+		vals := make([]string, 0, len(values))
+		for _, row := range values {
+			if row[i].Valid {
+				vals = append(vals, row[i].String)
+			}
+		}
+		col.expanding.Fit(vals)
+	}
+}
+
+func (col *column) width() int {
+	switch {
+	case col.numerical != nil:
+		return 1
+	case col.expanding != nil:
+		return col.expanding.NumFeatures()
+	default:
+		return col.Size
+	}
+}
+
+// transform returns the features of v, missing values are all zeros.
+func (col *column) transform(v sql.NullString) (ret []float32) {
+	ret = make([]float32, col.width())
+	switch {
+	case col.numerical != nil:
+		if f, ok := parseFloat(v); ok {
+			if t := col.numerical.Transform(f); !math.IsNaN(t) && !math.IsInf(t, 0) {
+				ret[0] = float32(t)
+			}
+		}
+	case !v.Valid:
+	case col.expanding != nil:
+		for j, f := range col.expanding.Transform(v.String) {
+			ret[j] = float32(f)
+		}
+	case col.Transform == config.TransformHash:
+		ret = feature.HashOneHot32([]byte(v.String), col.Size)
+	case col.Transform == config.TransformMultiHot:
+		for j, f := range feature.StringSplitMultiHot(v.String, col.Separator, col.Size) {
+			ret[j] = float32(f)
+		}
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package tablerec
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/auxten/go-ctr/config"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createTestDb(t *testing.T, dbPath string) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE users (uid INTEGER PRIMARY KEY, age INT, gender TEXT)",
+		"INSERT INTO users VALUES (1, 20, 'F'), (2, 30, 'M'), (3, NULL, 'M')",
+		"CREATE TABLE items (iid INTEGER PRIMARY KEY, title TEXT, tags TEXT, price REAL)",
+		"INSERT INTO items VALUES (1, 'red apple', 'fruit|red', 1.5), (2, 'green apple', 'fruit|green', 2.5), " +
+			"(3, 'red car', 'vehicle|red', 1000)",
+		"CREATE TABLE clicks (uid INT, iid INT, rating REAL, ts INT)",
+		"INSERT INTO clicks VALUES (1, 1, 5, 300), (1, 2, 1, 100), (2, 3, 4, 200), (3, 1, 2, 400)",
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTableRec(t *testing.T) {
+	dir, err := os.MkdirTemp("", "tablerec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbPath := filepath.Join(dir, "test.db")
+	createTestDb(t, dbPath)
+
+	threshold := 3.0
+	conf := &config.RecSysConfig{
+		Db: config.Config{DbType: "sqlite", Dsn: dbPath},
+		Interaction: config.InteractionConfig{
+			Table:           "clicks",
+			UserColumn:      "uid",
+			ItemColumn:      "iid",
+			LabelColumn:     "rating",
+			TimestampColumn: "ts",
+			LabelThreshold:  &threshold,
+		},
+		// all columns with inferred transforms
+		User: config.EntityConfig{Table: "users", IdColumn: "uid"},
+		Item: config.EntityConfig{Table: "items", IdColumn: "iid", Columns: []config.ColumnConfig{
+			{Name: "title", Transform: config.TransformTFIDF},
+			{Name: "tags", Transform: config.TransformMultiHot, Separator: "|", Size: 8},
+			{Name: "price", Transform: config.TransformQuantile},
+		}},
+	}
+	ctx := context.WithValue(context.Background(), rcmd.StageKey, rcmd.TrainStage)
+
+	Convey("features", t, func() {
+		recSys, err := New(conf)
+		So(err, ShouldBeNil)
+		_, err = recSys.GetUserFeature(ctx, 1)
+		So(err, ShouldNotBeNil)
+		So(recSys.PreTrain(ctx), ShouldBeNil)
+
+		// age standard scaled, gender hashed
+		uf, err := recSys.GetUserFeature(ctx, 1)
+		So(err, ShouldBeNil)
+		So(uf, ShouldHaveLength, 1+DefaultHashSize)
+		So(uf[0], ShouldBeLessThan, 0)
+		uf, err = recSys.GetUserFeature(ctx, 3)
+		So(err, ShouldBeNil)
+		So(uf[0], ShouldEqual, 0)
+		_, err = recSys.GetUserFeature(ctx, 4)
+		So(err, ShouldNotBeNil)
+
+		// 4 words of title, 8 tags, 1 price
+		f1, err := recSys.GetItemFeature(ctx, 1)
+		So(err, ShouldBeNil)
+		So(f1, ShouldHaveLength, 4+8+1)
+		f3, err := recSys.GetItemFeature(ctx, 3)
+		So(err, ShouldBeNil)
+		So(f3[12], ShouldBeGreaterThan, f1[12])
+	})
+
+	Convey("samples", t, func() {
+		recSys, err := New(conf)
+		So(err, ShouldBeNil)
+		ch, err := recSys.SampleGenerator(ctx)
+		So(err, ShouldBeNil)
+		var samples []rcmd.Sample
+		for s := range ch {
+			samples = append(samples, s)
+		}
+		So(samples, ShouldResemble, []rcmd.Sample{
+			{UserId: 1, ItemId: 2, Label: 0, Timestamp: 100},
+			{UserId: 2, ItemId: 3, Label: 1, Timestamp: 200},
+			{UserId: 1, ItemId: 1, Label: 1, Timestamp: 300},
+			{UserId: 3, ItemId: 1, Label: 0, Timestamp: 400},
+		})
+
+		So(recSys.PreTrain(ctx), ShouldBeNil)
+		sample, err := rcmd.GetSample(recSys, ctx)
+		So(err, ShouldBeNil)
+		So(sample.Rows, ShouldEqual, 4)
+	})
+
+	Convey("samples stop when ctx is done", t, func() {
+		db, err := sql.Open("sqlite3", dbPath)
+		So(err, ShouldBeNil)
+		_, err = db.Exec("CREATE TABLE many AS WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 30000) " +
+			"SELECT i % 3 + 1 AS uid, i % 3 + 1 AS iid, 5.0 AS rating, i AS ts FROM n")
+		So(err, ShouldBeNil)
+		So(db.Close(), ShouldBeNil)
+
+		conf := *conf
+		conf.Interaction.Table = "many"
+		recSys, err := New(&conf)
+		So(err, ShouldBeNil)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		ch, err := recSys.SampleGenerator(cancelCtx)
+		So(err, ShouldBeNil)
+		<-ch
+		cancel()
+		read := 1
+		for range ch {
+			read++
+		}
+		So(read, ShouldBeLessThan, 30000)
+	})
+
+	Convey("invalid column", t, func() {
+		conf := *conf
+		conf.User.Columns = []config.ColumnConfig{{Name: "not_exist"}}
+		recSys, err := New(&conf)
+		So(err, ShouldBeNil)
+		So(recSys.PreTrain(ctx), ShouldNotBeNil)
+	})
+
+	Convey("csv files", t, func() {
+		for name, content := range map[string]string{
+			"users.csv":  "uid,age,gender\n1,20,F\n2,30,M\n3,,M\n",
+			"items.csv":  "iid,title,tags,price\n1,red apple,fruit|red,1.5\n2,green apple,fruit|green,2.5\n3,red car,vehicle|red,1000\n",
+			"clicks.csv": "uid,iid,rating,ts\n1,1,5,300\n1,2,1,100\n2,3,4,200\n3,1,2,400\n",
+		} {
+			So(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+		}
+		conf := *conf
+		conf.Db = config.Config{DbType: "csv", Dsn: dir}
+		recSys, err := New(&conf)
+		So(err, ShouldBeNil)
+		So(recSys.PreTrain(ctx), ShouldBeNil)
+		So(recSys.User.Len(), ShouldEqual, 3)
+		So(recSys.Item.Width(), ShouldEqual, 4+8+1)
+
+		sample, err := rcmd.GetSample(recSys, ctx)
+		So(err, ShouldBeNil)
+		So(sample.Rows, ShouldEqual, 4)
+		var positives float32
+		for _, y := range sample.Y {
+			positives += y
+		}
+		So(positives, ShouldEqual, 2)
+	})
+}
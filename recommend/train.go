@@ -0,0 +1,120 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/model"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+)
+
+// TrainOptions controls TrainWithOptions.
+type TrainOptions struct {
+	// ItemEmbedding is the options of item2vec model trained if ItemEmbedding
+	// or ItemSequenceEmbedding is implemented. Dim must be ItemEmbDim.
+	// MinCount drops the items occurred less, they will have zero embeddings.
+	ItemEmbedding word2vec.Options
+}
+
+// DefaultTrainOptions is used by Train.
+var DefaultTrainOptions = TrainOptions{
+	ItemEmbedding: embedding.DefaultOptions(ItemEmbWindow, ItemEmbDim, 1),
+}
+
+func (opts TrainOptions) Validate() error {
+	if opts.ItemEmbedding.Dim != ItemEmbDim {
+		return fmt.Errorf("item embedding dim must be %d, got %d", ItemEmbDim, opts.ItemEmbedding.Dim)
+	}
+	return opts.ItemEmbedding.Validate()
+}
+
+// EmbeddingCoverage reports how many items and samples got no item embedding
+// during the last training.
+type EmbeddingCoverage struct {
+	Items          int     `json:"items"`
+	MissingItems   int     `json:"missingItems"`
+	Samples        int     `json:"samples"`
+	MissingSamples int     `json:"missingSamples"`
+	ItemMissRate   float64 `json:"itemMissRate"`
+	SampleMissRate float64 `json:"sampleMissRate"`
+}
+
+func (c EmbeddingCoverage) String() string {
+	return fmt.Sprintf("items without embedding: %d/%d (%.2f%%), samples without embedding: %d/%d (%.2f%%)",
+		c.MissingItems, c.Items, c.ItemMissRate*100, c.MissingSamples, c.Samples, c.SampleMissRate*100)
+}
+
+var (
+	lastCoverage   EmbeddingCoverage
+	lastCoverageMu sync.RWMutex
+)
+
+// ItemEmbeddingCoverage returns the item embedding coverage of training samples
+// of the last Train, it's zero if no item embedding is trained.
+func ItemEmbeddingCoverage() EmbeddingCoverage {
+	lastCoverageMu.RLock()
+	defer lastCoverageMu.RUnlock()
+	return lastCoverage
+}
+
+// coverageCounter counts the items and samples without item embedding.
+type coverageCounter struct {
+	embs     EmbeddingGetter
+	items    map[int]bool // itemId -> has embedding
+	coverage EmbeddingCoverage
+}
+
+func newCoverageCounter(embs EmbeddingGetter) *coverageCounter {
+	return &coverageCounter{embs: embs, items: make(map[int]bool)}
+}
+
+func (c *coverageCounter) add(itemId int) {
+	has, seen := c.items[itemId]
+	if !seen {
+		_, has = c.embs.Get(strconv.Itoa(itemId))
+		c.items[itemId] = has
+		c.coverage.Items++
+		if !has {
+			c.coverage.MissingItems++
+		}
+	}
+	c.coverage.Samples++
+	if !has {
+		c.coverage.MissingSamples++
+	}
+}
+
+func (c *coverageCounter) report() EmbeddingCoverage {
+	cov := c.coverage
+	if cov.Items != 0 {
+		cov.ItemMissRate = float64(cov.MissingItems) / float64(cov.Items)
+	}
+	if cov.Samples != 0 {
+		cov.SampleMissRate = float64(cov.MissingSamples) / float64(cov.Samples)
+	}
+	return cov
+}
+
+// trainItemEmbedding trains item2vec model if recSys implements ItemSequenceEmbedding
+// or ItemEmbedding, mod is nil if neither is implemented.
+func trainItemEmbedding(ctx context.Context, recSys interface{}, opts word2vec.Options) (mod model.Model, err error) {
+	if iSeq, ok := recSys.(ItemSequenceEmbedding); ok {
+		var itemSeqs <-chan []corpus.TimedWord
+		if itemSeqs, err = iSeq.ItemSequenceGenerator(ctx); err != nil {
+			return
+		}
+		return embedding.TrainEmbeddingSeqWithOptions(corpus.SplitSessions(itemSeqs, ItemEmbSessionGap), opts)
+	}
+	if iSeq, ok := recSys.(ItemEmbedding); ok {
+		var itemSeq <-chan string
+		if itemSeq, err = iSeq.ItemSeqGenerator(ctx); err != nil {
+			return
+		}
+		return embedding.TrainEmbeddingWithOptions(itemSeq, opts)
+	}
+	return
+}
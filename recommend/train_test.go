@@ -0,0 +1,90 @@
+package recommend
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeSeqRecSys struct {
+	fakePredictor
+	sampleItems []int
+}
+
+func (r *fakeSeqRecSys) SampleGenerator(_ context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample, len(r.sampleItems))
+	for i, itemId := range r.sampleItems {
+		ch <- Sample{UserId: i, ItemId: itemId, Label: float32(itemId % 2)}
+	}
+	close(ch)
+	return ch, nil
+}
+
+// ItemSequenceGenerator generates items 1~4 many times and item 5 only once
+func (r *fakeSeqRecSys) ItemSequenceGenerator(_ context.Context) (<-chan []corpus.TimedWord, error) {
+	ch := make(chan []corpus.TimedWord, 100)
+	go func() {
+		defer close(ch)
+		for u := 0; u < 50; u++ {
+			var seq []corpus.TimedWord
+			for i := 1; i <= 4; i++ {
+				seq = append(seq, corpus.TimedWord{Word: strconv.Itoa(i), Timestamp: int64(i)})
+			}
+			ch <- seq
+		}
+		ch <- []corpus.TimedWord{{Word: "5"}}
+	}()
+	return ch, nil
+}
+
+type fakeFitter struct {
+	sample *TrainSample
+}
+
+func (f *fakeFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.sample = sample
+	return &fakePredictor{}, nil
+}
+
+func TestTrainWithOptions(t *testing.T) {
+	defer func() {
+		itemEmbeddingModel, itemEmbeddings = nil, nil
+	}()
+	recSys := &fakeSeqRecSys{sampleItems: []int{1, 2, 3, 4, 5, 6, 1}}
+
+	Convey("invalid options", t, func() {
+		opts := DefaultTrainOptions
+		opts.ItemEmbedding.Dim = ItemEmbDim + 1
+		_, err := TrainWithOptions(context.Background(), recSys, &fakeFitter{}, opts)
+		So(err, ShouldNotBeNil)
+		opts = DefaultTrainOptions
+		opts.ItemEmbedding.ModelType = "unknown"
+		_, err = TrainWithOptions(context.Background(), recSys, &fakeFitter{}, opts)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("item embedding coverage", t, func() {
+		opts := DefaultTrainOptions
+		opts.ItemEmbedding.Verbose = false
+		opts.ItemEmbedding.MinCount = 2
+		opts.ItemEmbedding.ModelType = "cbow"
+		opts.ItemEmbedding.OptimizerType = "ns"
+		opts.ItemEmbedding.Goroutines = 2
+		fitter := &fakeFitter{}
+		_, err := TrainWithOptions(context.Background(), recSys, fitter, opts)
+		So(err, ShouldBeNil)
+		So(fitter.sample.Rows, ShouldEqual, 7)
+		So(itemEmbeddings, ShouldHaveLength, 4)
+
+		cov := ItemEmbeddingCoverage()
+		So(cov.Items, ShouldEqual, 6)
+		So(cov.MissingItems, ShouldEqual, 2)
+		So(cov.Samples, ShouldEqual, 7)
+		So(cov.MissingSamples, ShouldEqual, 2)
+		So(cov.ItemMissRate, ShouldAlmostEqual, 2.0/6)
+		So(cov.SampleMissRate, ShouldAlmostEqual, 2.0/7)
+	})
+}
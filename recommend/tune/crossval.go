@@ -0,0 +1,56 @@
+package tune
+
+import (
+	"fmt"
+	"math"
+
+	modelselection "github.com/auxten/go-ctr/nn/model_selection"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gonum.org/v1/gonum/mat"
+)
+
+// sampleMatrix is the mat.Matrix of the features of a TrainSample.
+type sampleMatrix struct {
+	sample *rcmd.TrainSample
+}
+
+func (m sampleMatrix) Dims() (r, c int) { return m.sample.Rows, m.sample.XCols }
+
+func (m sampleMatrix) At(i, j int) float64 { return float64(m.sample.X[i*m.sample.XCols+j]) }
+
+func (m sampleMatrix) T() mat.Matrix { return mat.Transpose{Matrix: m} }
+
+// labels returns the labels of sample of shape (rows, 1).
+func labels(sample *rcmd.TrainSample) *mat.Dense {
+	y := mat.NewDense(sample.Rows, 1, nil)
+	for i := 0; i < sample.Rows; i++ {
+		y.Set(i, 0, float64(sample.Y[i]))
+	}
+	return y
+}
+
+// CrossValScore fits a new Fitter of newFitter on the train rows of each split
+// of splitter, and returns the metric of the predictions of the test rows.
+// To keep the samples of a user in one fold, split with
+// modelselection.GroupKFold of the user of each row.
+func CrossValScore(newFitter func() rcmd.Fitter, sample *rcmd.TrainSample, splitter modelselection.Splitter, metric Metric) (scores []float64, err error) {
+	if len(sample.X) != sample.Rows*sample.XCols || len(sample.Y) != sample.Rows {
+		return nil, fmt.Errorf("sample of %d rows has %d features and %d labels", sample.Rows, len(sample.X), len(sample.Y))
+	}
+	yTrue := labels(sample)
+	return modelselection.CrossValidate(sampleMatrix{sample}, yTrue, splitter, func(split modelselection.Split) (score float64, err error) {
+		pred, err := newFitter().Fit(subSample(sample, split.TrainIndex))
+		if err != nil {
+			return 0, fmt.Errorf("fit: %v", err)
+		}
+		yPred, err := Predict(pred, subSample(sample, split.TestIndex))
+		if err != nil {
+			return 0, fmt.Errorf("predict: %v", err)
+		}
+		score = metric.Score(modelselection.TakeRows(yTrue, split.TestIndex), yPred)
+		if math.IsNaN(score) {
+			return 0, fmt.Errorf("%s is NaN", metric.Name)
+		}
+		return
+	})
+}
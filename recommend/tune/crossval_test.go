@@ -0,0 +1,85 @@
+package tune
+
+import (
+	"testing"
+
+	modelselection "github.com/auxten/go-ctr/nn/model_selection"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingFitter records the rows of the samples fitted.
+type recordingFitter struct {
+	noisyFitter
+	rows []int
+}
+
+func (f *recordingFitter) Fit(sample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	f.rows = append(f.rows, sample.Rows)
+	return f.noisyFitter.Fit(sample)
+}
+
+// recordingFactory returns a factory of recordingFitter, fitters are the ones made.
+func recordingFactory(noise float64, fitters *[]*recordingFitter) func() rcmd.Fitter {
+	return func() rcmd.Fitter {
+		fitter := &recordingFitter{noisyFitter: noisyFitter{noise: noise}}
+		*fitters = append(*fitters, fitter)
+		return fitter
+	}
+}
+
+func TestCrossValScore(t *testing.T) {
+	Convey("k-fold scores", t, func() {
+		var fitters []*recordingFitter
+		scores, err := CrossValScore(recordingFactory(0, &fitters), linearSample(300), &modelselection.StratifiedKFold{NSplits: 3}, ROCAUC)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []float64{1, 1, 1})
+		// each split is fitted by a new fitter
+		So(fitters, ShouldHaveLength, 3)
+		for _, fitter := range fitters {
+			So(fitter.rows, ShouldResemble, []int{200})
+		}
+
+		fitters = nil
+		scores, err = CrossValScore(recordingFactory(0.5, &fitters), linearSample(300), &modelselection.TimeSeriesSplit{NSplits: 2}, Accuracy)
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 2)
+		So(fitters, ShouldHaveLength, 2)
+		So(fitters[0].rows, ShouldResemble, []int{100})
+		So(fitters[1].rows, ShouldResemble, []int{200})
+		for _, score := range scores {
+			So(score, ShouldBeBetween, 0.5, 1)
+		}
+	})
+
+	Convey("groups of users", t, func() {
+		// the rows of each of the 30 users are in one test fold
+		sample := linearSample(300)
+		groups := make([]int, sample.Rows)
+		for i := range groups {
+			groups[i] = i % 30
+		}
+		var fitters []*recordingFitter
+		scores, err := CrossValScore(recordingFactory(0, &fitters), sample, &modelselection.GroupKFold{NSplits: 3, Groups: groups}, ROCAUC)
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 3)
+		for _, score := range scores {
+			So(score, ShouldAlmostEqual, 1)
+		}
+		for _, fitter := range fitters {
+			So(fitter.rows, ShouldResemble, []int{200})
+		}
+	})
+
+	Convey("errors", t, func() {
+		noisy := func(noise float64) func() rcmd.Fitter {
+			return func() rcmd.Fitter { return &noisyFitter{noise: noise} }
+		}
+		_, err := CrossValScore(noisy(-1), linearSample(30), &modelselection.KFold{NSplits: 3}, ROCAUC)
+		So(err, ShouldNotBeNil)
+		_, err = CrossValScore(noisy(0), linearSample(2), &modelselection.KFold{NSplits: 3}, ROCAUC)
+		So(err, ShouldNotBeNil)
+		_, err = CrossValScore(noisy(0), linearSample(30), &modelselection.GroupKFold{NSplits: 3, Groups: []int{1, 2}}, ROCAUC)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,63 @@
+package tune
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+// Trial is the result of a Fitter of Params trained with Resource.
+type Trial struct {
+	Id       int     `json:"id"`
+	Params   Params  `json:"params"`
+	Resource int     `json:"resource"`
+	Score    float64 `json:"score"`
+	Seconds  float64 `json:"seconds"`
+	// Err is the error of failed trials, they have no Score
+	Err string `json:"error,omitempty"`
+}
+
+// Leaderboard is the trials of a search ranked by the resource and score,
+// failed trials are the last.
+type Leaderboard struct {
+	Strategy        string  `json:"strategy"`
+	Metric          string  `json:"metric"`
+	GreaterIsBetter bool    `json:"greaterIsBetter"`
+	Best            *Trial  `json:"best"`
+	Trials          []Trial `json:"trials"`
+}
+
+func sortTrials(trials []Trial, metric Metric) {
+	sort.SliceStable(trials, func(i, j int) bool {
+		a, b := trials[i], trials[j]
+		if (a.Err == "") != (b.Err == "") {
+			return a.Err == ""
+		}
+		if a.Resource != b.Resource {
+			return a.Resource > b.Resource
+		}
+		return metric.Better(a.Score, b.Score)
+	})
+}
+
+// WriteJSON writes the indented JSON of the leaderboard to w.
+func (lb *Leaderboard) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lb)
+}
+
+// Save writes the JSON of the leaderboard to the file path.
+func (lb *Leaderboard) Save(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+	return lb.WriteJSON(f)
+}
@@ -0,0 +1,94 @@
+package tune
+
+import (
+	"github.com/auxten/go-ctr/nn/metrics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Metric scores the predictions of the validation samples.
+type Metric struct {
+	Name            string
+	GreaterIsBetter bool
+	// Score returns the metric of yPred, the output of PredictAbstract, against
+	// the labels yTrue of shape (rows, 1).
+	Score func(yTrue, yPred *mat.Dense) float64
+}
+
+// Better reports whether score a is better than b.
+func (m Metric) Better(a, b float64) bool {
+	if m.GreaterIsBetter {
+		return a > b
+	}
+	return a < b
+}
+
+var (
+	// ROCAUC is the area under ROC curve of binary labels.
+	ROCAUC = Metric{
+		Name:            "roc_auc",
+		GreaterIsBetter: true,
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.ROCAUCScore(yTrue, yPred, "", nil)
+		},
+	}
+	// AveragePrecision is the area under precision-recall curve of binary labels.
+	AveragePrecision = Metric{
+		Name:            "average_precision",
+		GreaterIsBetter: true,
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.AveragePrecisionScore(yTrue, yPred, "", nil)
+		},
+	}
+	// Accuracy is the accuracy of the classes predicted, probabilities of a
+	// single column are thresholded at 0.5, the argmax is the class of multiple columns.
+	Accuracy = Metric{
+		Name:            "accuracy",
+		GreaterIsBetter: true,
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.AccuracyScore(yTrue, predictClasses(yPred), true, nil)
+		},
+	}
+	// MSE is the mean squared error of regression.
+	MSE = Metric{
+		Name: "mse",
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.MeanSquaredError(yTrue, yPred, nil, "").At(0, 0)
+		},
+	}
+	// MAE is the mean absolute error of regression.
+	MAE = Metric{
+		Name: "mae",
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.MeanAbsoluteError(yTrue, yPred, nil, "").At(0, 0)
+		},
+	}
+	// R2 is the coefficient of determination of regression.
+	R2 = Metric{
+		Name:            "r2",
+		GreaterIsBetter: true,
+		Score: func(yTrue, yPred *mat.Dense) float64 {
+			return metrics.R2Score(yTrue, yPred, nil, "").At(0, 0)
+		},
+	}
+)
+
+func predictClasses(yPred *mat.Dense) *mat.Dense {
+	rows, cols := yPred.Dims()
+	classes := mat.NewDense(rows, 1, nil)
+	for i := 0; i < rows; i++ {
+		if cols == 1 {
+			if yPred.At(i, 0) >= 0.5 {
+				classes.Set(i, 0, 1)
+			}
+			continue
+		}
+		best := 0
+		for j := 1; j < cols; j++ {
+			if yPred.At(i, j) > yPred.At(i, best) {
+				best = j
+			}
+		}
+		classes.Set(i, 0, float64(best))
+	}
+	return classes
+}
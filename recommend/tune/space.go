@@ -0,0 +1,203 @@
+package tune
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Params is the hyperparameters of a trial, keyed by the names of Space.
+type Params map[string]interface{}
+
+// Int returns the int param name, or def if it's not set.
+func (p Params) Int(name string, def int) int {
+	switch v := p[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// Float returns the float param name, or def if it's not set.
+func (p Params) Float(name string, def float64) float64 {
+	switch v := p[name].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return def
+}
+
+// String returns the string param name, or def if it's not set.
+func (p Params) String(name string, def string) string {
+	if v, ok := p[name].(string); ok {
+		return v
+	}
+	return def
+}
+
+// Ints returns the []int param name, e.g. hidden layer sizes, or def if it's not set.
+func (p Params) Ints(name string, def []int) []int {
+	if v, ok := p[name].([]int); ok {
+		return v
+	}
+	return def
+}
+
+// Dimension is the values of a hyperparameter.
+type Dimension interface {
+	// Values returns all the values for grid search, nil if the dimension is continuous.
+	Values() []interface{}
+	// Sample returns a random value for random search.
+	Sample(rnd *rand.Rand) interface{}
+}
+
+// Space is the hyperparameters to search, keyed by name.
+type Space map[string]Dimension
+
+type choice []interface{}
+
+// Choice is a dimension of the given values, e.g. Choice([]int{16}, []int{32, 16})
+// for hidden layer sizes.
+func Choice(values ...interface{}) Dimension {
+	return choice(values)
+}
+
+func (c choice) Values() []interface{} {
+	return c
+}
+
+func (c choice) Sample(rnd *rand.Rand) interface{} {
+	return c[rnd.Intn(len(c))]
+}
+
+type intRange struct {
+	min, max, step int
+}
+
+// IntRange is a dimension of ints in [min, max] with step.
+func IntRange(min, max, step int) Dimension {
+	if step <= 0 {
+		step = 1
+	}
+	return intRange{min: min, max: max, step: step}
+}
+
+func (r intRange) Values() []interface{} {
+	var values []interface{}
+	for v := r.min; v <= r.max; v += r.step {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (r intRange) Sample(rnd *rand.Rand) interface{} {
+	return r.min + rnd.Intn((r.max-r.min)/r.step+1)*r.step
+}
+
+type uniform struct {
+	min, max float64
+	log      bool
+}
+
+// Uniform is a continuous dimension of floats uniformly distributed in [min, max).
+func Uniform(min, max float64) Dimension {
+	return uniform{min: min, max: max}
+}
+
+// LogUniform is a continuous dimension of floats in [min, max) whose logarithm
+// is uniformly distributed, e.g. for learning rates.
+func LogUniform(min, max float64) Dimension {
+	return uniform{min: min, max: max, log: true}
+}
+
+func (u uniform) Values() []interface{} {
+	return nil
+}
+
+func (u uniform) Sample(rnd *rand.Rand) interface{} {
+	if u.log {
+		return math.Exp(math.Log(u.min) + rnd.Float64()*(math.Log(u.max)-math.Log(u.min)))
+	}
+	return u.min + rnd.Float64()*(u.max-u.min)
+}
+
+// names returns the names of space in order, so the trials are reproducible.
+func (s Space) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks all the dimensions have values.
+func (s Space) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("empty search space")
+	}
+	for _, name := range s.names() {
+		switch d := s[name].(type) {
+		case nil:
+			return fmt.Errorf("dimension %s is nil", name)
+		case choice:
+			if len(d) == 0 {
+				return fmt.Errorf("dimension %s has no values", name)
+			}
+		case intRange:
+			if d.min > d.max {
+				return fmt.Errorf("dimension %s has min %d > max %d", name, d.min, d.max)
+			}
+		case uniform:
+			if d.min >= d.max || (d.log && d.min <= 0) {
+				return fmt.Errorf("dimension %s has invalid range [%g, %g)", name, d.min, d.max)
+			}
+		}
+	}
+	return nil
+}
+
+// Grid returns the cartesian product of all the dimensions.
+func (s Space) Grid() ([]Params, error) {
+	names := s.names()
+	grid := []Params{{}}
+	for _, name := range names {
+		values := s[name].Values()
+		if len(values) == 0 {
+			return nil, fmt.Errorf("dimension %s is continuous, could not be grid searched", name)
+		}
+		product := make([]Params, 0, len(grid)*len(values))
+		for _, params := range grid {
+			for _, v := range values {
+				p := make(Params, len(names))
+				for k, pv := range params {
+					p[k] = pv
+				}
+				p[name] = v
+				product = append(product, p)
+			}
+		}
+		grid = product
+	}
+	return grid, nil
+}
+
+// Sample returns n params drawn randomly from all the dimensions.
+func (s Space) Sample(rnd *rand.Rand, n int) []Params {
+	names := s.names()
+	samples := make([]Params, n)
+	for i := range samples {
+		samples[i] = make(Params, len(names))
+		for _, name := range names {
+			samples[i][name] = s[name].Sample(rnd)
+		}
+	}
+	return samples
+}
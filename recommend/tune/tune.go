@@ -0,0 +1,402 @@
+// Package tune searches the hyperparameters of any rcmd.Fitter with grid,
+// random or successive-halving search.
+//
+// Each trial fits a new Fitter of the params on the training part of the
+// sample and scores it on the validation part with a Metric of nn/metrics.
+// Trials run in parallel goroutines within the budget of trials and time, the
+// results are ranked in a Leaderboard which could be written as JSON.
+//
+// CrossValScore scores new Fitters on the splits of nn/model_selection.
+package tune
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	log "github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/mat"
+	"gorgonia.org/tensor"
+)
+
+// FitterFactory returns a new Fitter of params. resource is the training
+// budget of the trial, e.g. epochs or max iterations, it is MaxResource for
+// grid and random search, and grows with the rungs of successive halving.
+type FitterFactory func(params Params, resource int) (rcmd.Fitter, error)
+
+// Tuner searches Space for the Fitter with the best Metric.
+type Tuner struct {
+	Space     Space
+	NewFitter FitterFactory
+	Metric    Metric
+
+	// ValidationFraction is the fraction of the last rows of the sample used
+	// for validation, default 0.2. The rows are shuffled with Seed before the
+	// split if Shuffle, otherwise samples ordered by time are validated on
+	// the latest ones.
+	ValidationFraction float64
+	Shuffle            bool
+	// Seed of the shuffle and random search.
+	Seed int64
+
+	// Parallelism is the number of trials run at the same time, default runtime.NumCPU().
+	Parallelism int
+	// MaxTrials is the budget of the number of trials, 0 means unlimited.
+	MaxTrials int
+	// Timeout is the budget of time, trials are not started after it, 0 means unlimited.
+	// Trials started could not be interrupted.
+	Timeout time.Duration
+
+	// MaxResource is passed to NewFitter, required by successive halving.
+	MaxResource int
+	// MinResource is the resource of the first rung of successive halving,
+	// default MaxResource / Eta^rungs.
+	MinResource int
+	// Eta is the factor of candidates dropped and resource increased by each
+	// rung of successive halving, default 3.
+	Eta int
+
+	// LeaderboardPath is the file the leaderboard JSON is written to after the search, if not empty.
+	LeaderboardPath string
+}
+
+func (t *Tuner) validate() error {
+	if t.NewFitter == nil {
+		return fmt.Errorf("NewFitter is nil")
+	}
+	if t.Metric.Score == nil {
+		return fmt.Errorf("metric %q has no Score", t.Metric.Name)
+	}
+	if t.ValidationFraction < 0 || t.ValidationFraction >= 1 {
+		return fmt.Errorf("validation fraction must be in [0, 1), got %g", t.ValidationFraction)
+	}
+	if t.Parallelism < 0 || t.MaxTrials < 0 || t.Timeout < 0 || t.MaxResource < 0 || t.MinResource < 0 {
+		return fmt.Errorf("parallelism, budget and resources must not be negative")
+	}
+	if t.Eta == 1 || t.Eta < 0 {
+		return fmt.Errorf("eta must be greater than 1, got %d", t.Eta)
+	}
+	return t.Space.Validate()
+}
+
+// Grid evaluates all the params of the cartesian product of Space.
+func (t *Tuner) Grid(ctx context.Context, sample *rcmd.TrainSample) (lb *Leaderboard, err error) {
+	if err = t.validate(); err != nil {
+		return
+	}
+	grid, err := t.Space.Grid()
+	if err != nil {
+		return
+	}
+	return t.search(ctx, "grid", sample, func(s *search) error {
+		s.run(grid, t.MaxResource)
+		return nil
+	})
+}
+
+// Random evaluates n params sampled from Space.
+func (t *Tuner) Random(ctx context.Context, sample *rcmd.TrainSample, n int) (lb *Leaderboard, err error) {
+	if err = t.validate(); err != nil {
+		return
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("number of random trials must be positive, got %d", n)
+	}
+	candidates := t.Space.Sample(rand.New(rand.NewSource(t.Seed)), n)
+	return t.search(ctx, "random", sample, func(s *search) error {
+		s.run(candidates, t.MaxResource)
+		return nil
+	})
+}
+
+// SuccessiveHalving evaluates n params sampled from Space with MinResource,
+// then keeps the best 1/Eta of them with Eta times the resource, until one
+// is left or MaxResource is reached. The best trial is of the last rung.
+func (t *Tuner) SuccessiveHalving(ctx context.Context, sample *rcmd.TrainSample, n int) (lb *Leaderboard, err error) {
+	if err = t.validate(); err != nil {
+		return
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("number of successive halving candidates must be positive, got %d", n)
+	}
+	if t.MaxResource <= 0 {
+		return nil, fmt.Errorf("successive halving requires MaxResource")
+	}
+	eta := t.Eta
+	if eta == 0 {
+		eta = 3
+	}
+	resource := t.MinResource
+	if resource == 0 {
+		rungs := int(math.Floor(math.Log(float64(n)) / math.Log(float64(eta))))
+		resource = t.MaxResource / int(math.Pow(float64(eta), float64(rungs)))
+		if resource < 1 {
+			resource = 1
+		}
+	}
+	if resource > t.MaxResource {
+		return nil, fmt.Errorf("min resource %d > max resource %d", resource, t.MaxResource)
+	}
+	candidates := t.Space.Sample(rand.New(rand.NewSource(t.Seed)), n)
+	return t.search(ctx, "successive_halving", sample, func(s *search) error {
+		for {
+			trials := s.run(candidates, resource)
+			if len(trials) < len(candidates) {
+				// out of budget, the rung is not complete
+				return nil
+			}
+			s.rungBest = s.best(trials)
+			if len(candidates) <= 1 || resource >= t.MaxResource {
+				return nil
+			}
+			sortTrials(trials, t.Metric)
+			keep := int(math.Ceil(float64(len(candidates)) / float64(eta)))
+			candidates = candidates[:0]
+			for _, trial := range trials[:keep] {
+				if trial.Err == "" {
+					candidates = append(candidates, trial.Params)
+				}
+			}
+			if len(candidates) == 0 {
+				return nil
+			}
+			resource *= eta
+			if resource > t.MaxResource {
+				resource = t.MaxResource
+			}
+		}
+	})
+}
+
+// search holds the state shared by the trials of a search.
+type search struct {
+	t            *Tuner
+	ctx          context.Context
+	train, valid *rcmd.TrainSample
+	yTrue        *mat.Dense
+
+	mu       sync.Mutex
+	started  int
+	trials   []Trial
+	rungBest *Trial
+}
+
+func (t *Tuner) search(ctx context.Context, strategy string, sample *rcmd.TrainSample, do func(s *search) error,
+) (lb *Leaderboard, err error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	train, valid, err := t.split(sample)
+	if err != nil {
+		return
+	}
+	s := &search{t: t, ctx: ctx, train: train, valid: valid}
+	s.yTrue = mat.NewDense(valid.Rows, 1, nil)
+	for i := 0; i < valid.Rows; i++ {
+		s.yTrue.Set(i, 0, float64(valid.Y[i]))
+	}
+	if err = do(s); err != nil {
+		return
+	}
+
+	lb = &Leaderboard{
+		Strategy:        strategy,
+		Metric:          t.Metric.Name,
+		GreaterIsBetter: t.Metric.GreaterIsBetter,
+		Trials:          s.trials,
+	}
+	sortTrials(lb.Trials, t.Metric)
+	if s.rungBest != nil {
+		lb.Best = s.rungBest
+	} else if len(lb.Trials) > 0 && lb.Trials[0].Err == "" {
+		lb.Best = &lb.Trials[0]
+	}
+	if t.LeaderboardPath != "" {
+		if err = lb.Save(t.LeaderboardPath); err != nil {
+			return
+		}
+	}
+	if lb.Best == nil {
+		return lb, fmt.Errorf("no trial succeeded of %d trials", len(lb.Trials))
+	}
+	log.Infof("best %s %g of %d trials: %v", t.Metric.Name, lb.Best.Score, len(lb.Trials), lb.Best.Params)
+	return
+}
+
+// split returns the training and validation parts of sample.
+func (t *Tuner) split(sample *rcmd.TrainSample) (train, valid *rcmd.TrainSample, err error) {
+	fraction := t.ValidationFraction
+	if fraction == 0 {
+		fraction = 0.2
+	}
+	validRows := int(float64(sample.Rows) * fraction)
+	if validRows == 0 || validRows == sample.Rows {
+		return nil, nil, fmt.Errorf("could not split %d rows for validation fraction %g", sample.Rows, fraction)
+	}
+	if len(sample.X) != sample.Rows*sample.XCols || len(sample.Y) != sample.Rows {
+		return nil, nil, fmt.Errorf("sample of %d rows has %d features and %d labels", sample.Rows, len(sample.X), len(sample.Y))
+	}
+	order := make([]int, sample.Rows)
+	for i := range order {
+		order[i] = i
+	}
+	if t.Shuffle {
+		rnd := rand.New(rand.NewSource(t.Seed))
+		rnd.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+	trainRows := sample.Rows - validRows
+	return subSample(sample, order[:trainRows]), subSample(sample, order[trainRows:]), nil
+}
+
+func subSample(sample *rcmd.TrainSample, rows []int) *rcmd.TrainSample {
+	sub := &rcmd.TrainSample{
+		X:     make([]float32, len(rows)*sample.XCols),
+		Y:     make([]float32, len(rows)),
+		Rows:  len(rows),
+		XCols: sample.XCols,
+		Info:  sample.Info,
+	}
+	for i, row := range rows {
+		copy(sub.X[i*sample.XCols:(i+1)*sample.XCols], sample.X[row*sample.XCols:])
+		sub.Y[i] = sample.Y[row]
+	}
+	return sub
+}
+
+// run evaluates the candidates with resource in parallel, and returns the
+// trials finished within the budget.
+func (s *search) run(candidates []Params, resource int) (trials []Trial) {
+	parallelism := s.t.Parallelism
+	if parallelism == 0 {
+		parallelism = runtime.NumCPU()
+	}
+	jobs := make(chan Trial)
+	results := make(chan Trial)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for trial := range jobs {
+				results <- s.evaluate(trial)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, params := range candidates {
+			trial, ok := s.start(params, resource)
+			if !ok {
+				return
+			}
+			jobs <- trial
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	for trial := range results {
+		trials = append(trials, trial)
+	}
+	sort.Slice(trials, func(i, j int) bool { return trials[i].Id < trials[j].Id })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trials = append(s.trials, trials...)
+	return
+}
+
+// start allocates the id of a new trial, ok is false if out of budget.
+func (s *search) start(params Params, resource int) (trial Trial, ok bool) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t.MaxTrials > 0 && s.started >= s.t.MaxTrials {
+		return
+	}
+	s.started++
+	return Trial{Id: s.started, Params: params, Resource: resource}, true
+}
+
+func (s *search) evaluate(trial Trial) Trial {
+	start := time.Now()
+	score, err := s.score(trial)
+	trial.Seconds = time.Since(start).Seconds()
+	if err != nil {
+		trial.Err = err.Error()
+		log.Warnf("trial %d %v failed: %v", trial.Id, trial.Params, err)
+		return trial
+	}
+	trial.Score = score
+	log.Infof("trial %d %v resource %d: %s %g", trial.Id, trial.Params, trial.Resource, s.t.Metric.Name, score)
+	return trial
+}
+
+func (s *search) score(trial Trial) (score float64, err error) {
+	fitter, err := s.t.NewFitter(trial.Params, trial.Resource)
+	if err != nil {
+		return
+	}
+	// fitters may modify the sample, so each trial has a copy
+	train := *s.train
+	train.X = append([]float32(nil), s.train.X...)
+	train.Y = append([]float32(nil), s.train.Y...)
+	pred, err := fitter.Fit(&train)
+	if err != nil {
+		return
+	}
+	yPred, err := Predict(pred, s.valid)
+	if err != nil {
+		return
+	}
+	score = s.t.Metric.Score(s.yTrue, yPred)
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, fmt.Errorf("%s is %g", s.t.Metric.Name, score)
+	}
+	return
+}
+
+func (s *search) best(trials []Trial) *Trial {
+	var best *Trial
+	for i := range trials {
+		if trials[i].Err != "" {
+			continue
+		}
+		if best == nil || s.t.Metric.Better(trials[i].Score, best.Score) {
+			trial := trials[i]
+			best = &trial
+		}
+	}
+	return best
+}
+
+// Predict returns the predictions of pred for the rows of sample, of shape
+// (rows, outputs).
+func Predict(pred rcmd.PredictAbstract, sample *rcmd.TrainSample) (yPred *mat.Dense, err error) {
+	X := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+	y := pred.Predict(X)
+	if y == nil {
+		return nil, fmt.Errorf("predict failed")
+	}
+	data, ok := y.Data().([]float32)
+	if !ok || len(data) == 0 || len(data)%sample.Rows != 0 {
+		return nil, fmt.Errorf("predictions of %d rows has %d values", sample.Rows, y.Shape().TotalSize())
+	}
+	cols := len(data) / sample.Rows
+	yPred = mat.NewDense(sample.Rows, cols, nil)
+	for i, v := range data {
+		yPred.Set(i/cols, i%cols, float64(v))
+	}
+	return
+}
@@ -0,0 +1,283 @@
+package tune
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auxten/go-ctr/model/mlp"
+	"github.com/auxten/go-ctr/nn/base"
+	nn "github.com/auxten/go-ctr/nn/neural_network"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"github.com/auxten/go-ctr/recommend/sampletest"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// linearSample is labeled 1 if the first column is greater than 0.5.
+func linearSample(rows int) *rcmd.TrainSample {
+	return sampletest.Uniform(rows, 2, 1, 0, 1, func(x []float32) bool {
+		return x[0] > 0.5
+	})
+}
+
+// noisyPred scores the first column with noise, the less noise the higher AUC.
+type noisyPred struct {
+	noise float64
+	seed  int64
+}
+
+func (p *noisyPred) Predict(X tensor.Tensor) tensor.Tensor {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	x := X.Data().([]float32)
+	rnd := rand.New(rand.NewSource(p.seed))
+	y := make([]float32, rows)
+	for i := range y {
+		y[i] = x[i*cols] + float32(p.noise*rnd.Float64())
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(y))
+}
+
+type noisyFitter struct {
+	noise   float64
+	fitting *int32
+	maxFit  *int32
+}
+
+func (f *noisyFitter) Fit(sample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	if f.fitting != nil {
+		n := atomic.AddInt32(f.fitting, 1)
+		defer atomic.AddInt32(f.fitting, -1)
+		for {
+			max := atomic.LoadInt32(f.maxFit)
+			if n <= max || atomic.CompareAndSwapInt32(f.maxFit, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.noise < 0 {
+		return nil, errors.New("negative noise")
+	}
+	return &noisyPred{noise: f.noise, seed: 1}, nil
+}
+
+func noisyFactory(params Params, resource int) (rcmd.Fitter, error) {
+	return &noisyFitter{noise: params.Float("noise", 0)}, nil
+}
+
+func TestSpace(t *testing.T) {
+	Convey("grid and sample", t, func() {
+		space := Space{
+			"hidden": Choice([]int{16}, []int{32, 16}),
+			"epochs": IntRange(10, 30, 10),
+			"lr":     LogUniform(1e-4, 1e-1),
+		}
+		So(space.Validate(), ShouldBeNil)
+		_, err := space.Grid()
+		So(err, ShouldNotBeNil)
+
+		delete(space, "lr")
+		grid, err := space.Grid()
+		So(err, ShouldBeNil)
+		So(grid, ShouldHaveLength, 6)
+		So(grid[0], ShouldResemble, Params{"epochs": 10, "hidden": []int{16}})
+		So(grid[5], ShouldResemble, Params{"epochs": 30, "hidden": []int{32, 16}})
+
+		space["lr"] = LogUniform(1e-4, 1e-1)
+		samples := space.Sample(rand.New(rand.NewSource(0)), 20)
+		So(samples, ShouldHaveLength, 20)
+		for _, p := range samples {
+			So(p.Float("lr", 0), ShouldBeBetweenOrEqual, 1e-4, 1e-1)
+			So(p.Int("epochs", 0), ShouldBeIn, 10, 20, 30)
+			So(p.Ints("hidden", nil), ShouldNotBeEmpty)
+		}
+		So(samples[0].String("missing", "default"), ShouldEqual, "default")
+	})
+
+	Convey("invalid space", t, func() {
+		So(Space{}.Validate(), ShouldNotBeNil)
+		So(Space{"a": Choice()}.Validate(), ShouldNotBeNil)
+		So(Space{"a": IntRange(3, 1, 1)}.Validate(), ShouldNotBeNil)
+		So(Space{"a": LogUniform(0, 1)}.Validate(), ShouldNotBeNil)
+	})
+}
+
+func TestGrid(t *testing.T) {
+	Convey("grid search and leaderboard", t, func() {
+		path := filepath.Join(t.TempDir(), "leaderboard.json")
+		tuner := &Tuner{
+			Space:           Space{"noise": Choice(1.0, 0.0, 0.5)},
+			NewFitter:       noisyFactory,
+			Metric:          ROCAUC,
+			LeaderboardPath: path,
+		}
+		lb, err := tuner.Grid(context.Background(), linearSample(500))
+		So(err, ShouldBeNil)
+		So(lb.Trials, ShouldHaveLength, 3)
+		So(lb.Best.Params["noise"], ShouldEqual, 0.0)
+		So(lb.Best.Score, ShouldAlmostEqual, 1)
+		So(lb.Trials[1].Params["noise"], ShouldEqual, 0.5)
+		So(lb.Trials[1].Score, ShouldBeGreaterThan, lb.Trials[2].Score)
+
+		data, err := os.ReadFile(path)
+		So(err, ShouldBeNil)
+		var saved Leaderboard
+		So(json.Unmarshal(data, &saved), ShouldBeNil)
+		So(saved.Strategy, ShouldEqual, "grid")
+		So(saved.Metric, ShouldEqual, "roc_auc")
+		So(saved.Best.Params["noise"], ShouldEqual, 0.0)
+		So(saved.Trials, ShouldHaveLength, 3)
+	})
+
+	Convey("metric less is better", t, func() {
+		tuner := &Tuner{
+			Space:     Space{"noise": Choice(1.0, 0.0, 0.5)},
+			NewFitter: noisyFactory,
+			Metric:    MSE,
+		}
+		lb, err := tuner.Grid(context.Background(), linearSample(500))
+		So(err, ShouldBeNil)
+		So(lb.Best.Params["noise"], ShouldEqual, 0.0)
+		So(lb.Trials[2].Params["noise"], ShouldEqual, 1.0)
+	})
+
+	Convey("failed trials", t, func() {
+		tuner := &Tuner{
+			Space:     Space{"noise": Choice(-1.0, 0.5)},
+			NewFitter: noisyFactory,
+			Metric:    Accuracy,
+		}
+		lb, err := tuner.Grid(context.Background(), linearSample(500))
+		So(err, ShouldBeNil)
+		So(lb.Best.Params["noise"], ShouldEqual, 0.5)
+		So(lb.Trials[1].Err, ShouldEqual, "negative noise")
+
+		tuner.Space = Space{"noise": Choice(-1.0)}
+		_, err = tuner.Grid(context.Background(), linearSample(500))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("invalid tuner", t, func() {
+		_, err := (&Tuner{Space: Space{"noise": Choice(0.0)}, Metric: ROCAUC}).Grid(context.Background(), linearSample(10))
+		So(err, ShouldNotBeNil)
+		_, err = (&Tuner{Space: Space{"noise": Choice(0.0)}, NewFitter: noisyFactory, Metric: ROCAUC}).
+			Grid(context.Background(), linearSample(2))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestBudget(t *testing.T) {
+	Convey("parallelism and max trials", t, func() {
+		var fitting, maxFit int32
+		tuner := &Tuner{
+			Space: Space{"noise": Uniform(0, 1)},
+			NewFitter: func(params Params, resource int) (rcmd.Fitter, error) {
+				return &noisyFitter{noise: params.Float("noise", 0), fitting: &fitting, maxFit: &maxFit}, nil
+			},
+			Metric:      ROCAUC,
+			Parallelism: 3,
+			MaxTrials:   10,
+		}
+		lb, err := tuner.Random(context.Background(), linearSample(200), 20)
+		So(err, ShouldBeNil)
+		So(lb.Trials, ShouldHaveLength, 10)
+		So(maxFit, ShouldBeBetweenOrEqual, 2, 3)
+		for i := 1; i < len(lb.Trials); i++ {
+			So(lb.Trials[i-1].Score, ShouldBeGreaterThanOrEqualTo, lb.Trials[i].Score)
+		}
+	})
+
+	Convey("timeout", t, func() {
+		var mu sync.Mutex
+		fits := 0
+		tuner := &Tuner{
+			Space: Space{"noise": Uniform(0, 1)},
+			NewFitter: func(params Params, resource int) (rcmd.Fitter, error) {
+				mu.Lock()
+				fits++
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				return &noisyFitter{noise: params.Float("noise", 0)}, nil
+			},
+			Metric:      ROCAUC,
+			Parallelism: 1,
+			Timeout:     50 * time.Millisecond,
+		}
+		lb, err := tuner.Random(context.Background(), linearSample(200), 100)
+		So(err, ShouldBeNil)
+		So(len(lb.Trials), ShouldBeBetweenOrEqual, 1, 5)
+		So(fits, ShouldEqual, len(lb.Trials))
+	})
+}
+
+func TestSuccessiveHalving(t *testing.T) {
+	Convey("rungs of resource", t, func() {
+		var mu sync.Mutex
+		resources := map[int]int{}
+		tuner := &Tuner{
+			Space: Space{"noise": Uniform(0, 1)},
+			NewFitter: func(params Params, resource int) (rcmd.Fitter, error) {
+				mu.Lock()
+				resources[resource]++
+				mu.Unlock()
+				// more resource reduces the noise
+				return &noisyFitter{noise: params.Float("noise", 0) / float64(resource)}, nil
+			},
+			Metric:      ROCAUC,
+			MaxResource: 9,
+		}
+		lb, err := tuner.SuccessiveHalving(context.Background(), linearSample(300), 9)
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, map[int]int{1: 9, 3: 3, 9: 1})
+		So(lb.Trials, ShouldHaveLength, 13)
+		So(lb.Best.Resource, ShouldEqual, 9)
+		So(lb.Trials[0].Id, ShouldEqual, lb.Best.Id)
+
+		// the candidate of the last rung is the best of the first one
+		var first []Trial
+		for _, trial := range lb.Trials {
+			if trial.Resource == 1 {
+				first = append(first, trial)
+			}
+		}
+		So(first[0].Params, ShouldResemble, lb.Best.Params)
+
+		tuner.MaxResource = 0
+		_, err = tuner.SuccessiveHalving(context.Background(), linearSample(300), 9)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTuneMlp(t *testing.T) {
+	Convey("random search of mlp", t, func() {
+		tuner := &Tuner{
+			Space: Space{
+				"hidden": Choice([]int{1}, []int{16, 8}),
+				"lr":     LogUniform(1e-3, 1e-2),
+			},
+			NewFitter: func(params Params, resource int) (rcmd.Fitter, error) {
+				model := nn.NewBaseMultilayerPerceptron32()
+				model.HiddenLayerSizes = params.Ints("hidden", nil)
+				model.LearningRateInit = float32(params.Float("lr", 1e-3))
+				model.MaxIter = resource
+				model.RandomState = base.NewLockedSource(7)
+				return &mlp.SimpleMlp32FitWrap{Model: model}, nil
+			},
+			Metric:      ROCAUC,
+			MaxResource: 100,
+			Seed:        1,
+		}
+		lb, err := tuner.Random(context.Background(), linearSample(500), 4)
+		So(err, ShouldBeNil)
+		So(lb.Trials, ShouldHaveLength, 4)
+		So(lb.Best.Score, ShouldBeGreaterThan, 0.95)
+	})
+}
@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/auxten/go-ctr/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const clickHouseTestDsn = "clickhouse://default:@ch.test:9000/logs?dial_timeout=1s"
+
+func TestClickHouseScanner(t *testing.T) {
+	columns := []string{"name", "type", "comment", "default_kind", "default_expression", "is_in_primary_key"}
+	setFakeFixtures(clickHouseTestDsn,
+		fakeFixture{
+			contains: "WHERE database = ? AND table = ?",
+			args:     []driver.Value{"logs", "clicks"},
+			columns:  columns,
+			// recorded from system.columns of clickhouse 22.8
+			rows: [][]driver.Value{
+				{"user_id", "UInt64", "", "", "", uint8(1)},
+				{"item_id", "UInt64", "", "", "", uint8(1)},
+				{"event", "LowCardinality(Nullable(String))", "click or view", "", "", uint8(0)},
+				{"price", "Nullable(Decimal(18, 2))", "", "DEFAULT", "0", uint8(0)},
+				{"ts", "DateTime", "event time", "", "", uint8(0)},
+			},
+		},
+		fakeFixture{
+			contains: "WHERE database = currentDatabase() AND table = ?",
+			args:     []driver.Value{"clicks"},
+			columns:  columns,
+			rows:     [][]driver.Value{{"user_id", "UInt64", "", "", "", uint8(1)}},
+		},
+		fakeFixture{
+			contains: "FROM system.columns",
+			columns:  columns,
+		},
+		fakeFixture{
+			contains: "SELECT event, count() FROM clicks",
+			columns:  []string{"event", "count()"},
+			rows:     [][]driver.Value{{"click", uint64(3)}, {"view", uint64(10)}},
+		},
+	)
+	newScanner := func() *ClickHouseScanner {
+		scanner := NewClickHouseScanner(clickHouseTestDsn)
+		scanner.DriverName = fakeDriver
+		return scanner
+	}
+
+	Convey("new scanner by config", t, func() {
+		_, err := NewScanner(config.Config{DbType: "ClickHouse", Dsn: clickHouseTestDsn})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "github.com/ClickHouse/clickhouse-go")
+
+		ClickHouseDriver = fakeDriver
+		defer func() { ClickHouseDriver = "clickhouse" }()
+		scanner, err := NewScanner(config.Config{DbType: "ClickHouse", Dsn: clickHouseTestDsn})
+		So(err, ShouldBeNil)
+		So(scanner.(*ClickHouseScanner).DbName, ShouldEqual, "logs")
+		So(NewClickHouseScanner("tcp://ch.test:9000?database=events").DbName, ShouldEqual, "events")
+		_, err = NewScanner(config.Config{DbType: "oracle"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("get schema", t, func() {
+		schema, err := newScanner().GetSchema("clicks")
+		So(err, ShouldBeNil)
+		So(schema.DbName, ShouldEqual, "logs")
+		So(schema.Columns, ShouldHaveLength, 5)
+		So(schema.Columns[2].Type, ShouldEqual, "String")
+		So(schema.Columns[2].Comment, ShouldEqual, "click or view")
+		So(schema.Columns[3].Type, ShouldEqual, "Decimal")
+		So(schema.Columns[3].Size, ShouldEqual, "18, 2")
+		So(schema.Columns[3].Extra, ShouldEqual, "defaultKind:DEFAULT, defaultVal:0, pk:0")
+		So(IsNumericType(schema.Columns[0].Type), ShouldBeTrue)
+		So(IsNumericType(schema.Columns[4].Type), ShouldBeFalse)
+
+		scanner := newScanner()
+		scanner.DbName = ""
+		schema, err = scanner.GetSchema("clicks")
+		So(err, ShouldBeNil)
+		So(schema.Columns, ShouldHaveLength, 1)
+	})
+
+	Convey("schema not exist", t, func() {
+		schema, err := newScanner().GetSchema("not_exist")
+		So(err, ShouldEqual, ErrDDLNotFound)
+		So(schema, ShouldBeNil)
+	})
+
+	Convey("get rows", t, func() {
+		rows, err := newScanner().GetRows("SELECT event, count() FROM clicks GROUP BY event")
+		So(err, ShouldBeNil)
+		defer rows.Close()
+		counts := make(map[string]int)
+		for rows.Next() {
+			var (
+				event sql.NullString
+				count int
+			)
+			So(rows.Scan(&event, &count), ShouldBeNil)
+			counts[event.String] = count
+		}
+		So(counts, ShouldResemble, map[string]int{"click": 3, "view": 10})
+	})
+}
+
+func TestIsNumericType(t *testing.T) {
+	Convey("numeric types", t, func() {
+		for _, typ := range []string{"Int64", "UInt8", "Float32", "Nullable(Float64)", "LowCardinality(Nullable(UInt32))",
+			"Decimal(10, 2)", "int(11) unsigned", "double precision", "numeric(10,2)", "REAL", "bigint"} {
+			So(IsNumericType(typ), ShouldBeTrue)
+		}
+	})
+	Convey("compound and other types", t, func() {
+		for _, typ := range []string{"Array(Float32)", "Map(String, Int64)", "Tuple(Int8, Float32)",
+			"Nullable(Array(Int32))", "integer[]", "_int4", "String", "DateTime64(3)", "interval", "point"} {
+			So(IsNumericType(typ), ShouldBeFalse)
+		}
+	})
+}
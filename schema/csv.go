@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// csvTable is a csv file with header, empty fields are NULL.
+type csvTable struct {
+	path    string
+	columns []Column
+}
+
+func openCsvTable(path string) (table *csvTable, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		err = fmt.Errorf("read header of %s: %v", path, err)
+		return
+	}
+
+	// infer type of each column by the first CsvInferRows rows
+	var (
+		isInt   = make([]bool, len(header))
+		isFloat = make([]bool, len(header))
+		seen    = make([]bool, len(header))
+	)
+	for i := range header {
+		isInt[i], isFloat[i] = true, true
+	}
+	for n := 0; n < CsvInferRows; n++ {
+		record, er := r.Read()
+		if er == io.EOF {
+			break
+		}
+		if er != nil {
+			err = fmt.Errorf("read %s: %v", path, er)
+			return
+		}
+		for i, v := range record {
+			if v == "" {
+				continue
+			}
+			seen[i] = true
+			if _, er := strconv.ParseInt(v, 10, 64); er != nil {
+				isInt[i] = false
+			}
+			if _, er := strconv.ParseFloat(v, 64); er != nil {
+				isFloat[i] = false
+			}
+		}
+	}
+
+	table = &csvTable{path: path}
+	for i, name := range header {
+		col := Column{Name: name, Type: FileTypeText}
+		switch {
+		case !seen[i]:
+		case isInt[i]:
+			col.Type = FileTypeInteger
+		case isFloat[i]:
+			col.Type = FileTypeReal
+		}
+		table.columns = append(table.columns, col)
+	}
+	return
+}
+
+func (t *csvTable) Columns() []Column {
+	return t.columns
+}
+
+func (t *csvTable) Open(proj []int) (iter fileRowIter, err error) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return
+	}
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	if _, err = r.Read(); err != nil {
+		f.Close()
+		return
+	}
+	iter = &csvRowIter{
+		table:  t,
+		file:   f,
+		reader: r,
+		proj:   proj,
+	}
+	return
+}
+
+type csvRowIter struct {
+	table  *csvTable
+	file   *os.File
+	reader *csv.Reader
+	proj   []int
+}
+
+func (it *csvRowIter) Next() (row []driver.Value, err error) {
+	record, err := it.reader.Read()
+	if err != nil {
+		return
+	}
+	row = make([]driver.Value, len(it.proj))
+	for i, c := range it.proj {
+		if c >= len(record) || record[c] == "" {
+			continue
+		}
+		row[i] = parseCsvValue(record[c], it.table.columns[c].Type)
+	}
+	return
+}
+
+// parseCsvValue returns v as the column type, or string if not parsable.
+func parseCsvValue(v string, colType string) driver.Value {
+	switch colType {
+	case FileTypeInteger:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+		fallthrough
+	case FileTypeReal:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func (it *csvRowIter) Close() error {
+	return it.file.Close()
+}
@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fakeDriver answers queries with recorded fixtures, it is used to test
+// scanners of databases not available in tests.
+const fakeDriver = "fakedb"
+
+type fakeFixture struct {
+	contains string         // query contains
+	args     []driver.Value // nil matches any args
+	columns  []string
+	rows     [][]driver.Value
+}
+
+var (
+	fakeMu       sync.Mutex
+	fakeFixtures = make(map[string][]fakeFixture) // dsn to fixtures
+)
+
+func init() {
+	sql.Register(fakeDriver, fakeDb{})
+}
+
+func setFakeFixtures(dsn string, fixtures ...fakeFixture) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	fakeFixtures[dsn] = fixtures
+}
+
+type fakeDb struct{}
+
+func (fakeDb) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{dsn: dsn}, nil
+}
+
+type fakeConn struct {
+	dsn string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("tx not supported")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	for _, f := range fakeFixtures[c.dsn] {
+		if strings.Contains(query, f.contains) && (f.args == nil || reflect.DeepEqual(f.args, args)) {
+			return &fakeRows{columns: f.columns, rows: f.rows}, nil
+		}
+	}
+	return nil, fmt.Errorf("no fixture for query %q with args %v", query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Column types of csv and parquet files
+const (
+	FileTypeInteger = "INTEGER"
+	FileTypeReal    = "REAL"
+	FileTypeText    = "TEXT"
+	FileTypeBoolean = "BOOLEAN"
+)
+
+// FileExtensions are tried in order to find the file of a table in FileScanner.Dir
+var FileExtensions = []string{".csv", ".parquet"}
+
+// CsvInferRows is the number of rows used to infer the column types of csv files
+var CsvInferRows = 1000
+
+var _ TableScanner = &FileScanner{}
+
+// FileScanner is a TableScanner over csv and parquet files in Dir,
+// the table "ratings" is the file "ratings.csv" or "ratings.parquet".
+//
+// GetRows supports simple queries like:
+//
+//	SELECT col, 0, * FROM table [WHERE cond] [ORDER BY col [DESC], ...] [LIMIT [offset,] n]
+//
+// cond could be comparisons, IN, IS [NOT] NULL combined by AND, OR and NOT.
+// Only the columns used are read from parquet files, and rows are streamed
+// from the file without ORDER BY. With ORDER BY, at most FileSortMemRows rows
+// are kept in memory: the top offset+limit rows with LIMIT, or else sorted
+// runs spilled to temp files and merged.
+type FileScanner struct {
+	Dir  string
+	conn *sql.DB
+	sync.Once
+}
+
+func NewFileScanner(dir string) *FileScanner {
+	return &FileScanner{
+		Dir: dir,
+	}
+}
+
+func (s *FileScanner) initConn() (err error) {
+	s.Do(func() {
+		s.conn, err = sql.Open(fileDriverName, s.Dir)
+	})
+	return err
+}
+
+func (s *FileScanner) GetSchema(tableName string) (schema *Schema, err error) {
+	table, err := openFileTable(s.Dir, tableName)
+	if err != nil {
+		return
+	}
+	schema = &Schema{
+		DbName:    s.Dir,
+		TableName: tableName,
+		Columns:   table.Columns(),
+	}
+	return
+}
+
+func (s *FileScanner) GetRows(query string) (rows *sql.Rows, err error) {
+	if err = s.initConn(); err != nil {
+		return
+	}
+
+	rows, err = s.conn.Query(query)
+	return
+}
+
+// fileTable is a csv or parquet file.
+type fileTable interface {
+	Columns() []Column
+	// Open iterates the rows of file with only the columns of indexes in proj
+	Open(proj []int) (fileRowIter, error)
+}
+
+type fileRowIter interface {
+	// Next returns the values of projected columns, or io.EOF at the end
+	Next() ([]driver.Value, error)
+	Close() error
+}
+
+func openFileTable(dir string, tableName string) (table fileTable, err error) {
+	path := filepath.Join(dir, tableName)
+	ext := strings.ToLower(filepath.Ext(tableName))
+	if ext != ".csv" && ext != ".parquet" {
+		ext = ""
+		for _, e := range FileExtensions {
+			if _, err = os.Stat(path + e); err == nil {
+				path, ext = path+e, e
+				break
+			}
+		}
+		if ext == "" {
+			err = fmt.Errorf("file of table %s not found in %s", tableName, dir)
+			return
+		}
+	}
+	switch ext {
+	case ".csv":
+		return openCsvTable(path)
+	default:
+		return openParquetTable(path)
+	}
+}
@@ -0,0 +1,171 @@
+package schema
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/auxten/go-ctr/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const testRatingsCsv = `userId,movieId,rating,timestamp,tags
+1,10,4.5,300,Action|Comedy
+1,20,2,100,
+2,10,3,200,Drama
+3,30,5,400,Action
+`
+
+type testRating struct {
+	UserId    int64   `parquet:"name=userId, type=INT64"`
+	MovieId   int32   `parquet:"name=movieId, type=INT32"`
+	Rating    float32 `parquet:"name=rating, type=FLOAT"`
+	Timestamp int64   `parquet:"name=timestamp, type=INT64"`
+	Tags      *string `parquet:"name=tags, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+func writeTestParquet(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	pw, err := writer.NewParquetWriterFromWriter(f, new(testRating), 1)
+	if err != nil {
+		return
+	}
+	str := func(s string) *string { return &s }
+	for _, r := range []testRating{
+		{1, 10, 4.5, 300, str("Action|Comedy")},
+		{1, 20, 2, 100, nil},
+		{2, 10, 3, 200, str("Drama")},
+		{3, 30, 5, 400, str("Action")},
+	} {
+		if err = pw.Write(r); err != nil {
+			return
+		}
+	}
+	return pw.WriteStop()
+}
+
+func TestFileScanner(t *testing.T) {
+	dir, err := os.MkdirTemp("", "filescanner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.WriteFile(filepath.Join(dir, "ratings_csv.csv"), []byte(testRatingsCsv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeTestParquet(filepath.Join(dir, "ratings_parquet.parquet")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"ratings_csv", "ratings_parquet"} {
+		scanner, err := NewScanner(config.Config{DbType: "file", Dsn: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		Convey("get schema of "+table, t, func() {
+			schema, err := scanner.GetSchema(table)
+			So(err, ShouldBeNil)
+			So(schema.Columns, ShouldHaveLength, 5)
+			var types []string
+			for _, col := range schema.Columns {
+				types = append(types, col.Type)
+			}
+			So(types, ShouldResemble, []string{FileTypeInteger, FileTypeInteger, FileTypeReal, FileTypeInteger, FileTypeText})
+			So(schema.Columns[4].Name, ShouldEqual, "tags")
+
+			_, err = scanner.GetSchema("not_exist")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("get rows of "+table, t, func() {
+			rows, err := scanner.GetRows("SELECT userId, movieId, rating, timestamp FROM " + table +
+				" WHERE rating >= 3 ORDER BY timestamp DESC, userId")
+			So(err, ShouldBeNil)
+			cols, err := rows.Columns()
+			So(err, ShouldBeNil)
+			So(cols, ShouldResemble, []string{"userId", "movieId", "rating", "timestamp"})
+			var timestamps []int64
+			for rows.Next() {
+				var (
+					userId, movieId int
+					rating          float64
+					ts              int64
+				)
+				So(rows.Scan(&userId, &movieId, &rating, &ts), ShouldBeNil)
+				timestamps = append(timestamps, ts)
+			}
+			So(rows.Err(), ShouldBeNil)
+			So(timestamps, ShouldResemble, []int64{400, 300, 200})
+
+			// streaming with literal, null check and limit
+			rows, err = scanner.GetRows("SELECT movieId, 0 AS zero, tags FROM " + table +
+				" WHERE tags IS NOT NULL AND (userId = 1 OR movieId IN (30)) LIMIT 1, 5")
+			So(err, ShouldBeNil)
+			var tags []string
+			for rows.Next() {
+				var (
+					movieId, zero int
+					tag           sql.NullString
+				)
+				So(rows.Scan(&movieId, &zero, &tag), ShouldBeNil)
+				So(zero, ShouldEqual, 0)
+				tags = append(tags, tag.String)
+			}
+			So(tags, ShouldResemble, []string{"Action"})
+
+			rows, err = scanner.GetRows("SELECT * FROM " + table + " LIMIT 2")
+			So(err, ShouldBeNil)
+			cols, _ = rows.Columns()
+			So(cols, ShouldHaveLength, 5)
+			var n int
+			for rows.Next() {
+				n++
+			}
+			So(n, ShouldEqual, 2)
+			So(rows.Close(), ShouldBeNil)
+
+			_, err = scanner.GetRows("SELECT not_exist FROM " + table)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("order by in memory, top k and spilled of "+table, t, func() {
+			memRows := FileSortMemRows
+			defer func() { FileSortMemRows = memRows }()
+			movieIds := func(query string) []int {
+				rows, err := scanner.GetRows(query)
+				So(err, ShouldBeNil)
+				defer rows.Close()
+				var ids []int
+				for rows.Next() {
+					var (
+						movieId int
+						tag     sql.NullString
+					)
+					So(rows.Scan(&movieId, &tag), ShouldBeNil)
+					ids = append(ids, movieId)
+				}
+				So(rows.Err(), ShouldBeNil)
+				return ids
+			}
+			for _, FileSortMemRows = range []int{100, 3, 1} {
+				So(movieIds("SELECT movieId, tags FROM "+table+" ORDER BY rating DESC"), ShouldResemble, []int{30, 10, 10, 20})
+				So(movieIds("SELECT movieId, tags FROM "+table+" ORDER BY userId, timestamp LIMIT 1, 2"), ShouldResemble, []int{10, 10})
+				So(movieIds("SELECT movieId, tags FROM "+table+" WHERE userId > 1 ORDER BY movieId DESC LIMIT 5"), ShouldResemble, []int{30, 10})
+			}
+		})
+
+		Convey("profile "+table, t, func() {
+			profile, err := ProfileTable(scanner, table)
+			So(err, ShouldBeNil)
+			So(profile.Rows, ShouldEqual, 4)
+			So(profile.Columns[4].NullRatio, ShouldEqual, 0.25)
+		})
+	}
+}
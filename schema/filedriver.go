@@ -0,0 +1,451 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// fileDriverName is the database/sql driver of FileScanner, dsn is the dir of files
+const fileDriverName = "go-ctr-file"
+
+func init() {
+	sql.Register(fileDriverName, fileDriver{})
+}
+
+type fileDriver struct{}
+
+func (fileDriver) Open(dir string) (driver.Conn, error) {
+	return &fileConn{dir: dir}, nil
+}
+
+type fileConn struct {
+	dir string
+}
+
+func (c *fileConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported by file scanner")
+}
+
+func (c *fileConn) Close() error { return nil }
+
+func (c *fileConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transaction not supported by file scanner")
+}
+
+func (c *fileConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("query args not supported by file scanner")
+	}
+	q, err := parseFileQuery(c.dir, query)
+	if err != nil {
+		return nil, err
+	}
+	return q.run(ctx)
+}
+
+// fileQuery is a parsed SELECT over a fileTable.
+type fileQuery struct {
+	table    fileTable
+	names    []string         // output column names
+	exprs    []sqlparser.Expr // output column expressions
+	where    sqlparser.Expr
+	orderBy  sqlparser.OrderBy
+	offset   int64
+	limit    int64          // -1 for no limit
+	proj     []int          // indexes of table columns read
+	colIndex map[string]int // lower case column name to index in projected row
+}
+
+func parseFileQuery(dir string, query string) (q *fileQuery, err error) {
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || len(sel.From) != 1 || sel.GroupBy != nil || sel.Having != nil || sel.Distinct != "" {
+		err = fmt.Errorf("only simple SELECT from one table is supported by file scanner: %s", query)
+		return
+	}
+	aliased, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		err = fmt.Errorf("unsupported table expression: %s", sqlparser.String(sel.From[0]))
+		return
+	}
+	tableName, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		err = fmt.Errorf("unsupported table expression: %s", sqlparser.String(aliased.Expr))
+		return
+	}
+
+	q = &fileQuery{limit: -1, orderBy: sel.OrderBy}
+	if q.table, err = openFileTable(dir, tableName.Name.String()); err != nil {
+		return
+	}
+	columns := q.table.Columns()
+	tableIndex := make(map[string]int, len(columns))
+	for i, col := range columns {
+		tableIndex[strings.ToLower(col.Name)] = i
+	}
+	q.colIndex = make(map[string]int)
+	// use adds the column to projection if not yet
+	use := func(name string) error {
+		name = strings.ToLower(name)
+		if _, ok := q.colIndex[name]; ok {
+			return nil
+		}
+		i, ok := tableIndex[name]
+		if !ok {
+			return fmt.Errorf("column %s not found in %s", name, tableName.Name.String())
+		}
+		q.colIndex[name] = len(q.proj)
+		q.proj = append(q.proj, i)
+		return nil
+	}
+	visit := func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok {
+			return false, use(col.Name.String())
+		}
+		return true, nil
+	}
+
+	for _, se := range sel.SelectExprs {
+		switch se := se.(type) {
+		case *sqlparser.StarExpr:
+			for _, col := range columns {
+				if err = use(col.Name); err != nil {
+					return
+				}
+				q.names = append(q.names, col.Name)
+				q.exprs = append(q.exprs, &sqlparser.ColName{Name: sqlparser.NewColIdent(col.Name)})
+			}
+		case *sqlparser.AliasedExpr:
+			if err = sqlparser.Walk(visit, se.Expr); err != nil {
+				return
+			}
+			name := se.As.String()
+			if name == "" {
+				if col, ok := se.Expr.(*sqlparser.ColName); ok {
+					name = col.Name.String()
+				} else {
+					name = sqlparser.String(se.Expr)
+				}
+			}
+			q.names = append(q.names, name)
+			q.exprs = append(q.exprs, se.Expr)
+		default:
+			err = fmt.Errorf("unsupported select expression: %s", sqlparser.String(se))
+			return
+		}
+	}
+	if sel.Where != nil {
+		q.where = sel.Where.Expr
+		if err = sqlparser.Walk(visit, q.where); err != nil {
+			return
+		}
+	}
+	for _, order := range sel.OrderBy {
+		if err = sqlparser.Walk(visit, order.Expr); err != nil {
+			return
+		}
+	}
+	if len(q.proj) == 0 && len(columns) > 0 {
+		// read one column to count rows
+		q.proj = []int{0}
+	}
+	if sel.Limit != nil {
+		if q.limit, err = limitValue(sel.Limit.Rowcount); err != nil {
+			return
+		}
+		if sel.Limit.Offset != nil {
+			if q.offset, err = limitValue(sel.Limit.Offset); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func limitValue(expr sqlparser.Expr) (n int64, err error) {
+	val, ok := expr.(*sqlparser.SQLVal)
+	if !ok || val.Type != sqlparser.IntVal {
+		err = fmt.Errorf("unsupported limit: %s", sqlparser.String(expr))
+		return
+	}
+	return strconv.ParseInt(string(val.Val), 10, 64)
+}
+
+func (q *fileQuery) run(ctx context.Context) (rows driver.Rows, err error) {
+	if len(q.proj) == 0 {
+		err = fmt.Errorf("no columns in table")
+		return
+	}
+	iter, err := q.table.Open(q.proj)
+	if err != nil {
+		return
+	}
+	fr := &fileRows{query: q, iter: iter}
+	if q.orderBy != nil {
+		// rows are filtered by sortRows
+		if fr.iter, err = q.sortRows(ctx, iter); err != nil {
+			return
+		}
+		fr.sorted = true
+	}
+	rows = fr
+	return
+}
+
+type fileRows struct {
+	query   *fileQuery
+	iter    fileRowIter
+	sorted  bool // rows of iter are sorted and filtered
+	skipped int64
+	emitted int64
+}
+
+// next returns the next raw row matching where.
+func (r *fileRows) next() (row []driver.Value, err error) {
+	if r.iter == nil {
+		return nil, io.EOF
+	}
+	for {
+		if row, err = r.iter.Next(); err != nil || r.sorted {
+			return
+		}
+		var match bool
+		if match, err = r.query.match(row); err != nil || match {
+			return
+		}
+	}
+}
+
+func (r *fileRows) Columns() []string {
+	return r.query.names
+}
+
+func (r *fileRows) Close() error {
+	if r.iter != nil {
+		iter := r.iter
+		r.iter = nil
+		return iter.Close()
+	}
+	return nil
+}
+
+func (r *fileRows) Next(dest []driver.Value) (err error) {
+	q := r.query
+	if q.limit >= 0 && r.emitted >= q.limit {
+		return io.EOF
+	}
+	for ; r.skipped < q.offset; r.skipped++ {
+		if _, err = r.next(); err != nil {
+			return
+		}
+	}
+	row, err := r.next()
+	if err != nil {
+		return
+	}
+	for i, expr := range q.exprs {
+		if dest[i], err = q.eval(expr, row); err != nil {
+			return
+		}
+	}
+	r.emitted++
+	return
+}
+
+func (q *fileQuery) match(row []driver.Value) (bool, error) {
+	if q.where == nil {
+		return true, nil
+	}
+	v, err := q.eval(q.where, row)
+	if err != nil {
+		return false, err
+	}
+	b, _ := v.(bool)
+	return b, nil
+}
+
+// eval evaluates expr on the projected row, comparisons with NULL are false.
+func (q *fileQuery) eval(expr sqlparser.Expr, row []driver.Value) (v driver.Value, err error) {
+	switch expr := expr.(type) {
+	case *sqlparser.ColName:
+		return row[q.colIndex[strings.ToLower(expr.Name.String())]], nil
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.IntVal:
+			return strconv.ParseInt(string(expr.Val), 10, 64)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(string(expr.Val), 64)
+		case sqlparser.StrVal:
+			return string(expr.Val), nil
+		}
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		return bool(expr), nil
+	case *sqlparser.ParenExpr:
+		return q.eval(expr.Expr, row)
+	case *sqlparser.UnaryExpr:
+		if expr.Operator == sqlparser.UMinusStr {
+			if v, err = q.eval(expr.Expr, row); err != nil {
+				return
+			}
+			switch n := v.(type) {
+			case int64:
+				return -n, nil
+			case float64:
+				return -n, nil
+			}
+		}
+	case *sqlparser.AndExpr:
+		var l, r driver.Value
+		if l, err = q.eval(expr.Left, row); err != nil || l != true {
+			return false, err
+		}
+		r, err = q.eval(expr.Right, row)
+		return r == true, err
+	case *sqlparser.OrExpr:
+		var l, r driver.Value
+		if l, err = q.eval(expr.Left, row); err != nil || l == true {
+			return l == true, err
+		}
+		r, err = q.eval(expr.Right, row)
+		return r == true, err
+	case *sqlparser.NotExpr:
+		if v, err = q.eval(expr.Expr, row); err != nil {
+			return
+		}
+		return v != true, nil
+	case *sqlparser.IsExpr:
+		if v, err = q.eval(expr.Expr, row); err != nil {
+			return
+		}
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			return v == nil, nil
+		case sqlparser.IsNotNullStr:
+			return v != nil, nil
+		}
+	case *sqlparser.ComparisonExpr:
+		return q.evalComparison(expr, row)
+	}
+	return nil, fmt.Errorf("unsupported expression: %s", sqlparser.String(expr))
+}
+
+func (q *fileQuery) evalComparison(expr *sqlparser.ComparisonExpr, row []driver.Value) (v driver.Value, err error) {
+	l, err := q.eval(expr.Left, row)
+	if err != nil {
+		return
+	}
+	switch expr.Operator {
+	case sqlparser.InStr, sqlparser.NotInStr:
+		tuple, ok := expr.Right.(sqlparser.ValTuple)
+		if !ok {
+			return nil, fmt.Errorf("unsupported expression: %s", sqlparser.String(expr))
+		}
+		if l == nil {
+			return false, nil
+		}
+		var in bool
+		for _, e := range tuple {
+			var r driver.Value
+			if r, err = q.eval(e, row); err != nil {
+				return
+			}
+			if c, ok := compareValues(l, r); ok && c == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (expr.Operator == sqlparser.InStr), nil
+	}
+
+	r, err := q.eval(expr.Right, row)
+	if err != nil {
+		return
+	}
+	c, ok := compareValues(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch expr.Operator {
+	case sqlparser.EqualStr:
+		return c == 0, nil
+	case sqlparser.NotEqualStr:
+		return c != 0, nil
+	case sqlparser.LessThanStr:
+		return c < 0, nil
+	case sqlparser.LessEqualStr:
+		return c <= 0, nil
+	case sqlparser.GreaterThanStr:
+		return c > 0, nil
+	case sqlparser.GreaterEqualStr:
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("unsupported operator: %s", expr.Operator)
+}
+
+func toFloat(v driver.Value) (f float64, ok bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return
+}
+
+// compareValues compares a and b as numbers if both are numeric, or as strings.
+// ok is false if any of them is NULL.
+func compareValues(a, b driver.Value) (c int, ok bool) {
+	if a == nil || b == nil {
+		return
+	}
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if !aStr || !bStr {
+		fa, okA := toFloat(a)
+		fb, okB := toFloat(b)
+		if okA && okB {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+// compareOrder compares a and b for ORDER BY, NULL is the smallest.
+func compareOrder(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compareValues(a, b)
+	return c
+}
@@ -0,0 +1,281 @@
+package schema
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"database/sql/driver"
+	"encoding/gob"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// FileSortMemRows is the max number of rows of an ORDER BY sorted in memory,
+// more rows are sorted in runs spilled to temp files and merged. ORDER BY with
+// LIMIT keeps only the top offset+limit rows if they are no more than it.
+var FileSortMemRows = 100000
+
+// sortEntry is a row with the values of ORDER BY, seq keeps the sort stable
+type sortEntry struct {
+	Key []driver.Value
+	Row []driver.Value
+	Seq int64
+}
+
+// sorter orders sortEntry by the ORDER BY of query.
+type sorter struct {
+	orderBy sqlparser.OrderBy
+}
+
+func (s sorter) less(a, b *sortEntry) bool {
+	for j, order := range s.orderBy {
+		c := compareOrder(a.Key[j], b.Key[j])
+		if order.Direction == sqlparser.DescScr {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return a.Seq < b.Seq
+}
+
+func (s sorter) sort(entries []*sortEntry) {
+	sort.Slice(entries, func(i, j int) bool { return s.less(entries[i], entries[j]) })
+}
+
+// entryHeap is a heap of entries, the root is the first by less, or the last
+// if reverse.
+type entryHeap struct {
+	sorter
+	entries []*sortEntry
+	reverse bool
+}
+
+func (h *entryHeap) Len() int { return len(h.entries) }
+func (h *entryHeap) Less(i, j int) bool {
+	if h.reverse {
+		return h.sorter.less(h.entries[j], h.entries[i])
+	}
+	return h.sorter.less(h.entries[i], h.entries[j])
+}
+func (h *entryHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *entryHeap) Push(x interface{}) { h.entries = append(h.entries, x.(*sortEntry)) }
+func (h *entryHeap) Pop() interface{} {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
+
+// sortRows returns the rows of iter matching where in the order of ORDER BY,
+// iter is closed.
+func (q *fileQuery) sortRows(ctx context.Context, iter fileRowIter) (sorted fileRowIter, err error) {
+	defer iter.Close()
+	var (
+		s       = sorter{orderBy: q.orderBy}
+		top     = -1
+		entries []*sortEntry
+		runs    []*os.File
+		seq     int64
+	)
+	defer func() {
+		if err != nil {
+			removeRuns(runs)
+		}
+	}()
+	if q.limit >= 0 && q.offset+q.limit <= int64(FileSortMemRows) {
+		top = int(q.offset + q.limit)
+	}
+	h := &entryHeap{sorter: s, reverse: true}
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var row []driver.Value
+		if row, err = iter.Next(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		var match bool
+		if match, err = q.match(row); err != nil {
+			return
+		}
+		if !match {
+			continue
+		}
+		e := &sortEntry{Row: row, Seq: seq, Key: make([]driver.Value, len(q.orderBy))}
+		seq++
+		for j, order := range q.orderBy {
+			if e.Key[j], err = q.eval(order.Expr, row); err != nil {
+				return
+			}
+		}
+		switch {
+		case top >= 0:
+			// keep the first top entries, the root is the last of them
+			if h.Len() < top {
+				heap.Push(h, e)
+			} else if top > 0 && s.less(e, h.entries[0]) {
+				h.entries[0] = e
+				heap.Fix(h, 0)
+			}
+		default:
+			entries = append(entries, e)
+			if len(entries) >= FileSortMemRows {
+				var run *os.File
+				if run, err = spillRun(s, entries); err != nil {
+					return
+				}
+				runs = append(runs, run)
+				entries = entries[:0]
+			}
+		}
+	}
+	if top >= 0 {
+		entries = h.entries
+	}
+	s.sort(entries)
+	if len(runs) == 0 {
+		return &memRowIter{entries: entries}, nil
+	}
+	return newMergeRowIter(s, runs, entries)
+}
+
+// memRowIter iterates the rows of sorted entries.
+type memRowIter struct {
+	entries []*sortEntry
+}
+
+func (it *memRowIter) Next() (row []driver.Value, err error) {
+	if len(it.entries) == 0 {
+		return nil, io.EOF
+	}
+	row = it.entries[0].Row
+	it.entries = it.entries[1:]
+	return
+}
+
+func (it *memRowIter) Close() error {
+	it.entries = nil
+	return nil
+}
+
+// spillRun writes the sorted entries into a temp file.
+func spillRun(s sorter, entries []*sortEntry) (run *os.File, err error) {
+	s.sort(entries)
+	if run, err = os.CreateTemp("", "go-ctr-sort-*"); err != nil {
+		return
+	}
+	w := bufio.NewWriter(run)
+	enc := gob.NewEncoder(w)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		_, err = run.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeRuns([]*os.File{run})
+		run = nil
+	}
+	return
+}
+
+func removeRuns(runs []*os.File) {
+	for _, run := range runs {
+		run.Close()
+		os.Remove(run.Name())
+	}
+}
+
+// runReader reads the entries of a run, or of the entries in memory if dec is nil.
+type runReader struct {
+	dec     *gob.Decoder
+	entries []*sortEntry
+}
+
+func (r *runReader) next() (e *sortEntry, err error) {
+	if r.dec == nil {
+		if len(r.entries) == 0 {
+			return nil, io.EOF
+		}
+		e, r.entries = r.entries[0], r.entries[1:]
+		return
+	}
+	e = new(sortEntry)
+	if err = r.dec.Decode(e); err != nil {
+		e = nil
+	}
+	return
+}
+
+// mergeRowIter merges the sorted runs and the entries in memory.
+type mergeRowIter struct {
+	runs    []*os.File
+	readers []*runReader
+	heap    *entryHeap
+	// from is the reader of the entries in heap by Seq
+	from map[int64]*runReader
+}
+
+func newMergeRowIter(s sorter, runs []*os.File, entries []*sortEntry) (it *mergeRowIter, err error) {
+	it = &mergeRowIter{
+		runs: runs,
+		heap: &entryHeap{sorter: s},
+		from: make(map[int64]*runReader),
+	}
+	for _, run := range runs {
+		it.readers = append(it.readers, &runReader{dec: gob.NewDecoder(bufio.NewReader(run))})
+	}
+	it.readers = append(it.readers, &runReader{entries: entries})
+	for _, r := range it.readers {
+		if err = it.push(r); err != nil {
+			it.Close()
+			return nil, err
+		}
+	}
+	return
+}
+
+// push pushes the next entry of r into the heap.
+func (it *mergeRowIter) push(r *runReader) error {
+	e, err := r.next()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	it.from[e.Seq] = r
+	heap.Push(it.heap, e)
+	return nil
+}
+
+func (it *mergeRowIter) Next() (row []driver.Value, err error) {
+	if it.heap.Len() == 0 {
+		return nil, io.EOF
+	}
+	e := heap.Pop(it.heap).(*sortEntry)
+	r := it.from[e.Seq]
+	delete(it.from, e.Seq)
+	if err = it.push(r); err != nil {
+		return
+	}
+	return e.Row, nil
+}
+
+func (it *mergeRowIter) Close() error {
+	removeRuns(it.runs)
+	it.runs = nil
+	it.heap.entries = nil
+	return nil
+}
@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// ParquetBatchSize is the number of rows read from each column of parquet files at a time
+var ParquetBatchSize int64 = 1024
+
+// localParquetFile implements source.ParquetFile with local file.
+type localParquetFile struct {
+	*os.File
+	path string
+}
+
+func (f *localParquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.path
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localParquetFile{File: file, path: name}, nil
+}
+
+func (f *localParquetFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localParquetFile{File: file, path: name}, nil
+}
+
+// parquetTable is a parquet file, only top level non-repeated columns are supported.
+type parquetTable struct {
+	path    string
+	columns []Column
+	paths   []string  // internal column paths of parquet-go
+	scales  []float64 // divisor of decimal columns stored as integer, 0 for others
+}
+
+func openParquetTable(path string) (table *parquetTable, err error) {
+	pFile, err := (&localParquetFile{path: path}).Open("")
+	if err != nil {
+		return
+	}
+	defer pFile.Close()
+	pr, err := reader.NewParquetColumnReader(pFile, 1)
+	if err != nil {
+		err = fmt.Errorf("read footer of %s: %v", path, err)
+		return
+	}
+
+	table = &parquetTable{path: path}
+	sh := pr.SchemaHandler
+	for _, inPath := range sh.ValueColumns {
+		idx := sh.MapIndex[inPath]
+		elem := sh.SchemaElements[idx]
+		if len(strings.Split(inPath, common.PAR_GO_PATH_DELIMITER)) != 2 ||
+			elem.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+			continue
+		}
+		table.columns = append(table.columns, Column{
+			Name:  sh.GetExName(int(idx)),
+			Type:  parquetColumnType(elem),
+			Extra: fmt.Sprintf("physicalType:%s, repetition:%s", elem.GetType(), elem.GetRepetitionType()),
+		})
+		table.paths = append(table.paths, inPath)
+		var scale float64
+		if isIntDecimal(elem) {
+			scale = math.Pow10(int(elem.GetScale()))
+		}
+		table.scales = append(table.scales, scale)
+	}
+	return
+}
+
+func isIntDecimal(elem *parquet.SchemaElement) bool {
+	return (elem.GetType() == parquet.Type_INT32 || elem.GetType() == parquet.Type_INT64) &&
+		elem.IsSetConvertedType() && elem.GetConvertedType() == parquet.ConvertedType_DECIMAL
+}
+
+func parquetColumnType(elem *parquet.SchemaElement) string {
+	switch elem.GetType() {
+	case parquet.Type_BOOLEAN:
+		return FileTypeBoolean
+	case parquet.Type_INT32, parquet.Type_INT64:
+		if isIntDecimal(elem) {
+			return FileTypeReal
+		}
+		return FileTypeInteger
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		return FileTypeReal
+	default:
+		return FileTypeText
+	}
+}
+
+func (t *parquetTable) Columns() []Column {
+	return t.columns
+}
+
+func (t *parquetTable) Open(proj []int) (iter fileRowIter, err error) {
+	pFile, err := (&localParquetFile{path: t.path}).Open("")
+	if err != nil {
+		return
+	}
+	pr, err := reader.NewParquetColumnReader(pFile, 1)
+	if err != nil {
+		pFile.Close()
+		return
+	}
+	iter = &parquetRowIter{
+		table:  t,
+		file:   pFile,
+		reader: pr,
+		proj:   proj,
+		rows:   pr.GetNumRows(),
+	}
+	return
+}
+
+type parquetRowIter struct {
+	table  *parquetTable
+	file   source.ParquetFile
+	reader *reader.ParquetReader
+	proj   []int
+	rows   int64 // total rows
+	read   int64 // rows read from file
+	batch  [][]interface{}
+	i      int // index in batch
+}
+
+// readBatch reads next ParquetBatchSize rows of projected columns.
+func (it *parquetRowIter) readBatch() (err error) {
+	n := it.rows - it.read
+	if n > ParquetBatchSize {
+		n = ParquetBatchSize
+	}
+	it.batch = make([][]interface{}, len(it.proj))
+	for i, c := range it.proj {
+		if it.batch[i], _, _, err = it.reader.ReadColumnByPath(it.table.paths[c], n); err != nil {
+			return
+		}
+		if int64(len(it.batch[i])) != n {
+			return fmt.Errorf("read %d values of column %s, expected %d",
+				len(it.batch[i]), it.table.columns[c].Name, n)
+		}
+	}
+	it.read += n
+	it.i = 0
+	return
+}
+
+func (it *parquetRowIter) Next() (row []driver.Value, err error) {
+	if it.batch == nil || it.i >= len(it.batch[0]) {
+		if it.read >= it.rows {
+			return nil, io.EOF
+		}
+		if err = it.readBatch(); err != nil {
+			return
+		}
+	}
+	row = make([]driver.Value, len(it.proj))
+	for i, c := range it.proj {
+		row[i] = parquetValue(it.batch[i][it.i], it.table.scales[c])
+	}
+	it.i++
+	return
+}
+
+func parquetValue(v interface{}, scale float64) driver.Value {
+	switch v := v.(type) {
+	case int32:
+		if scale != 0 {
+			return float64(v) / scale
+		}
+		return int64(v)
+	case int64:
+		if scale != 0 {
+			return float64(v) / scale
+		}
+		return v
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+func (it *parquetRowIter) Close() error {
+	it.reader.ReadStop()
+	return it.file.Close()
+}
@@ -0,0 +1,341 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/auxten/go-ctr/config"
+)
+
+// ListSeparators are the separators tried to detect delimited list columns
+var ListSeparators = []string{"|", ",", ";"}
+
+// Profiler samples rows of a table and proposes the transform of each column.
+type Profiler struct {
+	SampleSize    int // rows sampled, default 10000
+	MaxCategories int // max distinct strings to use OneHotEncoder, default 50
+	// MaxIntCategories is max distinct integers treated as codes to use OneHotEncoder, default 10
+	MaxIntCategories int
+	HashSize         int     // max width of hash and multihot, default 64
+	SkewThreshold    float64 // use QuantileScaler if abs skewness is greater, default 1
+	ListRatio        float64 // min ratio of values containing separator to be a list, default 0.3
+}
+
+// DefaultProfiler is the Profiler with default settings
+var DefaultProfiler = &Profiler{
+	SampleSize:       10000,
+	MaxCategories:    50,
+	MaxIntCategories: 10,
+	HashSize:         64,
+	SkewThreshold:    1,
+	ListRatio:        0.3,
+}
+
+// TableProfile is the profile of sampled rows of a table
+type TableProfile struct {
+	TableName string
+	Rows      int
+	Columns   []ColumnProfile
+}
+
+// ColumnProfile contains the stats of one column and the proposed transform
+type ColumnProfile struct {
+	Column
+	Nulls       int
+	NullRatio   float64
+	Cardinality int // distinct non-null values
+	Unique      bool
+
+	// numeric distribution, valid if Numeric
+	Numeric  bool
+	Integer  bool
+	Min      float64
+	Max      float64
+	Mean     float64
+	Std      float64
+	Skewness float64
+
+	// string token stats
+	AvgLength        float64
+	Separator        string  // list separator detected, empty if not a list
+	AvgTokens        float64 // tokens split by Separator or space
+	TokenCardinality int
+
+	Proposal config.ColumnConfig
+}
+
+// ProfileTable profiles tableName with DefaultProfiler.
+func ProfileTable(scanner TableScanner, tableName string) (*TableProfile, error) {
+	return DefaultProfiler.Profile(scanner, tableName)
+}
+
+// Profile samples at most p.SampleSize rows of tableName via scanner.GetRows
+// and proposes the transform of each column.
+func (p *Profiler) Profile(scanner TableScanner, tableName string) (profile *TableProfile, err error) {
+	tableSchema, err := scanner.GetSchema(tableName)
+	if err != nil {
+		return
+	}
+	types := make(map[string]Column, len(tableSchema.Columns))
+	for _, col := range tableSchema.Columns {
+		types[col.Name] = col
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", tableName)
+	if p.SampleSize > 0 {
+		query += fmt.Sprintf(" LIMIT %d", p.SampleSize)
+	}
+	rows, err := scanner.GetRows(query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return
+	}
+
+	values := make([][]sql.NullString, len(names))
+	for rows.Next() {
+		var (
+			row  = make([]sql.NullString, len(names))
+			dest = make([]interface{}, len(names))
+		)
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		for i := range row {
+			values[i] = append(values[i], row[i])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	profile = &TableProfile{TableName: tableName}
+	for i, name := range names {
+		col, ok := types[name]
+		if !ok {
+			col = Column{Name: name}
+		}
+		colProfile := p.profileColumn(col, values[i])
+		profile.Rows = len(values[i])
+		profile.Columns = append(profile.Columns, colProfile)
+	}
+	return
+}
+
+func (p *Profiler) profileColumn(col Column, values []sql.NullString) (cp ColumnProfile) {
+	cp.Column = col
+	var (
+		distinct = make(map[string]struct{})
+		nums     = make([]float64, 0, len(values))
+		strs     = make([]string, 0, len(values))
+	)
+	cp.Numeric, cp.Integer = true, true
+	for _, v := range values {
+		if !v.Valid {
+			cp.Nulls++
+			continue
+		}
+		distinct[v.String] = struct{}{}
+		strs = append(strs, v.String)
+		if !cp.Numeric {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.String), 64)
+		if err != nil {
+			cp.Numeric, cp.Integer = false, false
+			continue
+		}
+		if f != math.Trunc(f) {
+			cp.Integer = false
+		}
+		nums = append(nums, f)
+	}
+	if len(values) > 0 {
+		cp.NullRatio = float64(cp.Nulls) / float64(len(values))
+	}
+	cp.Cardinality = len(distinct)
+	cp.Unique = cp.Cardinality > 1 && cp.Cardinality == len(strs)
+	if len(strs) == 0 {
+		// no data, trust the column type
+		cp.Numeric = IsNumericType(col.Type)
+		cp.Integer = cp.Numeric
+	} else if cp.Numeric {
+		cp.numericStats(nums)
+	} else {
+		cp.tokenStats(strs, p.ListRatio)
+	}
+	cp.Proposal = p.propose(&cp)
+	return
+}
+
+func (cp *ColumnProfile) numericStats(nums []float64) {
+	cp.Min, cp.Max = math.Inf(1), math.Inf(-1)
+	var sum float64
+	for _, f := range nums {
+		sum += f
+		cp.Min = math.Min(cp.Min, f)
+		cp.Max = math.Max(cp.Max, f)
+	}
+	n := float64(len(nums))
+	cp.Mean = sum / n
+	var m2, m3 float64
+	for _, f := range nums {
+		d := f - cp.Mean
+		m2 += d * d
+		m3 += d * d * d
+	}
+	m2, m3 = m2/n, m3/n
+	cp.Std = math.Sqrt(m2)
+	if m2 > 0 {
+		cp.Skewness = m3 / math.Pow(m2, 1.5)
+	}
+}
+
+func (cp *ColumnProfile) tokenStats(strs []string, listRatio float64) {
+	var length int
+	for _, s := range strs {
+		length += len(s)
+	}
+	cp.AvgLength = float64(length) / float64(len(strs))
+
+	for _, sep := range ListSeparators {
+		var contains int
+		for _, s := range strs {
+			if strings.Contains(s, sep) {
+				contains++
+			}
+		}
+		if float64(contains) >= listRatio*float64(len(strs)) {
+			cp.Separator = sep
+			break
+		}
+	}
+
+	var (
+		tokens   int
+		distinct = make(map[string]struct{})
+	)
+	for _, s := range strs {
+		var ts []string
+		if cp.Separator != "" {
+			ts = strings.Split(s, cp.Separator)
+		} else {
+			ts = strings.Fields(s)
+		}
+		for _, t := range ts {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				tokens++
+				distinct[t] = struct{}{}
+			}
+		}
+	}
+	cp.AvgTokens = float64(tokens) / float64(len(strs))
+	cp.TokenCardinality = len(distinct)
+}
+
+func isIdName(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), "id")
+}
+
+// hashSize returns power of 2 no less than 2*cardinality, capped by p.HashSize.
+func (p *Profiler) hashSize(cardinality int) int {
+	size := 8
+	for size < 2*cardinality && size < p.HashSize {
+		size *= 2
+	}
+	if size > p.HashSize {
+		size = p.HashSize
+	}
+	return size
+}
+
+func (p *Profiler) propose(cp *ColumnProfile) (conf config.ColumnConfig) {
+	conf.Name = cp.Name
+	skip := func(reason string) config.ColumnConfig {
+		conf.Transform = config.TransformSkip
+		conf.Comment = reason
+		return conf
+	}
+	switch {
+	case cp.Cardinality == 0 && cp.Nulls > 0:
+		return skip("all null")
+	case cp.Cardinality == 1:
+		return skip("constant")
+	case cp.Unique && (isIdName(cp.Name) || cp.Integer && cp.Cardinality > p.MaxCategories):
+		return skip("id")
+	}
+
+	if cp.Numeric {
+		switch {
+		case cp.Integer && cp.Cardinality <= p.MaxIntCategories:
+			conf.Transform = config.TransformOneHot
+			conf.Comment = fmt.Sprintf("integer codes of %d values", cp.Cardinality)
+		case math.Abs(cp.Skewness) > p.SkewThreshold:
+			conf.Transform = config.TransformQuantile
+			conf.Comment = fmt.Sprintf("skewed, skewness %.2f", cp.Skewness)
+		default:
+			conf.Transform = config.TransformStandard
+			conf.Comment = fmt.Sprintf("mean %.4g, std %.4g", cp.Mean, cp.Std)
+		}
+		return
+	}
+
+	switch {
+	case cp.Separator != "":
+		conf.Transform = config.TransformMultiHot
+		conf.Separator = cp.Separator
+		conf.Size = p.hashSize(cp.TokenCardinality)
+		conf.Comment = fmt.Sprintf("list of %d tokens, %.1f per value", cp.TokenCardinality, cp.AvgTokens)
+	case cp.Cardinality <= p.MaxCategories:
+		conf.Transform = config.TransformOneHot
+		conf.Comment = fmt.Sprintf("%d categories", cp.Cardinality)
+	case cp.AvgTokens >= 3:
+		conf.Transform = config.TransformTFIDF
+		conf.Comment = fmt.Sprintf("text of %.1f words, %d distinct", cp.AvgTokens, cp.TokenCardinality)
+	case cp.Unique:
+		return skip("unique string")
+	default:
+		conf.Transform = config.TransformHash
+		conf.Size = p.hashSize(cp.Cardinality)
+		conf.Comment = fmt.Sprintf("%d categories", cp.Cardinality)
+	}
+	return
+}
+
+// EntityConfig returns the config of the profiled table with proposed
+// column transforms, idColumn is always excluded.
+func (tp *TableProfile) EntityConfig(idColumn string) (conf config.EntityConfig) {
+	conf.Table = tp.TableName
+	conf.IdColumn = idColumn
+	for _, col := range tp.Columns {
+		if col.Name != idColumn {
+			conf.Columns = append(conf.Columns, col.Proposal)
+		}
+	}
+	return
+}
+
+// ProposeConfig profiles the user and item tables of conf, and fills
+// the column transforms of the tables without columns configured.
+func (p *Profiler) ProposeConfig(scanner TableScanner, conf *config.RecSysConfig) (err error) {
+	for _, entity := range []*config.EntityConfig{&conf.User, &conf.Item} {
+		if len(entity.Columns) != 0 {
+			continue
+		}
+		var profile *TableProfile
+		if profile, err = p.Profile(scanner, entity.Table); err != nil {
+			return
+		}
+		*entity = profile.EntityConfig(entity.IdColumn)
+	}
+	return
+}
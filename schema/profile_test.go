@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/auxten/go-ctr/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProfile(t *testing.T) {
+	tempDbFile, err := os.CreateTemp("", "profile_test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempDbFile.Name())
+	db, err := sql.Open("sqlite3", tempDbFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE users (userId INTEGER PRIMARY KEY, age INT, income REAL, gender TEXT, " +
+		"genres TEXT, bio TEXT, zip TEXT, level INT, country TEXT, empty TEXT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genres := []string{"Action|Comedy", "Drama", "Comedy|Drama|Romance", "Sci-Fi|Action"}
+	words := strings.Fields("the quick brown fox jumps over lazy dog and runs away")
+	for i := 0; i < 200; i++ {
+		_, err = db.Exec("INSERT INTO users VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'CN', NULL)",
+			i+1,
+			20+i%40+i%7,
+			math.Exp(float64(i%50)/5),
+			[]string{"F", "M"}[i%2],
+			genres[i%len(genres)],
+			fmt.Sprintf("%s %s %s %s", words[i%11], words[(i/11)%11], words[(i/3)%11], words[(i+5)%11]),
+			fmt.Sprintf("Z%03d", i%80),
+			i%3,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = db.Close()
+	scanner := NewSqliteScanner(tempDbFile.Name())
+
+	Convey("profile table", t, func() {
+		profile, err := ProfileTable(scanner, "users")
+		So(err, ShouldBeNil)
+		So(profile.Rows, ShouldEqual, 200)
+		So(profile.Columns, ShouldHaveLength, 10)
+		proposals := make(map[string]config.ColumnConfig)
+		for _, col := range profile.Columns {
+			proposals[col.Name] = col.Proposal
+		}
+		So(proposals["userId"].Transform, ShouldEqual, config.TransformSkip)
+		So(proposals["age"].Transform, ShouldEqual, config.TransformStandard)
+		So(proposals["income"].Transform, ShouldEqual, config.TransformQuantile)
+		So(proposals["gender"].Transform, ShouldEqual, config.TransformOneHot)
+		So(proposals["genres"].Transform, ShouldEqual, config.TransformMultiHot)
+		So(proposals["genres"].Separator, ShouldEqual, "|")
+		So(proposals["genres"].Size, ShouldEqual, 16)
+		So(proposals["bio"].Transform, ShouldEqual, config.TransformTFIDF)
+		So(proposals["zip"].Transform, ShouldEqual, config.TransformHash)
+		So(proposals["zip"].Size, ShouldEqual, DefaultProfiler.HashSize)
+		So(proposals["level"].Transform, ShouldEqual, config.TransformOneHot)
+		So(proposals["country"].Transform, ShouldEqual, config.TransformSkip)
+		So(proposals["empty"].Transform, ShouldEqual, config.TransformSkip)
+
+		gender := profile.Columns[3]
+		So(gender.Cardinality, ShouldEqual, 2)
+		So(gender.NullRatio, ShouldEqual, 0)
+		So(profile.Columns[9].NullRatio, ShouldEqual, 1)
+		So(profile.Columns[1].Numeric, ShouldBeTrue)
+		So(profile.Columns[4].TokenCardinality, ShouldEqual, 5)
+
+		entity := profile.EntityConfig("userId")
+		So(entity.Columns, ShouldHaveLength, 9)
+		for _, col := range entity.Columns {
+			So(col.Validate(), ShouldBeNil)
+		}
+	})
+
+	Convey("propose config", t, func() {
+		conf := &config.RecSysConfig{
+			User: config.EntityConfig{Table: "users", IdColumn: "userId"},
+			Item: config.EntityConfig{Table: "users", IdColumn: "userId", Columns: []config.ColumnConfig{
+				{Name: "age", Transform: config.TransformMinMax},
+			}},
+		}
+		So(DefaultProfiler.ProposeConfig(scanner, conf), ShouldBeNil)
+		So(conf.User.Columns, ShouldHaveLength, 9)
+		So(conf.Item.Columns, ShouldHaveLength, 1)
+		data, err := conf.Marshal()
+		So(err, ShouldBeNil)
+		So(string(data), ShouldContainSubstring, "transform: tfidf")
+	})
+}